@@ -26,6 +26,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/odeke-em/command"
 	"github.com/odeke-em/drive/config"
@@ -36,6 +37,36 @@ import (
 
 var context *config.Context
 
+// output is the format of the global -output flag.
+var output = outputFormat(drive.OutputText)
+
+type outputFormat string
+
+func (o *outputFormat) String() string {
+	return string(*o)
+}
+
+func (o *outputFormat) Set(value string) error {
+	switch value {
+	case drive.OutputText, drive.OutputJSON, drive.OutputJSONL:
+		*o = outputFormat(value)
+		return nil
+	}
+	return fmt.Errorf("expecting %s, %s or %s", drive.OutputText, drive.OutputJSON, drive.OutputJSONL)
+}
+
+// outputWithJSONAlias is the output format of the commands that took -json
+// before -output existed. -json is kept as a deprecated alias of -output jsonl.
+func outputWithJSONAlias(json bool) string {
+	if json {
+		drive.FprintfShadow(os.Stderr, "-%s is deprecated, use -%s %s instead\n", drive.CLIOptionJSON, drive.CLIOptionOutput, drive.OutputJSONL)
+		if output == drive.OutputText {
+			output = drive.OutputJSONL
+		}
+	}
+	return string(output)
+}
+
 type errorer func() error
 
 func bindCommandWithAliases(key, description string, cmd command.Cmd, requiredFlags []string) {
@@ -121,6 +152,16 @@ func main() {
 	bindCommandWithAliases(drive.ClashesKey, drive.DescFixClashes, &clashesCmd{}, []string{})
 	bindCommandWithAliases(drive.IdKey, drive.DescId, &idCmd{}, []string{})
 	bindCommandWithAliases(drive.ReportIssueKey, drive.DescReportIssue, &issueCmd{}, []string{})
+	bindCommandWithAliases(drive.WatchKey, drive.DescWatch, &watchCmd{}, []string{})
+	bindCommandWithAliases(drive.CacheKey, drive.DescCache, &cacheCmd{}, []string{})
+	bindCommandWithAliases(drive.ServeKey, drive.DescServe, &serveCmd{}, []string{})
+	bindCommandWithAliases(drive.SyncKey, drive.DescSync, &syncCmd{}, []string{})
+	bindCommandWithAliases(drive.RevisionsKey, drive.DescRevisions, &revisionsCmd{}, []string{})
+	bindCommandWithAliases(drive.CommentsKey, drive.DescComments, &commentsCmd{}, []string{})
+	bindCommandWithAliases(drive.PropKey, drive.DescProp, &propCmd{}, []string{})
+	bindCommandWithAliases(drive.ShortcutKey, drive.DescShortcut, &shortcutCmd{}, []string{})
+
+	flag.Var(&output, drive.CLIOptionOutput, drive.DescOutput)
 
 	command.DefineHelp(&helpCmd{})
 	command.ParseAndRun()
@@ -149,7 +190,8 @@ func (cmd *featuresCmd) Run(args []string, definedFlags map[string]*flag.Flag) {
 	context, path := discoverContext(args)
 
 	exitWithError(drive.New(context, &drive.Options{
-		Path: path,
+		Path:   path,
+		Output: string(output),
 	}).About(drive.AboutFeatures))
 }
 
@@ -166,10 +208,12 @@ func (cmd *versionCmd) Run(args []string, definedFlags map[string]*flag.Flag) {
 
 type initCmd struct {
 	ServiceAccountJSONFile *string `json:"-"`
+	SharedDrive            *string `json:"-"`
 }
 
 func (cmd *initCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
 	cmd.ServiceAccountJSONFile = fs.String(drive.ServiceAccountJSONFileKey, "", "points the Google Service Account JSON file")
+	cmd.SharedDrive = fs.String(drive.CLIOptionSharedDrive, "", "name or id of the shared drive to root the context at instead of \"My Drive\"")
 	return fs
 }
 
@@ -181,6 +225,10 @@ func (cmd *initCmd) Run(args []string, definedFlags map[string]*flag.Flag) {
 	} else {
 		exitWithError(comm.InitWithServiceAccount(gcsJSONFile))
 	}
+
+	if *cmd.SharedDrive != "" {
+		exitWithError(comm.InitSharedDrive(*cmd.SharedDrive))
+	}
 }
 
 type deInitCmd struct {
@@ -212,10 +260,155 @@ func (cmd *quotaCmd) Run(args []string, definedFlags map[string]*flag.Flag) {
 	context, path := discoverContext(args)
 
 	exitWithError(drive.New(context, &drive.Options{
-		Path: path,
+		Path:   path,
+		Output: string(output),
 	}).About(drive.AboutQuota))
 }
 
+type watchCmd struct {
+	Interval *time.Duration `json:"interval"`
+	Once     *bool          `json:"once"`
+	JSON     *bool          `json:"json"`
+	Quiet    *bool          `json:"quiet"`
+}
+
+func (cmd *watchCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+	cmd.Interval = fs.Duration(drive.CLIOptionWatchInterval, drive.DefaultWatchInterval, "how long to wait between polls of the changes feed")
+	cmd.Once = fs.Bool(drive.CLIOptionWatchOnce, false, "poll the changes feed only once then exit")
+	cmd.JSON = fs.Bool(drive.CLIOptionJSON, false, "deprecated, the same as -output jsonl")
+	cmd.Quiet = fs.Bool(drive.QuietKey, false, "if set, do not log anything but errors")
+	return fs
+}
+
+func (cmd *watchCmd) Run(args []string, definedFlags map[string]*flag.Flag) {
+	sources, context, path := preprocessArgs(args)
+
+	exitWithError(drive.New(context, &drive.Options{
+		Path:    path,
+		Sources: sources,
+		Quiet:   *cmd.Quiet,
+		Output:  outputWithJSONAlias(*cmd.JSON),
+	}).Watch(&drive.WatchOptions{
+		Interval: *cmd.Interval,
+		Once:     *cmd.Once,
+	}))
+}
+
+type cacheCmd struct {
+	Rebuild *bool `json:"rebuild"`
+	Quiet   *bool `json:"quiet"`
+}
+
+func (cmd *cacheCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+	cmd.Rebuild = fs.Bool(drive.CLIOptionRebuild, false, "discard the cache and list the whole drive again")
+	cmd.Quiet = fs.Bool(drive.QuietKey, false, "if set, do not log anything but errors")
+	return fs
+}
+
+func (cmd *cacheCmd) Run(args []string, definedFlags map[string]*flag.Flag) {
+	context, path := discoverContext(args)
+
+	exitWithError(drive.New(context, &drive.Options{
+		Path:  path,
+		Quiet: *cmd.Quiet,
+	}).Cache(*cmd.Rebuild))
+}
+
+type serveCmd struct {
+	Addr               *string `json:"addr"`
+	Socket             *string `json:"socket"`
+	Quiet              *bool   `json:"quiet"`
+	Export             *string `json:"export"`
+	ExportMap          *string `json:"export-map"`
+	EncryptionPassword *string `json:"encryption-password"`
+	DecryptionPassword *string `json:"decryption-password"`
+}
+
+func (cmd *serveCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+	cmd.Addr = fs.String(drive.CLIOptionAddr, drive.DefaultServeAddress, "host:port to listen on")
+	cmd.Socket = fs.String(drive.CLIOptionSocket, "", "path of a Unix socket to listen on instead of -addr")
+	cmd.Quiet = fs.Bool(drive.QuietKey, false, "if set, do not log anything but errors")
+	cmd.Export = fs.String(drive.ExportsKey, "", "comma separated list of formats that docs + sheets files are seen as")
+	cmd.ExportMap = fs.String(drive.CLIOptionExportMap, "", drive.DescExportMap)
+	cmd.EncryptionPassword = fs.String(drive.CLIEncryptionPassword, "", drive.DescEncryptionPassword)
+	cmd.DecryptionPassword = fs.String(drive.CLIDecryptionPassword, "", drive.DescDecryptionPassword)
+	return fs
+}
+
+func (sCmd *serveCmd) Run(args []string, definedFlags map[string]*flag.Flag) {
+	so := &drive.ServeOptions{}
+
+	if len(args) >= 1 {
+		switch args[0] {
+		case drive.ServeProtocolWebDAV, drive.ServeProtocolS3, drive.ServeProtocolAPI:
+			so.Protocol = args[0]
+			args = parseActionFlags(drive.ServeKey, args, definedFlags, func(fs *flag.FlagSet) {
+				fs.StringVar(sCmd.Addr, drive.CLIOptionAddr, *sCmd.Addr, "")
+				fs.StringVar(sCmd.Socket, drive.CLIOptionSocket, *sCmd.Socket, "")
+				fs.BoolVar(sCmd.Quiet, drive.QuietKey, *sCmd.Quiet, "")
+				fs.StringVar(sCmd.Export, drive.ExportsKey, *sCmd.Export, "")
+				fs.StringVar(sCmd.ExportMap, drive.CLIOptionExportMap, *sCmd.ExportMap, "")
+				fs.StringVar(sCmd.EncryptionPassword, drive.CLIEncryptionPassword, *sCmd.EncryptionPassword, "")
+				fs.StringVar(sCmd.DecryptionPassword, drive.CLIDecryptionPassword, *sCmd.DecryptionPassword, "")
+			})
+		}
+	}
+
+	if so.Protocol == "" || len(args) > 1 {
+		exitWithError(fmt.Errorf("serve: expecting %s|%s [remote-path] or %s", drive.ServeProtocolWebDAV, drive.ServeProtocolS3, drive.ServeProtocolAPI))
+	}
+	if so.Protocol == drive.ServeProtocolAPI && len(args) >= 1 {
+		exitWithError(fmt.Errorf("serve: %s serves all of the drive, expecting no remote-path", drive.ServeProtocolAPI))
+	}
+
+	sources, context, path := preprocessArgs(args)
+	cmd := serveCmd{}
+	df := defaultsFiller{
+		command: drive.ServeKey,
+		from:    *sCmd, to: &cmd,
+		rcSourcePath: context.AbsPathOf(path),
+		definedFlags: definedFlags,
+	}
+
+	if err := fillWithDefaults(df); err != nil {
+		exitWithError(err)
+	}
+
+	var encryptFn func(io.Reader) (io.Reader, error)
+	if pass := *cmd.EncryptionPassword; pass != "" {
+		encryptFn = func(r io.Reader) (io.Reader, error) {
+			return dcrypto.NewEncrypter(r, []byte(pass))
+		}
+	}
+
+	var decryptFn func(io.Reader) (io.ReadCloser, error)
+	if pass := *cmd.DecryptionPassword; pass != "" {
+		decryptFn = func(r io.Reader) (io.ReadCloser, error) {
+			return dcrypto.NewDecrypter(r, []byte(pass))
+		}
+	}
+
+	exports := drive.NonEmptyTrimmedStrings(strings.Split(*cmd.Export, ",")...)
+
+	s3Credentials, err := drive.S3CredentialsFromRC(context.AbsPathOf(path))
+	exitWithError(err)
+
+	so.Addr = *cmd.Addr
+	so.Socket = *cmd.Socket
+	so.S3Credentials = s3Credentials
+	exitWithError(drive.New(context, &drive.Options{
+		Path:      path,
+		Sources:   sources,
+		Quiet:     *cmd.Quiet,
+		Exports:   uniqOrderedStr(exports),
+		ExportMap: exportMapFor(context.AbsPathOf(path), *cmd.ExportMap),
+		Encrypter: encryptFn,
+		Decrypter: decryptFn,
+
+		ExponentialBackoffRetryCount: drive.MaxFailedRetryCount,
+	}).Serve(so))
+}
+
 type openCmd struct {
 	ById        *bool `json:"by-id"`
 	FileBrowser *bool `json:"file-browser"`
@@ -330,6 +523,7 @@ type listCmd struct {
 	LongFmt      *bool   `json:"long"`
 	NoPrompt     *bool   `json:"no-prompt"`
 	Shared       *bool   `json:"shared"`
+	SharedDrives *bool   `json:"shared-drives"`
 	InTrash      *bool   `json:"trashed"`
 	Version      *bool   `json:"version"`
 	Matches      *bool   `json:"matches"`
@@ -342,6 +536,9 @@ type listCmd struct {
 	ExactOwner   *string `json:"exact-owner"`
 	NotOwner     *string `json:"not-owner"`
 	Sort         *string `json:"sort"`
+	Property     *string `json:"property"`
+	Query        *string `json:"query"`
+	Offline      *bool   `json:"offline"`
 }
 
 func (cmd *listCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
@@ -352,6 +549,7 @@ func (cmd *listCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
 	cmd.LongFmt = fs.Bool(drive.CLIOptionLongFmt, false, "long listing of contents")
 	cmd.PageSize = fs.Int64(drive.PageSizeKey, 100, "number of results per pagination")
 	cmd.Shared = fs.Bool("shared", false, "show files that are shared with me")
+	cmd.SharedDrives = fs.Bool(drive.CLIOptionSharedDrives, false, "list the shared drives that you are a member of")
 	cmd.InTrash = fs.Bool(drive.CLIOptionTrashed, false, "list content in the trash")
 	cmd.Version = fs.Bool("version", false, "show the number of times that the file has been modified on \n\t\tthe server even with changes not visible to the user")
 	cmd.NoPrompt = fs.Bool(drive.NoPromptKey, false, "shows no prompt before pagination")
@@ -367,12 +565,16 @@ func (cmd *listCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
 	cmd.ExactOwner = fs.String(drive.CLIOptionExactOwner, "", drive.DescExactOwner)
 	cmd.NotOwner = fs.String(drive.CLIOptionNotOwner, "", drive.DescNotOwner)
 	cmd.ById = fs.Bool(drive.CLIOptionId, false, "list by id instead of path")
+	cmd.Property = fs.String(drive.CLIOptionProperty, "", drive.DescProperty)
+	cmd.Query = fs.String(drive.CLIOptionQuery, "", drive.DescQuery)
+	cmd.Offline = fs.Bool(drive.CLIOptionOffline, false, "list from the metadata cache, see `drive cache`")
 
 	return fs
 }
 
 func (lCmd *listCmd) _run(args []string, definedFlags map[string]*flag.Flag, diskUsageSubset bool) error {
-	sources, context, path := preprocessArgsByToggle(args, (*lCmd.ById || *lCmd.Matches))
+	byMatches := *lCmd.Matches && *lCmd.Query == ""
+	sources, context, path := preprocessArgsByToggle(args, (*lCmd.ById || byMatches))
 	cmd := listCmd{}
 	df := defaultsFiller{
 		command: drive.ListKey,
@@ -426,6 +628,8 @@ func (lCmd *listCmd) _run(args []string, definedFlags map[string]*flag.Flag, dis
 		drive.MatchOwnerKey:   drive.NonEmptyTrimmedStrings(strings.Split(*cmd.MatchOwner, ",")...),
 		drive.ExactOwnerKey:   drive.NonEmptyTrimmedStrings(strings.Split(*cmd.ExactOwner, ",")...),
 		drive.NotOwnerKey:     drive.NonEmptyTrimmedStrings(strings.Split(*cmd.NotOwner, ",")...),
+		drive.PropertyKey:     drive.NonEmptyTrimmedStrings(strings.Split(*cmd.Property, ",")...),
+		drive.QueryKey:        drive.NonEmptyTrimmedStrings(*cmd.Query),
 	}
 
 	opts := &drive.Options{
@@ -441,11 +645,15 @@ func (lCmd *listCmd) _run(args []string, definedFlags map[string]*flag.Flag, dis
 		Quiet:     *cmd.Quiet,
 		Meta:      &meta,
 		Match:     *cmd.Matches,
+		Offline:   *cmd.Offline,
+		Output:    string(output),
 	}
 
-	if *cmd.Shared {
+	if *cmd.SharedDrives {
+		return drive.New(context, opts).ListSharedDrives()
+	} else if *cmd.Shared {
 		return drive.New(context, opts).ListShared()
-	} else if *cmd.Matches {
+	} else if byMatches {
 		return drive.New(context, opts).ListMatches()
 	} else {
 		return drive.New(context, opts).List(*cmd.ById)
@@ -512,6 +720,7 @@ func (mcmd *md5SumCmd) Run(args []string, definedFlags map[string]*flag.Flag) {
 		Recursive: *cmd.Recursive,
 		Quiet:     *cmd.Quiet,
 		Md5sum:    true,
+		Output:    string(output),
 	}
 
 	if *cmd.ById {
@@ -528,6 +737,7 @@ type statCmd struct {
 	Recursive *bool `json:"recursive"`
 	Quiet     *bool `json:"quiet"`
 	Md5sum    *bool `json:"md5sum"`
+	Offline   *bool `json:"offline"`
 }
 
 func (cmd *statCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
@@ -537,6 +747,7 @@ func (cmd *statCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
 	cmd.Quiet = fs.Bool(drive.QuietKey, false, "if set, do not log anything but errors")
 	cmd.ById = fs.Bool(drive.CLIOptionId, false, "stat by id instead of path")
 	cmd.Md5sum = fs.Bool(drive.Md5sumKey, false, "produce output compatible with md5sum(1)")
+	cmd.Offline = fs.Bool(drive.CLIOptionOffline, false, "stat from the metadata cache, see `drive cache`")
 	return fs
 }
 
@@ -569,6 +780,8 @@ func (scmd *statCmd) Run(args []string, definedFlags map[string]*flag.Flag) {
 		Recursive: *cmd.Recursive,
 		Quiet:     *cmd.Quiet,
 		Md5sum:    *cmd.Md5sum,
+		Offline:   *cmd.Offline,
+		Output:    string(output),
 	}
 
 	if *cmd.ById {
@@ -594,6 +807,7 @@ type indexCmd struct {
 	Prune             *bool   `json:"prune"`
 	AllOps            *bool   `json:"all-ops"`
 	Matches           *bool   `json:"matches"`
+	Query             *string `json:"query"`
 }
 
 func (cmd *indexCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
@@ -612,13 +826,14 @@ func (cmd *indexCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
 	cmd.Prune = fs.Bool(drive.CLIOptionPruneIndices, false, drive.DescPruneIndices)
 	cmd.AllOps = fs.Bool(drive.CLIOptionAllIndexOperations, false, drive.DescAllIndexOperations)
 	cmd.Matches = fs.Bool(drive.MatchesKey, false, "search by prefix")
+	cmd.Query = fs.String(drive.CLIOptionQuery, "", drive.DescQuery)
 
 	return fs
 }
 
 func (icmd *indexCmd) Run(args []string, definedFlags map[string]*flag.Flag) {
 	byId := *icmd.ById
-	byMatches := *icmd.Matches
+	byMatches := *icmd.Matches && *icmd.Query == ""
 	sources, context, path := preprocessArgsByToggle(args, byMatches || byId)
 	absEntryPath := context.AbsPathOf(path)
 
@@ -634,6 +849,10 @@ func (icmd *indexCmd) Run(args []string, definedFlags map[string]*flag.Flag) {
 		exitWithError(err)
 	}
 
+	meta := map[string][]string{
+		drive.QueryKey: drive.NonEmptyTrimmedStrings(*cmd.Query),
+	}
+
 	options := &drive.Options{
 		Path:              path,
 		Sources:           sources,
@@ -647,6 +866,7 @@ func (icmd *indexCmd) Run(args []string, definedFlags map[string]*flag.Flag) {
 		Force:             *cmd.Force,
 		IgnoreNameClashes: *cmd.IgnoreNameClashes,
 		Match:             *cmd.Matches,
+		Meta:              &meta,
 	}
 
 	dr := drive.New(context, options)
@@ -654,7 +874,7 @@ func (icmd *indexCmd) Run(args []string, definedFlags map[string]*flag.Flag) {
 	fetchFn := dr.Fetch
 	if byId {
 		fetchFn = dr.FetchById
-	} else if *cmd.Matches {
+	} else if byMatches {
 		fetchFn = dr.FetchMatches
 	}
 
@@ -710,6 +930,18 @@ type pullCmd struct {
 	ExportsDumpToSameDirectory   *bool `json:"same-exports-dir"`
 
 	AllowURLLinkedFiles *bool `json:"desktop-links"`
+
+	DownloadRateLimit *int `json:"download-rate-limit"`
+
+	Revision     *string `json:"revision"`
+	RevisionDest *string `json:"revision-dest"`
+
+	Property  *string `json:"property"`
+	Query     *string `json:"query"`
+	Shortcuts *string `json:"shortcuts"`
+
+	MultiParentLinks *string `json:"multi-parent-links"`
+	ExportMap        *string `json:"export-map"`
 }
 
 func (cmd *pullCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
@@ -747,12 +979,37 @@ func (cmd *pullCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
 	cmd.Files = fs.Bool(drive.CLIOptionFiles, false, "pull only files")
 	cmd.Directories = fs.Bool(drive.CLIOptionDirectories, false, "pull only directories")
 	cmd.AllowURLLinkedFiles = fs.Bool(drive.CLIOptionDesktopLinks, true, drive.DescAllowDesktopLinks)
+	cmd.DownloadRateLimit = fs.Int(drive.CLIOptionDownloadRateLimit, 0, "Limit the combined download bandwidth of all files, exports included, to n KiB/s, default is unlimited.")
+	cmd.Revision = fs.String(drive.CLIOptionRevision, "", "id of the revision of the file to pull, see `drive revisions`")
+	cmd.RevisionDest = fs.String(drive.CLIOptionRevisionDest, "", "local path to save the pulled revision to")
+	cmd.Property = fs.String(drive.CLIOptionProperty, "", drive.DescProperty)
+	cmd.Query = fs.String(drive.CLIOptionQuery, "", drive.DescQuery)
+	cmd.Shortcuts = fs.String(drive.CLIOptionShortcuts, "symlink", drive.DescShortcutPolicy)
+	cmd.MultiParentLinks = fs.String(drive.CLIOptionMultiParentLinks, "hardlink", drive.DescMultiParentLinks)
+	cmd.ExportMap = fs.String(drive.CLIOptionExportMap, "", drive.DescExportMap)
 
 	return fs
 }
 
+// exportMapFor is the export map of the .driverc at rcSourcePath
+// overridden type by type by that of the -export-map flag.
+func exportMapFor(rcSourcePath, flagValue string) map[string][]string {
+	exportMap, err := drive.ExportMapFromRC(rcSourcePath)
+	exitWithError(err)
+	flagExportMap, err := drive.ParseExportMap(flagValue)
+	exitWithError(err)
+	if exportMap == nil {
+		exportMap = flagExportMap
+	}
+	for mimeType, exts := range flagExportMap {
+		exportMap[mimeType] = exts
+	}
+	return exportMap
+}
+
 func (pCmd *pullCmd) Run(args []string, definedFlags map[string]*flag.Flag) {
-	sources, context, path := preprocessArgsByToggle(args, (*pCmd.ById || *pCmd.Matches || *pCmd.Starred))
+	byMatches := (*pCmd.Matches || *pCmd.Starred) && *pCmd.Query == ""
+	sources, context, path := preprocessArgsByToggle(args, (*pCmd.ById || byMatches))
 	cmd := pullCmd{}
 	df := defaultsFiller{
 		command: drive.PullKey,
@@ -773,6 +1030,8 @@ func (pCmd *pullCmd) Run(args []string, definedFlags map[string]*flag.Flag) {
 
 	meta := map[string][]string{
 		drive.SkipMimeKeyKey: drive.NonEmptyTrimmedStrings(strings.Split(*cmd.SkipMimeKey, ",")...),
+		drive.PropertyKey:    drive.NonEmptyTrimmedStrings(strings.Split(*cmd.Property, ",")...),
+		drive.QueryKey:       drive.NonEmptyTrimmedStrings(*cmd.Query),
 	}
 
 	// Filter out empty strings.
@@ -809,6 +1068,18 @@ func (pCmd *pullCmd) Run(args []string, definedFlags map[string]*flag.Flag) {
 		exitWithError(fmt.Errorf("Unknown fix mode: %s", *cmd.FixMode))
 	}
 
+	shortcutPolicy, ok := translateShortcutPolicy(*cmd.Shortcuts)
+	if !ok {
+		exitWithError(fmt.Errorf("Unknown shortcut policy: %s", *cmd.Shortcuts))
+	}
+
+	multiParentLinks, ok := translateMultiParentLinkMode(*cmd.MultiParentLinks)
+	if !ok {
+		exitWithError(fmt.Errorf("Unknown multi-parent link style: %s", *cmd.MultiParentLinks))
+	}
+
+	exportMap := exportMapFor(context.AbsPathOf(path), *cmd.ExportMap)
+
 	options := &drive.Options{
 		Path:       path,
 		Sources:    sources,
@@ -842,9 +1113,17 @@ func (pCmd *pullCmd) Run(args []string, definedFlags map[string]*flag.Flag) {
 		AllowURLLinkedFiles:          *cmd.AllowURLLinkedFiles,
 		ExportsDumpToSameDirectory:   *cmd.ExportsDumpToSameDirectory,
 		ExponentialBackoffRetryCount: retryCount,
+		DownloadRateLimit:            *cmd.DownloadRateLimit,
+		Revision:                     *cmd.Revision,
+		RevisionDest:                 *cmd.RevisionDest,
+		ShortcutPolicy:               shortcutPolicy,
+		MultiParentLinks:             multiParentLinks,
+		ExportMap:                    exportMap,
 	}
 
-	if *cmd.Matches || *cmd.Starred {
+	if *cmd.Revision != "" {
+		exitWithError(drive.New(context, options).PullRevision(*cmd.ById))
+	} else if byMatches {
 		if *cmd.AllStarred {
 			exitWithError(drive.New(context, options).PullAllStarred())
 		} else {
@@ -892,6 +1171,7 @@ type pushCmd struct {
 	Directories     *bool `json:"directories"`
 	UploadChunkSize *int  `json:"upload-chunk-size"`
 	UploadRateLimit *int  `json:"upload-rate-limit"`
+	Watch           *bool `json:"watch"`
 }
 
 func (cmd *pushCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
@@ -922,6 +1202,7 @@ func (cmd *pushCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
 	cmd.Directories = fs.Bool(drive.CLIOptionDirectories, false, "push only directories")
 	cmd.UploadChunkSize = fs.Int(drive.CLIOptionUploadChunkSize, 0, "specifies the size of each data chunk to be uploaded. Only set it if you want a custom chunk size. Otherwise the default value of googleapi.DefaultUploadChunkSize ie 8MiB will be used. However it must be at least googleapi.MinUploadChunkSize ie 256KiB. See https://godoc.org/google.golang.org/api/googleapi#pkg-constants. If `-upload-chunk-size` is not set yet `-upload-rate-limit` is, `-upload-chunk-size` will be the same as `-upload-rate-limit`.")
 	cmd.UploadRateLimit = fs.Int(drive.CLIOptionUploadRateLimit, 0, "Limit the upload bandwidth to n KiB/s, default is unlimited.")
+	cmd.Watch = fs.Bool(drive.CLIOptionWatch, false, "after pushing, keep watching for local changes and push them as they happen")
 
 	return fs
 }
@@ -944,11 +1225,282 @@ func (cmd *pushCmd) Run(args []string, definedFlags map[string]*flag.Flag) {
 
 	if *cmd.Piped {
 		exitWithError(drive.New(context, options).PushPiped())
+	} else if *cmd.Watch {
+		exitWithError(drive.New(context, options).PushWatch())
 	} else {
 		exitWithError(drive.New(context, options).Push())
 	}
 }
 
+// parseActionFlags parses the flags that follow the action which args starts
+// with e.g `revisions restore -keep-forever path id`, bind defines them on top
+// of the values given before the action. It returns the remaining arguments.
+func parseActionFlags(name string, args []string, definedFlags map[string]*flag.Flag, bind func(fs *flag.FlagSet)) []string {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	bind(fs)
+	fs.Parse(args[1:])
+	fs.Visit(func(f *flag.Flag) {
+		definedFlags[f.Name] = f
+	})
+	return fs.Args()
+}
+
+type commentsCmd struct {
+	Quiet *bool `json:"quiet"`
+	JSON  *bool `json:"json"`
+}
+
+func (cmd *commentsCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+	cmd.Quiet = fs.Bool(drive.QuietKey, false, "if set, do not log anything but errors")
+	cmd.JSON = fs.Bool(drive.CLIOptionJSON, false, "deprecated, the same as -output jsonl")
+	return fs
+}
+
+func (cCmd *commentsCmd) Run(args []string, definedFlags map[string]*flag.Flag) {
+	co := &drive.CommentsOptions{Action: drive.CommentsActionList}
+
+	if len(args) >= 1 {
+		switch args[0] {
+		case drive.CommentsActionList, drive.CommentsActionAdd, drive.CommentsActionReply, drive.CommentsActionResolve:
+			co.Action = args[0]
+			args = parseActionFlags(drive.CommentsKey, args, definedFlags, func(fs *flag.FlagSet) {
+				fs.BoolVar(cCmd.Quiet, drive.QuietKey, *cCmd.Quiet, "")
+				fs.BoolVar(cCmd.JSON, drive.CLIOptionJSON, *cCmd.JSON, "")
+			})
+		}
+	}
+
+	switch co.Action {
+	case drive.CommentsActionAdd:
+		if len(args) < 2 {
+			exitWithError(fmt.Errorf("comments %s: expecting <path> <message>", co.Action))
+		}
+		args, co.Message = args[:1], strings.Join(args[1:], " ")
+	case drive.CommentsActionReply:
+		if len(args) < 3 {
+			exitWithError(fmt.Errorf("comments %s: expecting <path> <commentId> <message>", co.Action))
+		}
+		args, co.CommentId, co.Message = args[:1], args[1], strings.Join(args[2:], " ")
+	case drive.CommentsActionResolve:
+		if len(args) < 2 {
+			exitWithError(fmt.Errorf("comments %s: expecting <path> <commentId> [message]", co.Action))
+		}
+		args, co.CommentId, co.Message = args[:1], args[1], strings.Join(args[2:], " ")
+	}
+
+	sources, context, path := preprocessArgs(args)
+	cmd := commentsCmd{}
+	df := defaultsFiller{
+		command: drive.CommentsKey,
+		from:    *cCmd, to: &cmd,
+		rcSourcePath: context.AbsPathOf(path),
+		definedFlags: definedFlags,
+	}
+
+	if err := fillWithDefaults(df); err != nil {
+		exitWithError(err)
+	}
+
+	exitWithError(drive.New(context, &drive.Options{
+		Path:    path,
+		Sources: sources,
+		Quiet:   *cmd.Quiet,
+		Output:  outputWithJSONAlias(*cmd.JSON),
+	}).Comments(co))
+}
+
+type propCmd struct {
+	Quiet   *bool `json:"quiet"`
+	Private *bool `json:"private"`
+}
+
+func (cmd *propCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+	cmd.Quiet = fs.Bool(drive.QuietKey, false, "if set, do not log anything but errors")
+	cmd.Private = fs.Bool(drive.CLIOptionPrivate, false, "act on the properties private to drive instead of the public ones")
+	return fs
+}
+
+func (pCmd *propCmd) Run(args []string, definedFlags map[string]*flag.Flag) {
+	po := &drive.PropOptions{}
+	if len(args) >= 1 {
+		switch args[0] {
+		case drive.PropActionSet, drive.PropActionGet, drive.PropActionRm:
+			po.Action = args[0]
+			args = parseActionFlags(drive.PropKey, args, definedFlags, func(fs *flag.FlagSet) {
+				fs.BoolVar(pCmd.Quiet, drive.QuietKey, *pCmd.Quiet, "")
+				fs.BoolVar(pCmd.Private, drive.CLIOptionPrivate, *pCmd.Private, "")
+			})
+		}
+	}
+
+	if po.Action == "" || len(args) < 1 {
+		exitWithError(fmt.Errorf("prop: expecting %s|%s|%s <path> [key=value...]", drive.PropActionSet, drive.PropActionGet, drive.PropActionRm))
+	}
+	args, po.Pairs = args[:1], args[1:]
+
+	sources, context, path := preprocessArgs(args)
+	cmd := propCmd{}
+	df := defaultsFiller{
+		command: drive.PropKey,
+		from:    *pCmd, to: &cmd,
+		rcSourcePath: context.AbsPathOf(path),
+		definedFlags: definedFlags,
+	}
+
+	if err := fillWithDefaults(df); err != nil {
+		exitWithError(err)
+	}
+
+	po.Private = *cmd.Private
+	exitWithError(drive.New(context, &drive.Options{
+		Path:    path,
+		Sources: sources,
+		Quiet:   *cmd.Quiet,
+	}).Prop(po))
+}
+
+type revisionsCmd struct {
+	Quiet       *bool `json:"quiet"`
+	NoPrompt    *bool `json:"no-prompt"`
+	KeepForever *bool `json:"keep-forever"`
+}
+
+func (cmd *revisionsCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+	cmd.Quiet = fs.Bool(drive.QuietKey, false, "if set, do not log anything but errors")
+	cmd.NoPrompt = fs.Bool(drive.NoPromptKey, false, "shows no prompt before restoring a revision")
+	cmd.KeepForever = fs.Bool(drive.CLIOptionKeepForever, false, "keep the restored revision from being automatically purged")
+	return fs
+}
+
+func (rCmd *revisionsCmd) Run(args []string, definedFlags map[string]*flag.Flag) {
+	restore := len(args) >= 1 && args[0] == drive.CLIOptionRestore
+	if restore {
+		args = parseActionFlags(drive.RevisionsKey, args, definedFlags, func(fs *flag.FlagSet) {
+			fs.BoolVar(rCmd.Quiet, drive.QuietKey, *rCmd.Quiet, "")
+			fs.BoolVar(rCmd.NoPrompt, drive.NoPromptKey, *rCmd.NoPrompt, "")
+			fs.BoolVar(rCmd.KeepForever, drive.CLIOptionKeepForever, *rCmd.KeepForever, "")
+		})
+		if len(args) != 2 {
+			exitWithError(fmt.Errorf("revisions %s: expecting <path> <revisionId>", drive.CLIOptionRestore))
+		}
+	}
+
+	var revisionId string
+	if restore {
+		args, revisionId = args[:1], args[1]
+	}
+
+	sources, context, path := preprocessArgs(args)
+	cmd := revisionsCmd{}
+	df := defaultsFiller{
+		command: drive.RevisionsKey,
+		from:    *rCmd, to: &cmd,
+		rcSourcePath: context.AbsPathOf(path),
+		definedFlags: definedFlags,
+	}
+
+	if err := fillWithDefaults(df); err != nil {
+		exitWithError(err)
+	}
+
+	opts := &drive.Options{
+		Path:        path,
+		Sources:     sources,
+		Quiet:       *cmd.Quiet,
+		NoPrompt:    *cmd.NoPrompt,
+		Revision:    revisionId,
+		KeepForever: *cmd.KeepForever,
+	}
+
+	if restore {
+		exitWithError(drive.New(context, opts).RestoreRevision())
+	} else {
+		exitWithError(drive.New(context, opts).Revisions())
+	}
+}
+
+type syncCmd struct {
+	Hidden            *bool   `json:"hidden"`
+	NoPrompt          *bool   `json:"no-prompt"`
+	Quiet             *bool   `json:"quiet"`
+	Verbose           *bool   `json:"verbose"`
+	Depth             *int    `json:"depth"`
+	IgnoreChecksum    *bool   `json:"ignore-checksum"`
+	IgnoreConflict    *bool   `json:"ignore-conflict"`
+	IgnoreNameClashes *bool   `json:"ignore-name-clashes"`
+	ExcludeOps        *string `json:"exclude-ops"`
+	FixClashes        *bool   `json:"fix-clashes"`
+	FixMode           *string `json:"fix-mode"`
+
+	ExponentialBackoffRetryCount *int `json:"retry-count"`
+}
+
+func (cmd *syncCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+	cmd.Hidden = fs.Bool(drive.HiddenKey, false, "allows syncing of hidden paths")
+	cmd.NoPrompt = fs.Bool(drive.NoPromptKey, false, "shows no prompt before applying the sync action")
+	cmd.Quiet = fs.Bool(drive.QuietKey, false, "if set, do not log anything but errors")
+	cmd.Verbose = fs.Bool(drive.CLIOptionVerboseKey, false, drive.DescVerbose)
+	cmd.Depth = fs.Int(drive.DepthKey, drive.DefaultMaxTraversalDepth, "max traversal depth")
+	cmd.IgnoreChecksum = fs.Bool(drive.CLIOptionIgnoreChecksum, true, drive.DescIgnoreChecksum)
+	cmd.IgnoreConflict = fs.Bool(drive.CLIOptionIgnoreConflict, false, "skip the paths that changed both locally and remotely and sync everything else")
+	cmd.IgnoreNameClashes = fs.Bool(drive.CLIOptionIgnoreNameClashes, false, drive.DescIgnoreNameClashes)
+	cmd.ExcludeOps = fs.String(drive.CLIOptionExcludeOperations, "", drive.DescExcludeOps)
+	cmd.FixClashes = fs.Bool(drive.CLIOptionFixClashesKey, false, drive.DescFixClashes)
+	cmd.FixMode = fs.String(drive.CLIOptionFixClashesMode, "rename", drive.DescFixClashesMode)
+	cmd.ExponentialBackoffRetryCount = fs.Int(drive.CLIOptionRetryCount, drive.MaxFailedRetryCount, drive.DescExponentialBackoffRetryCount)
+	return fs
+}
+
+func (sCmd *syncCmd) Run(args []string, definedFlags map[string]*flag.Flag) {
+	sources, context, path := preprocessArgs(args)
+
+	cmd := syncCmd{}
+	df := defaultsFiller{
+		command: drive.SyncKey,
+		from:    *sCmd, to: &cmd,
+		rcSourcePath: context.AbsPathOf(path),
+		definedFlags: definedFlags,
+	}
+
+	if err := fillWithDefaults(df); err != nil {
+		exitWithError(err)
+	}
+
+	excludes := drive.NonEmptyTrimmedStrings(strings.Split(*cmd.ExcludeOps, ",")...)
+	excludeCrudMask := drive.CrudAtoi(excludes...)
+	if excludeCrudMask == drive.AllCrudOperations {
+		exitWithError(fmt.Errorf("all CRUD operations forbidden"))
+	}
+
+	fixMode, ok := translateFixMode(*cmd.FixMode)
+	if !ok {
+		exitWithError(fmt.Errorf("Unknown fix mode: %s", *cmd.FixMode))
+	}
+
+	options := &drive.Options{
+		Path:    path,
+		Sources: sources,
+
+		Hidden:     *cmd.Hidden,
+		NoPrompt:   *cmd.NoPrompt,
+		Quiet:      *cmd.Quiet,
+		Verbose:    *cmd.Verbose,
+		Depth:      *cmd.Depth,
+		Recursive:  true,
+		FixClashes: *cmd.FixClashes,
+
+		FixClashesMode:    fixMode,
+		IgnoreChecksum:    *cmd.IgnoreChecksum,
+		IgnoreConflict:    *cmd.IgnoreConflict,
+		IgnoreNameClashes: *cmd.IgnoreNameClashes,
+		ExcludeCrudMask:   excludeCrudMask,
+
+		ExponentialBackoffRetryCount: *cmd.ExponentialBackoffRetryCount,
+	}
+
+	exitWithError(drive.New(context, options).Sync())
+}
+
 type qrLinkCmd struct {
 	Address *string `json:"address"`
 	ById    *bool   `json:"by-id"`
@@ -1000,6 +1552,8 @@ type touchCmd struct {
 	Quiet     *bool `json:"quiet"`
 	Verbose   *bool `json:"verbose"`
 
+	Query *string `json:"query"`
+
 	TouchTimeStr        *string `json:"time"`
 	OffsetDurationStr   *string `json:"duration"`
 	TimeFormatSpecifier *string `json:"format"`
@@ -1013,6 +1567,7 @@ func (cmd *touchCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
 	cmd.ById = fs.Bool(drive.CLIOptionId, false, "share by id instead of path")
 	cmd.Depth = fs.Int(drive.DepthKey, drive.DefaultMaxTraversalDepth, "max traversal depth")
 	cmd.Verbose = fs.Bool(drive.CLIOptionVerboseKey, true, drive.DescVerbose)
+	cmd.Query = fs.String(drive.CLIOptionQuery, "", drive.DescQuery)
 
 	cmd.TouchTimeStr = fs.String(drive.TouchModTimeKey, "", drive.DescTouchTimeStr)
 	cmd.OffsetDurationStr = fs.String(drive.TouchOffsetDurationKey, "", drive.DescTouchOffsetDuration)
@@ -1022,7 +1577,8 @@ func (cmd *touchCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
 }
 
 func (tcmd *touchCmd) Run(args []string, definedFlags map[string]*flag.Flag) {
-	sources, context, path := preprocessArgsByToggle(args, *tcmd.Matches || *tcmd.ById)
+	byMatches := *tcmd.Matches && *tcmd.Query == ""
+	sources, context, path := preprocessArgsByToggle(args, byMatches || *tcmd.ById)
 	absEntryPath := context.AbsPathOf(path)
 
 	cmd := new(touchCmd)
@@ -1057,11 +1613,12 @@ func (tcmd *touchCmd) Run(args []string, definedFlags map[string]*flag.Flag) {
 		drive.TouchModTimeKey:          drive.NonEmptyTrimmedStrings(*cmd.TouchTimeStr),
 		drive.TouchOffsetDurationKey:   drive.NonEmptyTrimmedStrings(*cmd.OffsetDurationStr),
 		drive.TouchTimeFmtSpecifierKey: drive.NonEmptyTrimmedStrings(*cmd.TimeFormatSpecifier),
+		drive.QueryKey:                 drive.NonEmptyTrimmedStrings(*cmd.Query),
 	}
 
 	opts.Meta = &meta
 
-	if *cmd.Matches {
+	if byMatches {
 		exitWithError(drive.New(context, &opts).TouchByMatch())
 	} else {
 		exitWithError(drive.New(context, &opts).Touch(*cmd.ById))
@@ -1258,7 +1815,8 @@ func (acmd *aboutCmd) Run(args []string, definedFlags map[string]*flag.Flag) {
 	}
 
 	exitWithError(drive.New(context, &drive.Options{
-		Quiet: *cmd.Quiet,
+		Quiet:  *cmd.Quiet,
+		Output: string(output),
 	}).About(mask))
 }
 
@@ -1319,6 +1877,7 @@ func (cmd *diffCmd) Run(args []string, definedFlags map[string]*flag.Flag) {
 		BaseLocal:         *cmd.BaseLocal,
 		Meta:              metaPtr,
 		TypeMask:          mask,
+		Output:            string(output),
 	}).Diff())
 }
 
@@ -1377,11 +1936,12 @@ func (cmd *emptyTrashCmd) Run(args []string, definedFlags map[string]*flag.Flag)
 }
 
 type deleteCmd struct {
-	Hidden   *bool `json:"hidden"`
-	Matches  *bool `json:"matches"`
-	Quiet    *bool `json:"quiet"`
-	ById     *bool `json:"by-id"`
-	NoPrompt *bool `json:"no-prompt"`
+	Hidden   *bool   `json:"hidden"`
+	Matches  *bool   `json:"matches"`
+	Quiet    *bool   `json:"quiet"`
+	ById     *bool   `json:"by-id"`
+	NoPrompt *bool   `json:"no-prompt"`
+	Query    *string `json:"query"`
 }
 
 func (cmd *deleteCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
@@ -1390,6 +1950,7 @@ func (cmd *deleteCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
 	cmd.Quiet = fs.Bool(drive.QuietKey, false, "if set, do not log anything but errors")
 	cmd.ById = fs.Bool(drive.CLIOptionId, false, "delete by id instead of path")
 	cmd.NoPrompt = fs.Bool(drive.NoPromptKey, false, "disables the prompt")
+	cmd.Query = fs.String(drive.CLIOptionQuery, "", drive.DescQuery)
 
 	return fs
 }
@@ -1399,16 +1960,22 @@ func (cmd *deleteCmd) Run(args []string, definedFlags map[string]*flag.Flag) {
 		exitWithError(drive.PermanentDeletionNoPromptError)
 	}
 
-	sources, context, path := preprocessArgsByToggle(args, *cmd.Matches || *cmd.ById)
+	byMatches := *cmd.Matches && *cmd.Query == ""
+	sources, context, path := preprocessArgsByToggle(args, byMatches || *cmd.ById)
+
+	meta := map[string][]string{
+		drive.QueryKey: drive.NonEmptyTrimmedStrings(*cmd.Query),
+	}
 
 	opts := drive.Options{
 		Path:    path,
 		Sources: sources,
 		Quiet:   *cmd.Quiet,
 		Match:   *cmd.Matches,
+		Meta:    &meta,
 	}
 
-	if !*cmd.Matches {
+	if !byMatches {
 		exitWithError(drive.New(context, &opts).Delete(*cmd.ById))
 	} else {
 		exitWithError(drive.New(context, &opts).DeleteByMatch())
@@ -1416,11 +1983,13 @@ func (cmd *deleteCmd) Run(args []string, definedFlags map[string]*flag.Flag) {
 }
 
 type trashCmd struct {
-	Hidden  *bool `json:"hidden"`
-	Matches *bool `json:"matches"`
-	Quiet   *bool `json:"quiet"`
-	ById    *bool `json:"by-id"`
-	Verbose *bool `json:"verbose"`
+	Hidden   *bool   `json:"hidden"`
+	Matches  *bool   `json:"matches"`
+	Quiet    *bool   `json:"quiet"`
+	ById     *bool   `json:"by-id"`
+	Verbose  *bool   `json:"verbose"`
+	Property *string `json:"property"`
+	Query    *string `json:"query"`
 }
 
 func (cmd *trashCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
@@ -1429,12 +1998,20 @@ func (cmd *trashCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
 	cmd.Quiet = fs.Bool(drive.QuietKey, false, "if set, do not log anything but errors")
 	cmd.ById = fs.Bool(drive.CLIOptionId, false, "trash by id instead of path")
 	cmd.Verbose = fs.Bool(drive.CLIOptionVerboseKey, false, drive.DescVerbose)
+	cmd.Property = fs.String(drive.CLIOptionProperty, "", drive.DescProperty)
+	cmd.Query = fs.String(drive.CLIOptionQuery, "", drive.DescQuery)
 
 	return fs
 }
 
 func (cmd *trashCmd) Run(args []string, definedFlags map[string]*flag.Flag) {
-	sources, context, path := preprocessArgsByToggle(args, *cmd.Matches || *cmd.ById)
+	byMatches := *cmd.Matches && *cmd.Query == ""
+	sources, context, path := preprocessArgsByToggle(args, byMatches || *cmd.ById)
+
+	meta := map[string][]string{
+		drive.PropertyKey: drive.NonEmptyTrimmedStrings(strings.Split(*cmd.Property, ",")...),
+		drive.QueryKey:    drive.NonEmptyTrimmedStrings(*cmd.Query),
+	}
 
 	opts := drive.Options{
 		Path:    path,
@@ -1442,9 +2019,10 @@ func (cmd *trashCmd) Run(args []string, definedFlags map[string]*flag.Flag) {
 		Quiet:   *cmd.Quiet,
 		Match:   *cmd.Matches,
 		Verbose: *cmd.Verbose,
+		Meta:    &meta,
 	}
 
-	if !*cmd.Matches {
+	if !byMatches {
 		exitWithError(drive.New(context, &opts).Trash(*cmd.ById))
 	} else {
 		exitWithError(drive.New(context, &opts).TrashByMatch())
@@ -1496,6 +2074,38 @@ func (cmd *copyCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
 	return fs
 }
 
+type shortcutCmd struct {
+	Quiet *bool `json:"quiet"`
+	ById  *bool `json:"by-id"`
+}
+
+func (cmd *shortcutCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+	cmd.Quiet = fs.Bool(drive.QuietKey, false, "if set, do not log anything but errors")
+	cmd.ById = fs.Bool(drive.CLIOptionId, false, "the target is an id instead of a path")
+	return fs
+}
+
+func (cmd *shortcutCmd) Run(args []string, definedFlags map[string]*flag.Flag) {
+	if len(args) != 2 {
+		exitWithError(fmt.Errorf("shortcut: expecting <target> <linkpath>"))
+	}
+
+	linkPath := args[1]
+
+	sources, context, path := preprocessArgsByToggle(args, *cmd.ById)
+
+	linkRels, err := relativePaths(context.AbsPathOf(""), linkPath)
+	exitWithError(err)
+
+	sources = []string{sources[0], linkRels[0]}
+
+	exitWithError(drive.New(context, &drive.Options{
+		Path:    path,
+		Sources: sources,
+		Quiet:   *cmd.Quiet,
+	}).Shortcut(*cmd.ById))
+}
+
 func (cmd *copyCmd) Run(args []string, definedFlags map[string]*flag.Flag) {
 	if len(args) < 2 {
 		args = append(args, ".")
@@ -1527,10 +2137,11 @@ func (cmd *copyCmd) Run(args []string, definedFlags map[string]*flag.Flag) {
 }
 
 type untrashCmd struct {
-	Hidden  *bool `json:"hidden"`
-	Matches *bool `json:"matches"`
-	Quiet   *bool `json:"quiet"`
-	ById    *bool `json:"by-id"`
+	Hidden  *bool   `json:"hidden"`
+	Matches *bool   `json:"matches"`
+	Quiet   *bool   `json:"quiet"`
+	ById    *bool   `json:"by-id"`
+	Query   *string `json:"query"`
 }
 
 func (cmd *untrashCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
@@ -1538,21 +2149,28 @@ func (cmd *untrashCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
 	cmd.Matches = fs.Bool(drive.MatchesKey, false, "search by prefix and untrash")
 	cmd.Quiet = fs.Bool(drive.QuietKey, false, "if set, do not log anything but errors")
 	cmd.ById = fs.Bool(drive.CLIOptionId, false, "untrash by id instead of path")
+	cmd.Query = fs.String(drive.CLIOptionQuery, "", drive.DescQuery)
 
 	return fs
 }
 
 func (cmd *untrashCmd) Run(args []string, definedFlags map[string]*flag.Flag) {
-	sources, context, path := preprocessArgsByToggle(args, *cmd.ById || *cmd.Matches)
+	byMatches := *cmd.Matches && *cmd.Query == ""
+	sources, context, path := preprocessArgsByToggle(args, *cmd.ById || byMatches)
+
+	meta := map[string][]string{
+		drive.QueryKey: drive.NonEmptyTrimmedStrings(*cmd.Query),
+	}
 
 	opts := drive.Options{
 		Path:    path,
 		Sources: sources,
 		Quiet:   *cmd.Quiet,
 		Match:   *cmd.Matches,
+		Meta:    &meta,
 	}
 
-	if !*cmd.Matches {
+	if !byMatches {
 		exitWithError(drive.New(context, &opts).Untrash(*cmd.ById))
 	} else {
 		exitWithError(drive.New(context, &opts).UntrashByMatch())
@@ -1833,6 +2451,7 @@ func (icmd *idCmd) Run(args []string, definedFlags map[string]*flag.Flag) {
 		Sources: sources,
 		Depth:   *cmd.Depth,
 		Hidden:  *cmd.Hidden,
+		Output:  string(output),
 	}
 
 	exitWithError(drive.New(context, opts).Id())
@@ -1860,6 +2479,30 @@ func (cmd *clashesCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
 	return fs
 }
 
+func translateShortcutPolicy(strPolicy string) (drive.ShortcutPolicy, bool) {
+	switch strings.ToLower(strPolicy) {
+	case "symlink":
+		return drive.ShortcutSymlink, true
+	case "link":
+		return drive.ShortcutLink, true
+	case "follow":
+		return drive.ShortcutFollow, true
+	default:
+		return 0, false
+	}
+}
+
+func translateMultiParentLinkMode(strMode string) (drive.MultiParentLinkMode, bool) {
+	switch strings.ToLower(strMode) {
+	case "hardlink":
+		return drive.MultiParentHardlink, true
+	case "symlink":
+		return drive.MultiParentSymlink, true
+	default:
+		return 0, false
+	}
+}
+
 func translateFixMode(strFixMode string) (drive.FixClashesMode, bool) {
 	switch strings.ToLower(strFixMode) {
 	case "rename":
@@ -2024,7 +2667,11 @@ func exitWithError(err error) {
 		code = codedErr.Code()
 	}
 
-	drive.FprintfShadow(os.Stderr, "%s\n", msg)
+	if output == drive.OutputText {
+		drive.FprintfShadow(os.Stderr, "%s\n", msg)
+	} else {
+		drive.WriteErrorRecord(os.Stderr, err)
+	}
 	os.Exit(code)
 }
 
@@ -0,0 +1,233 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/boltdb/bolt"
+)
+
+const (
+	CacheKey         = "cache"
+	CacheFilesKey    = "cache-files"
+	CacheChildrenKey = "cache-children"
+
+	cacheStateKey = "state"
+)
+
+// CacheState records what the metadata cache was built from
+// and up to which remote change it has been kept fresh.
+type CacheState struct {
+	RootId          string `json:"root"`
+	LargestChangeId int64  `json:"change"`
+	UpdateTime      int64  `json:"utime"`
+}
+
+// CachedFile is the metadata of a remote file as kept in the cache.
+// Data is its full serialized record and ParentIds the folders that
+// it is in, which the cache also indexes to list their children.
+type CachedFile struct {
+	Id        string          `json:"id"`
+	ParentIds []string        `json:"parents,omitempty"`
+	Data      json.RawMessage `json:"data"`
+}
+
+func childKey(parentId, id string) []byte {
+	return byteify(parentId + "/" + id)
+}
+
+// CacheState returns the state of the metadata cache.
+// It returns ErrNoSuchDbKey if the cache was never built.
+func (c *Context) CacheState() (*CacheState, error) {
+	data, err := c.getDbKey(CacheKey, cacheStateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	state := CacheState{}
+	err = json.Unmarshal(data, &state)
+	return &state, err
+}
+
+// ResetCache replaces everything in the metadata cache with files.
+func (c *Context) ResetCache(state *CacheState, files []*CachedFile) error {
+	return c.updateCache(true, state, files, nil)
+}
+
+// UpdateCache adds or replaces files in the metadata cache and removes
+// the files with removedIds, all at once along with the new state.
+func (c *Context) UpdateCache(state *CacheState, files []*CachedFile, removedIds []string) error {
+	return c.updateCache(false, state, files, removedIds)
+}
+
+func (c *Context) updateCache(reset bool, state *CacheState, files []*CachedFile, removedIds []string) error {
+	stateData, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	db, err := c.OpenDB()
+	if err != nil {
+		return err
+	}
+	defer c.closeDB(db)
+
+	return db.Update(func(tx *bolt.Tx) error {
+		if reset {
+			for _, name := range []string{CacheKey, CacheFilesKey, CacheChildrenKey} {
+				if err := tx.DeleteBucket(byteify(name)); err != nil && err != bolt.ErrBucketNotFound {
+					return err
+				}
+			}
+		}
+
+		var buckets []*bolt.Bucket
+		for _, name := range []string{CacheKey, CacheFilesKey, CacheChildrenKey} {
+			bucket, err := tx.CreateBucketIfNotExists(byteify(name))
+			if err != nil {
+				return err
+			}
+			buckets = append(buckets, bucket)
+		}
+		stateBucket, filesBucket, childrenBucket := buckets[0], buckets[1], buckets[2]
+
+		// Unlink the files from their previous parents, which
+		// they might have been moved out of since.
+		unlink := func(id string) error {
+			prev, err := cachedFileFrom(filesBucket.Get(byteify(id)))
+			if err != nil || prev == nil {
+				return err
+			}
+			for _, parentId := range prev.ParentIds {
+				if err := childrenBucket.Delete(childKey(parentId, id)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		for _, id := range removedIds {
+			if err := unlink(id); err != nil {
+				return err
+			}
+			if err := filesBucket.Delete(byteify(id)); err != nil {
+				return err
+			}
+		}
+
+		for _, f := range files {
+			if err := unlink(f.Id); err != nil {
+				return err
+			}
+
+			data, err := json.Marshal(f)
+			if err != nil {
+				return err
+			}
+			if err := filesBucket.Put(byteify(f.Id), data); err != nil {
+				return err
+			}
+			for _, parentId := range f.ParentIds {
+				if err := childrenBucket.Put(childKey(parentId, f.Id), []byte{}); err != nil {
+					return err
+				}
+			}
+		}
+
+		return stateBucket.Put(byteify(cacheStateKey), stateData)
+	})
+}
+
+func cachedFileFrom(data []byte) (*CachedFile, error) {
+	if len(data) < 1 {
+		return nil, nil
+	}
+
+	f := CachedFile{}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// CachedFileById returns the cached file with that id.
+// It returns ErrNoSuchDbKey if there is none.
+func (c *Context) CachedFileById(id string) (*CachedFile, error) {
+	data, err := c.getDbKey(CacheFilesKey, id)
+	if err != nil {
+		return nil, err
+	}
+	return cachedFileFrom(data)
+}
+
+// CachedChildren returns the cached files that are in the folder parentId.
+func (c *Context) CachedChildren(parentId string) ([]*CachedFile, error) {
+	db, err := c.OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer c.closeDB(db)
+
+	var children []*CachedFile
+	err = db.View(func(tx *bolt.Tx) error {
+		filesBucket, childrenBucket := tx.Bucket(byteify(CacheFilesKey)), tx.Bucket(byteify(CacheChildrenKey))
+		if filesBucket == nil || childrenBucket == nil {
+			return ErrNoSuchDbBucket
+		}
+
+		prefix := byteify(parentId + "/")
+		cur := childrenBucket.Cursor()
+		for key, _ := cur.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = cur.Next() {
+			// The retrieved slices are only valid during the transaction
+			// but unmarshaling copies whatever is kept of them.
+			f, err := cachedFileFrom(filesBucket.Get(key[len(prefix):]))
+			if err != nil {
+				return err
+			}
+			if f != nil {
+				children = append(children, f)
+			}
+		}
+		return nil
+	})
+
+	return children, err
+}
+
+// ForEachCachedFile calls fn with every cached file, stopping at the first error.
+func (c *Context) ForEachCachedFile(fn func(*CachedFile) error) error {
+	db, err := c.OpenDB()
+	if err != nil {
+		return err
+	}
+	defer c.closeDB(db)
+
+	return db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(byteify(CacheFilesKey))
+		if bucket == nil {
+			return ErrNoSuchDbBucket
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			f, err := cachedFileFrom(v)
+			if err != nil || f == nil {
+				return err
+			}
+			return fn(f)
+		})
+	})
+}
@@ -22,6 +22,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"golang.org/x/oauth2/jwt"
@@ -42,8 +43,12 @@ var (
 )
 
 const (
-	IndicesKey = "indices"
-	DriveDb    = "drivedb"
+	IndicesKey        = "indices"
+	UploadSessionsKey = "upload-sessions"
+	ChangesKey        = "changes"
+	DriveDb           = "drivedb"
+
+	largestChangeIdKey = "largest-change-id"
 )
 
 const (
@@ -57,6 +62,13 @@ type Context struct {
 	ClientSecret string `json:"client_secret"`
 	RefreshToken string `json:"refresh_token"`
 	AbsPath      string `json:"-"`
+
+	// SharedDriveId if set, roots the context at
+	// that shared drive instead of at "My Drive".
+	SharedDriveId string `json:"shared_drive_id,omitempty"`
+
+	// db is the index DB held open by HoldDB, if any.
+	db *bolt.DB
 }
 
 type Index struct {
@@ -67,6 +79,22 @@ type Index struct {
 	ModTime     int64  `json:"mtime"`
 	Version     int64  `json:"version"`
 	IndexTime   int64  `json:"itime"`
+	// Path is the remote path of the file when it was
+	// indexed, it is empty for older or pathless indices.
+	Path string `json:"path,omitempty"`
+	// Exports lists the local paths that the file was last exported to.
+	Exports []string `json:"exports,omitempty"`
+}
+
+// UploadSession records how far a resumable upload got, so
+// that an interrupted push can continue from where it left off.
+type UploadSession struct {
+	URI         string `json:"uri"`
+	FileId      string `json:"id,omitempty"`
+	Offset      int64  `json:"offset"`
+	Size        int64  `json:"size"`
+	ModTime     int64  `json:"mtime"`
+	CreatedTime int64  `json:"ctime"`
 }
 
 type MountPoint struct {
@@ -125,7 +153,7 @@ func (c *Context) DeserializeIndex(key string) (*Index, error) {
 		return nil, err
 	}
 
-	defer db.Close()
+	defer c.closeDB(db)
 
 	var data []byte
 
@@ -152,6 +180,40 @@ func (c *Context) DeserializeIndex(key string) (*Index, error) {
 	return &index, err
 }
 
+// IndicesByPath returns all the indices that have a path, keyed by that path.
+func (c *Context) IndicesByPath() (map[string]*Index, error) {
+	if err := c.CreateIndicesBucket(); err != nil {
+		return nil, err
+	}
+
+	db, err := c.OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer c.closeDB(db)
+
+	byPath := make(map[string]*Index)
+	err = db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(byteify(IndicesKey))
+		if bucket == nil {
+			return ErrNoSuchDbBucket
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			index := Index{}
+			if err := json.Unmarshal(v, &index); err != nil {
+				return err
+			}
+			if index.Path != "" {
+				byPath[index.Path] = &index
+			}
+			return nil
+		})
+	})
+
+	return byPath, err
+}
+
 func (c *Context) ListKeys(dir, bucketName string) (chan string, error) {
 	keysChan := make(chan string)
 	if err := c.CreateIndicesBucket(); err != nil {
@@ -167,7 +229,7 @@ func (c *Context) ListKeys(dir, bucketName string) (chan string, error) {
 
 	go func() {
 		defer func() {
-			db.Close()
+			c.closeDB(db)
 			close(keysChan)
 		}()
 
@@ -199,10 +261,10 @@ func (c *Context) popDbKey(bucketName, key string) error {
 	if err != nil {
 		return err
 	}
-	defer db.Close()
+	defer c.closeDB(db)
 
 	return db.Update(func(tx *bolt.Tx) error {
-		bucket, err := tx.CreateBucketIfNotExists(byteify(IndicesKey))
+		bucket, err := tx.CreateBucketIfNotExists(byteify(bucketName))
 		if err != nil {
 			return err
 		}
@@ -214,6 +276,91 @@ func (c *Context) popDbKey(bucketName, key string) error {
 	})
 }
 
+func (c *Context) getDbKey(bucketName, key string) ([]byte, error) {
+	db, err := c.OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer c.closeDB(db)
+
+	var data []byte
+	err = db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(byteify(bucketName))
+		if bucket == nil {
+			return ErrNoSuchDbKey
+		}
+
+		retr := bucket.Get(byteify(key))
+		if len(retr) < 1 {
+			return ErrNoSuchDbKey
+		}
+
+		// The retrieved slice is only valid during the transaction.
+		data = append([]byte{}, retr...)
+		return nil
+	})
+
+	return data, err
+}
+
+func (c *Context) putDbKey(bucketName, key string, data []byte) error {
+	db, err := c.OpenDB()
+	if err != nil {
+		return err
+	}
+	defer c.closeDB(db)
+
+	return db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(byteify(bucketName))
+		if err != nil {
+			return err
+		}
+		if bucket == nil {
+			return ErrNoSuchDbBucket
+		}
+		return bucket.Put(byteify(key), data)
+	})
+}
+
+// DeserializeUploadSession retrieves the resumable upload session saved for key.
+// It returns ErrNoSuchDbKey if there is none.
+func (c *Context) DeserializeUploadSession(key string) (*UploadSession, error) {
+	data, err := c.getDbKey(UploadSessionsKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	session := UploadSession{}
+	err = json.Unmarshal(data, &session)
+	return &session, err
+}
+
+func (c *Context) SerializeUploadSession(key string, session *UploadSession) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return c.putDbKey(UploadSessionsKey, key, data)
+}
+
+func (c *Context) PopUploadSession(key string) error {
+	return c.popDbKey(UploadSessionsKey, key)
+}
+
+// LargestChangeId retrieves the id of the last remote change that was
+// processed by `drive watch`. It returns ErrNoSuchDbKey if there is none.
+func (c *Context) LargestChangeId() (int64, error) {
+	data, err := c.getDbKey(ChangesKey, largestChangeIdKey)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(string(data), 10, 64)
+}
+
+func (c *Context) SetLargestChangeId(changeId int64) error {
+	return c.putDbKey(ChangesKey, largestChangeIdKey, byteify(strconv.FormatInt(changeId, 10)))
+}
+
 func (c *Context) RemoveIndex(index *Index, p string) error {
 	if index == nil {
 		return ErrDerefNilIndex
@@ -226,7 +373,7 @@ func (c *Context) RemoveIndex(index *Index, p string) error {
 	if err != nil {
 		return err
 	}
-	defer db.Close()
+	defer c.closeDB(db)
 
 	return db.Update(func(tx *bolt.Tx) error {
 		bucket, err := tx.CreateBucketIfNotExists(byteify(IndicesKey))
@@ -245,7 +392,7 @@ func (c *Context) CreateIndicesBucket() error {
 	if err != nil {
 		return err
 	}
-	defer db.Close()
+	defer c.closeDB(db)
 
 	return db.Update(func(tx *bolt.Tx) error {
 		bucket, err := tx.CreateBucketIfNotExists(byteify(IndicesKey))
@@ -269,7 +416,7 @@ func (c *Context) SerializeIndex(index *Index) error {
 	if err != nil {
 		return err
 	}
-	defer db.Close()
+	defer c.closeDB(db)
 
 	return db.Update(func(tx *bolt.Tx) error {
 		bucket, err := tx.CreateBucketIfNotExists(byteify(IndicesKey))
@@ -315,7 +462,13 @@ func (c *Context) DeInitialize(prompter func(...interface{}) bool, returnOnAnyEr
 	return nil
 }
 
+// OpenDB opens the index DB, or returns the one that HoldDB
+// keeps open. Callers release it with closeDB when done.
 func (c *Context) OpenDB() (*bolt.DB, error) {
+	if c.db != nil {
+		return c.db, nil
+	}
+
 	dbPath := DbSuffixedPath(c.AbsPathOf(""))
 	db, err := bolt.Open(dbPath, O_RWForAll, nil)
 	if err != nil {
@@ -329,6 +482,39 @@ func (c *Context) OpenDB() (*bolt.DB, error) {
 	return db, nil
 }
 
+func (c *Context) closeDB(db *bolt.DB) error {
+	if db == c.db {
+		return nil
+	}
+	return db.Close()
+}
+
+// HoldDB opens the index DB and keeps it open, instead of opening
+// it for every operation, until ReleaseDB is invoked. This suits
+// long running processes that serve many operations.
+func (c *Context) HoldDB() error {
+	if c.db != nil {
+		return nil
+	}
+
+	db, err := c.OpenDB()
+	if err != nil {
+		return err
+	}
+	c.db = db
+	return nil
+}
+
+// ReleaseDB closes the index DB that HoldDB kept open.
+func (c *Context) ReleaseDB() error {
+	db := c.db
+	if db == nil {
+		return nil
+	}
+	c.db = nil
+	return db.Close()
+}
+
 // Discovers the gd directory, if no gd directory or credentials
 // could be found for the path, returns ErrNoContext.
 func Discover(currentAbsPath string) (*Context, error) {
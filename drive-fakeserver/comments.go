@@ -0,0 +1,223 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	drive "google.golang.org/api/drive/v2"
+)
+
+var errCommentNotFound = errors.New("comment not found")
+
+const (
+	commentStatusOpen     = "open"
+	commentStatusResolved = "resolved"
+
+	commentVerbResolve = "resolve"
+	commentVerbReopen  = "reopen"
+)
+
+func fakeAuthor() *drive.User {
+	return &drive.User{EmailAddress: fakeOwner, DisplayName: "Fake Owner", IsAuthenticatedUser: true}
+}
+
+func (s *store) comments(fileId string) ([]*drive.Comment, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	rec, err := s.lookupLocked(fileId)
+	if err != nil {
+		return nil, err
+	}
+
+	var comments []*drive.Comment
+	for _, comment := range s.state.Comments[rec.File.Id] {
+		comments = append(comments, presentComment(comment))
+	}
+	return comments, nil
+}
+
+// presentComment returns a copy of the comment that replies won't change.
+func presentComment(comment *drive.Comment) *drive.Comment {
+	c := *comment
+	c.Replies = append([]*drive.CommentReply{}, comment.Replies...)
+	return &c
+}
+
+func (s *store) lookupCommentLocked(fileId, commentId string) (*drive.Comment, error) {
+	rec, err := s.lookupLocked(fileId)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, comment := range s.state.Comments[rec.File.Id] {
+		if comment.CommentId == commentId {
+			return comment, nil
+		}
+	}
+	return nil, errCommentNotFound
+}
+
+func (s *store) comment(fileId, commentId string) (*drive.Comment, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	comment, err := s.lookupCommentLocked(fileId, commentId)
+	if err != nil {
+		return nil, err
+	}
+	return presentComment(comment), nil
+}
+
+func (s *store) insertComment(fileId string, meta *drive.Comment) (*drive.Comment, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	rec, err := s.lookupLocked(fileId)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.state.Comments == nil {
+		s.state.Comments = make(map[string][]*drive.Comment)
+	}
+
+	s.state.LastId += 1
+	comment := &drive.Comment{
+		CommentId:    fmt.Sprintf("fakeComment%08d", s.state.LastId),
+		Kind:         "drive#comment",
+		FileId:       rec.File.Id,
+		FileTitle:    rec.File.Title,
+		Content:      meta.Content,
+		Anchor:       meta.Anchor,
+		Context:      meta.Context,
+		Author:       fakeAuthor(),
+		Status:       commentStatusOpen,
+		CreatedDate:  nowString(),
+		ModifiedDate: nowString(),
+	}
+	s.state.Comments[rec.File.Id] = append(s.state.Comments[rec.File.Id], comment)
+
+	if err := s.saveLocked(); err != nil {
+		return nil, err
+	}
+	return presentComment(comment), nil
+}
+
+// insertReply adds the reply to the comment, replies whose verb
+// is "resolve" or "reopen" also change the status of the comment.
+func (s *store) insertReply(fileId, commentId string, meta *drive.CommentReply) (*drive.CommentReply, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	comment, err := s.lookupCommentLocked(fileId, commentId)
+	if err != nil {
+		return nil, err
+	}
+
+	switch meta.Verb {
+	case commentVerbResolve:
+		comment.Status = commentStatusResolved
+	case commentVerbReopen:
+		comment.Status = commentStatusOpen
+	}
+
+	s.state.LastId += 1
+	reply := &drive.CommentReply{
+		ReplyId:      fmt.Sprintf("fakeReply%08d", s.state.LastId),
+		Kind:         "drive#commentReply",
+		Content:      meta.Content,
+		Verb:         meta.Verb,
+		Author:       fakeAuthor(),
+		CreatedDate:  nowString(),
+		ModifiedDate: nowString(),
+	}
+	comment.Replies = append(comment.Replies, reply)
+	comment.ModifiedDate = reply.ModifiedDate
+
+	if err := s.saveLocked(); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+func (s *server) comments(w http.ResponseWriter, r *http.Request, fileId string, parts []string) {
+	switch {
+	case len(parts) == 0 && r.Method == "GET":
+		comments, err := s.store.comments(fileId)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		start, end, nextPageToken := pageBounds(r, len(comments))
+		writeJSON(w, &drive.CommentList{
+			Kind:          "drive#commentList",
+			Items:         comments[start:end],
+			NextPageToken: nextPageToken,
+		})
+
+	case len(parts) == 0 && r.Method == "POST":
+		meta := new(drive.Comment)
+		if err := decodeJSON(r.Body, meta); err != nil {
+			writeError(w, http.StatusBadRequest, "parseError", err.Error())
+			return
+		}
+		if meta.Content == "" {
+			writeError(w, http.StatusBadRequest, "required", "Required: content")
+			return
+		}
+		comment, err := s.store.insertComment(fileId, meta)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		writeJSON(w, comment)
+
+	case len(parts) == 1 && r.Method == "GET":
+		comment, err := s.store.comment(fileId, parts[0])
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		writeJSON(w, comment)
+
+	case len(parts) == 2 && parts[1] == "replies" && r.Method == "POST":
+		meta := new(drive.CommentReply)
+		if err := decodeJSON(r.Body, meta); err != nil {
+			writeError(w, http.StatusBadRequest, "parseError", err.Error())
+			return
+		}
+		switch {
+		case meta.Verb != "" && meta.Verb != commentVerbResolve && meta.Verb != commentVerbReopen:
+			writeError(w, http.StatusBadRequest, "invalid", fmt.Sprintf("Invalid value for: verb %q", meta.Verb))
+			return
+		case meta.Content == "" && meta.Verb == "":
+			writeError(w, http.StatusBadRequest, "required", "Required: content")
+			return
+		}
+		reply, err := s.store.insertReply(fileId, parts[0], meta)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		writeJSON(w, reply)
+
+	default:
+		writeError(w, http.StatusNotFound, "notFound", r.URL.Path)
+	}
+}
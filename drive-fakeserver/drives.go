@@ -0,0 +1,190 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	drive "google.golang.org/api/drive/v2"
+)
+
+var errDriveNotFound = errors.New("shared drive not found")
+
+// corpus describes which files a listing covers. The zero value
+// is "My Drive" and anything shared with the user.
+type corpus struct {
+	// driveId restricts the listing to a single shared drive.
+	driveId string
+	// allDrives includes items from shared drives.
+	allDrives bool
+}
+
+func corpusFromRequest(r *http.Request) (corpus, error) {
+	q := r.URL.Query()
+	c := corpus{
+		driveId:   q.Get("driveId"),
+		allDrives: q.Get("includeItemsFromAllDrives") == "true",
+	}
+
+	switch corpora := q.Get("corpora"); {
+	case corpora == "drive" && c.driveId == "":
+		return c, errors.New("the driveId parameter is required for the drive corpus")
+	case c.driveId != "" && corpora != "drive":
+		return c, errors.New("the drive corpus is required with the driveId parameter")
+	case c.driveId != "" && !c.allDrives:
+		return c, errors.New("includeItemsFromAllDrives is required with the driveId parameter")
+	}
+	return c, nil
+}
+
+func (c corpus) covers(f *drive.File) bool {
+	if c.driveId != "" {
+		return f.DriveId == c.driveId
+	}
+	return f.DriveId == "" || c.allDrives
+}
+
+func supportsAllDrives(r *http.Request) bool {
+	return r.URL.Query().Get("supportsAllDrives") == "true"
+}
+
+// createDrive makes a shared drive whose root folder shares its id.
+func (s *store) createDrive(name string) (*drive.Drive, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.state.Drives == nil {
+		s.state.Drives = make(map[string]*drive.Drive)
+	}
+
+	s.state.LastId += 1
+	d := &drive.Drive{
+		Id:          fmt.Sprintf("0AFakeSharedDrive%08d", s.state.LastId),
+		Name:        name,
+		Kind:        "drive#drive",
+		CreatedDate: nowString(),
+		Capabilities: &drive.DriveCapabilities{
+			CanAddChildren:   true,
+			CanDeleteDrive:   true,
+			CanEdit:          true,
+			CanManageMembers: true,
+			CanTrashChildren: true,
+		},
+	}
+	s.state.Drives[d.Id] = d
+
+	root := &fileRecord{
+		File: &drive.File{
+			Id:           d.Id,
+			Title:        name,
+			MimeType:     folderMime,
+			DriveId:      d.Id,
+			TeamDriveId:  d.Id,
+			ModifiedDate: nowString(),
+			Labels:       &drive.FileLabels{},
+			Editable:     true,
+			Kind:         "drive#file",
+		},
+	}
+	s.state.Files[d.Id] = root
+	if err := s.recordLocked(root, false); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (s *store) drives() []*drive.Drive {
+	s.Lock()
+	defer s.Unlock()
+
+	var drives []*drive.Drive
+	for _, d := range s.state.Drives {
+		drives = append(drives, d)
+	}
+	sort.Slice(drives, func(i, j int) bool {
+		return drives[i].Id < drives[j].Id
+	})
+	return drives
+}
+
+func (s *store) getDrive(id string) (*drive.Drive, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	d, ok := s.state.Drives[id]
+	if !ok {
+		return nil, errDriveNotFound
+	}
+	return d, nil
+}
+
+func (s *store) isDriveRootLocked(id string) bool {
+	_, ok := s.state.Drives[id]
+	return ok
+}
+
+// inSharedDrive tells whether the file lives in a shared drive. The API
+// hides such files from clients that don't pass supportsAllDrives=true.
+func (s *store) inSharedDrive(id string) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	rec, err := s.lookupLocked(id)
+	return err == nil && rec.File.DriveId != ""
+}
+
+func (s *server) drives(w http.ResponseWriter, r *http.Request, parts []string) {
+	switch {
+	case len(parts) == 0 && r.Method == "GET":
+		drives := s.store.drives()
+		start, end, nextPageToken := pageBounds(r, len(drives))
+		writeJSON(w, &drive.DriveList{
+			Kind:          "drive#driveList",
+			Items:         drives[start:end],
+			NextPageToken: nextPageToken,
+		})
+
+	case len(parts) == 0 && r.Method == "POST":
+		if r.URL.Query().Get("requestId") == "" {
+			writeError(w, http.StatusBadRequest, "required", "Required parameter: requestId")
+			return
+		}
+		meta := new(drive.Drive)
+		if err := decodeJSON(r.Body, meta); err != nil {
+			writeError(w, http.StatusBadRequest, "parseError", err.Error())
+			return
+		}
+		d, err := s.store.createDrive(meta.Name)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		writeJSON(w, d)
+
+	case len(parts) == 1 && r.Method == "GET":
+		d, err := s.store.getDrive(parts[0])
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		writeJSON(w, d)
+
+	default:
+		writeError(w, http.StatusNotFound, "notFound", r.URL.Path)
+	}
+}
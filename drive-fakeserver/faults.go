@@ -0,0 +1,125 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type fault int
+
+const (
+	faultNone fault = iota
+	faultRateLimit
+	faultServerError
+	faultTruncate
+)
+
+// Faults describes the failures that the server injects. Each
+// XEvery knob makes every Nth matching request fail that way
+// and a value of 0 disables it. Only requests whose path starts
+// with PathPrefix are counted, so that for example only uploads
+// can be made to fail.
+type Faults struct {
+	RateLimitEvery   int    `json:"rateLimitEvery"`
+	ServerErrorEvery int    `json:"serverErrorEvery"`
+	TruncateEvery    int    `json:"truncateEvery"`
+	PathPrefix       string `json:"pathPrefix"`
+}
+
+type faultInjector struct {
+	sync.Mutex
+
+	faults Faults
+
+	requests  int
+	downloads int
+}
+
+func faultsFromEnv() Faults {
+	every := func(key string) int {
+		n, _ := strconv.Atoi(envGet(key))
+		return n
+	}
+
+	return Faults{
+		RateLimitEvery:   every(envFakeServerRateLimitEvery),
+		ServerErrorEvery: every(envFakeServerServerErrorEvery),
+		TruncateEvery:    every(envFakeServerTruncateEvery),
+		PathPrefix:       envGet(envFakeServerFaultPathPrefix),
+	}
+}
+
+func (fi *faultInjector) get() Faults {
+	fi.Lock()
+	defer fi.Unlock()
+
+	return fi.faults
+}
+
+// set replaces the current faults and resets the request counters.
+func (fi *faultInjector) set(faults Faults) {
+	fi.Lock()
+	defer fi.Unlock()
+
+	fi.faults = faults
+	fi.requests = 0
+	fi.downloads = 0
+}
+
+func (fi *faultInjector) matches(path string) bool {
+	return strings.HasPrefix(path, fi.faults.PathPrefix)
+}
+
+func nth(count, every int) bool {
+	return every > 0 && count%every == 0
+}
+
+// forRequest returns the fault to inject into the request for path.
+func (fi *faultInjector) forRequest(path string) fault {
+	fi.Lock()
+	defer fi.Unlock()
+
+	if !fi.matches(path) {
+		return faultNone
+	}
+
+	fi.requests += 1
+	switch {
+	case nth(fi.requests, fi.faults.RateLimitEvery):
+		return faultRateLimit
+	case nth(fi.requests, fi.faults.ServerErrorEvery):
+		return faultServerError
+	}
+	return faultNone
+}
+
+// forDownload reports whether the content being served for path should be truncated.
+func (fi *faultInjector) forDownload(path string) fault {
+	fi.Lock()
+	defer fi.Unlock()
+
+	if !fi.matches(path) {
+		return faultNone
+	}
+
+	fi.downloads += 1
+	if nth(fi.downloads, fi.faults.TruncateEvery) {
+		return faultTruncate
+	}
+	return faultNone
+}
@@ -0,0 +1,95 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// drive-fakeserver implements the subset of the Drive v2 REST API
+// that drive uses, backed by a local directory. Point drive at it by
+// setting DRIVE_API_BASE_URL to the address that it prints on startup.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+)
+
+const (
+	envFakeServerPort    = "DRIVE_FAKESERVER_PORT"
+	envFakeServerHost    = "DRIVE_FAKESERVER_HOST"
+	envFakeServerDataDir = "DRIVE_FAKESERVER_DATA_DIR"
+
+	envFakeServerRateLimitEvery   = "DRIVE_FAKESERVER_RATE_LIMIT_EVERY"
+	envFakeServerServerErrorEvery = "DRIVE_FAKESERVER_SERVER_ERROR_EVERY"
+	envFakeServerTruncateEvery    = "DRIVE_FAKESERVER_TRUNCATE_EVERY"
+	envFakeServerFaultPathPrefix  = "DRIVE_FAKESERVER_FAULT_PATH_PREFIX"
+)
+
+func envGet(varname string, placeholders ...string) string {
+	v := os.Getenv(varname)
+	if v == "" {
+		for _, placeholder := range placeholders {
+			if placeholder != "" {
+				v = placeholder
+				break
+			}
+		}
+	}
+
+	return v
+}
+
+func main() {
+	host := envGet(envFakeServerHost, "localhost")
+	// Port 0 lets the kernel pick a free port.
+	port := envGet(envFakeServerPort, "0")
+
+	dataDir := envGet(envFakeServerDataDir)
+	if dataDir == "" {
+		tmpDir, err := ioutil.TempDir("", "drive-fakeserver")
+		if err != nil {
+			errorPrint("%v\n", err)
+			os.Exit(1)
+		}
+		defer os.RemoveAll(tmpDir)
+		dataDir = tmpDir
+	}
+
+	ln, err := net.Listen("tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		errorPrint("%v\n", err)
+		os.Exit(1)
+	}
+
+	baseURL := fmt.Sprintf("http://%s", ln.Addr())
+	st, err := newStore(dataDir, baseURL)
+	if err != nil {
+		errorPrint("%v\n", err)
+		os.Exit(1)
+	}
+
+	// The first line of output is the address to reach us at.
+	fmt.Println(baseURL)
+
+	if err := http.Serve(ln, newServer(st, faultsFromEnv())); err != nil {
+		errorPrint("%v\n", err)
+		os.Exit(1)
+	}
+}
+
+func errorPrint(fmt_ string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "\033[31m")
+	fmt.Fprintf(os.Stderr, fmt_, args...)
+	fmt.Fprintf(os.Stderr, "\033[00m")
+}
@@ -0,0 +1,152 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	drive "google.golang.org/api/drive/v2"
+)
+
+var errPropertyNotFound = errors.New("property not found")
+
+// Properties are private to the app that set them unless made public.
+const propertyVisibilityPrivate = "PRIVATE"
+
+func sameProperty(prop *drive.Property, key, visibility string) bool {
+	return prop.Key == key && strings.EqualFold(prop.Visibility, visibility)
+}
+
+// insertProperty adds the property to the file or, if the file
+// has one with the same key and visibility, updates its value.
+func (s *store) insertProperty(fileId string, prop *drive.Property) (*drive.Property, error) {
+	if prop.Visibility == "" {
+		prop.Visibility = propertyVisibilityPrivate
+	}
+	prop.Kind = "drive#property"
+
+	_, err := s.update(fileId, func(rec *fileRecord) error {
+		for i, have := range rec.File.Properties {
+			if sameProperty(have, prop.Key, prop.Visibility) {
+				rec.File.Properties[i] = prop
+				return nil
+			}
+		}
+		rec.File.Properties = append(rec.File.Properties, prop)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return prop, nil
+}
+
+func (s *store) deleteProperty(fileId, key, visibility string) error {
+	if visibility == "" {
+		visibility = propertyVisibilityPrivate
+	}
+
+	_, err := s.update(fileId, func(rec *fileRecord) error {
+		for i, have := range rec.File.Properties {
+			if sameProperty(have, key, visibility) {
+				rec.File.Properties = append(rec.File.Properties[:i:i], rec.File.Properties[i+1:]...)
+				return nil
+			}
+		}
+		return errPropertyNotFound
+	})
+	return err
+}
+
+func (s *server) properties(w http.ResponseWriter, r *http.Request, fileId string, parts []string) {
+	switch {
+	case len(parts) == 0 && r.Method == "POST":
+		prop := new(drive.Property)
+		if err := decodeJSON(r.Body, prop); err != nil {
+			writeError(w, http.StatusBadRequest, "parseError", err.Error())
+			return
+		}
+		if prop.Key == "" {
+			writeError(w, http.StatusBadRequest, "required", "Required: key")
+			return
+		}
+		prop, err := s.store.insertProperty(fileId, prop)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		writeJSON(w, prop)
+
+	case len(parts) == 1 && r.Method == "DELETE":
+		if err := s.store.deleteProperty(fileId, parts[0], r.URL.Query().Get("visibility")); err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusNotFound, "notFound", r.URL.Path)
+	}
+}
+
+// parseHas parses the "{ key='k' and value='v' and visibility='PUBLIC' }"
+// that follows "properties has" in queries.
+func (p *parser) parseHas(field string) (predicate, error) {
+	if field != "properties" {
+		return nil, fmt.Errorf("unsupported collection %q", field)
+	}
+	if t := p.next(); t.kind != tokLBrace {
+		return nil, fmt.Errorf("expected '{' after 'has' got %q", t.value)
+	}
+
+	want := make(map[string]string)
+	for {
+		name := p.next()
+		if name.kind != tokWord {
+			return nil, fmt.Errorf("expected a property field got %q", name.value)
+		}
+		if t := p.next(); t.kind != tokOp || t.value != "=" {
+			return nil, fmt.Errorf("expected '=' after %q got %q", name.value, t.value)
+		}
+		value := p.next()
+		if value.kind != tokString {
+			return nil, fmt.Errorf("expected a value for %q got %q", name.value, value.value)
+		}
+		want[name.value] = value.value
+
+		if p.peek().kind == tokRBrace {
+			p.next()
+			break
+		}
+		if !p.keyword("and") {
+			return nil, fmt.Errorf("expected 'and' or '}' got %q", p.peek().value)
+		}
+	}
+
+	return func(f *fileRecord) bool {
+		for _, prop := range f.File.Properties {
+			if prop.Key != want["key"] || prop.Value != want["value"] {
+				continue
+			}
+			if visibility, ok := want["visibility"]; !ok || strings.EqualFold(prop.Visibility, visibility) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
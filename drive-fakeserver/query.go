@@ -0,0 +1,345 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	drive "google.golang.org/api/drive/v2"
+)
+
+// The Drive v2 search grammar understood here is the subset that
+// drive itself emits, for example:
+//   'root' in parents and trashed=false and mimeType = 'application/vnd.google-apps.folder'
+//   "id" in parents and title = "a.txt" and trashed=false
+//   (title contains "foo" and trashed=false) or (not "me@x.com" in owners)
+//   properties has { key="project" and value="X" and visibility="PUBLIC" }
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokLParen
+	tokRParen
+	tokLBrace
+	tokRBrace
+	tokString
+	tokWord
+	tokOp
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+}
+
+func tokenize(q string) ([]token, error) {
+	var tokens []token
+	runes := []rune(q)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i += 1
+
+		case r == '(':
+			tokens = append(tokens, token{kind: tokLParen, value: "("})
+			i += 1
+
+		case r == ')':
+			tokens = append(tokens, token{kind: tokRParen, value: ")"})
+			i += 1
+
+		case r == '{':
+			tokens = append(tokens, token{kind: tokLBrace, value: "{"})
+			i += 1
+
+		case r == '}':
+			tokens = append(tokens, token{kind: tokRBrace, value: "}"})
+			i += 1
+
+		case r == '\'' || r == '"':
+			quote := r
+			var buf []rune
+			i += 1
+			for ; i < len(runes) && runes[i] != quote; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i += 1
+				}
+				buf = append(buf, runes[i])
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("unterminated string in %q", q)
+			}
+			tokens = append(tokens, token{kind: tokString, value: string(buf)})
+			i += 1
+
+		case r == '=' || r == '!' || r == '<' || r == '>':
+			op := string(r)
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				op += "="
+				i += 1
+			}
+			if op == "!" {
+				return nil, fmt.Errorf("dangling '!' in %q", q)
+			}
+			tokens = append(tokens, token{kind: tokOp, value: op})
+			i += 1
+
+		default:
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || strings.ContainsRune("_.-:", runes[i])) {
+				i += 1
+			}
+			if start == i {
+				return nil, fmt.Errorf("unexpected character %q in %q", r, q)
+			}
+			tokens = append(tokens, token{kind: tokWord, value: string(runes[start:i])})
+		}
+	}
+
+	return append(tokens, token{kind: tokEOF}), nil
+}
+
+// predicate reports whether a file satisfies a query.
+type predicate func(f *fileRecord) bool
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func parseQuery(q string) (predicate, error) {
+	if strings.TrimSpace(q) == "" {
+		return func(*fileRecord) bool { return true }, nil
+	}
+
+	tokens, err := tokenize(q)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	pred, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q in query %q", p.peek().value, q)
+	}
+	return pred, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos += 1
+	}
+	return t
+}
+
+func (p *parser) keyword(kw string) bool {
+	t := p.peek()
+	if t.kind == tokWord && strings.EqualFold(t.value, kw) {
+		p.pos += 1
+		return true
+	}
+	return false
+}
+
+func (p *parser) parseOr() (predicate, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l, r := left, right
+		left = func(f *fileRecord) bool { return l(f) || r(f) }
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (predicate, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("and") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l, r := left, right
+		left = func(f *fileRecord) bool { return l(f) && r(f) }
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (predicate, error) {
+	if p.keyword("not") {
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(f *fileRecord) bool { return !inner(f) }, nil
+	}
+
+	if p.peek().kind == tokLParen {
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != tokRParen {
+			return nil, fmt.Errorf("expected ')' got %q", t.value)
+		}
+		return inner, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (predicate, error) {
+	left := p.next()
+	if left.kind != tokString && left.kind != tokWord {
+		return nil, fmt.Errorf("expected an operand got %q", left.value)
+	}
+
+	if left.kind == tokString && p.keyword("in") {
+		field := p.next()
+		if field.kind != tokWord {
+			return nil, fmt.Errorf("expected a field after 'in' got %q", field.value)
+		}
+		return membership(left.value, field.value)
+	}
+
+	if left.kind == tokWord && p.keyword("has") {
+		return p.parseHas(left.value)
+	}
+
+	var op string
+	switch t := p.next(); {
+	case t.kind == tokOp:
+		op = t.value
+	case t.kind == tokWord && strings.EqualFold(t.value, "contains"):
+		op = "contains"
+	default:
+		return nil, fmt.Errorf("expected an operator after %q got %q", left.value, t.value)
+	}
+
+	right := p.next()
+	if right.kind != tokString && right.kind != tokWord {
+		return nil, fmt.Errorf("expected a value after %q got %q", op, right.value)
+	}
+
+	return comparison(left.value, op, right.value)
+}
+
+func membership(value, field string) (predicate, error) {
+	switch field {
+	case "parents":
+		return func(f *fileRecord) bool {
+			for _, p := range f.File.Parents {
+				if p != nil && (p.Id == value || (value == rootAlias && p.IsRoot)) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	case "owners", "writers", "readers":
+		return func(f *fileRecord) bool {
+			for _, owner := range f.File.Owners {
+				if owner != nil && owner.EmailAddress == value {
+					return true
+				}
+			}
+			return false
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported collection %q", field)
+}
+
+func fieldValue(f *drive.File, field string) (string, bool) {
+	labels := f.Labels
+	if labels == nil {
+		labels = &drive.FileLabels{}
+	}
+
+	switch field {
+	case "title":
+		return f.Title, true
+	case "mimeType":
+		return f.MimeType, true
+	case "fullText":
+		return f.Title + " " + f.Description, true
+	case "modifiedDate":
+		return f.ModifiedDate, true
+	case "trashed":
+		return fmt.Sprintf("%v", labels.Trashed), true
+	case "starred":
+		return fmt.Sprintf("%v", labels.Starred), true
+	case "hidden":
+		return fmt.Sprintf("%v", labels.Hidden), true
+	case "sharedWithMe":
+		return fmt.Sprintf("%v", f.SharedWithMeDate != ""), true
+	}
+
+	return "", false
+}
+
+func comparison(field, op, value string) (predicate, error) {
+	if _, ok := fieldValue(&drive.File{}, field); !ok {
+		return nil, fmt.Errorf("unsupported field %q", field)
+	}
+
+	var cmp func(have string) bool
+	switch op {
+	case "=":
+		cmp = func(have string) bool { return have == value }
+	case "!=":
+		cmp = func(have string) bool { return have != value }
+	case "contains":
+		cmp = func(have string) bool { return strings.Contains(have, value) }
+	case "<":
+		cmp = func(have string) bool { return have < value }
+	case "<=":
+		cmp = func(have string) bool { return have <= value }
+	case ">":
+		cmp = func(have string) bool { return have > value }
+	case ">=":
+		cmp = func(have string) bool { return have >= value }
+	default:
+		return nil, fmt.Errorf("unsupported operator %q", op)
+	}
+
+	return func(f *fileRecord) bool {
+		have, _ := fieldValue(f.File, field)
+		return cmp(have)
+	}, nil
+}
@@ -0,0 +1,217 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	drive "google.golang.org/api/drive/v2"
+)
+
+var errRevisionNotFound = errors.New("revision not found")
+
+func (s *store) revisionBlobPath(fileId, revisionId string) string {
+	return filepath.Join(s.dir, "blobs", fileId+".revision-"+revisionId)
+}
+
+// recordRevisionLocked keeps a copy of the content just written
+// to the file as its newest revision.
+func (s *store) recordRevisionLocked(rec *fileRecord, pinned bool) error {
+	if s.state.Revisions == nil {
+		s.state.Revisions = make(map[string][]*drive.Revision)
+	}
+
+	fileId := rec.File.Id
+	revisions := s.state.Revisions[fileId]
+	rev := &drive.Revision{
+		Id:                    strconv.Itoa(len(revisions) + 1),
+		Kind:                  "drive#revision",
+		MimeType:              rec.File.MimeType,
+		FileSize:              rec.File.FileSize,
+		Md5Checksum:           rec.File.Md5Checksum,
+		ModifiedDate:          nowString(),
+		Pinned:                pinned,
+		LastModifyingUserName: "Fake Owner",
+		LastModifyingUser:     &drive.User{EmailAddress: fakeOwner, DisplayName: "Fake Owner"},
+	}
+	if err := copyFile(s.blobPath(fileId), s.revisionBlobPath(fileId, rev.Id)); err != nil {
+		return err
+	}
+
+	s.state.Revisions[fileId] = append(revisions, rev)
+	return nil
+}
+
+// deleteRevisionsLocked drops the revisions of a file being deleted.
+func (s *store) deleteRevisionsLocked(fileId string) {
+	for _, rev := range s.state.Revisions[fileId] {
+		os.Remove(s.revisionBlobPath(fileId, rev.Id))
+	}
+	delete(s.state.Revisions, fileId)
+}
+
+func copyFile(srcPath, destPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dest, err := os.Create(destPath)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dest, src)
+	if cErr := dest.Close(); err == nil {
+		err = cErr
+	}
+	return err
+}
+
+// presentRevisionLocked returns a copy of the revision as the API serves it.
+func (s *store) presentRevisionLocked(fileId string, rev *drive.Revision) *drive.Revision {
+	r := *rev
+	r.DownloadUrl = fmt.Sprintf("%s/drive/v2/files/%s/revisions/%s?alt=media", s.baseURL, fileId, rev.Id)
+	return &r
+}
+
+func (s *store) revisions(fileId string) ([]*drive.Revision, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	rec, err := s.lookupLocked(fileId)
+	if err != nil {
+		return nil, err
+	}
+
+	var revisions []*drive.Revision
+	for _, rev := range s.state.Revisions[rec.File.Id] {
+		revisions = append(revisions, s.presentRevisionLocked(rec.File.Id, rev))
+	}
+	return revisions, nil
+}
+
+func (s *store) lookupRevisionLocked(fileId, revisionId string) (string, *drive.Revision, error) {
+	rec, err := s.lookupLocked(fileId)
+	if err != nil {
+		return "", nil, err
+	}
+
+	for _, rev := range s.state.Revisions[rec.File.Id] {
+		if rev.Id == revisionId {
+			return rec.File.Id, rev, nil
+		}
+	}
+	return "", nil, errRevisionNotFound
+}
+
+func (s *store) revision(fileId, revisionId string) (*drive.Revision, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	fileId, rev, err := s.lookupRevisionLocked(fileId, revisionId)
+	if err != nil {
+		return nil, err
+	}
+	return s.presentRevisionLocked(fileId, rev), nil
+}
+
+func (s *store) pinRevision(fileId, revisionId string, pinned bool) (*drive.Revision, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	fileId, rev, err := s.lookupRevisionLocked(fileId, revisionId)
+	if err != nil {
+		return nil, err
+	}
+
+	rev.Pinned = pinned
+	if err := s.saveLocked(); err != nil {
+		return nil, err
+	}
+	return s.presentRevisionLocked(fileId, rev), nil
+}
+
+func (s *store) openRevision(fileId, revisionId string) (io.ReadCloser, error) {
+	s.Lock()
+	fileId, rev, err := s.lookupRevisionLocked(fileId, revisionId)
+	s.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(s.revisionBlobPath(fileId, rev.Id))
+}
+
+func (s *server) revisions(w http.ResponseWriter, r *http.Request, fileId string, parts []string) {
+	switch {
+	case len(parts) == 0 && r.Method == "GET":
+		revisions, err := s.store.revisions(fileId)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		start, end, nextPageToken := pageBounds(r, len(revisions))
+		writeJSON(w, &drive.RevisionList{
+			Kind:          "drive#revisionList",
+			Items:         revisions[start:end],
+			NextPageToken: nextPageToken,
+		})
+
+	case len(parts) == 1 && r.Method == "GET" && r.URL.Query().Get("alt") == "media":
+		body, err := s.store.openRevision(fileId, parts[0])
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		defer body.Close()
+		io.Copy(w, &countingReader{r: body, count: &s.downloadedBytes})
+
+	case len(parts) == 1 && r.Method == "GET":
+		rev, err := s.store.revision(fileId, parts[0])
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		writeJSON(w, rev)
+
+	case len(parts) == 1 && (r.Method == "PATCH" || r.Method == "PUT"):
+		// Only pinning is supported, a missing pinned leaves it as is.
+		var meta struct {
+			Pinned *bool `json:"pinned"`
+		}
+		if err := decodeJSON(r.Body, &meta); err != nil {
+			writeError(w, http.StatusBadRequest, "parseError", err.Error())
+			return
+		}
+		rev, err := s.store.revision(fileId, parts[0])
+		if err == nil && meta.Pinned != nil {
+			rev, err = s.store.pinRevision(fileId, parts[0], *meta.Pinned)
+		}
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		writeJSON(w, rev)
+
+	default:
+		writeError(w, http.StatusNotFound, "notFound", r.URL.Path)
+	}
+}
@@ -0,0 +1,855 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	drive "google.golang.org/api/drive/v2"
+)
+
+const (
+	apiPrefix    = "/drive/v2/"
+	uploadPrefix = "/upload/drive/v2/files"
+	faultsPath   = "/fakeserver/faults"
+	statsPath    = "/fakeserver/stats"
+
+	googleAppsMimePrefix = "application/vnd.google-apps."
+
+	defaultMaxResults = 100
+)
+
+type server struct {
+	store  *store
+	faults *faultInjector
+
+	// mediaBytes counts the bytes of content uploaded.
+	mediaBytes int64
+	// downloadedBytes counts the bytes of content downloaded.
+	downloadedBytes int64
+}
+
+// Stats reports how much content the server has transferred so far.
+type Stats struct {
+	MediaBytesReceived int64 `json:"mediaBytesReceived"`
+	MediaBytesSent     int64 `json:"mediaBytesSent"`
+}
+
+type countingReader struct {
+	r     io.Reader
+	count *int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	atomic.AddInt64(cr.count, int64(n))
+	return n, err
+}
+
+func (s *server) countMedia(r io.Reader) io.Reader {
+	return &countingReader{r: r, count: &s.mediaBytes}
+}
+
+func newServer(st *store, faults Faults) *server {
+	return &server{
+		store:  st,
+		faults: &faultInjector{faults: faults},
+	}
+}
+
+type apiError struct {
+	Error *apiErrorBody `json:"error"`
+}
+
+type apiErrorBody struct {
+	Errors  []*apiErrorItem `json:"errors"`
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+}
+
+type apiErrorItem struct {
+	Domain  string `json:"domain"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+// writeError replies in the same shape as the Drive API so that
+// the client surfaces it as a *googleapi.Error.
+func writeError(w http.ResponseWriter, code int, reason, message string) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(&apiError{
+		Error: &apiErrorBody{
+			Errors:  []*apiErrorItem{{Domain: "global", Reason: reason, Message: message}},
+			Code:    code,
+			Message: message,
+		},
+	})
+}
+
+func writeStoreError(w http.ResponseWriter, err error) {
+	switch err {
+	case errNotFound, errPermNotFound, errSessionNotFound, errDriveNotFound,
+		errRevisionNotFound, errCommentNotFound, errPropertyNotFound:
+		writeError(w, http.StatusNotFound, "notFound", err.Error())
+	case errParentNotFound, errChunkGap:
+		writeError(w, http.StatusBadRequest, "invalidParent", err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, "internalError", err.Error())
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(v)
+}
+
+func decodeJSON(r io.Reader, v interface{}) error {
+	blob, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if len(strings.TrimSpace(string(blob))) < 1 {
+		return nil
+	}
+	return json.Unmarshal(blob, v)
+}
+
+func queryParams(r *http.Request) map[string]string {
+	params := make(map[string]string)
+	for key, values := range r.URL.Query() {
+		if len(values) >= 1 {
+			params[key] = values[0]
+		}
+	}
+	return params
+}
+
+// splitPath breaks up /drive/v2/files/id/permissions into
+// ["files", "id", "permissions"].
+func splitPath(p, prefix string) []string {
+	var parts []string
+	for _, part := range strings.Split(strings.TrimPrefix(p, prefix), "/") {
+		if part == "" {
+			continue
+		}
+		if unescaped, err := url.PathUnescape(part); err == nil {
+			part = unescaped
+		}
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/token":
+		s.token(w, r)
+		return
+	case r.URL.Path == "/auth":
+		fmt.Fprintf(w, "fake-authorization-code\n")
+		return
+	case r.URL.Path == faultsPath:
+		s.handleFaults(w, r)
+		return
+	case r.URL.Path == statsPath:
+		writeJSON(w, &Stats{
+			MediaBytesReceived: atomic.LoadInt64(&s.mediaBytes),
+			MediaBytesSent:     atomic.LoadInt64(&s.downloadedBytes),
+		})
+		return
+	}
+
+	switch s.faults.forRequest(r.URL.Path) {
+	case faultRateLimit:
+		writeError(w, http.StatusForbidden, "userRateLimitExceeded", "User Rate Limit Exceeded")
+		return
+	case faultServerError:
+		writeError(w, http.StatusInternalServerError, "backendError", "Backend Error")
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, uploadPrefix):
+		s.upload(w, r, splitPath(r.URL.Path, uploadPrefix))
+	case strings.HasPrefix(r.URL.Path, apiPrefix):
+		s.api(w, r, splitPath(r.URL.Path, apiPrefix))
+	default:
+		writeError(w, http.StatusNotFound, "notFound", fmt.Sprintf("no such path %q", r.URL.Path))
+	}
+}
+
+func (s *server) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	token := map[string]interface{}{
+		"access_token": "fake-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+	}
+	if r.Form.Get("grant_type") == "authorization_code" {
+		token["refresh_token"] = "fake-refresh-token"
+	}
+	writeJSON(w, token)
+}
+
+func (s *server) handleFaults(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		writeJSON(w, s.faults.get())
+	case "PUT", "POST":
+		var faults Faults
+		if err := decodeJSON(r.Body, &faults); err != nil {
+			writeError(w, http.StatusBadRequest, "parseError", err.Error())
+			return
+		}
+		s.faults.set(faults)
+		writeJSON(w, faults)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "methodNotAllowed", r.Method)
+	}
+}
+
+func (s *server) api(w http.ResponseWriter, r *http.Request, parts []string) {
+	if len(parts) < 1 {
+		writeError(w, http.StatusNotFound, "notFound", r.URL.Path)
+		return
+	}
+
+	switch resource := parts[0]; {
+	case resource == "about" && r.Method == "GET":
+		writeJSON(w, s.store.about())
+	case resource == "changes" && r.Method == "GET":
+		s.changes(w, r, parts[1:])
+	case resource == "permissionIds" && len(parts) == 2 && r.Method == "GET":
+		writeJSON(w, &drive.PermissionId{Id: permissionIdForEmail(parts[1]), Kind: "drive#permissionId"})
+	case resource == "files":
+		s.files(w, r, parts[1:])
+	case resource == "drives":
+		s.drives(w, r, parts[1:])
+	default:
+		writeError(w, http.StatusNotFound, "notFound", r.URL.Path)
+	}
+}
+
+func (s *server) files(w http.ResponseWriter, r *http.Request, parts []string) {
+	if len(parts) < 1 {
+		switch r.Method {
+		case "GET":
+			s.list(w, r)
+		case "POST":
+			s.insertMetadata(w, r)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "methodNotAllowed", r.Method)
+		}
+		return
+	}
+
+	if len(parts) == 1 && parts[0] == "trash" && r.Method == "DELETE" {
+		if err := s.store.emptyTrash(); err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	id := parts[0]
+	if !supportsAllDrives(r) && s.store.inSharedDrive(id) {
+		writeStoreError(w, errNotFound)
+		return
+	}
+
+	if len(parts) == 1 {
+		switch r.Method {
+		case "GET":
+			if r.URL.Query().Get("alt") == "media" {
+				s.download(w, r, id)
+				return
+			}
+			f, err := s.store.get(id)
+			s.respondFile(w, f, err)
+		case "PUT", "PATCH":
+			s.updateMetadata(w, r, id)
+		case "DELETE":
+			if err := s.store.delete(id); err != nil {
+				writeStoreError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "methodNotAllowed", r.Method)
+		}
+		return
+	}
+
+	switch sub := parts[1]; {
+	case sub == "trash" && r.Method == "POST":
+		f, err := s.store.update(id, setTrashed(true))
+		s.respondFile(w, f, err)
+	case sub == "untrash" && r.Method == "POST":
+		f, err := s.store.update(id, setTrashed(false))
+		s.respondFile(w, f, err)
+	case sub == "touch" && r.Method == "POST":
+		f, err := s.store.update(id, func(rec *fileRecord) error {
+			rec.File.ModifiedDate = nowString()
+			return nil
+		})
+		s.respondFile(w, f, err)
+	case sub == "copy" && r.Method == "POST":
+		meta := new(drive.File)
+		if err := decodeJSON(r.Body, meta); err != nil {
+			writeError(w, http.StatusBadRequest, "parseError", err.Error())
+			return
+		}
+		f, err := s.store.copy(id, meta)
+		s.respondFile(w, f, err)
+	case sub == "parents":
+		s.parents(w, r, id, parts[2:])
+	case sub == "permissions":
+		s.permissions(w, r, id, parts[2:])
+	case sub == "revisions":
+		s.revisions(w, r, id, parts[2:])
+	case sub == "comments":
+		s.comments(w, r, id, parts[2:])
+	case sub == "properties":
+		s.properties(w, r, id, parts[2:])
+	default:
+		writeError(w, http.StatusNotFound, "notFound", r.URL.Path)
+	}
+}
+
+func setTrashed(trashed bool) func(*fileRecord) error {
+	return func(rec *fileRecord) error {
+		if rec.File.Labels == nil {
+			rec.File.Labels = &drive.FileLabels{}
+		}
+		rec.File.Labels.Trashed = trashed
+		rec.File.ExplicitlyTrashed = trashed
+		return nil
+	}
+}
+
+func (s *server) respondFile(w http.ResponseWriter, f *drive.File, err error) {
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, f)
+}
+
+// pageBounds resolves the offset encoded in the pageToken
+// and the end of the page for a listing of n items.
+func pageBounds(r *http.Request, n int) (start, end int, nextPageToken string) {
+	q := r.URL.Query()
+
+	start, _ = strconv.Atoi(q.Get("pageToken"))
+	if start < 0 || start > n {
+		start = n
+	}
+
+	maxResults, _ := strconv.Atoi(q.Get("maxResults"))
+	if maxResults < 1 {
+		maxResults = defaultMaxResults
+	}
+
+	end = start + maxResults
+	if end >= n {
+		end = n
+	} else {
+		nextPageToken = strconv.Itoa(end)
+	}
+	return
+}
+
+func (s *server) list(w http.ResponseWriter, r *http.Request) {
+	pred, err := parseQuery(r.URL.Query().Get("q"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", fmt.Sprintf("Invalid query: %v", err))
+		return
+	}
+
+	c, err := corpusFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+
+	files := s.store.list(pred, c)
+	start, end, nextPageToken := pageBounds(r, len(files))
+
+	writeJSON(w, &drive.FileList{
+		Kind:          "drive#fileList",
+		Items:         files[start:end],
+		NextPageToken: nextPageToken,
+	})
+}
+
+func (s *server) changes(w http.ResponseWriter, r *http.Request, parts []string) {
+	if len(parts) == 1 {
+		changeId, _ := strconv.ParseInt(parts[0], 10, 64)
+		for _, change := range s.store.changes(changeId) {
+			if change.Id == changeId {
+				writeJSON(w, change)
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, "notFound", fmt.Sprintf("change %q not found", parts[0]))
+		return
+	}
+
+	c := corpus{
+		driveId:   r.URL.Query().Get("driveId"),
+		allDrives: r.URL.Query().Get("includeItemsFromAllDrives") == "true",
+	}
+
+	startChangeId, _ := strconv.ParseInt(r.URL.Query().Get("startChangeId"), 10, 64)
+	var changes []*drive.Change
+	for _, change := range s.store.changes(startChangeId) {
+		if change.File == nil || c.covers(change.File) {
+			changes = append(changes, change)
+		}
+	}
+	start, end, nextPageToken := pageBounds(r, len(changes))
+
+	about := s.store.about()
+	writeJSON(w, &drive.ChangeList{
+		Kind:            "drive#changeList",
+		Items:           changes[start:end],
+		LargestChangeId: about.LargestChangeId,
+		NextPageToken:   nextPageToken,
+	})
+}
+
+func (s *server) insertMetadata(w http.ResponseWriter, r *http.Request) {
+	meta := new(drive.File)
+	if err := decodeJSON(r.Body, meta); err != nil {
+		writeError(w, http.StatusBadRequest, "parseError", err.Error())
+		return
+	}
+	f, err := s.store.upsert("", meta, queryParams(r), nil, "")
+	s.respondFile(w, f, err)
+}
+
+func (s *server) updateMetadata(w http.ResponseWriter, r *http.Request, id string) {
+	meta := new(drive.File)
+	if err := decodeJSON(r.Body, meta); err != nil {
+		writeError(w, http.StatusBadRequest, "parseError", err.Error())
+		return
+	}
+
+	params := queryParams(r)
+	if err := s.reparent(id, params); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	f, err := s.store.upsert(id, meta, params, nil, "")
+	s.respondFile(w, f, err)
+}
+
+// reparent handles the addParents and removeParents parameters of updates.
+func (s *server) reparent(id string, params map[string]string) error {
+	if params["addParents"] == "" && params["removeParents"] == "" {
+		return nil
+	}
+
+	_, err := s.store.update(id, func(rec *fileRecord) error {
+		for _, parentId := range strings.Split(params["removeParents"], ",") {
+			removeParent(rec, resolveAlias(parentId))
+		}
+		for _, parentId := range strings.Split(params["addParents"], ",") {
+			if parentId != "" {
+				addParent(rec, resolveAlias(parentId))
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+func addParent(rec *fileRecord, parentId string) {
+	for _, p := range rec.File.Parents {
+		if p.Id == parentId {
+			return
+		}
+	}
+	rec.File.Parents = append(rec.File.Parents, &drive.ParentReference{Id: parentId, IsRoot: parentId == rootId})
+}
+
+func removeParent(rec *fileRecord, parentId string) {
+	var kept []*drive.ParentReference
+	for _, p := range rec.File.Parents {
+		if p.Id != parentId {
+			kept = append(kept, p)
+		}
+	}
+	rec.File.Parents = kept
+}
+
+func (s *server) parents(w http.ResponseWriter, r *http.Request, id string, parts []string) {
+	switch {
+	case len(parts) == 0 && r.Method == "GET":
+		f, err := s.store.get(id)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		writeJSON(w, &drive.ParentList{Kind: "drive#parentList", Items: f.Parents})
+
+	case len(parts) == 0 && r.Method == "POST":
+		parent := new(drive.ParentReference)
+		if err := decodeJSON(r.Body, parent); err != nil {
+			writeError(w, http.StatusBadRequest, "parseError", err.Error())
+			return
+		}
+
+		parentId := resolveAlias(parent.Id)
+		if _, err := s.store.get(parentId); err != nil {
+			writeStoreError(w, errParentNotFound)
+			return
+		}
+
+		_, err := s.store.update(id, func(rec *fileRecord) error {
+			addParent(rec, parentId)
+			return nil
+		})
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		writeJSON(w, &drive.ParentReference{Id: parentId, IsRoot: parentId == rootId, Kind: "drive#parentReference"})
+
+	case len(parts) == 1 && r.Method == "DELETE":
+		_, err := s.store.update(id, func(rec *fileRecord) error {
+			removeParent(rec, resolveAlias(parts[0]))
+			return nil
+		})
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "methodNotAllowed", r.Method)
+	}
+}
+
+func (s *server) permissions(w http.ResponseWriter, r *http.Request, id string, parts []string) {
+	switch {
+	case len(parts) == 0 && r.Method == "GET":
+		perms, err := s.store.permissions(id)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		writeJSON(w, &drive.PermissionList{Kind: "drive#permissionList", Items: perms})
+
+	case len(parts) == 0 && r.Method == "POST":
+		perm := new(drive.Permission)
+		if err := decodeJSON(r.Body, perm); err != nil {
+			writeError(w, http.StatusBadRequest, "parseError", err.Error())
+			return
+		}
+
+		perm, err := s.store.insertPermission(id, perm)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		writeJSON(w, perm)
+
+	case len(parts) == 1 && r.Method == "DELETE":
+		if err := s.store.deletePermission(id, parts[0]); err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "methodNotAllowed", r.Method)
+	}
+}
+
+func (s *server) download(w http.ResponseWriter, r *http.Request, id string) {
+	f, err := s.store.get(id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	if strings.HasPrefix(f.MimeType, googleAppsMimePrefix) {
+		writeError(w, http.StatusForbidden, "fileNotDownloadable", "Only files with binary content can be downloaded. Use Export with Google Docs files.")
+		return
+	}
+
+	start, end, ranged, err := parseRange(r.Header.Get("Range"), f.FileSize)
+	if err != nil {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", f.FileSize))
+		writeError(w, http.StatusRequestedRangeNotSatisfiable, "requestedRangeNotSatisfiable", err.Error())
+		return
+	}
+
+	body, err := s.store.open(id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	defer body.Close()
+
+	if _, err := io.CopyN(ioutil.Discard, body, start); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	size := end - start
+	w.Header().Set("Content-Type", f.MimeType)
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	if ranged {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end-1, f.FileSize))
+		w.WriteHeader(http.StatusPartialContent)
+	}
+
+	if s.faults.forDownload(r.URL.Path) == faultTruncate {
+		// Advertising the full length but sending only half of the content
+		// makes the server drop the connection, just like a flaky network.
+		size /= 2
+	}
+
+	// Count the content as it is read rather than once it has all been sent,
+	// otherwise a client could query the stats before they are updated.
+	io.CopyN(w, &countingReader{r: body, count: &s.downloadedBytes}, size)
+}
+
+// parseRange parses a Range header of the form "bytes=start-" or
+// "bytes=start-end" and returns the half open interval it covers.
+// An empty header covers all of the content.
+func parseRange(rangeHeader string, size int64) (start, end int64, ranged bool, err error) {
+	if rangeHeader == "" {
+		return 0, size, false, nil
+	}
+
+	spec := strings.TrimPrefix(rangeHeader, "bytes=")
+	dash := strings.Index(spec, "-")
+	if dash < 1 || strings.Contains(spec, ",") {
+		return 0, 0, false, fmt.Errorf("unsupported Range %q", rangeHeader)
+	}
+
+	if start, err = strconv.ParseInt(spec[:dash], 10, 64); err != nil {
+		return 0, 0, false, err
+	}
+
+	end = size
+	if last := spec[dash+1:]; last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil {
+			return 0, 0, false, err
+		}
+		end += 1
+		if end > size {
+			end = size
+		}
+	}
+
+	if start >= size || start >= end {
+		return 0, 0, false, fmt.Errorf("range %q is not satisfiable for size %d", rangeHeader, size)
+	}
+	return start, end, true, nil
+}
+
+// upload handles the three upload types supported by the Drive API:
+// plain media, multipart/related and resumable sessions.
+func (s *server) upload(w http.ResponseWriter, r *http.Request, parts []string) {
+	var fileId string
+	if len(parts) >= 1 {
+		fileId = parts[0]
+	}
+
+	if fileId != "" && !supportsAllDrives(r) && s.store.inSharedDrive(fileId) {
+		writeStoreError(w, errNotFound)
+		return
+	}
+
+	params := queryParams(r)
+	switch uploadType := params["uploadType"]; uploadType {
+	case "media":
+		f, err := s.store.upsert(fileId, nil, params, s.countMedia(r.Body), r.Header.Get("Content-Type"))
+		s.respondFile(w, f, err)
+
+	case "multipart":
+		s.uploadMultipart(w, r, fileId, params)
+
+	case "resumable":
+		if sessionId := params["upload_id"]; sessionId != "" {
+			s.uploadChunk(w, r, sessionId)
+			return
+		}
+
+		meta := new(drive.File)
+		if err := decodeJSON(r.Body, meta); err != nil {
+			writeError(w, http.StatusBadRequest, "parseError", err.Error())
+			return
+		}
+		if fileId != "" {
+			if err := s.reparent(fileId, params); err != nil {
+				writeStoreError(w, err)
+				return
+			}
+		}
+
+		size := int64(-1)
+		if contentLength := r.Header.Get("X-Upload-Content-Length"); contentLength != "" {
+			var err error
+			if size, err = strconv.ParseInt(contentLength, 10, 64); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid", err.Error())
+				return
+			}
+		}
+
+		sessionId, err := s.store.newSession(fileId, meta, params, size)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+
+		location := fmt.Sprintf("%s%s?uploadType=resumable&upload_id=%s", s.store.baseURL, uploadPrefix, url.QueryEscape(sessionId))
+		w.Header().Set("Location", location)
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		writeError(w, http.StatusBadRequest, "invalid", fmt.Sprintf("unsupported uploadType %q", uploadType))
+	}
+}
+
+func (s *server) uploadMultipart(w http.ResponseWriter, r *http.Request, fileId string, params map[string]string) {
+	_, mediaParams, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "parseError", err.Error())
+		return
+	}
+
+	mr := multipart.NewReader(r.Body, mediaParams["boundary"])
+
+	metaPart, err := mr.NextPart()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "parseError", err.Error())
+		return
+	}
+
+	meta := new(drive.File)
+	if err := decodeJSON(metaPart, meta); err != nil {
+		writeError(w, http.StatusBadRequest, "parseError", err.Error())
+		return
+	}
+
+	mediaPart, err := mr.NextPart()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "parseError", err.Error())
+		return
+	}
+
+	if fileId != "" {
+		if err := s.reparent(fileId, params); err != nil {
+			writeStoreError(w, err)
+			return
+		}
+	}
+
+	f, err := s.store.upsert(fileId, meta, params, s.countMedia(mediaPart), mediaPart.Header.Get("Content-Type"))
+	s.respondFile(w, f, err)
+}
+
+// parseContentRange parses the Content-Range of resumable chunks, which is one of:
+//
+//	bytes start-end/*     more chunks to come
+//	bytes start-end/total chunk of content whose size is total
+//	bytes */total         no content, just querying the session
+//
+// start is -1 if there is no content and total is -1 if it is unknown.
+func parseContentRange(contentRange string) (start, total int64, err error) {
+	spec := strings.TrimPrefix(contentRange, "bytes ")
+	slash := strings.Index(spec, "/")
+	if slash < 0 {
+		return 0, 0, fmt.Errorf("malformed Content-Range %q", contentRange)
+	}
+
+	rangePart, totalPart := spec[:slash], spec[slash+1:]
+
+	total = -1
+	if totalPart != "*" {
+		if total, err = strconv.ParseInt(totalPart, 10, 64); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if rangePart == "*" {
+		return -1, total, nil
+	}
+
+	dash := strings.Index(rangePart, "-")
+	if dash < 0 {
+		return 0, 0, fmt.Errorf("malformed Content-Range %q", contentRange)
+	}
+
+	start, err = strconv.ParseInt(rangePart[:dash], 10, 64)
+	return start, total, err
+}
+
+func (s *server) uploadChunk(w http.ResponseWriter, r *http.Request, sessionId string) {
+	start, total, err := parseContentRange(r.Header.Get("Content-Range"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+
+	var chunk io.Reader
+	if start >= 0 {
+		chunk = s.countMedia(r.Body)
+	}
+
+	received, complete, err := s.store.appendChunk(sessionId, start, total, chunk)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	if !complete {
+		if received > 0 {
+			w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", received-1))
+		}
+
+		// Unless the client asks us to signal an incomplete upload via
+		// a header, use 308 just like Google's upload servers do.
+		if r.Header.Get("X-GUploader-No-308") != "yes" {
+			w.WriteHeader(http.StatusPermanentRedirect)
+			return
+		}
+		w.Header().Set("X-Http-Status-Code-Override", "308")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	f, err := s.store.finishSession(sessionId, r.Header.Get("Content-Type"))
+	s.respondFile(w, f, err)
+}
@@ -0,0 +1,720 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	drive "google.golang.org/api/drive/v2"
+)
+
+const (
+	rootAlias  = "root"
+	rootId     = "0AFakeDriveRootFolder"
+	folderMime = "application/vnd.google-apps.folder"
+
+	fakeOwner        = "fake-owner@drive-fakeserver.local"
+	defaultQuotaSize = 15 * 1024 * 1024 * 1024
+
+	timeFormat = "2006-01-02T15:04:05.000Z"
+)
+
+var (
+	errNotFound        = errors.New("file not found")
+	errParentNotFound  = errors.New("parent not found")
+	errPermNotFound    = errors.New("permission not found")
+	errSessionNotFound = errors.New("upload session not found")
+	errChunkGap        = errors.New("chunk starts beyond the received content")
+)
+
+type fileRecord struct {
+	File        *drive.File         `json:"file"`
+	Permissions []*drive.Permission `json:"permissions,omitempty"`
+}
+
+// state is what gets persisted to disk so that a
+// restarted server picks up from where it left off.
+type state struct {
+	LastId  uint64                  `json:"lastId"`
+	Files   map[string]*fileRecord  `json:"files"`
+	Changes []*drive.Change         `json:"changes"`
+	Drives  map[string]*drive.Drive `json:"drives,omitempty"`
+	// Revisions and Comments are keyed by the id of their file.
+	Revisions map[string][]*drive.Revision `json:"revisions,omitempty"`
+	Comments  map[string][]*drive.Comment  `json:"comments,omitempty"`
+}
+
+type uploadSession struct {
+	// fileId is empty for insertions.
+	fileId   string
+	metadata *drive.File
+	params   map[string]string
+	received int64
+	// size is -1 until the client tells us.
+	size int64
+}
+
+// store keeps the metadata of files in memory, mirrored to
+// state.json, while their content lives under blobs/ in dir.
+type store struct {
+	sync.Mutex
+
+	dir      string
+	baseURL  string
+	state    *state
+	sessions map[string]*uploadSession
+}
+
+func newStore(dir, baseURL string) (*store, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "blobs"), 0755); err != nil {
+		return nil, err
+	}
+
+	s := &store{
+		dir:      dir,
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		sessions: make(map[string]*uploadSession),
+	}
+
+	blob, err := ioutil.ReadFile(s.statePath())
+	switch {
+	case err == nil:
+		st := new(state)
+		if err := json.Unmarshal(blob, st); err != nil {
+			return nil, err
+		}
+		s.state = st
+	case os.IsNotExist(err):
+		s.state = &state{Files: make(map[string]*fileRecord)}
+		root := &drive.File{
+			Id:           rootId,
+			Title:        "My Drive",
+			MimeType:     folderMime,
+			ModifiedDate: nowString(),
+			Labels:       &drive.FileLabels{},
+			Owners:       []*drive.User{{EmailAddress: fakeOwner, DisplayName: "Fake Owner"}},
+			OwnerNames:   []string{"Fake Owner"},
+			Editable:     true,
+		}
+		s.state.Files[rootId] = &fileRecord{File: root}
+		if err := s.saveLocked(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func nowString() string {
+	return time.Now().UTC().Format(timeFormat)
+}
+
+func (s *store) statePath() string {
+	return filepath.Join(s.dir, "state.json")
+}
+
+func (s *store) blobPath(id string) string {
+	return filepath.Join(s.dir, "blobs", id)
+}
+
+func (s *store) saveLocked() error {
+	blob, err := json.Marshal(s.state)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := s.statePath() + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, blob, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.statePath())
+}
+
+func resolveAlias(id string) string {
+	if id == rootAlias {
+		return rootId
+	}
+	return id
+}
+
+func (s *store) nextIdLocked() string {
+	s.state.LastId += 1
+	return fmt.Sprintf("fake%08d", s.state.LastId)
+}
+
+func (s *store) lookupLocked(id string) (*fileRecord, error) {
+	rec, ok := s.state.Files[resolveAlias(id)]
+	if !ok {
+		return nil, errNotFound
+	}
+	return rec, nil
+}
+
+// present returns a copy of the file as the API serves it.
+func (s *store) presentLocked(rec *fileRecord) *drive.File {
+	f := *rec.File
+	if f.MimeType != folderMime {
+		f.DownloadUrl = fmt.Sprintf("%s/drive/v2/files/%s?alt=media", s.baseURL, f.Id)
+	}
+	f.AlternateLink = fmt.Sprintf("%s/file/d/%s/view", s.baseURL, f.Id)
+	f.Permissions = rec.Permissions
+	f.Shared = len(rec.Permissions) >= 1
+	f.Copyable = true
+	return &f
+}
+
+// recordLocked bumps the version of the file, logs a change
+// for it and persists the new state.
+func (s *store) recordLocked(rec *fileRecord, deleted bool) error {
+	rec.File.Version += 1
+	rec.File.Etag = fmt.Sprintf("\"%s/%d\"", rec.File.Id, rec.File.Version)
+
+	change := &drive.Change{
+		Id:               int64(len(s.state.Changes) + 1),
+		FileId:           rec.File.Id,
+		Deleted:          deleted,
+		ModificationDate: nowString(),
+		Kind:             "drive#change",
+	}
+	if !deleted {
+		change.File = s.presentLocked(rec)
+	}
+	s.state.Changes = append(s.state.Changes, change)
+
+	return s.saveLocked()
+}
+
+func (s *store) get(id string) (*drive.File, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	rec, err := s.lookupLocked(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.presentLocked(rec), nil
+}
+
+func (s *store) list(pred predicate, c corpus) []*drive.File {
+	s.Lock()
+	defer s.Unlock()
+
+	var matches []*fileRecord
+	for id, rec := range s.state.Files {
+		if id == rootId || s.isDriveRootLocked(id) {
+			continue
+		}
+		if c.covers(rec.File) && pred(rec) {
+			matches = append(matches, rec)
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		fi, fj := matches[i].File, matches[j].File
+		if fi.Title != fj.Title {
+			return fi.Title < fj.Title
+		}
+		return fi.Id < fj.Id
+	})
+
+	var files []*drive.File
+	for _, rec := range matches {
+		files = append(files, s.presentLocked(rec))
+	}
+	return files
+}
+
+func (s *store) open(id string) (io.ReadCloser, error) {
+	s.Lock()
+	_, err := s.lookupLocked(id)
+	s.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(s.blobPath(resolveAlias(id)))
+	if os.IsNotExist(err) {
+		return ioutil.NopCloser(strings.NewReader("")), nil
+	}
+	return f, err
+}
+
+func guessMimeType(title, contentType string) string {
+	if contentType != "" {
+		if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && mediaType != "application/octet-stream" {
+			return mediaType
+		}
+	}
+
+	if byExt := mime.TypeByExtension(filepath.Ext(title)); byExt != "" {
+		mediaType, _, _ := mime.ParseMediaType(byExt)
+		return mediaType
+	}
+	return "application/octet-stream"
+}
+
+// applyMetadataLocked copies the mutable fields from the
+// request's metadata onto the stored file.
+func (s *store) applyMetadataLocked(rec *fileRecord, meta *drive.File, params map[string]string) error {
+	if meta == nil {
+		return nil
+	}
+
+	f := rec.File
+	if meta.Title != "" {
+		f.Title = meta.Title
+	}
+	if meta.MimeType != "" {
+		f.MimeType = meta.MimeType
+	}
+	if meta.Description != "" {
+		f.Description = meta.Description
+	}
+	if meta.Labels != nil {
+		if f.Labels == nil {
+			f.Labels = &drive.FileLabels{}
+		}
+		f.Labels.Starred = meta.Labels.Starred
+	}
+
+	if meta.ModifiedDate != "" && (f.Version == 0 || params["setModifiedDate"] == "true") {
+		f.ModifiedDate = meta.ModifiedDate
+	} else {
+		f.ModifiedDate = nowString()
+	}
+
+	if len(meta.Parents) >= 1 {
+		var parents []*drive.ParentReference
+		for _, p := range meta.Parents {
+			parentId := resolveAlias(p.Id)
+			if _, err := s.lookupLocked(parentId); err != nil {
+				return errParentNotFound
+			}
+			parents = append(parents, &drive.ParentReference{Id: parentId, IsRoot: parentId == rootId})
+		}
+		f.Parents = parents
+
+		// Content belongs to the shared drive that it is placed in.
+		parent, _ := s.lookupLocked(parents[0].Id)
+		f.DriveId, f.TeamDriveId = parent.File.DriveId, parent.File.DriveId
+		if f.DriveId != "" {
+			f.Owners, f.OwnerNames = nil, nil
+		}
+	}
+
+	return nil
+}
+
+// upsert inserts a file if fileId is empty otherwise it updates that file.
+// If content is non-nil, it replaces the stored content.
+func (s *store) upsert(fileId string, meta *drive.File, params map[string]string, content io.Reader, contentType string) (*drive.File, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	var rec *fileRecord
+	if fileId == "" {
+		rec = &fileRecord{
+			File: &drive.File{
+				Id:         s.nextIdLocked(),
+				Labels:     &drive.FileLabels{},
+				Owners:     []*drive.User{{EmailAddress: fakeOwner, DisplayName: "Fake Owner"}},
+				OwnerNames: []string{"Fake Owner"},
+				Editable:   true,
+				Kind:       "drive#file",
+				Parents:    []*drive.ParentReference{{Id: rootId, IsRoot: true}},
+			},
+		}
+	} else {
+		var err error
+		if rec, err = s.lookupLocked(fileId); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.applyMetadataLocked(rec, meta, params); err != nil {
+		return nil, err
+	}
+
+	if rec.File.MimeType == "" {
+		rec.File.MimeType = guessMimeType(rec.File.Title, contentType)
+	}
+
+	if content != nil && rec.File.MimeType != folderMime {
+		if err := s.writeBlobLocked(rec, content); err != nil {
+			return nil, err
+		}
+		if err := s.recordRevisionLocked(rec, params["pinned"] == "true"); err != nil {
+			return nil, err
+		}
+	}
+
+	s.state.Files[rec.File.Id] = rec
+	if err := s.recordLocked(rec, false); err != nil {
+		return nil, err
+	}
+	return s.presentLocked(rec), nil
+}
+
+func (s *store) writeBlobLocked(rec *fileRecord, content io.Reader) error {
+	tmpPath := s.blobPath(rec.File.Id) + ".tmp"
+	fo, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	hash := md5.New()
+	n, err := io.Copy(io.MultiWriter(fo, hash), content)
+	if cErr := fo.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, s.blobPath(rec.File.Id)); err != nil {
+		return err
+	}
+
+	rec.File.FileSize = n
+	rec.File.QuotaBytesUsed = n
+	rec.File.Md5Checksum = fmt.Sprintf("%x", hash.Sum(nil))
+	return nil
+}
+
+// update applies fn to the file with id and records the change.
+func (s *store) update(id string, fn func(rec *fileRecord) error) (*drive.File, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	rec, err := s.lookupLocked(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fn(rec); err != nil {
+		return nil, err
+	}
+
+	if err := s.recordLocked(rec, false); err != nil {
+		return nil, err
+	}
+	return s.presentLocked(rec), nil
+}
+
+func (s *store) deleteLocked(id string) {
+	rec, ok := s.state.Files[id]
+	if !ok || id == rootId || s.isDriveRootLocked(id) {
+		return
+	}
+
+	delete(s.state.Files, id)
+	os.Remove(s.blobPath(id))
+	s.deleteRevisionsLocked(id)
+	delete(s.state.Comments, id)
+	s.recordLocked(rec, true)
+
+	for childId, child := range s.state.Files {
+		var remaining []*drive.ParentReference
+		for _, p := range child.File.Parents {
+			if p.Id != id {
+				remaining = append(remaining, p)
+			}
+		}
+
+		if len(remaining) == len(child.File.Parents) {
+			continue
+		}
+
+		child.File.Parents = remaining
+		if len(remaining) < 1 {
+			s.deleteLocked(childId)
+		}
+	}
+}
+
+func (s *store) delete(id string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	rec, err := s.lookupLocked(id)
+	if err != nil {
+		return err
+	}
+
+	s.deleteLocked(rec.File.Id)
+	return s.saveLocked()
+}
+
+func (s *store) emptyTrash() error {
+	s.Lock()
+	defer s.Unlock()
+
+	var trashed []string
+	for id, rec := range s.state.Files {
+		// Shared drives' trash isn't the user's to empty.
+		if rec.File.DriveId != "" {
+			continue
+		}
+		if rec.File.Labels != nil && rec.File.Labels.Trashed {
+			trashed = append(trashed, id)
+		}
+	}
+
+	for _, id := range trashed {
+		s.deleteLocked(id)
+	}
+	return s.saveLocked()
+}
+
+func (s *store) copy(id string, meta *drive.File) (*drive.File, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	src, err := s.lookupLocked(id)
+	if err != nil {
+		return nil, err
+	}
+
+	dupFile := *src.File
+	dupFile.Id = s.nextIdLocked()
+	dupFile.Labels = &drive.FileLabels{}
+	dupFile.Version = 0
+
+	rec := &fileRecord{File: &dupFile}
+	if err := s.applyMetadataLocked(rec, meta, map[string]string{"setModifiedDate": "true"}); err != nil {
+		return nil, err
+	}
+
+	if src.File.MimeType != folderMime {
+		blob, err := os.Open(s.blobPath(src.File.Id))
+		if err == nil {
+			err = s.writeBlobLocked(rec, blob)
+			blob.Close()
+			if err == nil {
+				err = s.recordRevisionLocked(rec, false)
+			}
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	s.state.Files[rec.File.Id] = rec
+	if err := s.recordLocked(rec, false); err != nil {
+		return nil, err
+	}
+	return s.presentLocked(rec), nil
+}
+
+func (s *store) changes(startChangeId int64) []*drive.Change {
+	s.Lock()
+	defer s.Unlock()
+
+	var pending []*drive.Change
+	for _, change := range s.state.Changes {
+		if change.Id >= startChangeId {
+			pending = append(pending, change)
+		}
+	}
+	return pending
+}
+
+func (s *store) about() *drive.About {
+	s.Lock()
+	defer s.Unlock()
+
+	used, usedInTrash := int64(0), int64(0)
+	for _, rec := range s.state.Files {
+		used += rec.File.FileSize
+		if rec.File.Labels != nil && rec.File.Labels.Trashed {
+			usedInTrash += rec.File.FileSize
+		}
+	}
+
+	about := &drive.About{
+		Kind:                  "drive#about",
+		Name:                  "Fake Owner",
+		QuotaType:             "LIMITED",
+		QuotaBytesTotal:       defaultQuotaSize,
+		QuotaBytesUsed:        used,
+		QuotaBytesUsedInTrash: usedInTrash,
+		RootFolderId:          rootId,
+		User:                  &drive.User{EmailAddress: fakeOwner, DisplayName: "Fake Owner", IsAuthenticatedUser: true},
+	}
+	if n := len(s.state.Changes); n >= 1 {
+		about.LargestChangeId = s.state.Changes[n-1].Id
+	}
+	return about
+}
+
+func permissionIdForEmail(email string) string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(strings.ToLower(email))))
+}
+
+func (s *store) insertPermission(fileId string, perm *drive.Permission) (*drive.Permission, error) {
+	switch {
+	case perm.Type == "anyone":
+		perm.Id = "anyone"
+	case perm.Value != "":
+		perm.Id = permissionIdForEmail(perm.Value)
+		perm.EmailAddress = perm.Value
+	default:
+		perm.Id = perm.Type
+	}
+	perm.Kind = "drive#permission"
+
+	_, err := s.update(fileId, func(rec *fileRecord) error {
+		var kept []*drive.Permission
+		for _, existing := range rec.Permissions {
+			if existing.Id != perm.Id {
+				kept = append(kept, existing)
+			}
+		}
+		rec.Permissions = append(kept, perm)
+		return nil
+	})
+	return perm, err
+}
+
+func (s *store) permissions(fileId string) ([]*drive.Permission, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	rec, err := s.lookupLocked(fileId)
+	if err != nil {
+		return nil, err
+	}
+	return rec.Permissions, nil
+}
+
+func (s *store) deletePermission(fileId, permId string) error {
+	_, err := s.update(fileId, func(rec *fileRecord) error {
+		var kept []*drive.Permission
+		for _, perm := range rec.Permissions {
+			if perm.Id != permId {
+				kept = append(kept, perm)
+			}
+		}
+		if len(kept) == len(rec.Permissions) {
+			return errPermNotFound
+		}
+		rec.Permissions = kept
+		return nil
+	})
+	return err
+}
+
+func (s *store) newSession(fileId string, meta *drive.File, params map[string]string, size int64) (string, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if fileId != "" {
+		if _, err := s.lookupLocked(fileId); err != nil {
+			return "", err
+		}
+	}
+
+	sessionId := fmt.Sprintf("session-%d-%d", time.Now().UnixNano(), len(s.sessions))
+	s.sessions[sessionId] = &uploadSession{
+		fileId:   resolveAlias(fileId),
+		metadata: meta,
+		params:   params,
+		size:     size,
+	}
+
+	fo, err := os.Create(s.sessionPath(sessionId))
+	if err != nil {
+		return "", err
+	}
+	return sessionId, fo.Close()
+}
+
+func (s *store) sessionPath(sessionId string) string {
+	return filepath.Join(s.dir, "blobs", sessionId+".upload")
+}
+
+// appendChunk appends a chunk starting at offset off to the session's content.
+// Any part of the chunk that had already been received is skipped over.
+// If total is non-negative, it is the size of the entire content.
+// It returns the number of bytes that the session has received and
+// whether that is all of the content.
+func (s *store) appendChunk(sessionId string, off, total int64, chunk io.Reader) (int64, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	session, ok := s.sessions[sessionId]
+	if !ok {
+		return 0, false, errSessionNotFound
+	}
+
+	if total >= 0 {
+		session.size = total
+	}
+	if chunk == nil {
+		return session.received, session.size >= 0 && session.received >= session.size, nil
+	}
+
+	if off > session.received {
+		return session.received, false, errChunkGap
+	}
+	if _, err := io.CopyN(ioutil.Discard, chunk, session.received-off); err != nil {
+		return session.received, false, err
+	}
+
+	fo, err := os.OpenFile(s.sessionPath(sessionId), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return session.received, false, err
+	}
+	defer fo.Close()
+
+	n, err := io.Copy(fo, chunk)
+	session.received += n
+	return session.received, session.size >= 0 && session.received >= session.size, err
+}
+
+func (s *store) finishSession(sessionId, contentType string) (*drive.File, error) {
+	s.Lock()
+	session, ok := s.sessions[sessionId]
+	delete(s.sessions, sessionId)
+	s.Unlock()
+	if !ok {
+		return nil, errSessionNotFound
+	}
+
+	defer os.Remove(s.sessionPath(sessionId))
+
+	content, err := os.Open(s.sessionPath(sessionId))
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	return s.upsert(session.fileId, session.metadata, session.params, content, contentType)
+}
@@ -47,6 +47,10 @@ func (g *Commands) About(mask int) (err error) {
 	if err != nil {
 		return err
 	}
+	if g.opts.structuredOutput() {
+		g.emitDocument(newAboutRecord(about, mask))
+		return nil
+	}
 	printSummary(g.log, about, mask)
 
 	return nil
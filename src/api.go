@@ -0,0 +1,412 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/odeke-em/log"
+)
+
+const (
+	APIEventRecord   = "record"
+	APIEventOutput   = "output"
+	APIEventError    = "error"
+	APIEventProgress = "progress"
+	APIEventDone     = "done"
+)
+
+// apiRequest is the JSON body that the commands of the API take.
+// Its fields are named after the flags of the same commands.
+type apiRequest struct {
+	Paths []string `json:"paths"`
+	ById  bool     `json:"id"`
+
+	Depth     *int  `json:"depth"`
+	Recursive *bool `json:"recursive"`
+	Hidden    bool  `json:"hidden"`
+	InTrash   bool  `json:"trashed"`
+	LongFmt   bool  `json:"long"`
+	Md5sum    bool  `json:"md5sum"`
+
+	BaseLocal      bool     `json:"base-local"`
+	Unified        bool     `json:"unified"`
+	Force          bool     `json:"force"`
+	NoClobber      bool     `json:"no-clobber"`
+	IgnoreChecksum bool     `json:"ignore-checksum"`
+	IgnoreConflict bool     `json:"ignore-conflict"`
+	Exports        []string `json:"export"`
+
+	Emails       []string `json:"emails"`
+	Roles        []string `json:"role"`
+	AccountTypes []string `json:"type"`
+	Message      string   `json:"message"`
+	Notify       bool     `json:"notify"`
+	WithLink     bool     `json:"with-link"`
+}
+
+// apiResult is the JSON response of a command that isn't streamed.
+// Records are those that the command emits with -output jsonl, e.g
+// FileRecords, and Output is what else it would have printed.
+type apiResult struct {
+	Records []interface{} `json:"records"`
+	Output  []string      `json:"output"`
+	Errors  []string      `json:"errors"`
+	Error   *ErrorRecord  `json:"error,omitempty"`
+}
+
+// apiDone is the last event of a streamed command.
+type apiDone struct {
+	Error *ErrorRecord `json:"error"`
+}
+
+type apiProgress struct {
+	Done  int64 `json:"done"`
+	Total int64 `json:"total"`
+}
+
+func apiHTTPStatus(er *ErrorRecord) int {
+	switch er.Code {
+	case StatusInvalidArguments:
+		return http.StatusBadRequest
+	case StatusNonExistantRemote, StatusNoMatchesFound:
+		return http.StatusNotFound
+	case StatusUnresolvedConflicts, StatusClashesDetected, StatusOverwriteAttempted:
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// apiServer serves `serve api`. Every request runs the command it
+// names against a fresh Commands that shares the Remote, and the
+// context whose index DB stays open, of the server. Commands run
+// one at a time since the backend's progress is per Commands.
+type apiServer struct {
+	sync.Mutex
+	g *Commands
+	// token is what clients present as "Authorization: Bearer <token>".
+	token string
+}
+
+type apiCommand func(g *Commands, req *apiRequest) error
+
+var apiCommands = map[string]apiCommand{
+	ListKey: func(g *Commands, req *apiRequest) error {
+		return g.List(req.ById)
+	},
+	StatKey: func(g *Commands, req *apiRequest) error {
+		if req.ById {
+			return g.StatById()
+		}
+		return g.Stat()
+	},
+	DiffKey: func(g *Commands, req *apiRequest) error {
+		return g.Diff()
+	},
+	PushKey: func(g *Commands, req *apiRequest) error {
+		return g.Push()
+	},
+	PullKey: func(g *Commands, req *apiRequest) error {
+		if req.ById {
+			return g.PullById()
+		}
+		return g.Pull()
+	},
+	ShareKey: func(g *Commands, req *apiRequest) error {
+		return g.Share(req.ById)
+	},
+	TrashKey: func(g *Commands, req *apiRequest) error {
+		return g.Trash(req.ById)
+	},
+}
+
+func (g *Commands) apiHandler(token string) (http.Handler, error) {
+	if token == "" {
+		return nil, illogicalStateErr(fmt.Errorf("serve: the api needs a token"))
+	}
+	if err := g.context.HoldDB(); err != nil {
+		return nil, err
+	}
+
+	s := &apiServer{g: g, token: token}
+	mux := http.NewServeMux()
+	for name, cmd := range apiCommands {
+		mux.Handle("/"+name, s.handler(name, cmd))
+	}
+	return mux, nil
+}
+
+// options are those that the command name runs with for req,
+// they default as the flags of the command do.
+func (s *apiServer) options(name string, req *apiRequest) *Options {
+	sources := []string{"/"}
+	if len(req.Paths) >= 1 {
+		sources = make([]string, len(req.Paths))
+		for i, p := range req.Paths {
+			if !req.ById {
+				p = remotePathJoin(p)
+			}
+			sources[i] = p
+		}
+	}
+
+	base := s.g.opts
+	opts := &Options{
+		Path:    "/",
+		Sources: sources,
+
+		Depth:     DefaultMaxTraversalDepth,
+		Recursive: true,
+		Hidden:    req.Hidden,
+		InTrash:   req.InTrash,
+		Md5sum:    req.Md5sum,
+		BaseLocal: req.BaseLocal,
+
+		Force:          req.Force,
+		NoClobber:      req.NoClobber,
+		IgnoreChecksum: req.IgnoreChecksum,
+		IgnoreConflict: req.IgnoreConflict,
+		NoPrompt:       true,
+		Output:         OutputJSONL,
+
+		Exports:   base.Exports,
+		ExportMap: base.ExportMap,
+		Encrypter: base.Encrypter,
+		Decrypter: base.Decrypter,
+
+		ExponentialBackoffRetryCount: base.ExponentialBackoffRetryCount,
+	}
+	if len(req.Exports) >= 1 {
+		opts.Exports = req.Exports
+	}
+
+	switch name {
+	case ListKey, StatKey:
+		opts.Depth, opts.Recursive = 1, false
+	}
+	if req.Recursive != nil {
+		opts.Recursive = *req.Recursive
+	}
+	if req.Depth != nil {
+		opts.Depth = *req.Depth
+	}
+	switch name {
+	case ListKey, StatKey:
+		if opts.Recursive {
+			opts.Depth = InfiniteDepth
+		}
+	}
+
+	meta := map[string][]string{}
+	switch name {
+	case ListKey:
+		if !req.LongFmt {
+			opts.TypeMask |= Minimal
+		}
+		if req.InTrash {
+			opts.TypeMask |= InTrash
+		}
+	case DiffKey:
+		if req.Unified {
+			opts.TypeMask |= DiffUnified
+		}
+	case ShareKey:
+		meta[EmailsKey] = req.Emails
+		meta[RoleKey] = req.Roles
+		meta[AccountTypeKey] = req.AccountTypes
+		meta[EmailMessageKey] = []string{req.Message}
+		opts.TypeMask = NoopOnShare
+		if req.Notify {
+			opts.TypeMask |= Notify
+		}
+		if req.WithLink {
+			opts.TypeMask |= WithLink
+		}
+	}
+	opts.Meta = &meta
+
+	return opts
+}
+
+func (s *apiServer) handler(name string, cmd apiCommand) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "expecting a POST", http.StatusMethodNotAllowed)
+			return
+		}
+		if !s.authorized(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "expecting the api token as a bearer token", http.StatusUnauthorized)
+			return
+		}
+		// Browsers can't send JSON to another origin without asking first.
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+			http.Error(w, "expecting a Content-Type of application/json", http.StatusUnsupportedMediaType)
+			return
+		}
+
+		req := &apiRequest{}
+		body, err := ioutil.ReadAll(r.Body)
+		if err == nil && len(bytes.TrimSpace(body)) >= 1 {
+			err = json.Unmarshal(body, req)
+		}
+		if err != nil {
+			writeAPIResult(w, &apiResult{
+				Records: []interface{}{},
+				Output:  []string{},
+				Errors:  []string{},
+				Error:   ErrorRecordFor(invalidArgumentsErr(err)),
+			})
+			return
+		}
+		opts := s.options(name, req)
+
+		flusher, canStream := w.(http.Flusher)
+		if canStream && strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+
+			emit := func(event string, data interface{}) {
+				blob, _ := json.Marshal(data)
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, blob)
+				flusher.Flush()
+			}
+			err := s.run(opts, emit, func(g *Commands) error {
+				return cmd(g, req)
+			})
+			emit(APIEventDone, &apiDone{Error: ErrorRecordFor(err)})
+			return
+		}
+
+		result := &apiResult{Records: []interface{}{}, Output: []string{}, Errors: []string{}}
+		emit := func(event string, data interface{}) {
+			switch event {
+			case APIEventRecord:
+				result.Records = append(result.Records, data)
+			case APIEventOutput:
+				result.Output = append(result.Output, data.(string))
+			case APIEventError:
+				result.Errors = append(result.Errors, data.(string))
+			}
+		}
+		err = s.run(opts, emit, func(g *Commands) error {
+			return cmd(g, req)
+		})
+		result.Error = ErrorRecordFor(err)
+		writeAPIResult(w, result)
+	})
+}
+
+func (s *apiServer) authorized(r *http.Request) bool {
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, prefix) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, prefix)), []byte(s.token)) == 1
+}
+
+func writeAPIResult(w http.ResponseWriter, result *apiResult) {
+	w.Header().Set("Content-Type", "application/json")
+	if result.Error != nil {
+		w.WriteHeader(apiHTTPStatus(result.Error))
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// run runs fn with a Commands for opts whose output, errors and
+// progress are emitted as events instead of going to the terminal.
+func (s *apiServer) run(opts *Options, emit func(event string, data interface{}), fn func(g *Commands) error) error {
+	s.Lock()
+	defer s.Unlock()
+
+	var emitLock sync.Mutex
+	emitSync := func(event string, data interface{}) {
+		emitLock.Lock()
+		defer emitLock.Unlock()
+		emit(event, data)
+	}
+
+	stdout := &apiLineWriter{event: APIEventOutput, emit: emitSync}
+	stderr := &apiLineWriter{event: APIEventError, emit: emitSync}
+	defer stdout.flush()
+	defer stderr.flush()
+
+	g := NewWithBackend(s.g.context, opts, s.g.rem)
+	opts.StdoutIsTty = false
+	g.log = log.New(strings.NewReader(""), stdout, stderr)
+	g.progressListener = func(done, total int64) {
+		emitSync(APIEventProgress, &apiProgress{Done: done, Total: total})
+	}
+	g.recordListener = func(record interface{}) {
+		emitSync(APIEventRecord, record)
+	}
+
+	return fn(g)
+}
+
+var ansiEscapeRegexp = regexp.MustCompile("\033\\[[0-9;]*m")
+
+// apiLineWriter emits each line written to it, without
+// the colors meant for terminals, as an event.
+type apiLineWriter struct {
+	sync.Mutex
+	event   string
+	emit    func(event string, data interface{})
+	pending []byte
+}
+
+func (lw *apiLineWriter) Write(p []byte) (int, error) {
+	lw.Lock()
+	defer lw.Unlock()
+
+	lw.pending = append(lw.pending, p...)
+	for {
+		i := bytes.IndexByte(lw.pending, '\n')
+		if i < 0 {
+			break
+		}
+		lw.emitLine(lw.pending[:i])
+		lw.pending = lw.pending[i+1:]
+	}
+	return len(p), nil
+}
+
+func (lw *apiLineWriter) emitLine(line []byte) {
+	text := ansiEscapeRegexp.ReplaceAllString(string(line), "")
+	if strings.TrimSpace(text) != "" {
+		lw.emit(lw.event, strings.TrimRight(text, "\r"))
+	}
+}
+
+func (lw *apiLineWriter) flush() {
+	lw.Lock()
+	defer lw.Unlock()
+
+	if len(lw.pending) >= 1 {
+		lw.emitLine(lw.pending)
+		lw.pending = nil
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAPIRunsCommands(t *testing.T) {
+	mb := NewMemoryBackend()
+
+	context := memoryTestContext(t)
+	defer os.RemoveAll(context.AbsPath)
+
+	writeTestFiles(t, context.AbsPath, map[string]string{
+		"docs/a.txt":   "alpha",
+		"docs/b/c.txt": "charlie",
+	})
+
+	g := NewWithBackend(context, memoryTestOptions("/"), mb)
+	const token = "s3cr3t"
+	handler, err := g.apiHandler(token)
+	if err != nil {
+		t.Fatalf("apiHandler: %v", err)
+	}
+	defer context.ReleaseDB()
+
+	server := httptest.NewServer(localRequestsOnly(handler, true))
+	defer server.Close()
+
+	newRequest := func(name, body, accept string) *http.Request {
+		req, err := http.NewRequest("POST", server.URL+"/"+name, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		req.Header.Set("Accept", accept)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		return req
+	}
+
+	do := func(req *http.Request, want int) string {
+		name := req.URL.Path
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		defer res.Body.Close()
+		content, _ := ioutil.ReadAll(res.Body)
+		if res.StatusCode != want {
+			t.Fatalf("%s: got status %d want %d: %s", name, res.StatusCode, want, content)
+		}
+		return string(content)
+	}
+
+	post := func(name, body, accept string, want int) string {
+		return do(newRequest(name, body, accept), want)
+	}
+
+	result := func(name, body string, want int) *apiResult {
+		ar := &apiResult{}
+		if err := json.Unmarshal([]byte(post(name, body, "application/json", want)), ar); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		return ar
+	}
+
+	if ar := result(PushKey, `{"paths": ["/docs"]}`, http.StatusOK); ar.Error != nil {
+		t.Fatalf("push: %v", ar.Error)
+	}
+	if got := remoteContent(t, mb, "/docs/b/c.txt"); got != "charlie" {
+		t.Errorf("push: got %q", got)
+	}
+
+	ar := result(ListKey, `{"paths": ["/docs"], "recursive": true}`, http.StatusOK)
+	var listed []string
+	for _, record := range ar.Records {
+		listed = append(listed, record.(map[string]interface{})["path"].(string))
+	}
+	if got, want := strings.Join(listed, " "), "/docs/a.txt /docs/b /docs/b/c.txt"; got != want {
+		t.Errorf("list: got %q want %q", got, want)
+	}
+
+	ar = result(StatKey, `{"paths": ["/missing"]}`, http.StatusNotFound)
+	if ar.Error == nil || ar.Error.Code != StatusNonExistantRemote {
+		t.Errorf("stat: expected /missing not to exist, got %v", ar.Error)
+	}
+
+	ar = result(ListKey, `{"paths": [`, http.StatusBadRequest)
+	if ar.Error == nil || ar.Error.Code != StatusInvalidArguments {
+		t.Errorf("list: expected invalid arguments, got %v", ar.Error)
+	}
+
+	if err := os.RemoveAll(filepath.Join(context.AbsPath, "docs")); err != nil {
+		t.Fatalf("removeAll: %v", err)
+	}
+	events := post(PullKey, `{"paths": ["/docs"]}`, "text/event-stream", http.StatusOK)
+	for _, want := range []string{
+		"event: progress\ndata: {\"done\":0,\"total\":12}",
+		"event: progress\ndata: {\"done\":12,\"total\":12}",
+		"event: done\ndata: {\"error\":null}",
+	} {
+		if !strings.Contains(events, want) {
+			t.Errorf("pull: %q missing from %s", want, events)
+		}
+	}
+	if content, err := ioutil.ReadFile(filepath.Join(context.AbsPath, "docs", "b", "c.txt")); string(content) != "charlie" {
+		t.Errorf("pull: got %q, %v", content, err)
+	}
+
+	if ar := result(TrashKey, `{"paths": ["/docs/a.txt"]}`, http.StatusOK); ar.Error != nil {
+		t.Fatalf("trash: %v", ar.Error)
+	}
+	if _, err := mb.FindByPath("/docs/a.txt"); err != ErrPathNotExists {
+		t.Errorf("trash: expected /docs/a.txt to be gone, got %v", err)
+	}
+
+	post(ListKey, "", "", http.StatusOK)
+
+	req := newRequest(ListKey, "", "")
+	req.Header.Del("Authorization")
+	do(req, http.StatusUnauthorized)
+	req = newRequest(ListKey, "", "")
+	req.Header.Set("Authorization", "Bearer "+token+"x")
+	do(req, http.StatusUnauthorized)
+	req = newRequest(ListKey, "", "")
+	req.Header.Set("Content-Type", "text/plain")
+	do(req, http.StatusUnsupportedMediaType)
+	req = newRequest(ListKey, "", "")
+	req.Header.Set("Origin", "https://example.com")
+	do(req, http.StatusForbidden)
+	req = newRequest(ListKey, "", "")
+	req.Host = "rebound.example.com"
+	do(req, http.StatusForbidden)
+
+	if res, err := http.Get(server.URL + "/" + ListKey); err != nil || res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET list: expected the method to be refused, got %v %v", res, err)
+	}
+}
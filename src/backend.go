@@ -0,0 +1,187 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"io"
+	"time"
+
+	drive "google.golang.org/api/drive/v2"
+)
+
+// Backend is the store that Commands pushes to and pulls from, such as
+// Google Drive. It is small enough to be implemented outside of this
+// package, to run drive against other stores; the lookups by path,
+// listings, copies etc that Commands needs are built on top of it.
+// *Remote and MemoryBackend also implement those natively.
+type Backend interface {
+	About() (*drive.About, error)
+
+	// RootId is the id of the folder that remote paths are relative to.
+	RootId() string
+	// Get returns the file with id, trashed or not,
+	// or ErrPathNotExists if there is no such file.
+	Get(id string) (*drive.File, error)
+	// Children returns the files in the folder with
+	// parentId, trashed ones included.
+	Children(parentId string) ([]*drive.File, error)
+
+	Create(req *CreateRequest) (*drive.File, error)
+	Update(req *UpdateRequest) (*drive.File, error)
+	// DownloadRange returns the content of the file with id
+	// from offset onwards along with the offset that the content
+	// actually starts at, 0 if the backend can't skip ahead.
+	DownloadRange(id string, offset int64) (io.ReadCloser, int64, error)
+
+	Trash(id string) error
+	Untrash(id string) error
+	// Delete permanently deletes the file with id.
+	Delete(id string) error
+}
+
+// CreateRequest describes a file or folder to create.
+type CreateRequest struct {
+	ParentId string
+	Name     string
+	// MimeType is DriveFolderMimeType for folders.
+	MimeType    string
+	ModTime     time.Time
+	Description string
+
+	// ShortcutTargetId makes the file a shortcut to the file with that id.
+	ShortcutTargetId string
+	// Content is that of the file, it is nil for folders and shortcuts.
+	Content io.Reader
+}
+
+// UpdateRequest describes the changes to make to the file with Id,
+// only the fields that are set are changed.
+type UpdateRequest struct {
+	Id string
+
+	Name        string
+	MimeType    string
+	ModTime     time.Time
+	Description *string
+	Starred     *bool
+
+	AddParents    []string
+	RemoveParents []string
+
+	// Content replaces the content of the file.
+	Content io.Reader
+}
+
+// backend is everything that Commands performs against a Backend.
+// Backends that only implement the methods of Backend get the rest
+// from basicBackend, see asBackend.
+type backend interface {
+	Backend
+
+	FindById(id string) (*File, error)
+	FindByIdM(id string) *paginationPair
+	FindByPath(p string) (*File, error)
+	FindByPathM(p string) *paginationPair
+	FindByPathTrashed(p string) (*File, error)
+	FindByPathTrashedM(p string) *paginationPair
+	FindByPathShared(p string) *paginationPair
+	FindByParentId(parentId string, hidden bool) *paginationPair
+	FindBackPaths(id string) ([]string, error)
+	FindStarred(trashed, hidden bool) *paginationPair
+	FindMatches(mq *matchQuery) *paginationPair
+	SharedDrives() ([]*drive.Drive, error)
+
+	UpsertByComparison(args *upsertOpt) (*File, error)
+	Download(id string, exportURL string) (io.ReadCloser, error)
+	Touch(id string) (*File, error)
+	SetModTime(id string, modTime time.Time) (*File, error)
+	EmptyTrash() error
+
+	Publish(id string) (string, error)
+	Unpublish(id string) error
+
+	// changes calls fn with every change from startChangeId on, in order.
+	// It returns the first error from fetching a page or from fn, so that
+	// callers never move past changes that they didn't get to see.
+	changes(startChangeId int64, fn func(*drive.Change) error) error
+	// allFiles calls fn with the full record of every file in the
+	// drive, the root folder and trashed files included.
+	allFiles(fn func(*drive.File) error) error
+	listChildren(lq *listQuery) *paginationPair
+	findChildren(parentId string, trashed bool) *paginationPair
+	upsertByComparison(body io.Reader, args *upsertOpt) (*File, bool, error)
+
+	rename(fileId, newTitle string) (*File, error)
+	copy(newName, parentId string, srcFile *File) (*File, error)
+	insertShortcut(parentId, title, targetId string) (*File, error)
+	updateDescription(fileId, newDescription string) (*File, error)
+	updateStarred(fileId string, star bool) (*File, error)
+	insertParent(fileId, parentId string) error
+	removeParent(fileId, parentId string) error
+
+	listRevisions(fileId string) ([]*drive.Revision, error)
+	getRevision(fileId, revisionId string) (*drive.Revision, error)
+	// downloadRevision downloads the content of rev, exported
+	// through exportURL if set, as it was at that revision.
+	downloadRevision(fileId string, rev *drive.Revision, exportURL string) (io.ReadCloser, error)
+	pinRevision(fileId, revisionId string, pinned bool) (*drive.Revision, error)
+
+	listComments(fileId string) ([]*drive.Comment, error)
+	getComment(fileId, commentId string) (*drive.Comment, error)
+	insertComment(fileId string, comment *drive.Comment) (*drive.Comment, error)
+	// insertReply replies to a comment, a reply whose Verb is
+	// "resolve" or "reopen" also changes the status of the comment.
+	insertReply(fileId, commentId string, reply *drive.CommentReply) (*drive.CommentReply, error)
+
+	// setProperty adds the property to the file or updates
+	// its value if the file already has one with that key.
+	setProperty(fileId string, prop *drive.Property) (*drive.Property, error)
+	deleteProperty(fileId, key, visibility string) error
+
+	// sheetTabs lists the tabs of a Google Sheet.
+	sheetTabs(spreadsheetId string) ([]*sheetTab, error)
+
+	idForEmail(email string) (string, error)
+	listPermissions(id string) ([]*drive.Permission, error)
+	insertPermissions(permInfo *permission) (*drive.Permission, error)
+	revokePermissions(p *permission) error
+
+	setCrypto(encrypter func(io.Reader) (io.Reader, error), decrypter func(io.Reader) (io.ReadCloser, error))
+}
+
+// asBackend returns b along with the methods of backend,
+// which basicBackend builds if b doesn't implement them.
+func asBackend(b Backend) backend {
+	if rem, ok := b.(backend); ok {
+		return rem
+	}
+	return newBasicBackend(b)
+}
+
+// listQuery describes a single level listing of the children of a folder.
+type listQuery struct {
+	parentId   string
+	typeMask   int
+	inTrash    bool
+	hidden     bool
+	pageSize   int64
+	matchQuery *matchQuery
+}
+
+var (
+	_ backend = (*Remote)(nil)
+	_ backend = (*MemoryBackend)(nil)
+	_ backend = (*basicBackend)(nil)
+)
@@ -0,0 +1,522 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	drive "google.golang.org/api/drive/v2"
+)
+
+// basicBackend builds the methods of backend on top of those of the
+// Backend that it wraps. Lookups by path resolve each segment through
+// Children and searches walk the whole tree, so they cost a lot more
+// than with Remote. Revisions, comments, properties, sharing and the
+// changes feed have no equivalent in Backend and aren't supported.
+type basicBackend struct {
+	Backend
+
+	encrypter func(io.Reader) (io.Reader, error)
+	decrypter func(io.Reader) (io.ReadCloser, error)
+}
+
+var errBackendExportsUnsupported = downloadFailedErr(fmt.Errorf("exports are not supported by this backend"))
+
+func newBasicBackend(b Backend) *basicBackend {
+	return &basicBackend{Backend: b}
+}
+
+func unsupportedByBackendErr(op string) error {
+	return illogicalStateErr(fmt.Errorf("%s is not supported by this backend", op))
+}
+
+func (bb *basicBackend) setCrypto(encrypter func(io.Reader) (io.Reader, error), decrypter func(io.Reader) (io.ReadCloser, error)) {
+	bb.encrypter = encrypter
+	bb.decrypter = decrypter
+}
+
+// children returns, sorted like the memory backend does, the
+// files in the folder parentId that satisfy the predicate.
+func (bb *basicBackend) children(parentId string, pred func(*drive.File) bool) ([]*File, error) {
+	children, err := bb.Children(parentId)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []*drive.File
+	for _, f := range children {
+		if pred(f) {
+			files = append(files, f)
+		}
+	}
+	return sortedRemoteFiles(files), nil
+}
+
+func (bb *basicBackend) allFiles(fn func(*drive.File) error) error {
+	root, err := bb.Get(bb.RootId())
+	if err != nil {
+		return err
+	}
+
+	// Files with several parents are only visited once.
+	visited := map[string]bool{}
+
+	var walk func(f *drive.File) error
+	walk = func(f *drive.File) error {
+		if visited[f.Id] {
+			return nil
+		}
+		visited[f.Id] = true
+
+		if err := fn(f); err != nil {
+			return err
+		}
+		if f.MimeType != DriveFolderMimeType {
+			return nil
+		}
+
+		children, err := bb.Children(f.Id)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			if err := walk(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return walk(root)
+}
+
+// filter returns the files in the tree that satisfy the predicate.
+func (bb *basicBackend) filter(pred func(*drive.File) bool) ([]*File, error) {
+	var files []*drive.File
+	err := bb.allFiles(func(f *drive.File) error {
+		if pred(f) {
+			files = append(files, f)
+		}
+		return nil
+	})
+	return sortedRemoteFiles(files), err
+}
+
+func (bb *basicBackend) FindById(id string) (*File, error) {
+	f, err := bb.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if f == nil {
+		return nil, ErrPathNotExists
+	}
+	return NewRemoteFile(f), nil
+}
+
+func (bb *basicBackend) FindByIdM(id string) *paginationPair {
+	f, err := bb.FindById(id)
+	return wrapInPaginationPair(f, err)
+}
+
+// resolvePath resolves the path segments just like the memory backend does.
+func (bb *basicBackend) resolvePath(parentId string, p []string, trashed bool) ([]*File, error) {
+	if len(p) < 1 {
+		return nil, nil
+	}
+
+	head := urlToPath(p[0], false)
+	titled := func(f *drive.File) bool {
+		return f.Title == head && isTrashed(f) == trashed
+	}
+
+	var matches []*File
+	var err error
+	if trashed {
+		matches, err = bb.filter(titled)
+	} else {
+		matches, err = bb.children(parentId, titled)
+	}
+	if err != nil || len(p) == 1 {
+		return matches, err
+	}
+
+	var resolved []*File
+	for _, f := range matches {
+		subResolved, err := bb.resolvePath(f.Id, p[1:], trashed)
+		if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, subResolved...)
+	}
+	return resolved, nil
+}
+
+func (bb *basicBackend) findByPath(p string, trashed bool) (*File, error) {
+	if rootLike(p) {
+		return bb.FindById(bb.RootId())
+	}
+
+	resolved, err := bb.resolvePath(bb.RootId(), strings.Split(p, RemoteSeparator)[1:], trashed)
+	if err != nil {
+		return nil, err
+	}
+	if len(resolved) < 1 {
+		return nil, ErrPathNotExists
+	}
+	return resolved[0], nil
+}
+
+func (bb *basicBackend) findByPathM(p string, trashed bool) *paginationPair {
+	if rootLike(p) {
+		return bb.FindByIdM(bb.RootId())
+	}
+
+	resolved, err := bb.resolvePath(bb.RootId(), strings.Split(p, RemoteSeparator)[1:], trashed)
+	if err != nil {
+		return wrapInPaginationPair(nil, err)
+	}
+	return memoryPage(resolved, true)
+}
+
+func (bb *basicBackend) FindByPath(p string) (*File, error) {
+	return bb.findByPath(p, false)
+}
+
+func (bb *basicBackend) FindByPathM(p string) *paginationPair {
+	return bb.findByPathM(p, false)
+}
+
+func (bb *basicBackend) FindByPathTrashed(p string) (*File, error) {
+	return bb.findByPath(p, true)
+}
+
+func (bb *basicBackend) FindByPathTrashedM(p string) *paginationPair {
+	return bb.findByPathM(p, true)
+}
+
+func (bb *basicBackend) FindByPathShared(p string) *paginationPair {
+	parts := NonEmptyStrings(strings.Split(p, "/")...)
+	if p == "root" {
+		parts = nil
+	}
+
+	return filesPage(bb.filter(func(f *drive.File) bool {
+		if len(parts) >= 1 && f.Title != parts[0] {
+			return false
+		}
+		return f.Shared
+	}))
+}
+
+func (bb *basicBackend) FindByParentId(parentId string, hidden bool) *paginationPair {
+	return filesPage(bb.children(parentId, func(f *drive.File) bool {
+		return !isTrashed(f) && !isHidden(f.Title, hidden)
+	}))
+}
+
+func (bb *basicBackend) findChildren(parentId string, trashed bool) *paginationPair {
+	return filesPage(bb.children(parentId, func(f *drive.File) bool {
+		return isTrashed(f) == trashed
+	}))
+}
+
+func (bb *basicBackend) listChildren(lq *listQuery) *paginationPair {
+	return filesPage(bb.children(lq.parentId, func(f *drive.File) bool {
+		if isTrashed(f) != lq.inTrash {
+			return false
+		}
+		if (lq.typeMask&Folder) != 0 && f.MimeType != DriveFolderMimeType {
+			return false
+		}
+		if isHidden(f.Title, lq.hidden) {
+			return false
+		}
+		return lq.matchQuery == nil || lq.matchQuery.satisfiedBy(f)
+	}))
+}
+
+func (bb *basicBackend) FindBackPaths(id string) ([]string, error) {
+	return findBackPaths(bb, id)
+}
+
+func (bb *basicBackend) FindStarred(trashed, hidden bool) *paginationPair {
+	return filesPage(bb.filter(func(f *drive.File) bool {
+		return isStarred(f) && isTrashed(f) == trashed && !isHidden(f.Title, hidden)
+	}))
+}
+
+func (bb *basicBackend) FindMatches(mq *matchQuery) *paginationPair {
+	if mq.anywhere {
+		rootId := bb.RootId()
+		return filesPage(bb.filter(func(f *drive.File) bool {
+			return f.Id != rootId && isTrashed(f) == mq.inTrash && mq.satisfiedBy(f)
+		}))
+	}
+
+	parent, err := bb.FindByPath(mq.dirPath)
+	if err != nil {
+		return wrapInPaginationPair(parent, err)
+	}
+
+	return filesPage(bb.children(parent.Id, mq.satisfiedBy))
+}
+
+// SharedDrives returns no drives since Backend has no notion of them.
+func (bb *basicBackend) SharedDrives() ([]*drive.Drive, error) {
+	return nil, nil
+}
+
+func (bb *basicBackend) UpsertByComparison(args *upsertOpt) (*File, error) {
+	return upsertWithProgress(bb, args)
+}
+
+func (bb *basicBackend) upsertByComparison(body io.Reader, args *upsertOpt) (f *File, mediaInserted bool, err error) {
+	mimeType := args.src.MimeType
+	if args.src.IsDir {
+		mimeType = DriveFolderMimeType
+	}
+	if args.mimeKey != "" {
+		mimeType = guessMimeType(args.mimeKey)
+	}
+
+	insert := args.src.Id == ""
+
+	var content io.Reader
+	if !args.src.IsDir && body != nil && (insert || args.shouldUploadBody()) {
+		content = body
+		if bb.encrypter != nil {
+			if content, err = bb.encrypter(body); err != nil {
+				return
+			}
+		}
+		mediaInserted = true
+	}
+
+	name := urlToPath(args.src.Name, false)
+
+	var uploaded *drive.File
+	if insert {
+		uploaded, err = bb.Create(&CreateRequest{
+			ParentId: args.parentId,
+			Name:     name,
+			MimeType: mimeType,
+			ModTime:  args.src.ModTime,
+			Content:  content,
+		})
+	} else {
+		uploaded, err = bb.Update(&UpdateRequest{
+			Id:       args.src.Id,
+			Name:     name,
+			MimeType: mimeType,
+			ModTime:  args.src.ModTime,
+			Content:  content,
+		})
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return NewRemoteFile(uploaded), mediaInserted, nil
+}
+
+func (bb *basicBackend) Download(id string, exportURL string) (io.ReadCloser, error) {
+	if exportURL != "" {
+		return nil, errBackendExportsUnsupported
+	}
+
+	body, _, err := bb.Backend.DownloadRange(id, 0)
+	if err != nil || bb.decrypter == nil {
+		return body, err
+	}
+	return bb.decrypter(body)
+}
+
+func (bb *basicBackend) DownloadRange(id string, offset int64) (io.ReadCloser, int64, error) {
+	// Encrypted content can only be decrypted from the start.
+	if bb.decrypter != nil {
+		body, err := bb.Download(id, "")
+		return body, 0, err
+	}
+	return bb.Backend.DownloadRange(id, offset)
+}
+
+func (bb *basicBackend) update(req *UpdateRequest) (*File, error) {
+	f, err := bb.Update(req)
+	if err != nil {
+		return nil, err
+	}
+	return NewRemoteFile(f), nil
+}
+
+func (bb *basicBackend) Touch(id string) (*File, error) {
+	return bb.SetModTime(id, time.Now())
+}
+
+func (bb *basicBackend) SetModTime(id string, modTime time.Time) (*File, error) {
+	return bb.update(&UpdateRequest{Id: id, ModTime: modTime})
+}
+
+func (bb *basicBackend) rename(fileId, newTitle string) (*File, error) {
+	return bb.update(&UpdateRequest{Id: fileId, Name: newTitle})
+}
+
+func (bb *basicBackend) updateDescription(fileId, newDescription string) (*File, error) {
+	return bb.update(&UpdateRequest{Id: fileId, Description: &newDescription})
+}
+
+func (bb *basicBackend) updateStarred(fileId string, star bool) (*File, error) {
+	return bb.update(&UpdateRequest{Id: fileId, Starred: &star})
+}
+
+func (bb *basicBackend) insertParent(fileId, parentId string) error {
+	_, err := bb.Update(&UpdateRequest{Id: fileId, AddParents: []string{parentId}})
+	return err
+}
+
+func (bb *basicBackend) removeParent(fileId, parentId string) error {
+	_, err := bb.Update(&UpdateRequest{Id: fileId, RemoveParents: []string{parentId}})
+	return err
+}
+
+func (bb *basicBackend) copy(newName, parentId string, srcFile *File) (*File, error) {
+	if parentId == "" && len(srcFile.Parents) >= 1 {
+		parentId = srcFile.Parents[0].Id
+	}
+
+	req := &CreateRequest{
+		ParentId:    parentId,
+		Name:        urlToPath(newName, false),
+		MimeType:    srcFile.MimeType,
+		ModTime:     srcFile.ModTime,
+		Description: srcFile.Description,
+	}
+	if !srcFile.IsDir {
+		// The content is copied as stored, encrypted or not.
+		body, _, err := bb.Backend.DownloadRange(srcFile.Id, 0)
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+		req.Content = body
+	}
+
+	copied, err := bb.Create(req)
+	if err != nil {
+		return nil, err
+	}
+	return NewRemoteFile(copied), nil
+}
+
+func (bb *basicBackend) insertShortcut(parentId, title, targetId string) (*File, error) {
+	shortcut, err := bb.Create(&CreateRequest{
+		ParentId:         parentId,
+		Name:             urlToPath(title, false),
+		ShortcutTargetId: targetId,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return NewRemoteFile(shortcut), nil
+}
+
+func (bb *basicBackend) EmptyTrash() error {
+	trashed, err := bb.filter(isTrashed)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range trashed {
+		// Deleting a folder might already have deleted f.
+		if err := bb.Delete(f.Id); err != nil && err != ErrPathNotExists {
+			return err
+		}
+	}
+	return nil
+}
+
+func (bb *basicBackend) changes(startChangeId int64, fn func(*drive.Change) error) error {
+	return unsupportedByBackendErr("the changes feed")
+}
+
+func (bb *basicBackend) Publish(id string) (string, error) {
+	return "", unsupportedByBackendErr("publishing")
+}
+
+func (bb *basicBackend) Unpublish(id string) error {
+	return unsupportedByBackendErr("unpublishing")
+}
+
+func (bb *basicBackend) listRevisions(fileId string) ([]*drive.Revision, error) {
+	return nil, unsupportedByBackendErr("revisions")
+}
+
+func (bb *basicBackend) getRevision(fileId, revisionId string) (*drive.Revision, error) {
+	return nil, unsupportedByBackendErr("revisions")
+}
+
+func (bb *basicBackend) downloadRevision(fileId string, rev *drive.Revision, exportURL string) (io.ReadCloser, error) {
+	return nil, unsupportedByBackendErr("revisions")
+}
+
+func (bb *basicBackend) pinRevision(fileId, revisionId string, pinned bool) (*drive.Revision, error) {
+	return nil, unsupportedByBackendErr("revisions")
+}
+
+func (bb *basicBackend) listComments(fileId string) ([]*drive.Comment, error) {
+	return nil, unsupportedByBackendErr("comments")
+}
+
+func (bb *basicBackend) getComment(fileId, commentId string) (*drive.Comment, error) {
+	return nil, unsupportedByBackendErr("comments")
+}
+
+func (bb *basicBackend) insertComment(fileId string, comment *drive.Comment) (*drive.Comment, error) {
+	return nil, unsupportedByBackendErr("comments")
+}
+
+func (bb *basicBackend) insertReply(fileId, commentId string, reply *drive.CommentReply) (*drive.CommentReply, error) {
+	return nil, unsupportedByBackendErr("comments")
+}
+
+func (bb *basicBackend) setProperty(fileId string, prop *drive.Property) (*drive.Property, error) {
+	return nil, unsupportedByBackendErr("properties")
+}
+
+func (bb *basicBackend) deleteProperty(fileId, key, visibility string) error {
+	return unsupportedByBackendErr("properties")
+}
+
+func (bb *basicBackend) sheetTabs(spreadsheetId string) ([]*sheetTab, error) {
+	return nil, errBackendExportsUnsupported
+}
+
+func (bb *basicBackend) idForEmail(email string) (string, error) {
+	return "", unsupportedByBackendErr("sharing")
+}
+
+// listPermissions returns no permissions, without sharing there are none.
+func (bb *basicBackend) listPermissions(id string) ([]*drive.Permission, error) {
+	return nil, nil
+}
+
+func (bb *basicBackend) insertPermissions(permInfo *permission) (*drive.Permission, error) {
+	return nil, unsupportedByBackendErr("sharing")
+}
+
+func (bb *basicBackend) revokePermissions(p *permission) error {
+	return unsupportedByBackendErr("sharing")
+}
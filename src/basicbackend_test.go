@@ -0,0 +1,79 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// exportedOnly hides all but the methods of Backend, like
+// a Backend implemented outside of this package would.
+type exportedOnly struct {
+	Backend
+}
+
+func TestBasicBackendPushPull(t *testing.T) {
+	mb := NewMemoryBackend()
+	b := exportedOnly{mb}
+	if _, ok := asBackend(b).(*basicBackend); !ok {
+		t.Fatalf("asBackend: expected a basicBackend for %T", b)
+	}
+
+	context := memoryTestContext(t)
+	defer os.RemoveAll(context.AbsPath)
+
+	writeTestFiles(t, context.AbsPath, map[string]string{
+		"docs/a.txt":   "alpha",
+		"docs/b/c.txt": "charlie",
+	})
+	if err := NewWithBackend(context, memoryTestOptions("/docs"), b).Push(); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	if got := remoteContent(t, mb, "/docs/b/c.txt"); got != "charlie" {
+		t.Errorf("push: got %q", got)
+	}
+
+	writeTestFiles(t, context.AbsPath, map[string]string{"docs/a.txt": "alpha, again"})
+	if err := NewWithBackend(context, memoryTestOptions("/docs/a.txt"), b).Push(); err != nil {
+		t.Fatalf("push modified: %v", err)
+	}
+	if got := remoteContent(t, mb, "/docs/a.txt"); got != "alpha, again" {
+		t.Errorf("push modified: got %q", got)
+	}
+
+	if err := NewWithBackend(context, memoryTestOptions("/docs/b"), b).Trash(false); err != nil {
+		t.Fatalf("trash: %v", err)
+	}
+	if _, err := mb.FindByPath("/docs/b"); err != ErrPathNotExists {
+		t.Errorf("trash: expected /docs/b to be trashed, got %v", err)
+	}
+
+	if err := os.RemoveAll(filepath.Join(context.AbsPath, "docs")); err != nil {
+		t.Fatalf("removeAll: %v", err)
+	}
+	if err := NewWithBackend(context, memoryTestOptions("/docs"), b).Pull(); err != nil {
+		t.Fatalf("pull: %v", err)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(context.AbsPath, "docs", "a.txt"))
+	if string(content) != "alpha, again" {
+		t.Errorf("pull: got %q, %v", content, err)
+	}
+	if _, err := os.Stat(filepath.Join(context.AbsPath, "docs", "b")); !os.IsNotExist(err) {
+		t.Errorf("pull: expected the trashed /docs/b not to be pulled, got %v", err)
+	}
+}
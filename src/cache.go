@@ -0,0 +1,434 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/odeke-em/drive/config"
+	drive "google.golang.org/api/drive/v2"
+)
+
+// cacheBackend answers lookups and listings from the metadata cache in
+// the context's db instead of from the backend that it wraps, so that
+// they don't need a single API call. Everything else, such as writes,
+// goes to the wrapped backend and is only picked up by the cache once
+// it is refreshed from the changes feed, see Commands.Cache.
+type cacheBackend struct {
+	backend
+	context *config.Context
+}
+
+func newCacheBackend(context *config.Context, rem backend) *cacheBackend {
+	return &cacheBackend{backend: rem, context: context}
+}
+
+var errNoCache = illogicalStateErr(fmt.Errorf("no metadata cache, run `drive %s` first", CacheKey))
+
+func (cb *cacheBackend) state() (*config.CacheState, error) {
+	state, err := cb.context.CacheState()
+	if err == config.ErrNoSuchDbKey || err == config.ErrNoSuchDbBucket {
+		return nil, errNoCache
+	}
+	return state, err
+}
+
+func driveFileFromCache(cf *config.CachedFile) (*drive.File, error) {
+	f := drive.File{}
+	if err := json.Unmarshal(cf.Data, &f); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func cachedFileFor(f *drive.File) (*config.CachedFile, error) {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+
+	cf := &config.CachedFile{Id: f.Id, Data: data}
+	for _, p := range f.Parents {
+		if p != nil {
+			cf.ParentIds = append(cf.ParentIds, p.Id)
+		}
+	}
+	return cf, nil
+}
+
+func (cb *cacheBackend) lookup(id string) (*drive.File, error) {
+	if id == cb.backend.RootId() || id == "root" {
+		state, err := cb.state()
+		if err != nil {
+			return nil, err
+		}
+		id = state.RootId
+	}
+
+	cf, err := cb.context.CachedFileById(id)
+	if err == config.ErrNoSuchDbKey {
+		if _, sErr := cb.state(); sErr != nil {
+			return nil, sErr
+		}
+		return nil, ErrPathNotExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	return driveFileFromCache(cf)
+}
+
+// children returns, sorted like the memory backend does, the
+// files in the folder parentId that satisfy the predicate.
+func (cb *cacheBackend) children(parentId string, pred func(*drive.File) bool) ([]*File, error) {
+	if _, err := cb.state(); err != nil {
+		return nil, err
+	}
+
+	cached, err := cb.context.CachedChildren(parentId)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []*drive.File
+	for _, cf := range cached {
+		f, err := driveFileFromCache(cf)
+		if err != nil {
+			return nil, err
+		}
+		if pred(f) {
+			files = append(files, f)
+		}
+	}
+	return sortedRemoteFiles(files), nil
+}
+
+// filter returns the cached files that satisfy the predicate.
+func (cb *cacheBackend) filter(pred func(*drive.File) bool) ([]*File, error) {
+	if _, err := cb.state(); err != nil {
+		return nil, err
+	}
+
+	var files []*drive.File
+	err := cb.context.ForEachCachedFile(func(cf *config.CachedFile) error {
+		f, err := driveFileFromCache(cf)
+		if err != nil {
+			return err
+		}
+		if pred(f) {
+			files = append(files, f)
+		}
+		return nil
+	})
+	return sortedRemoteFiles(files), err
+}
+
+func sortedRemoteFiles(files []*drive.File) (sorted []*File) {
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Title != files[j].Title {
+			return files[i].Title < files[j].Title
+		}
+		return files[i].Id < files[j].Id
+	})
+
+	for _, f := range files {
+		sorted = append(sorted, NewRemoteFile(f))
+	}
+	return sorted
+}
+
+func filesPage(files []*File, err error) *paginationPair {
+	if err != nil {
+		return wrapInPaginationPair(nil, err)
+	}
+	return memoryPage(files, false)
+}
+
+func (cb *cacheBackend) RootId() string {
+	state, err := cb.state()
+	if err != nil {
+		return cb.backend.RootId()
+	}
+	return state.RootId
+}
+
+func (cb *cacheBackend) FindById(id string) (*File, error) {
+	f, err := cb.lookup(id)
+	if err != nil {
+		return nil, err
+	}
+	return NewRemoteFile(f), nil
+}
+
+func (cb *cacheBackend) FindByIdM(id string) *paginationPair {
+	f, err := cb.FindById(id)
+	return wrapInPaginationPair(f, err)
+}
+
+// resolvePath resolves the path segments just like the memory backend does.
+func (cb *cacheBackend) resolvePath(parentId string, p []string, trashed bool) ([]*File, error) {
+	if len(p) < 1 {
+		return nil, nil
+	}
+
+	head := urlToPath(p[0], false)
+	titled := func(f *drive.File) bool {
+		return f.Title == head && isTrashed(f) == trashed
+	}
+
+	var matches []*File
+	var err error
+	if trashed {
+		matches, err = cb.filter(titled)
+	} else {
+		matches, err = cb.children(parentId, titled)
+	}
+	if err != nil || len(p) == 1 {
+		return matches, err
+	}
+
+	var resolved []*File
+	for _, f := range matches {
+		subResolved, err := cb.resolvePath(f.Id, p[1:], trashed)
+		if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, subResolved...)
+	}
+	return resolved, nil
+}
+
+func (cb *cacheBackend) findByPath(p string, trashed bool) (*File, error) {
+	if rootLike(p) {
+		return cb.FindById(cb.RootId())
+	}
+
+	resolved, err := cb.resolvePath(cb.RootId(), strings.Split(p, RemoteSeparator)[1:], trashed)
+	if err != nil {
+		return nil, err
+	}
+	if len(resolved) < 1 {
+		return nil, ErrPathNotExists
+	}
+	return resolved[0], nil
+}
+
+func (cb *cacheBackend) findByPathM(p string, trashed bool) *paginationPair {
+	if rootLike(p) {
+		return cb.FindByIdM(cb.RootId())
+	}
+
+	resolved, err := cb.resolvePath(cb.RootId(), strings.Split(p, RemoteSeparator)[1:], trashed)
+	if err != nil {
+		return wrapInPaginationPair(nil, err)
+	}
+	return memoryPage(resolved, true)
+}
+
+func (cb *cacheBackend) FindByPath(p string) (*File, error) {
+	return cb.findByPath(p, false)
+}
+
+func (cb *cacheBackend) FindByPathM(p string) *paginationPair {
+	return cb.findByPathM(p, false)
+}
+
+func (cb *cacheBackend) FindByPathTrashed(p string) (*File, error) {
+	return cb.findByPath(p, true)
+}
+
+func (cb *cacheBackend) FindByPathTrashedM(p string) *paginationPair {
+	return cb.findByPathM(p, true)
+}
+
+func (cb *cacheBackend) FindByPathShared(p string) *paginationPair {
+	parts := NonEmptyStrings(strings.Split(p, "/")...)
+	if p == "root" {
+		parts = nil
+	}
+
+	return filesPage(cb.filter(func(f *drive.File) bool {
+		if len(parts) >= 1 && f.Title != parts[0] {
+			return false
+		}
+		return f.Shared
+	}))
+}
+
+func (cb *cacheBackend) FindByParentId(parentId string, hidden bool) *paginationPair {
+	return filesPage(cb.children(parentId, func(f *drive.File) bool {
+		return !isTrashed(f) && !isHidden(f.Title, hidden)
+	}))
+}
+
+func (cb *cacheBackend) findChildren(parentId string, trashed bool) *paginationPair {
+	return filesPage(cb.children(parentId, func(f *drive.File) bool {
+		return isTrashed(f) == trashed
+	}))
+}
+
+func (cb *cacheBackend) listChildren(lq *listQuery) *paginationPair {
+	return filesPage(cb.children(lq.parentId, func(f *drive.File) bool {
+		if isTrashed(f) != lq.inTrash {
+			return false
+		}
+		if (lq.typeMask&Folder) != 0 && f.MimeType != DriveFolderMimeType {
+			return false
+		}
+		if isHidden(f.Title, lq.hidden) {
+			return false
+		}
+		return lq.matchQuery == nil || lq.matchQuery.satisfiedBy(f)
+	}))
+}
+
+func (cb *cacheBackend) FindBackPaths(id string) ([]string, error) {
+	return findBackPaths(cb, id)
+}
+
+func (cb *cacheBackend) FindStarred(trashed, hidden bool) *paginationPair {
+	return filesPage(cb.filter(func(f *drive.File) bool {
+		return isStarred(f) && isTrashed(f) == trashed && !isHidden(f.Title, hidden)
+	}))
+}
+
+func (cb *cacheBackend) FindMatches(mq *matchQuery) *paginationPair {
+	if mq.anywhere {
+		rootId := cb.RootId()
+		return filesPage(cb.filter(func(f *drive.File) bool {
+			return f.Id != rootId && isTrashed(f) == mq.inTrash && mq.satisfiedBy(f)
+		}))
+	}
+
+	parent, err := cb.FindByPath(mq.dirPath)
+	if err != nil {
+		return wrapInPaginationPair(parent, err)
+	}
+
+	return filesPage(cb.children(parent.Id, mq.satisfiedBy))
+}
+
+func (cb *cacheBackend) listPermissions(id string) ([]*drive.Permission, error) {
+	f, err := cb.lookup(id)
+	if err != nil {
+		return nil, err
+	}
+	return f.Permissions, nil
+}
+
+// Cache builds the metadata cache that `-offline` lookups and listings
+// are answered from, or if it was already built, brings it up to date
+// with the changes made since. Rebuilding discards the cache first.
+func (g *Commands) Cache(rebuild bool) error {
+	state, err := g.context.CacheState()
+	if rebuild || err == config.ErrNoSuchDbKey || err == config.ErrNoSuchDbBucket {
+		return g.buildCache()
+	}
+	if err != nil {
+		return err
+	}
+	return g.refreshCache(state)
+}
+
+func (g *Commands) buildCache() error {
+	// Changes made while listing are replayed by the next refresh.
+	about, err := g.rem.About()
+	if err != nil {
+		return err
+	}
+	root, err := g.rem.FindById(g.rem.RootId())
+	if err != nil {
+		return err
+	}
+
+	spin := g.playabler()
+	spin.play()
+	defer spin.stop()
+
+	var files []*config.CachedFile
+	err = g.rem.allFiles(func(f *drive.File) error {
+		cf, err := cachedFileFor(f)
+		if err != nil {
+			return err
+		}
+		files = append(files, cf)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	state := &config.CacheState{
+		RootId:          root.Id,
+		LargestChangeId: about.LargestChangeId,
+		UpdateTime:      time.Now().Unix(),
+	}
+	if err := g.context.ResetCache(state, files); err != nil {
+		return err
+	}
+
+	g.log.Logf("cache: %d files as of change %d\n", len(files), state.LargestChangeId)
+	return nil
+}
+
+func (g *Commands) refreshCache(state *config.CacheState) error {
+	// A file can change several times since the last
+	// refresh, only its latest state matters.
+	largestChangeId := state.LargestChangeId
+	var fileIds []string
+	latest := map[string]*drive.Change{}
+	err := g.rem.changes(state.LargestChangeId+1, func(change *drive.Change) error {
+		if change.Id > largestChangeId {
+			largestChangeId = change.Id
+		}
+		if _, ok := latest[change.FileId]; !ok {
+			fileIds = append(fileIds, change.FileId)
+		}
+		latest[change.FileId] = change
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	state.LargestChangeId = largestChangeId
+
+	var files []*config.CachedFile
+	var removedIds []string
+	for _, fileId := range fileIds {
+		change := latest[fileId]
+		if change.Deleted || change.File == nil {
+			removedIds = append(removedIds, fileId)
+			continue
+		}
+
+		cf, err := cachedFileFor(change.File)
+		if err != nil {
+			return err
+		}
+		files = append(files, cf)
+	}
+
+	state.UpdateTime = time.Now().Unix()
+	if err := g.context.UpdateCache(state, files, removedIds); err != nil {
+		return err
+	}
+
+	g.log.Logf("cache: %d updated, %d removed as of change %d\n", len(files), len(removedIds), state.LargestChangeId)
+	return nil
+}
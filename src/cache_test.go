@@ -0,0 +1,110 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"os"
+	"testing"
+)
+
+func TestCacheAnswersOffline(t *testing.T) {
+	mb := NewMemoryBackend()
+
+	context := memoryTestContext(t)
+	defer os.RemoveAll(context.AbsPath)
+
+	writeTestFiles(t, context.AbsPath, map[string]string{
+		"a.txt":          "alpha",
+		"docs/b.txt":     "bravo",
+		"docs/old/c.txt": "charlie",
+	})
+	if err := NewWithBackend(context, memoryTestOptions("/"), mb).Push(); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	cb := newCacheBackend(context, mb)
+	if _, err := cb.FindByPath("/a.txt"); err != errNoCache {
+		t.Fatalf("expected errNoCache before building the cache, got %v", err)
+	}
+
+	if err := NewWithBackend(context, memoryTestOptions("/"), mb).Cache(false); err != nil {
+		t.Fatalf("cache: %v", err)
+	}
+
+	children := func(p string) (names []string) {
+		parent, err := cb.FindByPath(p)
+		if err != nil {
+			t.Fatalf("findByPath %q: %v", p, err)
+		}
+		for f := range cb.listChildren(&listQuery{parentId: parent.Id}).filesChan {
+			names = append(names, f.Name)
+		}
+		return names
+	}
+
+	if got := children("/docs"); len(got) != 2 || got[0] != "b.txt" || got[1] != "old" {
+		t.Errorf("children of /docs: got %v", got)
+	}
+
+	c, err := cb.FindByPath("/docs/old/c.txt")
+	if err != nil {
+		t.Fatalf("findByPath: %v", err)
+	}
+	if c.Size != int64(len("charlie")) {
+		t.Errorf("size: got %d", c.Size)
+	}
+	want, _ := mb.FindBackPaths(c.Id)
+	if got, _ := cb.FindBackPaths(c.Id); len(got) != 1 || got[0] != want[0] {
+		t.Errorf("backPaths: got %v want %v", got, want)
+	}
+
+	// Changes only show up offline once the cache is refreshed.
+	writeTestFiles(t, context.AbsPath, map[string]string{"docs/d.txt": "delta"})
+	if err := NewWithBackend(context, memoryTestOptions("/docs/d.txt"), mb).Push(); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	if err := NewWithBackend(context, memoryTestOptions("/docs/old"), mb).Trash(false); err != nil {
+		t.Fatalf("trash: %v", err)
+	}
+	if err := mb.Delete(c.Id); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	if got := children("/docs"); len(got) != 2 {
+		t.Errorf("children of /docs before refreshing: got %v", got)
+	}
+
+	if err := NewWithBackend(context, memoryTestOptions("/"), mb).Cache(false); err != nil {
+		t.Fatalf("cache refresh: %v", err)
+	}
+
+	if got := children("/docs"); len(got) != 2 || got[0] != "b.txt" || got[1] != "d.txt" {
+		t.Errorf("children of /docs after refreshing: got %v", got)
+	}
+	if _, err := cb.FindById(c.Id); err != ErrPathNotExists {
+		t.Errorf("deleted file: expected ErrPathNotExists, got %v", err)
+	}
+	if _, err := cb.FindByPathTrashed("/old"); err != nil {
+		t.Errorf("trashed folder: %v", err)
+	}
+
+	opts := memoryTestOptions("/docs")
+	if err := NewWithBackend(context, opts, cb).List(false); err != nil {
+		t.Errorf("offline list: %v", err)
+	}
+	if err := NewWithBackend(context, opts, cb).Stat(); err != nil {
+		t.Errorf("offline stat: %v", err)
+	}
+}
@@ -341,7 +341,7 @@ func (g *Commands) resolveChangeListRecv(clr *changeListResolve) (cl, clashes []
 		return
 	}
 
-	explicitlyRequested := g.opts.ExplicitlyExport && hasExportLinks(r) && len(g.opts.Exports) >= 1
+	explicitlyRequested := g.opts.ExplicitlyExport && hasExportLinks(r) && len(g.exportsFor(r, g.opts.Exports)) >= 1
 
 	if clr.push {
 		// Handle the case of doc files for which we don't have a direct download
@@ -349,8 +349,18 @@ func (g *Commands) resolveChangeListRecv(clr *changeListResolve) (cl, clashes []
 		if hasExportLinks(r) {
 			return cl, clashes, nil
 		}
+		// Shortcuts are pulled as symlinks, link files or their targets'
+		// content, none of which should be pushed in their place.
+		if isShortcut(r) {
+			return cl, clashes, nil
+		}
 		change = &Change{Path: clr.remoteBase, Src: l, Dest: r, Parent: dir, g: g}
 	} else {
+		if isShortcut(r) && l != nil && !g.opts.Force {
+			// Shortcuts have no content of their own to compare with what
+			// was pulled for them, which only gets recreated when forced.
+			return cl, clashes, nil
+		}
 		exportable := !g.opts.Force && hasExportLinks(r)
 		if exportable && !explicitlyRequested {
 			// The case when we have files that don't provide the download urls
@@ -807,7 +817,12 @@ func previewChanges(clArgs *changeListArg, reduce bool, opMap map[Operation]size
 
 	for _, c := range cl {
 		op := c.Op()
-		if op != OpNone {
+		if op == OpNone {
+			continue
+		}
+		if c.syncTarget != "" {
+			logy.Logln(c.Symbol(), c.syncTarget, c.Path)
+		} else {
 			logy.Logln(c.Symbol(), c.Path)
 		}
 	}
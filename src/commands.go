@@ -21,6 +21,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sync/atomic"
 
 	"github.com/cheggaaa/pb"
 	"github.com/mattn/go-isatty"
@@ -43,6 +44,11 @@ type Options struct {
 	// If not provided, will export them to the same dir as the source files are
 	ExportsDir string
 
+	// ExportMap maps the mime types of Google Docs to the formats to
+	// export each type to e.g {"application/vnd.google-apps.spreadsheet": ["xlsx" "csv"]}
+	// Types missing from it are exported to Exports.
+	ExportMap map[string][]string
+
 	// ExportsDumpToSameDirectory when set, requests that all exports be put in the
 	// same directory instead of in a directory that is prefixed first by the file name
 	ExportsDumpToSameDirectory bool
@@ -110,6 +116,12 @@ type Options struct {
 	// See issue #697.
 	AllowURLLinkedFiles bool
 
+	// ShortcutPolicy decides how shortcuts are pulled.
+	ShortcutPolicy ShortcutPolicy
+	// MultiParentLinks decides how the local copies of
+	// a file that has several parents are linked.
+	MultiParentLinks MultiParentLinkMode
+
 	// Chunksize is the size per block of data uploaded.
 	// If not set, the default value from googleapi.DefaultUploadChunkSize
 	// is used instead.
@@ -118,6 +130,26 @@ type Options struct {
 
 	// Limit the upload bandwidth to n KiB/s.
 	UploadRateLimit int
+
+	// Limit the combined bandwidth of all downloads to n KiB/s.
+	DownloadRateLimit int
+
+	// Revision when set is the id of the revision of the
+	// file to pull instead of its current content.
+	Revision string
+	// RevisionDest is the local path to save the pulled revision to.
+	RevisionDest string
+	// KeepForever pins a restored revision so that Google Drive
+	// doesn't purge it once newer revisions come in.
+	KeepForever bool
+
+	// Offline when set answers lookups and listings from
+	// the metadata cache instead of from Google Drive.
+	Offline bool
+
+	// Output is the format, e.g OutputJSONL, that list, stat, diff,
+	// about, md5sum and id print in. OutputText if not set.
+	Output string
 }
 
 func (opts *Options) CryptoEnabled() bool {
@@ -126,20 +158,39 @@ func (opts *Options) CryptoEnabled() bool {
 
 type Commands struct {
 	context *config.Context
-	rem     *Remote
+	rem     backend
 	opts    *Options
 	rcOpts  *Options
 	log     *log.Logger
 
 	progress      *pb.ProgressBar
 	mkdirAllCache *expirableCache.OperationCache
+
+	// progressChan is told the number of bytes transferred by the
+	// uploads and downloads of the command. It is closed once a run
+	// completes, so each Commands has its own instead of the backend.
+	progressChan chan int
+
+	// downloadThrottle is shared by all the downloads of
+	// the run, it is nil if downloads aren't rate limited.
+	downloadThrottle *bandwidthThrottle
+
+	// progressListener when set is told the number of bytes
+	// done out of the total each time that tasks make progress.
+	progressListener     func(done, total int64)
+	tasksDone, tasksSize int64
+
+	// recordListener when set is handed the records of the
+	// command instead of them being printed, see emitRecord.
+	recordListener func(record interface{})
+	recordCount    int
 }
 
 func (opts *Options) canPrompt() bool {
 	if opts == nil || !opts.StdoutIsTty {
 		return false
 	}
-	if opts.Quiet {
+	if opts.Quiet || opts.structuredOutput() {
 		return false
 	}
 	return !opts.NoPrompt
@@ -156,7 +207,8 @@ func (opts *Options) canPreview() bool {
 	if opts == nil || !opts.StdoutIsTty {
 		return false
 	}
-	if opts.Quiet {
+	// Previews and progress bars would garble the records.
+	if opts.Quiet || opts.structuredOutput() {
 		return false
 	}
 	return true
@@ -198,9 +250,18 @@ func (opts *Options) rcPath() (string, error) {
 }
 
 func New(context *config.Context, opts *Options) *Commands {
-	var rem *Remote
-	var err error
+	rem, err := remoteForContext(context)
+	if err != nil {
+		panic(fmt.Errorf("failed to initialize remoteContext: %v", err))
+	}
 
+	if opts != nil && opts.Offline {
+		return NewWithBackend(context, opts, newCacheBackend(context, rem))
+	}
+	return NewWithBackend(context, opts, rem)
+}
+
+func remoteForContext(context *config.Context) (rem *Remote, err error) {
 	if context.GSAJWTConfig != nil {
 		rem, err = NewRemoteContextFromServiceAccount(context.GSAJWTConfig)
 	} else {
@@ -208,8 +269,22 @@ func New(context *config.Context, opts *Options) *Commands {
 	}
 
 	if err != nil {
-		panic(fmt.Errorf("failed to initialize remoteContext: %v", err))
+		return nil, err
+	}
+
+	rem.sharedDriveId = context.SharedDriveId
+
+	if qps, ok := maxQPSFromRc(context.AbsPath); ok {
+		SetMaxQPS(float64(qps))
 	}
+	return rem, nil
+}
+
+// NewWithBackend is like New except that all remote operations
+// are performed against the supplied backend, for example one
+// created by NewMemoryBackend, instead of Google Drive.
+func NewWithBackend(context *config.Context, opts *Options, b Backend) *Commands {
+	rem := asBackend(b)
 
 	stdin, stdout, stderr := os.Stdin, os.Stdout, os.Stderr
 
@@ -252,12 +327,20 @@ func New(context *config.Context, opts *Options) *Commands {
 		}
 	}
 
+	var downloadThrottle *bandwidthThrottle
+	if opts != nil && opts.DownloadRateLimit > 0 {
+		// DownloadRateLimit is in KiB/s
+		downloadThrottle = newBandwidthThrottle(int64(opts.DownloadRateLimit) * 1024)
+	}
+
 	return &Commands{
-		context:       context,
-		rem:           rem,
-		opts:          opts,
-		log:           logger,
-		mkdirAllCache: expirableCache.New(),
+		context:          context,
+		rem:              rem,
+		opts:             opts,
+		log:              logger,
+		mkdirAllCache:    expirableCache.New(),
+		downloadThrottle: downloadThrottle,
+		progressChan:     make(chan int),
 	}
 }
 
@@ -265,6 +348,11 @@ func (g *Commands) taskStart(tasks int64) {
 	if tasks > 0 && g.opts.canPreview() {
 		g.progress = newProgressBar(tasks)
 	}
+	if tasks > 0 && g.progressListener != nil {
+		atomic.StoreInt64(&g.tasksDone, 0)
+		atomic.StoreInt64(&g.tasksSize, tasks)
+		g.progressListener(0, tasks)
+	}
 }
 
 func newProgressBar(total int64) *pb.ProgressBar {
@@ -277,6 +365,9 @@ func (g *Commands) taskAdd(n int64) {
 	if g.progress != nil {
 		g.progress.Add64(n)
 	}
+	if g.progressListener != nil {
+		g.progressListener(atomic.AddInt64(&g.tasksDone, n), atomic.LoadInt64(&g.tasksSize))
+	}
 }
 
 func (g *Commands) taskFinish() {
@@ -0,0 +1,267 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	drive "google.golang.org/api/drive/v2"
+)
+
+const (
+	CommentsActionList    = "list"
+	CommentsActionAdd     = "add"
+	CommentsActionReply   = "reply"
+	CommentsActionResolve = "resolve"
+)
+
+const (
+	commentStatusOpen     = "open"
+	commentStatusResolved = "resolved"
+
+	// Replies with these verbs change the status of their comment.
+	commentVerbResolve = "resolve"
+	commentVerbReopen  = "reopen"
+)
+
+type CommentsOptions struct {
+	// Action is one of CommentsActionList, Add, Reply or Resolve.
+	Action string
+	// CommentId is the id of the comment to reply to or resolve.
+	CommentId string
+	// Message is the content of the comment or reply.
+	Message string
+}
+
+func (r *Remote) listComments(fileId string) ([]*drive.Comment, error) {
+	var comments []*drive.Comment
+	err := r.service.Comments.List(fileId).Pages(context.Background(), func(res *drive.CommentList) error {
+		comments = append(comments, res.Items...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+func (r *Remote) getComment(fileId, commentId string) (*drive.Comment, error) {
+	return r.service.Comments.Get(fileId, commentId).Do()
+}
+
+func (r *Remote) insertComment(fileId string, comment *drive.Comment) (*drive.Comment, error) {
+	return r.service.Comments.Insert(fileId, comment).Do()
+}
+
+func (r *Remote) insertReply(fileId, commentId string, reply *drive.CommentReply) (*drive.CommentReply, error) {
+	return r.service.Replies.Insert(fileId, commentId, reply).Do()
+}
+
+func commentAuthor(u *drive.User) string {
+	if u == nil {
+		return ""
+	}
+	if u.EmailAddress == "" {
+		return u.DisplayName
+	}
+	return fmt.Sprintf("%s <%s>", u.DisplayName, u.EmailAddress)
+}
+
+func commentStatus(c *drive.Comment) string {
+	if c.Status == "" {
+		return commentStatusOpen
+	}
+	return c.Status
+}
+
+func toCommentRecord(relToRootPath string, c *drive.Comment) *CommentRecord {
+	cj := &CommentRecord{
+		Path:      relToRootPath,
+		FileId:    c.FileId,
+		CommentId: c.CommentId,
+		Author:    commentAuthor(c.Author),
+		Content:   c.Content,
+		Anchor:    c.Anchor,
+		Status:    commentStatus(c),
+		Created:   c.CreatedDate,
+		Modified:  c.ModifiedDate,
+	}
+	if c.Context != nil {
+		cj.Quote = c.Context.Value
+	}
+
+	for _, reply := range c.Replies {
+		if reply == nil || reply.Deleted {
+			continue
+		}
+		cj.Replies = append(cj.Replies, &ReplyRecord{
+			ReplyId: reply.ReplyId,
+			Author:  commentAuthor(reply.Author),
+			Content: reply.Content,
+			Verb:    reply.Verb,
+			Created: reply.CreatedDate,
+		})
+	}
+	return cj
+}
+
+// Comments lists the comments on the files in g.opts.Sources or, depending
+// on co.Action, adds a comment to, replies to or resolves a comment on the
+// file in g.opts.Sources[0].
+func (g *Commands) Comments(co *CommentsOptions) error {
+	switch co.Action {
+	case "", CommentsActionList:
+		return g.listCommentsOfSources(co)
+	case CommentsActionAdd, CommentsActionReply, CommentsActionResolve:
+	default:
+		return invalidArgumentsErr(fmt.Errorf("comments: unknown action %s", customQuote(co.Action)))
+	}
+
+	if len(g.opts.Sources) != 1 {
+		return invalidArgumentsErr(fmt.Errorf("comments %s: expecting exactly one path", co.Action))
+	}
+
+	relToRootPath := g.opts.Sources[0]
+	f, err := g.rem.FindByPath(relToRootPath)
+	if err != nil {
+		return err
+	}
+
+	var comment *drive.Comment
+	switch co.Action {
+	case CommentsActionAdd:
+		if co.Message == "" {
+			return invalidArgumentsErr(fmt.Errorf("comments %s: expecting a message", co.Action))
+		}
+		comment, err = g.rem.insertComment(f.Id, &drive.Comment{Content: co.Message})
+
+	default:
+		comment, err = g.replyToComment(f, co)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	g.emitComment(co, relToRootPath, comment)
+	return nil
+}
+
+func (g *Commands) replyToComment(f *File, co *CommentsOptions) (*drive.Comment, error) {
+	if co.CommentId == "" {
+		return nil, invalidArgumentsErr(fmt.Errorf("comments %s: expecting a comment id", co.Action))
+	}
+
+	reply := &drive.CommentReply{Content: co.Message}
+	switch co.Action {
+	case CommentsActionReply:
+		if co.Message == "" {
+			return nil, invalidArgumentsErr(fmt.Errorf("comments %s: expecting a message", co.Action))
+		}
+	case CommentsActionResolve:
+		reply.Verb = commentVerbResolve
+	}
+
+	// Ensure that the comment exists on this very file before replying.
+	if _, err := g.rem.getComment(f.Id, co.CommentId); err != nil {
+		return nil, err
+	}
+
+	if _, err := g.rem.insertReply(f.Id, co.CommentId, reply); err != nil {
+		return nil, err
+	}
+	return g.rem.getComment(f.Id, co.CommentId)
+}
+
+func (g *Commands) listCommentsOfSources(co *CommentsOptions) (err error) {
+	defer g.endRecords()
+
+	for _, relToRootPath := range g.opts.Sources {
+		if lErr := g.listCommentsOf(co, relToRootPath); lErr != nil {
+			msg := fmt.Sprintf("comments: %s err: %v\n", relToRootPath, lErr)
+			err = reComposeError(err, msg)
+			err = copyErrStatusCode(err, lErr)
+		}
+	}
+	return err
+}
+
+func (g *Commands) listCommentsOf(co *CommentsOptions, relToRootPath string) error {
+	f, err := g.rem.FindByPath(relToRootPath)
+	if err != nil {
+		return err
+	}
+
+	comments, err := g.rem.listComments(f.Id)
+	if err != nil {
+		return err
+	}
+
+	if !g.opts.structuredOutput() && len(comments) >= 1 {
+		g.log.Logf("\n\033[92m%s\033[00m\n", relToRootPath)
+	}
+
+	for _, comment := range comments {
+		if comment.Deleted {
+			continue
+		}
+		g.emitComment(co, relToRootPath, comment)
+	}
+	return nil
+}
+
+func (g *Commands) emitComment(co *CommentsOptions, relToRootPath string, comment *drive.Comment) {
+	cj := toCommentRecord(relToRootPath, comment)
+
+	if g.opts.structuredOutput() {
+		switch co.Action {
+		case "", CommentsActionList:
+			g.emitRecord(cj)
+		default:
+			g.emitDocument(cj)
+		}
+		return
+	}
+
+	g.log.Logf("\n[%s] %s %s %s\n", cj.Status, cj.CommentId, cj.Author, formatCommentTime(cj.Created))
+	if cj.Anchor != "" {
+		g.log.Logf("  anchor: %s\n", cj.Anchor)
+	}
+	if cj.Quote != "" {
+		g.log.Logf("  > %s\n", strings.Replace(cj.Quote, "\n", "\n  > ", -1))
+	}
+	g.log.Logf("  %s\n", strings.Replace(cj.Content, "\n", "\n  ", -1))
+
+	for _, reply := range cj.Replies {
+		verb := ""
+		if reply.Verb != "" {
+			verb = fmt.Sprintf(" (%s)", reply.Verb)
+		}
+		g.log.Logf("    %s %s %s%s\n", reply.ReplyId, reply.Author, formatCommentTime(reply.Created), verb)
+		if reply.Content != "" {
+			g.log.Logf("      %s\n", strings.Replace(reply.Content, "\n", "\n      ", -1))
+		}
+	}
+}
+
+func formatCommentTime(ts string) string {
+	t := parseTime(ts, true)
+	if t.IsZero() {
+		return ts
+	}
+	return t.Local().Format(revisionTimeFmt)
+}
@@ -0,0 +1,94 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"os"
+	"testing"
+
+	drive "google.golang.org/api/drive/v2"
+)
+
+func TestToCommentRecord(t *testing.T) {
+	comment := &drive.Comment{
+		CommentId: "c1",
+		Content:   "check the totals",
+		Author:    &drive.User{DisplayName: "Ann", EmailAddress: "ann@example.com"},
+		Context:   &drive.CommentContext{Value: "total: 42"},
+		Replies: []*drive.CommentReply{
+			{ReplyId: "r1", Content: "fixed", Author: &drive.User{DisplayName: "Bob"}},
+			{ReplyId: "r2", Content: "retracted", Deleted: true},
+			{ReplyId: "r3", Verb: commentVerbResolve},
+		},
+	}
+
+	cj := toCommentRecord("/report.txt", comment)
+	if cj.Status != commentStatusOpen {
+		t.Errorf("status: got %q want %q", cj.Status, commentStatusOpen)
+	}
+	if cj.Author != "Ann <ann@example.com>" {
+		t.Errorf("author: got %q", cj.Author)
+	}
+	if cj.Quote != "total: 42" {
+		t.Errorf("quote: got %q", cj.Quote)
+	}
+	if len(cj.Replies) != 2 {
+		t.Fatalf("replies: got %d want 2, deleted replies are left out", len(cj.Replies))
+	}
+	if cj.Replies[0].Author != "Bob" || cj.Replies[1].Verb != commentVerbResolve {
+		t.Errorf("replies: got %+v and %+v", cj.Replies[0], cj.Replies[1])
+	}
+}
+
+func TestCommentsRejectsBadArguments(t *testing.T) {
+	mb, context := memoryTestPush(t, map[string]string{
+		"report.txt": "quarterly numbers",
+		"other.txt":  "other numbers",
+	})
+	defer os.RemoveAll(context.AbsPath)
+
+	other, err := mb.FindByPath("/other.txt")
+	if err != nil {
+		t.Fatalf("findByPath: %v", err)
+	}
+	elsewhere, err := mb.insertComment(other.Id, &drive.Comment{Content: "on another file"})
+	if err != nil {
+		t.Fatalf("insertComment: %v", err)
+	}
+
+	cases := []struct {
+		desc    string
+		sources []string
+		co      *CommentsOptions
+	}{
+		{"unknown action", []string{"/report.txt"}, &CommentsOptions{Action: "edit"}},
+		{"add without a message", []string{"/report.txt"}, &CommentsOptions{Action: CommentsActionAdd}},
+		{"add to two files", []string{"/report.txt", "/other.txt"}, &CommentsOptions{Action: CommentsActionAdd, Message: "hi"}},
+		{"reply without a comment", []string{"/report.txt"}, &CommentsOptions{Action: CommentsActionReply, Message: "hi"}},
+		{"reply without a message", []string{"/report.txt"}, &CommentsOptions{Action: CommentsActionReply, CommentId: elsewhere.CommentId}},
+		{"reply to a missing comment", []string{"/report.txt"}, &CommentsOptions{Action: CommentsActionReply, CommentId: "no-such-comment", Message: "hi"}},
+		{"resolve another file's comment", []string{"/report.txt"}, &CommentsOptions{Action: CommentsActionResolve, CommentId: elsewhere.CommentId}},
+	}
+
+	for _, tc := range cases {
+		if err := NewWithBackend(context, memoryTestOptions(tc.sources...), mb).Comments(tc.co); err == nil {
+			t.Errorf("%s: succeeded", tc.desc)
+		}
+	}
+
+	if comment, err := mb.getComment(other.Id, elsewhere.CommentId); err != nil || len(comment.Replies) != 0 {
+		t.Errorf("the comment on other.txt was replied to: %v", err)
+	}
+}
@@ -15,6 +15,7 @@
 package drive
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -110,8 +111,18 @@ func (g *Commands) Diff() (err error) {
 		_, dst.skipContentCheck = meta[SkipContentCheckKey]
 	}
 
+	if g.opts.structuredOutput() {
+		defer g.endRecords()
+	}
+
 	for _, c := range cl {
 		dst.change = c
+		if g.opts.structuredOutput() {
+			if dErr := g.emitChange(dst); dErr != nil {
+				g.emitError(dErr)
+			}
+			continue
+		}
 		dErr := g.perDiff(dst)
 		if dErr != nil {
 			g.log.LogErrln(dErr)
@@ -120,9 +131,46 @@ func (g *Commands) Diff() (err error) {
 	return
 }
 
+// emitChange emits the change of dSt as a record,
+// with the hunks of its content if that differs.
+func (g *Commands) emitChange(dSt diffSt) error {
+	change := dSt.change
+	l, r := change.Src, change.Dest
+
+	mask := fileDifferences(r, l, g.opts.IgnoreChecksum)
+	if mask == DifferNone {
+		return nil
+	}
+
+	record := &ChangeRecord{
+		Path:        change.Path,
+		Operation:   change.Op(),
+		Crud:        change.crudValue(),
+		Differences: differenceNames(mask),
+	}
+	if l != nil {
+		record.Local = newFileRecord(change.Path, l)
+	}
+	if r != nil {
+		record.Remote = newFileRecord(change.Path, r)
+	}
+
+	contentDiffers := checksumDiffers(mask) || sizeDiffers(mask)
+	if l != nil && r != nil && !l.IsDir && !r.IsDir && contentDiffers && !dSt.skipContentCheck {
+		var output bytes.Buffer
+		dSt.mask |= DiffUnified
+		if err := g.diffContent(dSt, &output); err != nil {
+			return err
+		}
+		record.Hunks = parseUnifiedDiff(output.String())
+	}
+
+	g.emitRecord(record)
+	return nil
+}
+
 func (g *Commands) perDiff(dSt diffSt) (err error) {
 	change := dSt.change
-	diffProgPath, cwd := dSt.diffProgPath, dSt.cwd
 
 	l, r := change.Src, change.Dest
 	if l == nil && r == nil {
@@ -186,6 +234,16 @@ func (g *Commands) perDiff(dSt diffSt) (err error) {
 		}
 	}()
 
+	return g.diffContent(dSt, os.Stdout)
+}
+
+// diffContent writes the output of diff(1) between
+// the local and remote content of dSt's change to stdout.
+func (g *Commands) diffContent(dSt diffSt, stdout io.Writer) (err error) {
+	change := dSt.change
+	diffProgPath, cwd := dSt.diffProgPath, dSt.cwd
+	l, r := change.Src, change.Dest
+
 	if r.BlobAt == "" {
 		return illogicalStateErr(fmt.Errorf("Cannot access download link for '%v'", r.Name))
 	}
@@ -252,7 +310,7 @@ func (g *Commands) perDiff(dSt diffSt) (err error) {
 		Dir:    cwd,
 		Path:   diffProgPath,
 		Stdin:  nil,
-		Stdout: os.Stdout,
+		Stdout: stdout,
 		Stderr: os.Stderr,
 	}
 
@@ -0,0 +1,333 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/odeke-em/drive/config"
+	"google.golang.org/api/googleapi"
+)
+
+// exportMapDocTypes maps the names by which an export map
+// can refer to the Google Apps types to their mime types.
+var exportMapDocTypes = map[string]string{
+	"docs":         "application/vnd.google-apps.document",
+	"doc":          "application/vnd.google-apps.document",
+	"document":     "application/vnd.google-apps.document",
+	"sheets":       "application/vnd.google-apps.spreadsheet",
+	"sheet":        "application/vnd.google-apps.spreadsheet",
+	"spreadsheet":  "application/vnd.google-apps.spreadsheet",
+	"slides":       "application/vnd.google-apps.presentation",
+	"slide":        "application/vnd.google-apps.presentation",
+	"presentation": "application/vnd.google-apps.presentation",
+	"drawings":     "application/vnd.google-apps.drawing",
+	"drawing":      "application/vnd.google-apps.drawing",
+	"script":       "application/vnd.google-apps.script",
+	"apps-script":  "application/vnd.google-apps.script",
+}
+
+// exportMimeTypesByExt lists the mime types, besides the one guessed
+// from the extension, that Google Apps types are exported as.
+var exportMimeTypesByExt = map[string][]string{
+	"md":   {"text/markdown", "text/x-markdown"},
+	"json": {"application/vnd.google-apps.script+json"},
+}
+
+// ParseExportMap parses an export map of the form
+//
+//	docs=docx,md;sheets=xlsx,csv;slides=pdf
+//
+// The types are either those of exportMapDocTypes or mime types.
+func ParseExportMap(spec string) (map[string][]string, error) {
+	kvMap := make(map[string]string)
+	for _, clause := range NonEmptyTrimmedStrings(strings.Split(spec, ";")...) {
+		splits := strings.SplitN(clause, "=", 2)
+		if len(splits) != 2 {
+			return nil, invalidArgumentsErr(fmt.Errorf("export map: expected <type>=<formats> instead got %q", clause))
+		}
+		kvMap[splits[0]] = splits[1]
+	}
+	return exportMapFromClauses(kvMap)
+}
+
+// ExportMapFromRC reads the export map from the
+// ExportMapKey section of the .driverc for rcSourcePath.
+func ExportMapFromRC(rcSourcePath string) (map[string][]string, error) {
+	opts := Options{Path: rcSourcePath}
+	rcPath, err := opts.rcPath()
+	if err != nil {
+		if NotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	nsRCMap, err := kvifyCommentedFile(rcPath, CommentStr)
+	if err != nil {
+		return nil, err
+	}
+	return exportMapFromClauses(nsRCMap[ExportMapKey])
+}
+
+func exportMapFromClauses(kvMap map[string]string) (map[string][]string, error) {
+	if len(kvMap) < 1 {
+		return nil, nil
+	}
+
+	exportMap := make(map[string][]string)
+	for docType, formats := range kvMap {
+		docType = strings.ToLower(strings.TrimSpace(docType))
+		mimeType, ok := exportMapDocTypes[docType]
+		if !ok {
+			if !strings.Contains(docType, "/") {
+				return nil, invalidArgumentsErr(fmt.Errorf("export map: unknown type %q", docType))
+			}
+			mimeType = docType
+		}
+
+		exts := NonEmptyTrimmedStrings(strings.Split(formats, ",")...)
+		for i, ext := range exts {
+			exts[i] = strings.TrimPrefix(strings.ToLower(ext), ".")
+		}
+		exportMap[mimeType] = exts
+	}
+
+	return exportMap, nil
+}
+
+// exportsFor returns the formats to export f to, those that
+// the export map has for its type otherwise the flat exports.
+func (g *Commands) exportsFor(f *File, exports []string) []string {
+	if f == nil {
+		return exports
+	}
+	if exts, ok := g.opts.ExportMap[f.MimeType]; ok {
+		return exts
+	}
+	return exports
+}
+
+// exportLink finds the link to export f as ext from.
+func exportLink(f *File, ext string) (mimeType, url string, ok bool) {
+	candidates := append([]string{mimeTypeFromExt(ext)}, exportMimeTypesByExt[ext]...)
+	for _, mimeType := range candidates {
+		if url, ok = f.ExportLinks[mimeType]; ok {
+			return mimeType, url, true
+		}
+	}
+	return "", "", false
+}
+
+// indexPulled indexes the Src of a pulled change along with the paths it
+// was exported to. The exports of an earlier pull that weren't made again
+// are removed, for example those named after what the file used to be called.
+func (g *Commands) indexPulled(change *Change) error {
+	f := change.Src
+	if f == nil {
+		return nil
+	}
+
+	index := f.ToIndex()
+	index.Path = change.Path
+	index.Exports = change.exports
+
+	if prev, err := g.context.DeserializeIndex(f.Id); err == nil {
+		if index.Exports == nil && prev.Path == index.Path {
+			// Nothing was exported this time so the earlier exports still stand.
+			index.Exports = prev.Exports
+		} else {
+			g.removeStaleExports(prev.Exports, index.Exports)
+		}
+	}
+
+	return g.context.SerializeIndex(index)
+}
+
+// removeExportsAt removes the exports recorded for the
+// file that was pulled to relToRootPath e.g once it is deleted.
+func (g *Commands) removeExportsAt(relToRootPath string) {
+	indicesByPath, err := g.context.IndicesByPath()
+	if err != nil {
+		return
+	}
+	if index, ok := indicesByPath[relToRootPath]; ok {
+		g.removeStaleExports(index.Exports, nil)
+	}
+}
+
+func (g *Commands) removeStaleExports(stale, keep []string) {
+	kept := make(map[string]bool)
+	for _, p := range keep {
+		kept[p] = true
+	}
+
+	for _, p := range stale {
+		if kept[p] {
+			continue
+		}
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			g.log.LogErrf("removing stale export %q: %v\n", p, err)
+			continue
+		}
+		g.log.Logf("Removed stale export '%s'\n", p)
+
+		// Exports dirs, and the per-sheet dirs within them, are
+		// only made by us so tidy them up once they are empty.
+		dir := filepath.Dir(p)
+		if parent := filepath.Dir(dir); strings.HasSuffix(parent, "_exports") {
+			os.Remove(dir)
+			dir = parent
+		}
+		if strings.HasSuffix(dir, "_exports") {
+			os.Remove(dir)
+		}
+	}
+}
+
+// pushExportsToSources looks for the exports of Google Docs among the
+// additions of a push. Those unedited since they were exported are dropped
+// since they only mirror their docs. When converting, edited exports update
+// the content of their docs in place rather than being added alongside
+// them. Docs that changed remotely since they were exported are conflicts
+// unless conflicts are ignored.
+func (g *Commands) pushExportsToSources(cl []*Change) (pushes, conflicts []*Change, err error) {
+	indicesByPath, err := g.context.IndicesByPath()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	exportSources := make(map[string]*config.Index)
+	for _, index := range indicesByPath {
+		for _, exportPath := range index.Exports {
+			exportSources[exportPath] = index
+		}
+	}
+	if len(exportSources) < 1 {
+		return cl, nil, nil
+	}
+
+	// The dirs that exports were made in are only pushed
+	// if anything besides the exports in them is pushed.
+	exportDirs := make(map[string]bool)
+	for exportPath := range exportSources {
+		dir := filepath.Dir(exportPath)
+		exportDirs[dir] = true
+		if parent := filepath.Dir(dir); strings.HasSuffix(parent, "_exports") {
+			exportDirs[parent] = true
+		}
+	}
+
+	var exportDirAdds []*Change
+	var pushedPaths []string
+	keep := func(c *Change) {
+		pushes = append(pushes, c)
+		if c.Src != nil {
+			pushedPaths = append(pushedPaths, c.Src.BlobAt)
+		}
+	}
+
+	for _, c := range cl {
+		if c.Op() != OpAdd || c.Src == nil {
+			keep(c)
+			continue
+		}
+		if c.Src.IsDir {
+			if exportDirs[c.Src.BlobAt] {
+				exportDirAdds = append(exportDirAdds, c)
+			} else {
+				keep(c)
+			}
+			continue
+		}
+
+		exportPath := c.Src.BlobAt
+		index, ok := exportSources[exportPath]
+		if !ok {
+			keep(c)
+			continue
+		}
+
+		if !c.Src.ModTime.After(time.Unix(index.ModTime, 0)) {
+			continue
+		}
+
+		ext := strings.TrimPrefix(filepath.Ext(exportPath), ".")
+		if exportedPerSheet(&File{MimeType: index.MimeType}, ext) {
+			g.log.LogErrf("%s: only holds one tab of %q so it can't replace it\n", exportPath, index.Path)
+			keep(c)
+			continue
+		}
+		if !convert(g.opts.TypeMask) {
+			g.log.LogErrf("%s: pass -%s to update %q with it\n", exportPath, ConvertKey, index.Path)
+			keep(c)
+			continue
+		}
+
+		doc, fErr := g.rem.FindById(index.FileId)
+		if fErr != nil {
+			// The doc is gone, the export is all that is left of it.
+			if gErr, ok := fErr.(*googleapi.Error); fErr == ErrPathNotExists || (ok && gErr.Code == http.StatusNotFound) {
+				keep(c)
+				continue
+			}
+			return nil, nil, fErr
+		}
+
+		// The doc keeps its name, its content is converted from the export's.
+		src := DupFile(c.Src)
+		src.Name = doc.Name
+		src.MimeType = guessMimeType(exportPath)
+
+		update := &Change{
+			Path:   index.Path,
+			Parent: path.Dir(index.Path),
+			Src:    src,
+			Dest:   doc,
+			Force:  c.Force,
+			g:      g,
+
+			IgnoreChecksum: c.IgnoreChecksum,
+			IgnoreConflict: true,
+
+			exports: index.Exports,
+		}
+
+		if doc.ModTime.Unix() != index.ModTime && !g.opts.IgnoreConflict {
+			update.IgnoreConflict = false
+			conflicts = append(conflicts, update)
+			continue
+		}
+		pushes = append(pushes, update)
+	}
+
+	for _, c := range exportDirAdds {
+		dirPrefix := c.Src.BlobAt + string(os.PathSeparator)
+		for _, p := range pushedPaths {
+			if strings.HasPrefix(p, dirPrefix) {
+				pushes = append(pushes, c)
+				break
+			}
+		}
+	}
+
+	return pushes, conflicts, nil
+}
@@ -0,0 +1,194 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseExportMap(t *testing.T) {
+	exportMap, err := ParseExportMap("docs=docx, md; sheets=xlsx,.CSV;application/vnd.google-apps.drawing=svg")
+	if err != nil {
+		t.Fatalf("parseExportMap: %v", err)
+	}
+
+	want := map[string][]string{
+		"application/vnd.google-apps.document":    {"docx", "md"},
+		"application/vnd.google-apps.spreadsheet": {"xlsx", "csv"},
+		"application/vnd.google-apps.drawing":     {"svg"},
+	}
+	if !reflect.DeepEqual(exportMap, want) {
+		t.Errorf("got %v want %v", exportMap, want)
+	}
+
+	for _, spec := range []string{"docs", "videos=mp4"} {
+		if _, err := ParseExportMap(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+
+	g := &Commands{opts: &Options{ExportMap: want}}
+	doc := &File{MimeType: "application/vnd.google-apps.document"}
+	form := &File{MimeType: "application/vnd.google-apps.form"}
+	if got := g.exportsFor(doc, []string{"pdf"}); !reflect.DeepEqual(got, want[doc.MimeType]) {
+		t.Errorf("exportsFor doc: got %v", got)
+	}
+	if got := g.exportsFor(form, []string{"pdf"}); !reflect.DeepEqual(got, []string{"pdf"}) {
+		t.Errorf("exportsFor form: got %v", got)
+	}
+
+	doc.ExportLinks = map[string]string{"text/markdown": "md-link"}
+	if _, url, ok := exportLink(doc, "md"); !ok || url != "md-link" {
+		t.Errorf("exportLink md: got %q %v", url, ok)
+	}
+}
+
+func TestStaleExportsRemoved(t *testing.T) {
+	context := memoryTestContext(t)
+	defer os.RemoveAll(context.AbsPath)
+
+	g := NewWithBackend(context, memoryTestOptions("/"), NewMemoryBackend())
+
+	exportPath := func(name, ext string) string {
+		return filepath.Join(context.AbsPath, name+"_exports", name+"."+ext)
+	}
+	oldExports := []string{exportPath("plan", "docx"), exportPath("plan", "md")}
+	newExports := []string{exportPath("roadmap", "docx")}
+	for _, p := range append(oldExports, newExports...) {
+		writeTestFiles(t, filepath.Dir(p), map[string]string{filepath.Base(p): "exported"})
+	}
+
+	doc := &File{Id: "doc", Name: "plan", MimeType: "application/vnd.google-apps.document"}
+	change := &Change{Src: doc, Path: "/plan", exports: oldExports}
+	if err := g.indexPulled(change); err != nil {
+		t.Fatalf("indexPulled: %v", err)
+	}
+
+	// Pulling it again without exporting keeps the exports.
+	if err := g.indexPulled(&Change{Src: doc, Path: "/plan"}); err != nil {
+		t.Fatalf("indexPulled: %v", err)
+	}
+	index, err := context.DeserializeIndex(doc.Id)
+	if err != nil {
+		t.Fatalf("deserializeIndex: %v", err)
+	}
+	if !reflect.DeepEqual(index.Exports, oldExports) {
+		t.Errorf("exports: got %v want %v", index.Exports, oldExports)
+	}
+
+	// Once renamed, the exports named after the old name are stale.
+	doc.Name = "roadmap"
+	if err := g.indexPulled(&Change{Src: doc, Path: "/roadmap", exports: newExports}); err != nil {
+		t.Fatalf("indexPulled: %v", err)
+	}
+	for _, p := range oldExports {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%q should have been removed, got %v", p, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Dir(oldExports[0])); !os.IsNotExist(err) {
+		t.Errorf("the empty exports dir should have been removed, got %v", err)
+	}
+
+	// Once deleted, so are the rest.
+	g.removeExportsAt("/roadmap")
+	if _, err := os.Stat(newExports[0]); !os.IsNotExist(err) {
+		t.Errorf("%q should have been removed, got %v", newExports[0], err)
+	}
+}
+
+func TestPushEditedExport(t *testing.T) {
+	mb := NewMemoryBackend()
+
+	context := memoryTestContext(t)
+	defer os.RemoveAll(context.AbsPath)
+
+	writeTestFiles(t, context.AbsPath, map[string]string{"notes.txt": "notes"})
+	if err := NewWithBackend(context, memoryTestOptions("/"), mb).Push(); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	if err := os.Remove(filepath.Join(context.AbsPath, "notes.txt")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+
+	// Turn it into a Google Doc that was pulled and exported as docx.
+	f, err := mb.FindByPath("/notes.txt")
+	if err != nil {
+		t.Fatalf("findByPath: %v", err)
+	}
+	doc, err := mb.update(f.Id, func(e *memoryEntry) error {
+		e.file.Title = "report"
+		e.file.MimeType = "application/vnd.google-apps.document"
+		e.file.ExportLinks = map[string]string{"application/vnd.openxmlformats-officedocument.wordprocessingml.document": "docx-link"}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	exportPath := filepath.Join(context.AbsPath, "report_exports", "report.docx")
+	writeTestFiles(t, context.AbsPath, map[string]string{"report_exports/report.docx": "exported"})
+	if err := os.Chtimes(exportPath, doc.ModTime, doc.ModTime); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	writeTestFiles(t, context.AbsPath, map[string]string{"report": ""})
+
+	g := NewWithBackend(context, memoryTestOptions("/"), mb)
+	if err := g.indexPulled(&Change{Src: doc, Path: "/report", exports: []string{exportPath}}); err != nil {
+		t.Fatalf("indexPulled: %v", err)
+	}
+
+	// An unedited export is not pushed.
+	opts := memoryTestOptions("/")
+	opts.TypeMask = OptConvert
+	if err := NewWithBackend(context, opts, mb).Push(); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	if _, err := mb.FindByPath("/report_exports"); err != ErrPathNotExists {
+		t.Fatalf("the unedited export should not have been pushed, got %v", err)
+	}
+
+	// An edited one updates the doc in place.
+	modifyTestFile(t, context.AbsPath, "report_exports/report.docx", "edited offline", time.Hour)
+	if err := NewWithBackend(context, opts, mb).Push(); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	if _, err := mb.FindByPath("/report_exports"); err != ErrPathNotExists {
+		t.Fatalf("the edited export should not have been pushed alongside the doc, got %v", err)
+	}
+
+	updated, err := mb.FindByPath("/report")
+	if err != nil {
+		t.Fatalf("findByPath: %v", err)
+	}
+	if updated.Id != doc.Id || updated.MimeType != doc.MimeType {
+		t.Errorf("got %q %q want the doc %q updated in place", updated.Id, updated.MimeType, doc.Id)
+	}
+	if got := remoteContent(t, mb, "/report"); got != "edited offline" {
+		t.Errorf("doc content: got %q", got)
+	}
+
+	index, err := context.DeserializeIndex(doc.Id)
+	if err != nil {
+		t.Fatalf("deserializeIndex: %v", err)
+	}
+	if !reflect.DeepEqual(index.Exports, []string{exportPath}) {
+		t.Errorf("exports: got %v", index.Exports)
+	}
+}
@@ -118,7 +118,7 @@ func (g *Commands) playFetchChanges(cl []*Change, opMap *map[Operation]sizeCount
 	wg.Add(changeCount)
 
 	go func() {
-		for n := range g.rem.progressChan {
+		for n := range g.progressChan {
 			g.taskAdd(int64(n))
 		}
 		progressDone <- true
@@ -131,16 +131,16 @@ func (g *Commands) playFetchChanges(cl []*Change, opMap *map[Operation]sizeCount
 		case OpDelete:
 			go g.removeIndex(&wg, c.Dest)
 		case OpNone:
-			loneCountRegister(&wg, g.rem.progressChan)
+			loneCountRegister(&wg, g.progressChan)
 		default:
-			go g.addIndex(&wg, c.Src)
+			go g.addIndex(&wg, c.Src, c.Path)
 		}
 
 		<-ticker
 	}
 
 	wg.Wait()
-	close(g.rem.progressChan)
+	close(g.progressChan)
 
 	<-progressDone
 	g.taskFinish()
@@ -148,10 +148,10 @@ func (g *Commands) playFetchChanges(cl []*Change, opMap *map[Operation]sizeCount
 	return nil
 }
 
-func (g *Commands) addIndex(wg *sync.WaitGroup, f *File) error {
-	defer loneCountRegister(wg, g.rem.progressChan)
+func (g *Commands) addIndex(wg *sync.WaitGroup, f *File, relToRootPath string) error {
+	defer loneCountRegister(wg, g.progressChan)
 
-	indexErr := g.createIndex(f)
+	indexErr := g.createIndex(f, relToRootPath)
 	// TODO: Should indexing errors be reported?
 	if indexErr != nil {
 		g.log.LogErrf("addIndex %s: %v\n", f.Name, indexErr)
@@ -165,7 +165,7 @@ func (g *Commands) removeIndex(wg *sync.WaitGroup, f *File) error {
 		return err
 	}
 
-	defer loneCountRegister(wg, g.rem.progressChan)
+	defer loneCountRegister(wg, g.progressChan)
 	if f.Id == "" {
 		return nil
 	}
@@ -306,11 +306,12 @@ func (g *Commands) pruneStaleIndices() (deletions chan string, err error) {
 	return
 }
 
-func (g *Commands) createIndex(f *File) error {
+func (g *Commands) createIndex(f *File, relToRootPath string) error {
 	if f == nil {
 		return config.ErrDerefNilIndex
 	}
 	index := f.ToIndex()
+	index.Path = relToRootPath
 	return g.context.SerializeIndex(index)
 }
 
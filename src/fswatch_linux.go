@@ -0,0 +1,145 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY |
+	syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+
+// inotifyWatcher is the fsWatcher backed by inotify(7).
+type inotifyWatcher struct {
+	mu   sync.Mutex
+	file *os.File
+	fd   int
+	dirs map[int]string
+	seen map[string]bool
+
+	eventsChan chan string
+	errsChan   chan error
+}
+
+func newFsWatcher() (fsWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+
+	w := &inotifyWatcher{
+		// A non-blocking fd is handed to the runtime poller, so
+		// that closing the file unblocks any pending reads.
+		file:       os.NewFile(uintptr(fd), "inotify"),
+		fd:         fd,
+		dirs:       make(map[int]string),
+		seen:       make(map[string]bool),
+		eventsChan: make(chan string, fsWatcherBacklog),
+		errsChan:   make(chan error, 1),
+	}
+
+	go w.readEvents()
+	return w, nil
+}
+
+func (w *inotifyWatcher) add(dir string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.seen[dir] {
+		return nil
+	}
+
+	wd, err := syscall.InotifyAddWatch(w.fd, dir, inotifyMask)
+	if err != nil {
+		return os.NewSyscallError("inotify_add_watch", err)
+	}
+
+	w.dirs[wd] = dir
+	w.seen[dir] = true
+	return nil
+}
+
+func (w *inotifyWatcher) events() <-chan string {
+	return w.eventsChan
+}
+
+func (w *inotifyWatcher) errors() <-chan error {
+	return w.errsChan
+}
+
+func (w *inotifyWatcher) close() error {
+	return w.file.Close()
+}
+
+func (w *inotifyWatcher) readEvents() {
+	defer close(w.eventsChan)
+
+	buf := make([]byte, syscall.SizeofInotifyEvent*fsWatcherBacklog)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				w.errsChan <- err
+			}
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameBytes := buf[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(event.Len)]
+			offset += syscall.SizeofInotifyEvent + int(event.Len)
+
+			// The queue overflowing isn't tied to any watch, its wd is -1.
+			if event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+				w.errsChan <- errFsWatcherOverflow
+				continue
+			}
+
+			w.mu.Lock()
+			dir, ok := w.dirs[int(event.Wd)]
+			if event.Mask&syscall.IN_IGNORED != 0 {
+				// The directory was removed so its watch is gone too.
+				delete(w.dirs, int(event.Wd))
+				delete(w.seen, dir)
+			}
+			w.mu.Unlock()
+
+			if !ok {
+				continue
+			}
+
+			name := string(trimNulls(nameBytes))
+			if name == "" {
+				continue
+			}
+			w.eventsChan <- filepath.Join(dir, name)
+		}
+	}
+}
+
+func trimNulls(b []byte) []byte {
+	for i, c := range b {
+		if c == 0 {
+			return b[:i]
+		}
+	}
+	return b
+}
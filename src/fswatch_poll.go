@@ -0,0 +1,156 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+// +build !linux
+
+package drive
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const fsWatcherPollInterval = time.Second
+
+type fileSnapshot struct {
+	size    int64
+	modTime time.Time
+	isDir   bool
+}
+
+// pollingWatcher is the fsWatcher used where inotify(7) isn't
+// available. It lists every watched directory on an interval.
+type pollingWatcher struct {
+	mu        sync.Mutex
+	snapshots map[string]map[string]fileSnapshot
+
+	eventsChan chan string
+	errsChan   chan error
+	done       chan bool
+}
+
+func (fs fileSnapshot) same(other fileSnapshot) bool {
+	return fs.size == other.size && fs.isDir == other.isDir && fs.modTime.Equal(other.modTime)
+}
+
+func newFsWatcher() (fsWatcher, error) {
+	w := &pollingWatcher{
+		snapshots:  make(map[string]map[string]fileSnapshot),
+		eventsChan: make(chan string, fsWatcherBacklog),
+		errsChan:   make(chan error, 1),
+		done:       make(chan bool),
+	}
+
+	go w.poll()
+	return w, nil
+}
+
+func snapshotDir(dir string) (map[string]fileSnapshot, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make(map[string]fileSnapshot)
+	for _, info := range infos {
+		snapshots[info.Name()] = fileSnapshot{
+			size:    info.Size(),
+			modTime: info.ModTime(),
+			isDir:   info.IsDir(),
+		}
+	}
+	return snapshots, nil
+}
+
+func (w *pollingWatcher) add(dir string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.snapshots[dir]; ok {
+		return nil
+	}
+
+	snapshots, err := snapshotDir(dir)
+	if err != nil {
+		return err
+	}
+	w.snapshots[dir] = snapshots
+	return nil
+}
+
+func (w *pollingWatcher) events() <-chan string {
+	return w.eventsChan
+}
+
+func (w *pollingWatcher) errors() <-chan error {
+	return w.errsChan
+}
+
+func (w *pollingWatcher) close() error {
+	close(w.done)
+	return nil
+}
+
+func (w *pollingWatcher) poll() {
+	defer close(w.eventsChan)
+
+	tick := time.NewTicker(fsWatcherPollInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-tick.C:
+		}
+
+		for _, p := range w.changedPaths() {
+			w.eventsChan <- p
+		}
+	}
+}
+
+func (w *pollingWatcher) changedPaths() (changed []string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for dir, before := range w.snapshots {
+		after, err := snapshotDir(dir)
+		if os.IsNotExist(err) {
+			delete(w.snapshots, dir)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		for name, snap := range after {
+			if prev, ok := before[name]; !ok || !prev.same(snap) {
+				changed = append(changed, filepath.Join(dir, name))
+			}
+		}
+		for name := range before {
+			if _, ok := after[name]; !ok {
+				changed = append(changed, filepath.Join(dir, name))
+			}
+		}
+		w.snapshots[dir] = after
+	}
+
+	return changed
+}
@@ -67,9 +67,19 @@ const (
 	PruneKey                  = "prune"
 	StarKey                   = "star"
 	UnStarKey                 = "unstar"
+	WatchKey                  = "watch"
+	SyncKey                   = "sync"
+	RevisionsKey              = "revisions"
+	CommentsKey               = "comments"
+	PropKey                   = "prop"
+	ShortcutKey               = "shortcut"
+	CacheKey                  = "cache"
+	ServeKey                  = "serve"
 
 	CoercedMimeKeyKey        = "coerced-mime"
 	ExportsKey               = "export"
+	ExportMapKey             = "export-map"
+	S3CredentialsKey         = "s3-credentials"
 	ExportsDirKey            = "exports-dir"
 	NoClobberKey             = "no-clobber"
 	RecursiveKey             = "recursive"
@@ -89,6 +99,8 @@ const (
 	YesShortKey              = "Y"
 	QuitLongKey              = "quit"
 	MatchesKey               = "matches"
+	PropertyKey              = "property"
+	QueryKey                 = "query"
 	HiddenKey                = "hidden"
 	Md5Key                   = "md5"
 	NoPromptKey              = "no-prompt"
@@ -159,8 +171,17 @@ const (
 	DescVersion               = "prints the version"
 	DescMd5sum                = "prints a list compatible with md5sum(1)"
 	DescDu                    = "similar to util `du` gives you disk usage"
+	DescWatch                 = "pulls remote changes as they happen"
+	DescSync                  = "pushes local changes and pulls remote changes in one go"
+	DescRevisions             = "lists and restores the revisions of files"
+	DescComments              = "lists, adds, replies to and resolves comments on files"
+	DescProp                  = "sets, gets and removes custom properties of files"
+	DescShortcut              = "creates a shortcut to a file or folder"
+	DescCache                 = "builds or refreshes the metadata cache that offline listings are answered from"
+	DescServe                 = "serves the remote tree over WebDAV or S3 for file managers and clients to mount, or the commands over a JSON API"
+	DescOutput                = "format that list, stat, diff, about, md5sum, id, comments and watch print in and errors are reported in: text, json or jsonl"
 	DescAccountTypes          = "\n\t* anyone.\n\t* user.\n\t* domain.\n\t* group"
-	DescRoles                 = "\n\t* owner.\n\t* reader.\n\t* writer.\n\t* commenter."
+	DescRoles                 = "\n\t* owner.\n\t* reader.\n\t* writer.\n\t* commenter.\n\t* organizer (shared drives only).\n\t* fileOrganizer (shared drives only)."
 	DescExplicitylPullExports = "explicitly pull exports"
 	DescIgnoreChecksum        = "avoids computation of checksums as a final check." +
 		"\nUse cases may include:\n\t* when you are low on bandwidth e.g SSHFS." +
@@ -200,6 +221,11 @@ const (
 	DescDecryptionPassword           = "decryption password"
 	DescWithLink                     = "turn off file indexing so that only those with the link can view it"
 	DescAllowDesktopLinks            = "allows docs + sheets to be pulled as .desktop files or URL linked files"
+	DescProperty                     = "operate only on files with these properties, comma separated key=value pairs e.g project=X,stage=final"
+	DescQuery                        = "operate only on the files under the paths that match this query e.g 'name ~ \"report\" and modified > 2026-01-01 and size > 10MB and not owner:bob@example.com'.\n\tFields: name, mime, owner, modified, size, starred, folder, path, depth and ext.\n\tOperators: = != ~ (contains) !~ =~ (regex) > >= < <= and : (same as =), joined by and, or, not and parentheses"
+	DescShortcutPolicy               = "how to pull shortcuts:\n\t* symlink: a symlink to the target if it is in the drive otherwise a link file.\n\t* link: a link file that opens the target.\n\t* follow: the content of the target, folders are pulled as with symlink"
+	DescMultiParentLinks             = "how to link the local copies of a file that is in several folders, which is downloaded once:\n\t* hardlink.\n\t* symlink"
+	DescExportMap                    = "formats to export each type of doc to, overriding -export for that type e.g 'docs=docx,md;sheets=xlsx,csv;slides=pdf;drawings=svg;script=json'"
 	DescKeepParent                   = "ensures that when moving a file into a destination, that we also retain its original parent so that it will exist in more than one folder"
 
 	DescTouchTimeStr          = "the time each file's modification time should be set to"
@@ -258,9 +284,39 @@ const (
 	CLIOptionUploadChunkSize = "upload-chunk-size"
 	CLIOptionUploadRateLimit = "upload-rate-limit"
 
+	CLIOptionDownloadRateLimit = "download-rate-limit"
+
 	CLIOptionExportsDumpToSameDirectory = "same-exports-dir"
 
 	CLIOptionTrashed = TrashedKey
+
+	CLIOptionSharedDrive  = "shared-drive"
+	CLIOptionSharedDrives = "shared-drives"
+
+	CLIOptionMaxQPS = "max-qps"
+
+	CLIOptionWatchInterval = "interval"
+	CLIOptionWatchOnce     = "once"
+	CLIOptionJSON          = "json"
+	CLIOptionWatch         = "watch"
+
+	CLIOptionRevision     = "revision"
+	CLIOptionRevisionDest = "revision-dest"
+	CLIOptionKeepForever  = "keep-forever"
+	CLIOptionRestore      = "restore"
+
+	CLIOptionProperty  = PropertyKey
+	CLIOptionQuery     = QueryKey
+	CLIOptionShortcuts = "shortcuts"
+	CLIOptionPrivate   = "private"
+
+	CLIOptionMultiParentLinks = "multi-parent-links"
+	CLIOptionExportMap        = ExportMapKey
+	CLIOptionOffline          = "offline"
+	CLIOptionRebuild          = "rebuild"
+	CLIOptionAddr             = "addr"
+	CLIOptionSocket           = "socket"
+	CLIOptionOutput           = "output"
 )
 
 const (
@@ -272,6 +328,7 @@ const (
 	GoogleApiClientSecretEnvKey = "GOOGLE_API_CLIENT_SECRET"
 	DriveGoMaxProcsKey          = "DRIVE_GOMAXPROCS"
 	GoMaxProcsKey               = "GOMAXPROCS"
+	DriveAPIBaseURLEnvKey       = "DRIVE_API_BASE_URL"
 )
 
 const (
@@ -319,6 +376,13 @@ var docMap = map[string][]string{
 	PullKey: []string{
 		DescPull, "Downloads content from the remote drive or modifies",
 		" local content to match that on your Google Drive",
+		"\t* Revision pull: `drive pull -revision id [-revision-dest path] path` downloads that revision of the file",
+		"\t* Property pull: `drive pull -property key=value [path]` pulls the files with that property from any folder under path",
+		"\t* Query pull: `drive pull -query 'ext = pdf and size > 1MB' [path]` pulls the files under path that match the query",
+		fmt.Sprintf("Shortcuts are pulled as symlinks to their targets, see `-%s`", CLIOptionShortcuts),
+		fmt.Sprintf("Files in several folders are downloaded once and linked to from the other folders, see `-%s`", CLIOptionMultiParentLinks),
+		fmt.Sprintf("Each type of doc can be exported to its own formats with `-%s` or a [%s] section in .driverc", CLIOptionExportMap, ExportMapKey),
+		"Sheets exported as csv or tsv get a file per tab, in a directory named after the sheet",
 		skipChecksumNote,
 	},
 	PushKey: []string{
@@ -326,12 +390,16 @@ var docMap = map[string][]string{
 		"Push comes in a couple of flavors",
 		"\t* Ordinary push: `drive push path1 path2 path3`",
 		"\t* Mounted push: `drive push -m path1 [path2 path3] drive_context_path`",
+		"\t* Watched push: `drive push -watch path1 path2` keeps pushing local changes as they happen",
+		fmt.Sprintf("Exports of docs are only pushed once edited, with `-%s` they update their doc in place", ConvertKey),
 		skipChecksumNote,
 	},
 	ListKey: []string{
 		DescList,
 		"List the information of a remote path not necessarily present locally",
 		"Allows printing of long options and by default does minimal printing",
+		fmt.Sprintf("`-%s` lists only the files that match a query e.g `drive list -%s 'mime ~ pdf and size > 1MB' path`", CLIOptionQuery, CLIOptionQuery),
+		fmt.Sprintf("`-%s` lists from the metadata cache without any API calls, see `drive help %s`", CLIOptionOffline, CacheKey),
 	},
 	MoveKey: []string{
 		DescMove,
@@ -381,6 +449,63 @@ var docMap = map[string][]string{
 	UrlKey: []string{
 		DescUrl, "takes multiple paths or ids",
 	},
+	CommentsKey: []string{
+		DescComments, "Lists the comments on each remote file with their ids, authors, anchors, replies and whether",
+		"they are open or resolved. `-output jsonl` prints each comment as a line of JSON instead",
+		"\t* Add: `drive comments add path message`",
+		"\t* Reply: `drive comments reply path commentId message`",
+		"\t* Resolve: `drive comments resolve path commentId [message]`",
+	},
+	PropKey: []string{
+		DescProp, "Properties are key=value pairs that are public to all apps unless `-private` is set",
+		"\t* Set: `drive prop set path key=value [key=value...]`",
+		"\t* Get: `drive prop get path [key...]`",
+		"\t* Remove: `drive prop rm path key [key...]`",
+		fmt.Sprintf("Files can then be filtered by property with `-%s key=value` on list, pull and trash", CLIOptionProperty),
+	},
+	RevisionsKey: []string{
+		DescRevisions, "Lists the revisions of each remote file: their ids, modification times, sizes",
+		"and the users that made them, oldest first",
+		"\t* Restore: `drive revisions restore path revisionId` makes that revision the current content",
+		"\t  of the file, `-keep-forever` keeps the resulting revision from being automatically purged",
+	},
+	ShortcutKey: []string{
+		DescShortcut, "Accepts <target> <linkpath>, with linkpath being a folder",
+		"the shortcut is created inside it and named after the target",
+		"Shortcuts show up in list and stat with the paths of their targets",
+	},
+	SyncKey: []string{
+		DescSync, "Uses the index from the last push or pull of each file to tell",
+		"which side changed since. Changes and deletions made on only one side",
+		"are applied to the other side, paths changed on both sides are conflicts",
+		skipChecksumNote,
+	},
+	CacheKey: []string{
+		DescCache, "The cache keeps the metadata of every file of the drive in the .gd directory",
+		"The first run lists the whole drive, later runs only apply the changes made since",
+		fmt.Sprintf("`list`, `du` and `stat` answer from it with `-%s`, `-%s` discards and lists the drive again", CLIOptionOffline, CLIOptionRebuild),
+	},
+	ServeKey: []string{
+		DescServe, fmt.Sprintf("Accepts %s, %s or %s and an optional remote folder to serve, the root otherwise", ServeProtocolWebDAV, ServeProtocolS3, ServeProtocolAPI),
+		fmt.Sprintf("`-%s` is the host:port to listen on, %s by default", CLIOptionAddr, DefaultServeAddress),
+		fmt.Sprintf("Over %s it only listens on loopback addresses, or on the Unix socket at `-%s`", ServeProtocolWebDAV, CLIOptionSocket),
+		"Google Docs are seen as the formats they export to with `-export` or `-export-map`, read only",
+		"Deleted files are moved to the trash, and files are copied on the server",
+		fmt.Sprintf("Over %s each top level folder is a bucket, requests are signed with SigV4 by", ServeProtocolS3),
+		fmt.Sprintf("the access key=secret key pairs in the [%s] section of the .driverc", S3CredentialsKey),
+		fmt.Sprintf("`-%s` and `-%s` encrypt uploads and decrypt downloads", CLIEncryptionPassword, CLIDecryptionPassword),
+		fmt.Sprintf("%s takes no folder and answers POSTs of JSON to /%s, /%s, /%s, /%s, /%s, /%s and /%s,", ServeProtocolAPI, ListKey, StatKey, DiffKey, PushKey, PullKey, ShareKey, TrashKey),
+		"with what the command printed, or as Server-Sent Events with progress if asked for text/event-stream",
+		"Requests have to carry the token printed at startup as a bearer token and a Content-Type of application/json",
+		fmt.Sprintf("It only listens on loopback addresses, or on the Unix socket at `-%s`, and holds the index open", CLIOptionSocket),
+		"so other drive commands in the same context wait for it to stop",
+	},
+	WatchKey: []string{
+		DescWatch, "Polls the remote changes feed and pulls only the files that changed",
+		"The id of the last change seen is saved so that watching resumes where it left off",
+		"The first run only records the current change id without pulling anything",
+		"`-output json` or `jsonl` prints each event as a line of JSON, `-json` is a deprecated alias",
+	},
 	VersionKey: []string{
 		DescVersion, fmt.Sprintf("current version is: %s", Version),
 	},
@@ -22,20 +22,24 @@ const (
 	fileIdWidth = -48
 )
 
-func idPrintAndRecurse(g *Commands, parentId, relToRootPath string, depth int) (err error) {
+func idPrintAndRecurse(g *Commands, parent *File, relToRootPath string, depth int) (err error) {
 	if depth == 0 {
 		return
 	}
 
-	// Paths vary greatly in length but fileIds don't vary that much
-	g.log.Logf("%*s %s\n", int(fileIdWidth), customQuote(parentId), customQuote(relToRootPath))
+	if g.opts.structuredOutput() {
+		g.emitRecord(newFileRecord(remotePathJoin(relToRootPath), parent))
+	} else {
+		// Paths vary greatly in length but fileIds don't vary that much
+		g.log.Logf("%*s %s\n", int(fileIdWidth), customQuote(parent.Id), customQuote(relToRootPath))
+	}
 
 	decrementedDepth := decrementTraversalDepth(depth)
 	if decrementedDepth == 0 { // No need to recurse if depth is already 0
 		return
 	}
 
-	pagePair := g.rem.FindByParentId(parentId, g.opts.Hidden)
+	pagePair := g.rem.FindByParentId(parent.Id, g.opts.Hidden)
 
 	separatorPrefix := relToRootPath
 	if rootLike(separatorPrefix) {
@@ -63,7 +67,7 @@ func idPrintAndRecurse(g *Commands, parentId, relToRootPath string, depth int) (
 				continue
 			}
 			childRelToRootPath := sepJoin(RemoteSeparator, separatorPrefix, child.Name)
-			cErr := idPrintAndRecurse(g, child.Id, childRelToRootPath, decrementedDepth)
+			cErr := idPrintAndRecurse(g, child, childRelToRootPath, decrementedDepth)
 			if cErr != nil {
 				err = combineErrors(err, cErr)
 			}
@@ -76,7 +80,10 @@ func idPrintAndRecurse(g *Commands, parentId, relToRootPath string, depth int) (
 var idTableHeader = fmt.Sprintf("%*s %s", int(fileIdWidth), "FileId", "Relative Path")
 
 func (g *Commands) Id() (err error) {
-	headerPrinted := false
+	defer g.endRecords()
+
+	// Records need no table header.
+	headerPrinted := g.opts.structuredOutput()
 
 	iterCount := uint64(0)
 	for _, relToRootPath := range g.opts.Sources {
@@ -122,7 +129,7 @@ func (g *Commands) idPrintRecursePerPath(relToRootPath string, headerPrinted boo
 			}
 
 			iterCount++
-			cErr := idPrintAndRecurse(g, rem.Id, relToRootPath, g.opts.Depth)
+			cErr := idPrintAndRecurse(g, rem, relToRootPath, g.opts.Depth)
 			if cErr != nil {
 				err = combineErrors(err, cErr)
 			}
@@ -66,6 +66,7 @@ func sorters(opts *Options) []string {
 }
 
 func (g *Commands) ListMatches() error {
+	defer g.endRecords()
 
 	inTrash := trashed(g.opts.TypeMask)
 
@@ -189,6 +190,16 @@ func (g *Commands) createMatchQuery(exactMatch bool) *matchQuery {
 }
 
 func (g *Commands) List(byId bool) error {
+	defer g.endRecords()
+
+	matches, searched, err := g.searchedMatches(g.opts.InTrash)
+	if err != nil {
+		return err
+	}
+	if searched {
+		return g.listSearched(matches)
+	}
+
 	var kvList []*keyValue
 
 	resolver := g.rem.FindByPath
@@ -206,7 +217,7 @@ func (g *Commands) List(byId bool) error {
 		}
 
 		if r == nil {
-			g.log.LogErrf("%s cannot be found remotely\n", customQuote(relPath))
+			g.emitError(nonExistantRemoteErr(fmt.Errorf("%s cannot be found remotely", customQuote(relPath))))
 			continue
 		}
 
@@ -220,7 +231,8 @@ func (g *Commands) List(byId bool) error {
 		if remoteRootLike(parentPath) {
 			parentPath = ""
 		}
-		if remoteRootLike(r.Name) {
+		// A shared drive's root is titled with the drive's name.
+		if remoteRootLike(r.Name) || (!byId && rootLike(relPath)) {
 			r.Name = ""
 		}
 		if rootLike(parentPath) {
@@ -303,6 +315,8 @@ func (g *Commands) listSharedPerPath(relToRootPath string) ([]*keyValue, error)
 }
 
 func (g *Commands) ListShared() (err error) {
+	defer g.endRecords()
+
 	spin := g.playabler()
 	spin.play()
 	defer spin.stop()
@@ -340,6 +354,9 @@ func (g *Commands) ListShared() (err error) {
 
 func (f *File) pretty(logy *log.Logger, opt attribute) {
 	fmtdPath := sepJoin("/", opt.parent, f.Name)
+	if f.shortcutTargetPath != "" {
+		fmtdPath = fmt.Sprintf("%s -> %s", fmtdPath, f.shortcutTargetPath)
+	}
 
 	if opt.diskUsageOnly {
 		logy.Logf("%-12v %s\n", f.Size, fmtdPath)
@@ -380,6 +397,15 @@ func (f *File) pretty(logy *log.Logger, opt attribute) {
 	}
 }
 
+// printFile prints f as a record in the JSON formats or as pretty does.
+func (g *Commands) printFile(f *File, opt attribute) {
+	if g.opts.structuredOutput() {
+		g.emitRecord(newFileRecord(remotePathJoin(opt.parent, f.Name), f))
+		return
+	}
+	f.pretty(g.log, opt)
+}
+
 func (g *Commands) breadthFirst(travSt traversalSt, spin *playable) bool {
 
 	opt := attribute{
@@ -395,7 +421,10 @@ func (g *Commands) breadthFirst(travSt traversalSt, spin *playable) bool {
 
 	f := travSt.file
 	if !f.IsDir {
-		f.pretty(g.log, opt)
+		if isShortcut(f) {
+			f.shortcutTargetPath = g.shortcutTargetPath(f)
+		}
+		g.printFile(f, opt)
 		return true
 	}
 
@@ -412,17 +441,15 @@ func (g *Commands) breadthFirst(travSt traversalSt, spin *playable) bool {
 		travSt.depth -= 1
 	}
 
-	expr := buildExpression(f.Id, travSt.mask, travSt.inTrash)
-
-	if travSt.matchQuery != nil {
-		exprExtra := travSt.matchQuery.Stringer()
-		expr = sepJoinNonEmpty(" and ", fmt.Sprintf("(%s)", expr), exprExtra)
+	lq := &listQuery{
+		parentId:   f.Id,
+		typeMask:   travSt.mask,
+		inTrash:    travSt.inTrash,
+		hidden:     g.opts.Hidden,
+		pageSize:   g.opts.PageSize,
+		matchQuery: travSt.matchQuery,
 	}
 
-	req := g.rem.service.Files.List()
-	req.Q(expr)
-	req.MaxResults(g.opts.PageSize)
-
 	spin.pause()
 
 	canPrompt := !travSt.explicitNoPrompt
@@ -441,7 +468,7 @@ func (g *Commands) breadthFirst(travSt traversalSt, spin *playable) bool {
 	// We shouldn't prompt in between the same page otherwise we get
 	// spurious prompts. See Issue https://github.com/odeke-em/drive/issues/724.
 	// We'll only make the prompts in between children.
-	pagePair := reqDoPage(req, g.opts.Hidden, false)
+	pagePair := g.rem.listChildren(lq)
 	errsChan := pagePair.errsChan
 	filesChan := pagePair.filesChan
 
@@ -486,7 +513,10 @@ func (g *Commands) breadthFirst(travSt traversalSt, spin *playable) bool {
 		if onlyFiles && file.IsDir {
 			continue
 		}
-		file.pretty(g.log, opt)
+		if isShortcut(file) {
+			file.shortcutTargetPath = g.shortcutTargetPath(file)
+		}
+		g.printFile(file, opt)
 		iterCount += 1
 	}
 
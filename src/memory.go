@@ -0,0 +1,1419 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	drive "google.golang.org/api/drive/v2"
+)
+
+const (
+	// MemoryRootId is the id of the root folder of a MemoryBackend.
+	MemoryRootId = "root"
+
+	// DefaultMemoryQuotaBytes is the storage quota that a
+	// MemoryBackend reports unless QuotaBytesTotal is changed.
+	DefaultMemoryQuotaBytes = 15 * 1024 * 1024 * 1024
+)
+
+var anyonePermissionId = func() string {
+	accountType := Anyone
+	return accountType.String()
+}()
+
+var errMemoryExportsUnsupported = downloadFailedErr(fmt.Errorf("memory backend: exports are not supported"))
+
+type memoryEntry struct {
+	file        *drive.File
+	content     []byte
+	permissions []*drive.Permission
+	revisions   []*memoryRevision
+	comments    []*drive.Comment
+}
+
+type memoryRevision struct {
+	revision *drive.Revision
+	content  []byte
+}
+
+// MemoryBackend is a Backend that keeps files, their content, permissions
+// and the changes feed in memory. It is meant for deterministic
+// tests of Commands and for embedding drive against other stores.
+type MemoryBackend struct {
+	sync.Mutex
+
+	// QuotaBytesTotal is the storage quota reported by About.
+	QuotaBytesTotal int64
+
+	entries   map[string]*memoryEntry
+	changeLog []*drive.Change
+	lastId    uint64
+	encrypter func(io.Reader) (io.Reader, error)
+	decrypter func(io.Reader) (io.ReadCloser, error)
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	root := &drive.File{
+		Id:           MemoryRootId,
+		Title:        "My Drive",
+		MimeType:     DriveFolderMimeType,
+		ModifiedDate: toUTCString(time.Now()),
+		Labels:       &drive.FileLabels{},
+		Version:      1,
+	}
+
+	mb := &MemoryBackend{
+		QuotaBytesTotal: DefaultMemoryQuotaBytes,
+		entries:         make(map[string]*memoryEntry),
+	}
+
+	mb.entries[root.Id] = &memoryEntry{file: root}
+	return mb
+}
+
+func (mb *MemoryBackend) setCrypto(encrypter func(io.Reader) (io.Reader, error), decrypter func(io.Reader) (io.ReadCloser, error)) {
+	mb.Lock()
+	defer mb.Unlock()
+
+	mb.encrypter = encrypter
+	mb.decrypter = decrypter
+}
+
+func (mb *MemoryBackend) nextIdLocked() string {
+	mb.lastId += 1
+	return fmt.Sprintf("mem-%06d", mb.lastId)
+}
+
+// touchedLocked bumps the version and etag of the entry
+// and records the modification on the changes feed.
+func (mb *MemoryBackend) touchedLocked(e *memoryEntry, deleted bool) {
+	e.file.Version += 1
+	e.file.Etag = fmt.Sprintf("\"%s/%d\"", e.file.Id, e.file.Version)
+
+	change := &drive.Change{
+		Id:               int64(len(mb.changeLog) + 1),
+		FileId:           e.file.Id,
+		Deleted:          deleted,
+		ModificationDate: toUTCString(time.Now()),
+	}
+	if !deleted {
+		change.File = dupDriveFile(e.file)
+	}
+	mb.changeLog = append(mb.changeLog, change)
+}
+
+func dupDriveFile(f *drive.File) *drive.File {
+	dup := *f
+	if f.Labels != nil {
+		labels := *f.Labels
+		dup.Labels = &labels
+	}
+
+	dup.Parents = nil
+	for _, p := range f.Parents {
+		pDup := *p
+		dup.Parents = append(dup.Parents, &pDup)
+	}
+
+	dup.Permissions = append([]*drive.Permission{}, f.Permissions...)
+	return &dup
+}
+
+func (mb *MemoryBackend) driveFileLocked(e *memoryEntry) *drive.File {
+	dup := dupDriveFile(e.file)
+	dup.Permissions = e.permissions
+	dup.Shared = len(e.permissions) >= 1
+	return dup
+}
+
+func (mb *MemoryBackend) toFileLocked(e *memoryEntry) *File {
+	return NewRemoteFile(mb.driveFileLocked(e))
+}
+
+func (mb *MemoryBackend) lookupLocked(id string) (*memoryEntry, error) {
+	e, ok := mb.entries[id]
+	if !ok || e == nil {
+		return nil, ErrPathNotExists
+	}
+	return e, nil
+}
+
+func hasParent(f *drive.File, parentId string) bool {
+	for _, p := range f.Parents {
+		if p != nil && p.Id == parentId {
+			return true
+		}
+	}
+	return false
+}
+
+func isTrashed(f *drive.File) bool {
+	return f.Labels != nil && f.Labels.Trashed
+}
+
+func isStarred(f *drive.File) bool {
+	return f.Labels != nil && f.Labels.Starred
+}
+
+// filterLocked returns, in a deterministic order, all the
+// entries satisfied by the predicate.
+func (mb *MemoryBackend) filterLocked(pred func(*drive.File) bool) (files []*File) {
+	var matches []*memoryEntry
+	for _, e := range mb.entries {
+		if pred(e.file) {
+			matches = append(matches, e)
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		fi, fj := matches[i].file, matches[j].file
+		if fi.Title != fj.Title {
+			return fi.Title < fj.Title
+		}
+		return fi.Id < fj.Id
+	})
+
+	for _, e := range matches {
+		files = append(files, mb.toFileLocked(e))
+	}
+	return files
+}
+
+func (mb *MemoryBackend) filter(pred func(*drive.File) bool) []*File {
+	mb.Lock()
+	defer mb.Unlock()
+
+	return mb.filterLocked(pred)
+}
+
+func memoryPage(files []*File, nilOnNoMatch bool) *paginationPair {
+	filesChan := make(chan *File)
+	errsChan := make(chan error)
+
+	go func() {
+		defer func() {
+			close(errsChan)
+			close(filesChan)
+		}()
+
+		if len(files) < 1 && nilOnNoMatch {
+			filesChan <- nil
+			return
+		}
+
+		for _, f := range files {
+			filesChan <- f
+		}
+	}()
+
+	return &paginationPair{filesChan: filesChan, errsChan: errsChan}
+}
+
+func (mb *MemoryBackend) FindById(id string) (*File, error) {
+	mb.Lock()
+	defer mb.Unlock()
+
+	e, err := mb.lookupLocked(id)
+	if err != nil {
+		return nil, err
+	}
+	return mb.toFileLocked(e), nil
+}
+
+func (mb *MemoryBackend) Get(id string) (*drive.File, error) {
+	mb.Lock()
+	defer mb.Unlock()
+
+	e, err := mb.lookupLocked(id)
+	if err != nil {
+		return nil, err
+	}
+	return mb.driveFileLocked(e), nil
+}
+
+func (mb *MemoryBackend) Children(parentId string) ([]*drive.File, error) {
+	mb.Lock()
+	defer mb.Unlock()
+
+	var files []*drive.File
+	for _, e := range mb.entries {
+		if hasParent(e.file, parentId) {
+			files = append(files, mb.driveFileLocked(e))
+		}
+	}
+	return files, nil
+}
+
+func (mb *MemoryBackend) FindByIdM(id string) *paginationPair {
+	f, err := mb.FindById(id)
+	return wrapInPaginationPair(f, err)
+}
+
+// resolvePath returns all the files that match the path segments
+// starting from the folder with id parentId. Just like Remote, a
+// trashed lookup matches each segment by title alone.
+func (mb *MemoryBackend) resolvePath(parentId string, p []string, trashed bool) []*File {
+	if len(p) < 1 {
+		return nil
+	}
+
+	head := urlToPath(p[0], false)
+	matches := mb.filter(func(f *drive.File) bool {
+		if f.Title != head {
+			return false
+		}
+		if trashed {
+			return isTrashed(f)
+		}
+		return hasParent(f, parentId) && !isTrashed(f)
+	})
+
+	if len(p) == 1 {
+		return matches
+	}
+
+	var resolved []*File
+	for _, f := range matches {
+		resolved = append(resolved, mb.resolvePath(f.Id, p[1:], trashed)...)
+	}
+	return resolved
+}
+
+func (mb *MemoryBackend) findByPath(p string, trashed bool) (*File, error) {
+	if rootLike(p) {
+		return mb.FindById(MemoryRootId)
+	}
+
+	resolved := mb.resolvePath(MemoryRootId, strings.Split(p, RemoteSeparator)[1:], trashed)
+	if len(resolved) < 1 {
+		return nil, ErrPathNotExists
+	}
+	return resolved[0], nil
+}
+
+func (mb *MemoryBackend) findByPathM(p string, trashed bool) *paginationPair {
+	if rootLike(p) {
+		return mb.FindByIdM(MemoryRootId)
+	}
+
+	resolved := mb.resolvePath(MemoryRootId, strings.Split(p, RemoteSeparator)[1:], trashed)
+	return memoryPage(resolved, true)
+}
+
+func (mb *MemoryBackend) FindByPath(p string) (*File, error) {
+	return mb.findByPath(p, false)
+}
+
+func (mb *MemoryBackend) FindByPathM(p string) *paginationPair {
+	return mb.findByPathM(p, false)
+}
+
+func (mb *MemoryBackend) FindByPathTrashed(p string) (*File, error) {
+	return mb.findByPath(p, true)
+}
+
+func (mb *MemoryBackend) FindByPathTrashedM(p string) *paginationPair {
+	return mb.findByPathM(p, true)
+}
+
+func (mb *MemoryBackend) FindByPathShared(p string) *paginationPair {
+	parts := NonEmptyStrings(strings.Split(p, "/")...)
+	if p == "root" {
+		parts = nil
+	}
+
+	files := mb.filter(func(f *drive.File) bool {
+		if len(parts) >= 1 && f.Title != parts[0] {
+			return false
+		}
+		return f.Shared
+	})
+
+	return memoryPage(files, false)
+}
+
+func (mb *MemoryBackend) children(parentId string, trashed, hidden bool) []*File {
+	return mb.filter(func(f *drive.File) bool {
+		return hasParent(f, parentId) && isTrashed(f) == trashed && !isHidden(f.Title, hidden)
+	})
+}
+
+func (mb *MemoryBackend) FindByParentId(parentId string, hidden bool) *paginationPair {
+	return memoryPage(mb.children(parentId, false, hidden), false)
+}
+
+func (mb *MemoryBackend) findChildren(parentId string, trashed bool) *paginationPair {
+	return memoryPage(mb.children(parentId, trashed, true), false)
+}
+
+func (mb *MemoryBackend) listChildren(lq *listQuery) *paginationPair {
+	files := mb.filter(func(f *drive.File) bool {
+		if !hasParent(f, lq.parentId) || isTrashed(f) != lq.inTrash {
+			return false
+		}
+		if (lq.typeMask&Folder) != 0 && f.MimeType != DriveFolderMimeType {
+			return false
+		}
+		if isHidden(f.Title, lq.hidden) {
+			return false
+		}
+		return lq.matchQuery == nil || lq.matchQuery.satisfiedBy(f)
+	})
+
+	return memoryPage(files, false)
+}
+
+func (mb *MemoryBackend) FindBackPaths(id string) ([]string, error) {
+	return findBackPaths(mb, id)
+}
+
+func (mb *MemoryBackend) FindStarred(trashed, hidden bool) *paginationPair {
+	files := mb.filter(func(f *drive.File) bool {
+		return isStarred(f) && isTrashed(f) == trashed && !isHidden(f.Title, hidden)
+	})
+
+	return memoryPage(files, false)
+}
+
+func (mb *MemoryBackend) FindMatches(mq *matchQuery) *paginationPair {
+	if mq.anywhere {
+		files := mb.filter(func(f *drive.File) bool {
+			return f.Id != MemoryRootId && isTrashed(f) == mq.inTrash && mq.satisfiedBy(f)
+		})
+		return memoryPage(files, false)
+	}
+
+	parent, err := mb.FindByPath(mq.dirPath)
+	if err != nil || parent == nil {
+		if parent == nil && err == nil {
+			err = errNilParent
+		}
+		return wrapInPaginationPair(parent, err)
+	}
+
+	files := mb.filter(func(f *drive.File) bool {
+		return hasParent(f, parent.Id) && mq.satisfiedBy(f)
+	})
+
+	return memoryPage(files, false)
+}
+
+func (mb *MemoryBackend) RootId() string {
+	return MemoryRootId
+}
+
+// SharedDrives returns no drives since the memory backend
+// only models a single "My Drive".
+func (mb *MemoryBackend) SharedDrives() ([]*drive.Drive, error) {
+	return nil, nil
+}
+
+func (mb *MemoryBackend) UpsertByComparison(args *upsertOpt) (*File, error) {
+	return upsertWithProgress(mb, args)
+}
+
+func (mb *MemoryBackend) upsertByComparison(body io.Reader, args *upsertOpt) (f *File, mediaInserted bool, err error) {
+	mimeType := args.src.MimeType
+	if args.src.IsDir {
+		mimeType = DriveFolderMimeType
+	}
+	if args.mimeKey != "" {
+		mimeType = guessMimeType(args.mimeKey)
+	}
+
+	insert := args.src.Id == ""
+
+	var content []byte
+	if !args.src.IsDir && body != nil && (insert || args.shouldUploadBody()) {
+		mb.Lock()
+		encrypter := mb.encrypter
+		mb.Unlock()
+
+		if encrypter != nil {
+			if body, err = encrypter(body); err != nil {
+				return
+			}
+		}
+
+		if content, err = ioutil.ReadAll(body); err != nil {
+			return
+		}
+		mediaInserted = true
+	}
+
+	mb.Lock()
+	defer mb.Unlock()
+
+	var e *memoryEntry
+	if insert {
+		if _, pErr := mb.lookupLocked(args.parentId); pErr != nil {
+			err = errNilParent
+			return
+		}
+
+		e = &memoryEntry{
+			file: &drive.File{
+				Id:       mb.nextIdLocked(),
+				Copyable: true,
+				Labels:   &drive.FileLabels{},
+				Parents: []*drive.ParentReference{
+					{Id: args.parentId, IsRoot: args.parentId == MemoryRootId},
+				},
+			},
+		}
+		mb.entries[e.file.Id] = e
+	} else if e, err = mb.lookupLocked(args.src.Id); err != nil {
+		return
+	}
+
+	e.file.Title = urlToPath(args.src.Name, false)
+	e.file.ModifiedDate = toUTCString(args.src.ModTime)
+	// Content converted into a Google Doc leaves it a Google Doc.
+	if convert(args.mask) && strings.HasPrefix(e.file.MimeType, "application/vnd.google-apps.") {
+		mimeType = ""
+	}
+	if mimeType != "" {
+		e.file.MimeType = mimeType
+	}
+
+	if mediaInserted {
+		mb.setContentLocked(e, content, pin(args.mask))
+	}
+
+	mb.touchedLocked(e, false)
+	f = mb.toFileLocked(e)
+	return
+}
+
+// setContentLocked replaces the content of the entry and records it as a revision.
+func (mb *MemoryBackend) setContentLocked(e *memoryEntry, content []byte, pinned bool) {
+	e.file.DownloadUrl = memoryDownloadURL(e.file.Id)
+	e.content = content
+	e.file.FileSize = int64(len(content))
+	e.file.QuotaBytesUsed = e.file.FileSize
+	e.file.Md5Checksum = fmt.Sprintf("%x", md5.Sum(content))
+	mb.addRevisionLocked(e, pinned)
+}
+
+func memoryDownloadURL(id string) string {
+	return "memory:///" + id
+}
+
+func (mb *MemoryBackend) Download(id string, exportURL string) (io.ReadCloser, error) {
+	if exportURL != "" {
+		return nil, errMemoryExportsUnsupported
+	}
+
+	mb.Lock()
+	e, err := mb.lookupLocked(id)
+	decrypter := mb.decrypter
+	var content []byte
+	if err == nil {
+		content = e.content
+	}
+	mb.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	body := ioutil.NopCloser(bytes.NewReader(content))
+	if decrypter != nil {
+		return decrypter(body)
+	}
+	return body, nil
+}
+
+func (mb *MemoryBackend) DownloadRange(id string, offset int64) (io.ReadCloser, int64, error) {
+	mb.Lock()
+	encrypted := mb.decrypter != nil
+	mb.Unlock()
+
+	body, err := mb.Download(id, "")
+	if err != nil || encrypted || offset <= 0 {
+		return body, 0, err
+	}
+
+	if _, err := io.CopyN(ioutil.Discard, body, offset); err != nil {
+		body.Close()
+		return nil, 0, err
+	}
+	return body, offset, nil
+}
+
+func (mb *MemoryBackend) Create(req *CreateRequest) (*drive.File, error) {
+	var content []byte
+	if req.Content != nil {
+		var err error
+		if content, err = ioutil.ReadAll(req.Content); err != nil {
+			return nil, err
+		}
+	}
+
+	mb.Lock()
+	defer mb.Unlock()
+
+	if _, err := mb.lookupLocked(req.ParentId); err != nil {
+		return nil, errNilParent
+	}
+
+	modTime := req.ModTime
+	if modTime.IsZero() {
+		modTime = time.Now()
+	}
+
+	e := &memoryEntry{
+		file: &drive.File{
+			Id:           mb.nextIdLocked(),
+			Title:        req.Name,
+			MimeType:     req.MimeType,
+			Description:  req.Description,
+			ModifiedDate: toUTCString(modTime),
+			Copyable:     true,
+			Labels:       &drive.FileLabels{},
+			Parents: []*drive.ParentReference{
+				{Id: req.ParentId, IsRoot: req.ParentId == MemoryRootId},
+			},
+		},
+	}
+
+	if req.ShortcutTargetId != "" {
+		target, err := mb.lookupLocked(req.ShortcutTargetId)
+		if err != nil {
+			return nil, err
+		}
+		e.file.MimeType = DriveShortcutMimeType
+		e.file.ShortcutDetails = &drive.FileShortcutDetails{
+			TargetId:       req.ShortcutTargetId,
+			TargetMimeType: target.file.MimeType,
+		}
+	}
+
+	mb.entries[e.file.Id] = e
+	if req.Content != nil {
+		mb.setContentLocked(e, content, false)
+	}
+	mb.touchedLocked(e, false)
+
+	return mb.driveFileLocked(e), nil
+}
+
+func (mb *MemoryBackend) Update(req *UpdateRequest) (*drive.File, error) {
+	var content []byte
+	if req.Content != nil {
+		var err error
+		if content, err = ioutil.ReadAll(req.Content); err != nil {
+			return nil, err
+		}
+	}
+
+	mb.Lock()
+	defer mb.Unlock()
+
+	e, err := mb.lookupLocked(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	for _, parentId := range req.AddParents {
+		if _, pErr := mb.lookupLocked(parentId); pErr != nil {
+			return nil, errNilParent
+		}
+	}
+
+	f := e.file
+	if req.Name != "" {
+		f.Title = req.Name
+	}
+	if req.MimeType != "" {
+		f.MimeType = req.MimeType
+	}
+	if !req.ModTime.IsZero() {
+		f.ModifiedDate = toUTCString(req.ModTime)
+	}
+	if req.Description != nil {
+		f.Description = *req.Description
+	}
+	if req.Starred != nil {
+		f.Labels.Starred = *req.Starred
+	}
+
+	for _, parentId := range req.AddParents {
+		if !hasParent(f, parentId) {
+			parent := &drive.ParentReference{Id: parentId, IsRoot: parentId == MemoryRootId}
+			f.Parents = append(f.Parents, parent)
+		}
+	}
+	for _, parentId := range req.RemoveParents {
+		var remaining []*drive.ParentReference
+		for _, p := range f.Parents {
+			if p.Id != parentId {
+				remaining = append(remaining, p)
+			}
+		}
+		f.Parents = remaining
+	}
+
+	if req.Content != nil {
+		mb.setContentLocked(e, content, false)
+	}
+	mb.touchedLocked(e, false)
+
+	return mb.driveFileLocked(e), nil
+}
+
+// update applies fn to the entry with id and returns the updated file.
+func (mb *MemoryBackend) update(id string, fn func(*memoryEntry) error) (*File, error) {
+	mb.Lock()
+	defer mb.Unlock()
+
+	e, err := mb.lookupLocked(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fn(e); err != nil {
+		return nil, err
+	}
+
+	mb.touchedLocked(e, false)
+	return mb.toFileLocked(e), nil
+}
+
+func (mb *MemoryBackend) Touch(id string) (*File, error) {
+	return mb.SetModTime(id, time.Now())
+}
+
+func (mb *MemoryBackend) SetModTime(id string, modTime time.Time) (*File, error) {
+	return mb.update(id, func(e *memoryEntry) error {
+		e.file.ModifiedDate = toUTCString(modTime)
+		return nil
+	})
+}
+
+func (mb *MemoryBackend) setTrashed(id string, trashed bool) error {
+	_, err := mb.update(id, func(e *memoryEntry) error {
+		e.file.Labels.Trashed = trashed
+		return nil
+	})
+	return err
+}
+
+func (mb *MemoryBackend) Trash(id string) error {
+	return mb.setTrashed(id, true)
+}
+
+func (mb *MemoryBackend) Untrash(id string) error {
+	return mb.setTrashed(id, false)
+}
+
+// deleteLocked removes the entry with id together with
+// all the descendants that have no other remaining parent.
+func (mb *MemoryBackend) deleteLocked(id string) {
+	e, ok := mb.entries[id]
+	if !ok {
+		return
+	}
+
+	delete(mb.entries, id)
+	mb.touchedLocked(e, true)
+
+	for childId, child := range mb.entries {
+		if !hasParent(child.file, id) {
+			continue
+		}
+
+		var remaining []*drive.ParentReference
+		for _, p := range child.file.Parents {
+			if p.Id != id {
+				remaining = append(remaining, p)
+			}
+		}
+
+		child.file.Parents = remaining
+		if len(remaining) < 1 {
+			mb.deleteLocked(childId)
+		}
+	}
+}
+
+func (mb *MemoryBackend) Delete(id string) error {
+	mb.Lock()
+	defer mb.Unlock()
+
+	if _, err := mb.lookupLocked(id); err != nil {
+		return err
+	}
+
+	mb.deleteLocked(id)
+	return nil
+}
+
+func (mb *MemoryBackend) EmptyTrash() error {
+	mb.Lock()
+	defer mb.Unlock()
+
+	var trashed []string
+	for id, e := range mb.entries {
+		if isTrashed(e.file) {
+			trashed = append(trashed, id)
+		}
+	}
+
+	for _, id := range trashed {
+		mb.deleteLocked(id)
+	}
+	return nil
+}
+
+func (mb *MemoryBackend) rename(fileId, newTitle string) (*File, error) {
+	return mb.update(fileId, func(e *memoryEntry) error {
+		e.file.Title = newTitle
+		return nil
+	})
+}
+
+func (mb *MemoryBackend) updateDescription(fileId, newDescription string) (*File, error) {
+	return mb.update(fileId, func(e *memoryEntry) error {
+		e.file.Description = newDescription
+		return nil
+	})
+}
+
+func (mb *MemoryBackend) updateStarred(fileId string, star bool) (*File, error) {
+	return mb.update(fileId, func(e *memoryEntry) error {
+		e.file.Labels.Starred = star
+		return nil
+	})
+}
+
+func (mb *MemoryBackend) insertParent(fileId, parentId string) error {
+	_, err := mb.update(fileId, func(e *memoryEntry) error {
+		if _, pErr := mb.lookupLocked(parentId); pErr != nil {
+			return errNilParent
+		}
+		if !hasParent(e.file, parentId) {
+			parent := &drive.ParentReference{Id: parentId, IsRoot: parentId == MemoryRootId}
+			e.file.Parents = append(e.file.Parents, parent)
+		}
+		return nil
+	})
+	return err
+}
+
+func (mb *MemoryBackend) removeParent(fileId, parentId string) error {
+	_, err := mb.update(fileId, func(e *memoryEntry) error {
+		var remaining []*drive.ParentReference
+		for _, p := range e.file.Parents {
+			if p.Id != parentId {
+				remaining = append(remaining, p)
+			}
+		}
+		e.file.Parents = remaining
+		return nil
+	})
+	return err
+}
+
+func (mb *MemoryBackend) copy(newName, parentId string, srcFile *File) (*File, error) {
+	mb.Lock()
+	defer mb.Unlock()
+
+	src, err := mb.lookupLocked(srcFile.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	dup := dupDriveFile(src.file)
+	dup.Id = mb.nextIdLocked()
+	if dup.DownloadUrl != "" {
+		dup.DownloadUrl = memoryDownloadURL(dup.Id)
+	}
+	dup.Title = urlToPath(newName, false)
+	dup.ModifiedDate = toUTCString(srcFile.ModTime)
+	dup.Labels = &drive.FileLabels{}
+	dup.Version = 0
+	if parentId != "" {
+		dup.Parents = []*drive.ParentReference{
+			{Id: parentId, IsRoot: parentId == MemoryRootId},
+		}
+	}
+
+	e := &memoryEntry{file: dup, content: src.content}
+	mb.entries[dup.Id] = e
+	if dup.DownloadUrl != "" {
+		mb.addRevisionLocked(e, false)
+	}
+	mb.touchedLocked(e, false)
+
+	return mb.toFileLocked(e), nil
+}
+
+func (mb *MemoryBackend) insertShortcut(parentId, title, targetId string) (*File, error) {
+	mb.Lock()
+	defer mb.Unlock()
+
+	if _, err := mb.lookupLocked(parentId); err != nil {
+		return nil, errNilParent
+	}
+	target, err := mb.lookupLocked(targetId)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &memoryEntry{
+		file: &drive.File{
+			Id:           mb.nextIdLocked(),
+			Title:        urlToPath(title, false),
+			MimeType:     DriveShortcutMimeType,
+			ModifiedDate: toUTCString(time.Now()),
+			Labels:       &drive.FileLabels{},
+			Parents: []*drive.ParentReference{
+				{Id: parentId, IsRoot: parentId == MemoryRootId},
+			},
+			ShortcutDetails: &drive.FileShortcutDetails{
+				TargetId:       targetId,
+				TargetMimeType: target.file.MimeType,
+			},
+		},
+	}
+	mb.entries[e.file.Id] = e
+	mb.touchedLocked(e, false)
+
+	return mb.toFileLocked(e), nil
+}
+
+func (mb *MemoryBackend) idForEmail(email string) (string, error) {
+	return fmt.Sprintf("%x", md5.Sum([]byte(strings.ToLower(email)))), nil
+}
+
+func (mb *MemoryBackend) listPermissions(id string) ([]*drive.Permission, error) {
+	mb.Lock()
+	defer mb.Unlock()
+
+	e, err := mb.lookupLocked(id)
+	if err != nil {
+		return nil, err
+	}
+	return append([]*drive.Permission{}, e.permissions...), nil
+}
+
+func (mb *MemoryBackend) insertPermissions(permInfo *permission) (*drive.Permission, error) {
+	perm := &drive.Permission{
+		Role:         permInfo.role.String(),
+		Type:         permInfo.accountType.String(),
+		WithLink:     permInfo.withLink,
+		Value:        permInfo.value,
+		EmailAddress: permInfo.value,
+	}
+
+	if permInfo.accountType == Anyone {
+		perm.Id = anyonePermissionId
+	} else {
+		perm.Id, _ = mb.idForEmail(permInfo.value)
+	}
+
+	_, err := mb.update(permInfo.fileId, func(e *memoryEntry) error {
+		e.permissions = append(e.permissions, perm)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return perm, nil
+}
+
+// dropPermissions removes the permissions of fileId that satisfy
+// the predicate and returns the number of permissions removed.
+func (mb *MemoryBackend) dropPermissions(fileId string, pred func(*drive.Permission) bool) (int, error) {
+	dropped := 0
+	_, err := mb.update(fileId, func(e *memoryEntry) error {
+		var remaining []*drive.Permission
+		for _, perm := range e.permissions {
+			if pred(perm) {
+				dropped += 1
+			} else {
+				remaining = append(remaining, perm)
+			}
+		}
+		e.permissions = remaining
+		return nil
+	})
+	return dropped, err
+}
+
+func (mb *MemoryBackend) revokePermissions(p *permission) error {
+	requiredSignature := stringifyPermissionForMatch(p)
+	dropped, err := mb.dropPermissions(p.fileId, func(perm *drive.Permission) bool {
+		return stringifyDrivePermissionForMatch(perm) == requiredSignature
+	})
+	if err != nil {
+		return err
+	}
+
+	if dropped < 1 {
+		return noMatchesFoundErr(fmt.Errorf("no matches found!"))
+	}
+	return nil
+}
+
+// addRevisionLocked records the current content of the entry as its head revision.
+func (mb *MemoryBackend) addRevisionLocked(e *memoryEntry, pinned bool) {
+	rev := &drive.Revision{
+		Id:                    fmt.Sprintf("%d", len(e.revisions)+1),
+		DownloadUrl:           memoryDownloadURL(e.file.Id),
+		FileSize:              e.file.FileSize,
+		LastModifyingUserName: "memory",
+		Md5Checksum:           e.file.Md5Checksum,
+		MimeType:              e.file.MimeType,
+		ModifiedDate:          e.file.ModifiedDate,
+		OriginalFilename:      e.file.Title,
+		Pinned:                pinned,
+	}
+	e.revisions = append(e.revisions, &memoryRevision{revision: rev, content: e.content})
+}
+
+func (mb *MemoryBackend) revisionLocked(fileId, revisionId string) (*memoryRevision, error) {
+	e, err := mb.lookupLocked(fileId)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, mr := range e.revisions {
+		if mr.revision.Id == revisionId {
+			return mr, nil
+		}
+	}
+	return nil, nonExistantRemoteErr(fmt.Errorf("no revision %s of %s", customQuote(revisionId), customQuote(fileId)))
+}
+
+func (mb *MemoryBackend) listRevisions(fileId string) ([]*drive.Revision, error) {
+	mb.Lock()
+	defer mb.Unlock()
+
+	e, err := mb.lookupLocked(fileId)
+	if err != nil {
+		return nil, err
+	}
+
+	var revisions []*drive.Revision
+	for _, mr := range e.revisions {
+		dup := *mr.revision
+		revisions = append(revisions, &dup)
+	}
+	return revisions, nil
+}
+
+func (mb *MemoryBackend) getRevision(fileId, revisionId string) (*drive.Revision, error) {
+	mb.Lock()
+	defer mb.Unlock()
+
+	mr, err := mb.revisionLocked(fileId, revisionId)
+	if err != nil {
+		return nil, err
+	}
+
+	dup := *mr.revision
+	return &dup, nil
+}
+
+func (mb *MemoryBackend) downloadRevision(fileId string, rev *drive.Revision, exportURL string) (io.ReadCloser, error) {
+	if exportURL != "" {
+		return nil, errMemoryExportsUnsupported
+	}
+
+	mb.Lock()
+	mr, err := mb.revisionLocked(fileId, rev.Id)
+	decrypter := mb.decrypter
+	mb.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	body := ioutil.NopCloser(bytes.NewReader(mr.content))
+	if decrypter != nil {
+		return decrypter(body)
+	}
+	return body, nil
+}
+
+func (mb *MemoryBackend) pinRevision(fileId, revisionId string, pinned bool) (*drive.Revision, error) {
+	mb.Lock()
+	defer mb.Unlock()
+
+	mr, err := mb.revisionLocked(fileId, revisionId)
+	if err != nil {
+		return nil, err
+	}
+
+	mr.revision.Pinned = pinned
+	dup := *mr.revision
+	return &dup, nil
+}
+
+func memoryUser() *drive.User {
+	return &drive.User{DisplayName: "memory", IsAuthenticatedUser: true}
+}
+
+func dupComment(c *drive.Comment) *drive.Comment {
+	dup := *c
+	dup.Replies = nil
+	for _, reply := range c.Replies {
+		replyDup := *reply
+		dup.Replies = append(dup.Replies, &replyDup)
+	}
+	return &dup
+}
+
+func (mb *MemoryBackend) commentLocked(fileId, commentId string) (*drive.Comment, error) {
+	e, err := mb.lookupLocked(fileId)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range e.comments {
+		if c.CommentId == commentId {
+			return c, nil
+		}
+	}
+	return nil, nonExistantRemoteErr(fmt.Errorf("no comment %s on %s", customQuote(commentId), customQuote(fileId)))
+}
+
+func (mb *MemoryBackend) listComments(fileId string) ([]*drive.Comment, error) {
+	mb.Lock()
+	defer mb.Unlock()
+
+	e, err := mb.lookupLocked(fileId)
+	if err != nil {
+		return nil, err
+	}
+
+	var comments []*drive.Comment
+	for _, c := range e.comments {
+		comments = append(comments, dupComment(c))
+	}
+	return comments, nil
+}
+
+func (mb *MemoryBackend) getComment(fileId, commentId string) (*drive.Comment, error) {
+	mb.Lock()
+	defer mb.Unlock()
+
+	c, err := mb.commentLocked(fileId, commentId)
+	if err != nil {
+		return nil, err
+	}
+	return dupComment(c), nil
+}
+
+func (mb *MemoryBackend) insertComment(fileId string, comment *drive.Comment) (*drive.Comment, error) {
+	mb.Lock()
+	defer mb.Unlock()
+
+	e, err := mb.lookupLocked(fileId)
+	if err != nil {
+		return nil, err
+	}
+
+	now := toUTCString(time.Now())
+	c := &drive.Comment{
+		CommentId:    mb.nextIdLocked(),
+		FileId:       fileId,
+		FileTitle:    e.file.Title,
+		Author:       memoryUser(),
+		Content:      comment.Content,
+		Anchor:       comment.Anchor,
+		Context:      comment.Context,
+		CreatedDate:  now,
+		ModifiedDate: now,
+		Status:       commentStatusOpen,
+	}
+	e.comments = append(e.comments, c)
+	return dupComment(c), nil
+}
+
+func (mb *MemoryBackend) insertReply(fileId, commentId string, reply *drive.CommentReply) (*drive.CommentReply, error) {
+	mb.Lock()
+	defer mb.Unlock()
+
+	c, err := mb.commentLocked(fileId, commentId)
+	if err != nil {
+		return nil, err
+	}
+
+	now := toUTCString(time.Now())
+	r := &drive.CommentReply{
+		ReplyId:      mb.nextIdLocked(),
+		Author:       memoryUser(),
+		Content:      reply.Content,
+		Verb:         reply.Verb,
+		CreatedDate:  now,
+		ModifiedDate: now,
+	}
+
+	switch reply.Verb {
+	case commentVerbResolve:
+		c.Status = commentStatusResolved
+	case commentVerbReopen:
+		c.Status = commentStatusOpen
+	}
+
+	c.Replies = append(c.Replies, r)
+	c.ModifiedDate = now
+
+	dup := *r
+	return &dup, nil
+}
+
+func (mb *MemoryBackend) setProperty(fileId string, prop *drive.Property) (*drive.Property, error) {
+	dup := *prop
+	if dup.Visibility == "" {
+		dup.Visibility = PropertyVisibilityPrivate
+	}
+
+	_, err := mb.update(fileId, func(e *memoryEntry) error {
+		// Replace rather than modify the slice since
+		// Files handed out earlier share it.
+		props := []*drive.Property{&dup}
+		for _, p := range e.file.Properties {
+			if p.Key != dup.Key || p.Visibility != dup.Visibility {
+				props = append(props, p)
+			}
+		}
+		e.file.Properties = props
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &dup, nil
+}
+
+func (mb *MemoryBackend) deleteProperty(fileId, key, visibility string) error {
+	_, err := mb.update(fileId, func(e *memoryEntry) error {
+		var props []*drive.Property
+		for _, p := range e.file.Properties {
+			if p.Key != key || p.Visibility != visibility {
+				props = append(props, p)
+			}
+		}
+		if len(props) == len(e.file.Properties) {
+			return nonExistantRemoteErr(fmt.Errorf("%s: no %s property %s", fileId, strings.ToLower(visibility), customQuote(key)))
+		}
+		e.file.Properties = props
+		return nil
+	})
+	return err
+}
+
+// sheetTabs is only needed to export spreadsheets, which the memory backend cannot do.
+func (mb *MemoryBackend) sheetTabs(spreadsheetId string) ([]*sheetTab, error) {
+	return nil, errMemoryExportsUnsupported
+}
+
+func (mb *MemoryBackend) Publish(id string) (string, error) {
+	_, err := mb.insertPermissions(&permission{
+		fileId:      id,
+		role:        Reader,
+		accountType: Anyone,
+	})
+	if err != nil {
+		return "", err
+	}
+	return DriveResourceHostURL + id, nil
+}
+
+func (mb *MemoryBackend) Unpublish(id string) error {
+	_, err := mb.dropPermissions(id, func(perm *drive.Permission) bool {
+		return perm.Id == anyonePermissionId
+	})
+	return err
+}
+
+func (mb *MemoryBackend) changes(startChangeId int64, fn func(*drive.Change) error) error {
+	mb.Lock()
+	var pending []*drive.Change
+	for _, change := range mb.changeLog {
+		if change.Id >= startChangeId {
+			pending = append(pending, change)
+		}
+	}
+	mb.Unlock()
+
+	for _, change := range pending {
+		if err := fn(change); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mb *MemoryBackend) allFiles(fn func(*drive.File) error) error {
+	mb.Lock()
+	var files []*drive.File
+	for _, e := range mb.entries {
+		files = append(files, mb.driveFileLocked(e))
+	}
+	mb.Unlock()
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Id < files[j].Id
+	})
+
+	for _, f := range files {
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mb *MemoryBackend) About() (*drive.About, error) {
+	mb.Lock()
+	defer mb.Unlock()
+
+	used, usedInTrash := int64(0), int64(0)
+	for _, e := range mb.entries {
+		used += e.file.FileSize
+		if isTrashed(e.file) {
+			usedInTrash += e.file.FileSize
+		}
+	}
+
+	about := &drive.About{
+		Name:                  "memory",
+		QuotaType:             "LIMITED",
+		QuotaBytesTotal:       mb.QuotaBytesTotal,
+		QuotaBytesUsed:        used,
+		QuotaBytesUsedInTrash: usedInTrash,
+		RootFolderId:          MemoryRootId,
+	}
+
+	if len(mb.changeLog) >= 1 {
+		about.LargestChangeId = mb.changeLog[len(mb.changeLog)-1].Id
+	}
+	return about, nil
+}
+
+// satisfiedBy evaluates the matchQuery against f client-side,
+// mirroring the Drive query that Stringer would produce.
+func (mq *matchQuery) satisfiedBy(f *drive.File) bool {
+	if mq.starred && !isStarred(f) {
+		return false
+	}
+
+	for i := range mq.mimeQuerySearches {
+		fz := &mq.mimeQuerySearches[i]
+		ok := fz.satisfiedBy(func(query string) bool {
+			resolvedMimeType := mimeTypeFromQuery(query)
+			if resolvedMimeType == "" {
+				resolvedMimeType = query
+			}
+			return fuzzyCompare(fz.fuzzyLevel, f.MimeType, resolvedMimeType)
+		})
+		if !ok {
+			return false
+		}
+	}
+
+	for i := range mq.titleSearches {
+		fz := &mq.titleSearches[i]
+		ok := fz.satisfiedBy(func(title string) bool {
+			if fz.starred {
+				return isStarred(f)
+			}
+			return fuzzyCompare(fz.fuzzyLevel, f.Title, title) && isTrashed(f) == fz.inTrash
+		})
+		if !ok {
+			return false
+		}
+	}
+
+	for _, pq := range mq.propertySearches {
+		if !pq.satisfiedBy(f.Properties) {
+			return false
+		}
+	}
+
+	if mq.query != nil && !mq.query.matches(NewRemoteFile(f), "") {
+		return false
+	}
+
+	for i := range mq.ownerSearches {
+		fz := &mq.ownerSearches[i]
+		ok := fz.satisfiedBy(func(owner string) bool {
+			owned := false
+			for _, name := range f.OwnerNames {
+				if name == owner {
+					owned = true
+				}
+			}
+			for _, user := range f.Owners {
+				if user != nil && user.EmailAddress == owner {
+					owned = true
+				}
+			}
+			if fz.fuzzyLevel == NotIn || fz.fuzzyLevel == Not {
+				return !owned
+			}
+			return owned
+		})
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (fz *fuzzyStringsValuePair) satisfiedBy(pred func(string) bool) bool {
+	if len(fz.values) < 1 {
+		return true
+	}
+
+	for _, value := range fz.values {
+		ok := pred(value)
+		if ok && fz.joiner != And {
+			return true
+		}
+		if !ok && fz.joiner == And {
+			return false
+		}
+	}
+
+	return fz.joiner == And
+}
+
+func fuzzyCompare(fz fuzziness, have, want string) bool {
+	switch fz {
+	case Like:
+		return strings.Contains(have, want)
+	case Not:
+		return have != want
+	case NotIn:
+		return !strings.Contains(have, want)
+	default:
+		return have == want
+	}
+}
@@ -0,0 +1,310 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/odeke-em/drive/config"
+)
+
+func memoryTestContext(t *testing.T) *config.Context {
+	// Push and pull throttle every change by 1/maxProcs seconds.
+	os.Setenv(DriveGoMaxProcsKey, "100")
+
+	dir, err := ioutil.TempDir("", "drive-memory")
+	if err != nil {
+		t.Fatalf("tempDir: %v", err)
+	}
+
+	_, _, context, err := config.Initialize(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("initialize %q: %v", dir, err)
+	}
+
+	return context
+}
+
+func memoryTestOptions(sources ...string) *Options {
+	return &Options{
+		Path:                         "/",
+		Sources:                      sources,
+		Depth:                        InfiniteDepth,
+		Recursive:                    true,
+		NoPrompt:                     true,
+		Quiet:                        true,
+		ExponentialBackoffRetryCount: 1,
+	}
+}
+
+func writeTestFiles(t *testing.T, root string, files map[string]string) {
+	for relPath, content := range files {
+		absPath := filepath.Join(root, relPath)
+		if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
+			t.Fatalf("mkdirAll %q: %v", absPath, err)
+		}
+		if err := ioutil.WriteFile(absPath, []byte(content), 0644); err != nil {
+			t.Fatalf("writeFile %q: %v", absPath, err)
+		}
+	}
+}
+
+// memoryTestPush pushes files from a fresh context to a fresh
+// MemoryBackend, the caller removes the context once done.
+func memoryTestPush(t *testing.T, files map[string]string) (*MemoryBackend, *config.Context) {
+	mb := NewMemoryBackend()
+	context := memoryTestContext(t)
+
+	writeTestFiles(t, context.AbsPath, files)
+	if err := NewWithBackend(context, memoryTestOptions("/"), mb).Push(); err != nil {
+		os.RemoveAll(context.AbsPath)
+		t.Fatalf("push: %v", err)
+	}
+	return mb, context
+}
+
+func remoteContent(t *testing.T, mb *MemoryBackend, p string) string {
+	f, err := mb.FindByPath(p)
+	if err != nil {
+		t.Fatalf("findByPath %q: %v", p, err)
+	}
+
+	body, err := mb.Download(f.Id, "")
+	if err != nil {
+		t.Fatalf("download %q: %v", p, err)
+	}
+	defer body.Close()
+
+	blob, err := ioutil.ReadAll(body)
+	if err != nil {
+		t.Fatalf("read %q: %v", p, err)
+	}
+	return string(blob)
+}
+
+func TestMemoryBackendPushPull(t *testing.T) {
+	mb := NewMemoryBackend()
+
+	pushContext := memoryTestContext(t)
+	defer os.RemoveAll(pushContext.AbsPath)
+
+	files := map[string]string{
+		"a.txt":           "alpha",
+		"docs/b.txt":      "bravo",
+		"docs/deep/c.txt": "charlie",
+	}
+	writeTestFiles(t, pushContext.AbsPath, files)
+
+	if err := NewWithBackend(pushContext, memoryTestOptions("/"), mb).Push(); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	for relPath, want := range files {
+		if got := remoteContent(t, mb, "/"+relPath); got != want {
+			t.Errorf("remote %q: got %q want %q", relPath, got, want)
+		}
+	}
+
+	pullContext := memoryTestContext(t)
+	defer os.RemoveAll(pullContext.AbsPath)
+
+	if err := NewWithBackend(pullContext, memoryTestOptions("/"), mb).Pull(); err != nil {
+		t.Fatalf("pull: %v", err)
+	}
+
+	for relPath, want := range files {
+		blob, err := ioutil.ReadFile(filepath.Join(pullContext.AbsPath, relPath))
+		if err != nil {
+			t.Errorf("pulled %q: %v", relPath, err)
+			continue
+		}
+		if got := string(blob); got != want {
+			t.Errorf("pulled %q: got %q want %q", relPath, got, want)
+		}
+	}
+
+	// Modify the content and ensure that only the update is pushed.
+	later := time.Now().Add(time.Hour)
+	modPath := filepath.Join(pullContext.AbsPath, "a.txt")
+	writeTestFiles(t, pullContext.AbsPath, map[string]string{"a.txt": "alpha, modified"})
+	if err := os.Chtimes(modPath, later, later); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+
+	opts := memoryTestOptions("/a.txt")
+	opts.IgnoreChecksum = true
+	if err := NewWithBackend(pullContext, opts, mb).Push(); err != nil {
+		t.Fatalf("push modification: %v", err)
+	}
+
+	if got, want := remoteContent(t, mb, "/a.txt"), "alpha, modified"; got != want {
+		t.Errorf("remote after modification: got %q want %q", got, want)
+	}
+}
+
+func TestMemoryBackendDiff(t *testing.T) {
+	mb := NewMemoryBackend()
+
+	context := memoryTestContext(t)
+	defer os.RemoveAll(context.AbsPath)
+
+	writeTestFiles(t, context.AbsPath, map[string]string{"notes.txt": "first draft"})
+	if err := NewWithBackend(context, memoryTestOptions("/"), mb).Push(); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	if err := NewWithBackend(context, memoryTestOptions("/"), mb).Diff(); err != nil {
+		t.Errorf("diff of identical trees: %v", err)
+	}
+}
+
+func TestMemoryBackendFixClashes(t *testing.T) {
+	mb := NewMemoryBackend()
+
+	context := memoryTestContext(t)
+	defer os.RemoveAll(context.AbsPath)
+
+	for _, content := range []string{"one", "two", "three"} {
+		args := &upsertOpt{
+			parentId: MemoryRootId,
+			src:      &File{Name: "clash.txt", ModTime: time.Now()},
+		}
+		if _, _, err := mb.upsertByComparison(strings.NewReader(content), args); err != nil {
+			t.Fatalf("upsert %q: %v", content, err)
+		}
+	}
+
+	opts := memoryTestOptions("/")
+	opts.FixClashesMode = FixClashesRename
+	if err := NewWithBackend(context, opts, mb).FixClashes(false); err != nil {
+		t.Fatalf("fixClashes: %v", err)
+	}
+
+	children := mb.children(MemoryRootId, false, true)
+	if len(children) != 3 {
+		t.Fatalf("children: got %d want 3", len(children))
+	}
+
+	seen := map[string]bool{}
+	for _, f := range children {
+		if seen[f.Name] {
+			t.Errorf("name %q still clashes", f.Name)
+		}
+		seen[f.Name] = true
+	}
+}
+
+func TestMemoryBackendPullDiscardsStalePartial(t *testing.T) {
+	mb := NewMemoryBackend()
+
+	pushContext := memoryTestContext(t)
+	defer os.RemoveAll(pushContext.AbsPath)
+
+	writeTestFiles(t, pushContext.AbsPath, map[string]string{"a.txt": "alpha"})
+	if err := NewWithBackend(pushContext, memoryTestOptions("/"), mb).Push(); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	pullContext := memoryTestContext(t)
+	defer os.RemoveAll(pullContext.AbsPath)
+
+	// A partial file as long as the remote content but whose content differs
+	// must fail verification and be downloaded again from scratch.
+	writeTestFiles(t, pullContext.AbsPath, map[string]string{"a.txt" + PartialFileSuffix: "bravo"})
+	if err := NewWithBackend(pullContext, memoryTestOptions("/"), mb).Pull(); err != nil {
+		t.Fatalf("pull: %v", err)
+	}
+
+	blob, err := ioutil.ReadFile(filepath.Join(pullContext.AbsPath, "a.txt"))
+	if err != nil {
+		t.Fatalf("pulled: %v", err)
+	}
+	if got, want := string(blob), "alpha"; got != want {
+		t.Errorf("pulled: got %q want %q", got, want)
+	}
+
+	if _, err := os.Stat(filepath.Join(pullContext.AbsPath, "a.txt"+PartialFileSuffix)); !os.IsNotExist(err) {
+		t.Errorf("partial file not cleaned up: %v", err)
+	}
+}
+
+func TestMemoryBackendPushSkipsOnlyDrivePartials(t *testing.T) {
+	mb := NewMemoryBackend()
+
+	context := memoryTestContext(t)
+	defer os.RemoveAll(context.AbsPath)
+
+	writeTestFiles(t, context.AbsPath, map[string]string{
+		"x.partial":                 "a file of the user's",
+		"a.txt" + PartialFileSuffix: "still downloading",
+	})
+	if err := NewWithBackend(context, memoryTestOptions("/"), mb).Push(); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	if got, want := remoteContent(t, mb, "/x.partial"), "a file of the user's"; got != want {
+		t.Errorf("x.partial: got %q want %q", got, want)
+	}
+	if _, err := mb.FindByPath("/a.txt" + PartialFileSuffix); err != ErrPathNotExists {
+		t.Errorf("drive's own partial file was pushed: %v", err)
+	}
+}
+
+func TestMemoryBackendSharedByConcurrentCommands(t *testing.T) {
+	mb := NewMemoryBackend()
+
+	// Like watch and the API server, each command is made up front
+	// from the same backend and they then run at the same time.
+	var commands []*Commands
+	for _, dir := range []string{"a", "b", "c"} {
+		context := memoryTestContext(t)
+		defer os.RemoveAll(context.AbsPath)
+
+		writeTestFiles(t, context.AbsPath, map[string]string{
+			dir + "/1.txt": dir + "1",
+			dir + "/2.txt": dir + "2",
+		})
+		commands = append(commands, NewWithBackend(context, memoryTestOptions("/"+dir), mb))
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(commands))
+	for i, g := range commands {
+		wg.Add(1)
+		go func(i int, g *Commands) {
+			defer wg.Done()
+			errs[i] = g.Push()
+		}(i, g)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("push %d: %v", i, err)
+		}
+	}
+	for _, dir := range []string{"a", "b", "c"} {
+		if got, want := remoteContent(t, mb, "/"+dir+"/2.txt"), dir+"2"; got != want {
+			t.Errorf("/%s/2.txt: got %q want %q", dir, got, want)
+		}
+	}
+}
@@ -200,6 +200,9 @@ func internalIgnores() (ignores []string) {
 	if runtime.GOOS == OSLinuxKey {
 		ignores = append(ignores, "\\.\\s*desktop$")
 	}
+
+	// Files still being downloaded.
+	ignores = append(ignores, regexp.QuoteMeta(PartialFileSuffix)+"$")
 	return ignores
 }
 
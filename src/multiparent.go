@@ -0,0 +1,186 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// MultiParentLinkMode decides how the local copies
+// of a file that has several parents are linked.
+type MultiParentLinkMode uint8
+
+const (
+	MultiParentHardlink MultiParentLinkMode = iota
+	MultiParentSymlink
+)
+
+func hasMultipleParents(f *File) bool {
+	return f != nil && !f.IsDir && len(f.Parents) >= 2 && !hasExportLinks(f) && !isShortcut(f)
+}
+
+// markMultiParentLinks picks, for each file with several parents that is pulled
+// to more than one path, the change that downloads it. The other changes only
+// link to that one's path so that the file is downloaded once and the local
+// copies can't diverge.
+func markMultiParentLinks(cl []*Change) []*Change {
+	var candidates []*Change
+	for _, c := range cl {
+		if c == nil || !hasMultipleParents(c.Src) {
+			continue
+		}
+		if op := c.Op(); op == OpAdd || op == OpMod {
+			candidates = append(candidates, c)
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Path < candidates[j].Path
+	})
+
+	primaries := map[string]*Change{}
+	for _, c := range candidates {
+		if primary, ok := primaries[c.Src.Id]; ok {
+			c.linkTo = primary.Path
+			continue
+		}
+		primaries[c.Src.Id] = c
+	}
+	return cl
+}
+
+// splitLinkChanges separates the changes that link
+// to what others pull from those that pull content.
+func splitLinkChanges(cl []*Change) (pulls, links []*Change) {
+	for _, c := range cl {
+		if c != nil && c.linkTo != "" {
+			links = append(links, c)
+		} else {
+			pulls = append(pulls, c)
+		}
+	}
+	return
+}
+
+// localLink makes change.Path a link to change.linkTo which holds the same file.
+func (g *Commands) localLink(change *Change) (err error) {
+	defer func() {
+		if err == nil {
+			chunks := chunkInt64(change.Src.Size)
+			for n := range chunks {
+				g.progressChan <- n
+			}
+		}
+	}()
+
+	linkAbsPath := g.context.AbsPathOf(change.Path)
+	primaryAbsPath := g.context.AbsPathOf(change.linkTo)
+
+	if err := os.MkdirAll(g.context.AbsPathOf(change.Parent), os.ModeDir|0755); err != nil {
+		return err
+	}
+	if info, lErr := os.Lstat(linkAbsPath); lErr == nil && !info.IsDir() {
+		if err := os.Remove(linkAbsPath); err != nil {
+			return err
+		}
+	}
+
+	if g.opts.MultiParentLinks == MultiParentSymlink {
+		var linkTo string
+		if linkTo, err = filepath.Rel(filepath.Dir(linkAbsPath), primaryAbsPath); err == nil {
+			err = os.Symlink(linkTo, linkAbsPath)
+		}
+	} else {
+		err = os.Link(primaryAbsPath, linkAbsPath)
+	}
+
+	if err != nil {
+		// Links aren't possible across devices and on some filesystems.
+		g.log.LogErrf("%s: cannot link to %s, copying it instead: %v\n", change.Path, change.linkTo, err)
+		if err = copyLocalFile(primaryAbsPath, linkAbsPath); err != nil {
+			return err
+		}
+	}
+
+	return chtimesNoFollow(linkAbsPath, change.Src.ModTime)
+}
+
+func copyLocalFile(from, to string) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dest, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dest, src); err != nil {
+		dest.Close()
+		return err
+	}
+	return dest.Close()
+}
+
+// dedupMultiParentPushes keeps only one of the changes that push local copies
+// of the same remote file which has several parents, so that the file gets
+// updated once. Copies whose content differs are returned as conflicts since
+// there is no telling which of them should win.
+func dedupMultiParentPushes(cl []*Change) (deduped, conflicts []*Change) {
+	byId := map[string][]*Change{}
+	for _, c := range cl {
+		if c == nil || c.Op() != OpMod || !hasMultipleParents(c.Dest) {
+			deduped = append(deduped, c)
+			continue
+		}
+		if _, seen := byId[c.Dest.Id]; !seen {
+			deduped = append(deduped, c)
+		}
+		byId[c.Dest.Id] = append(byId[c.Dest.Id], c)
+	}
+
+	for _, copies := range byId {
+		checksum := md5Checksum(copies[0].Src)
+		for _, c := range copies[1:] {
+			if md5Checksum(c.Src) != checksum {
+				conflicts = append(conflicts, copies...)
+				break
+			}
+		}
+	}
+
+	if len(conflicts) >= 1 {
+		return nil, conflicts
+	}
+	return deduped, nil
+}
+
+func warnMultiParentConflicts(g *Commands, conflicts []*Change) error {
+	var paths []string
+	for _, c := range conflicts {
+		paths = append(paths, c.Path)
+	}
+	sort.Strings(paths)
+
+	g.log.LogErrf("These local copies of the same remote file differ:\n\t%s\n", strings.Join(paths, "\n\t"))
+	return unresolvedConflictsErr(fmt.Errorf("differing copies of files with several parents have prevented a push operation"))
+}
@@ -0,0 +1,116 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMultiParentFiles(t *testing.T) {
+	mb := NewMemoryBackend()
+
+	context := memoryTestContext(t)
+	defer os.RemoveAll(context.AbsPath)
+
+	writeTestFiles(t, context.AbsPath, map[string]string{
+		"a/shared.txt": "shared",
+		"b/other.txt":  "other",
+	})
+	if err := NewWithBackend(context, memoryTestOptions("/"), mb).Push(); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	f, err := mb.FindByPath("/a/shared.txt")
+	if err != nil {
+		t.Fatalf("findByPath: %v", err)
+	}
+	b, err := mb.FindByPath("/b")
+	if err != nil {
+		t.Fatalf("findByPath: %v", err)
+	}
+	if err := mb.insertParent(f.Id, b.Id); err != nil {
+		t.Fatalf("insertParent: %v", err)
+	}
+
+	pullContext := memoryTestContext(t)
+	defer os.RemoveAll(pullContext.AbsPath)
+
+	if err := NewWithBackend(pullContext, memoryTestOptions("/"), mb).Pull(); err != nil {
+		t.Fatalf("pull: %v", err)
+	}
+
+	aPath := filepath.Join(pullContext.AbsPath, "a", "shared.txt")
+	bPath := filepath.Join(pullContext.AbsPath, "b", "shared.txt")
+	aInfo, aErr := os.Stat(aPath)
+	bInfo, bErr := os.Stat(bPath)
+	if aErr != nil || bErr != nil {
+		t.Fatalf("stat: %v %v", aErr, bErr)
+	}
+	if !os.SameFile(aInfo, bInfo) {
+		t.Errorf("b/shared.txt should be a hardlink to a/shared.txt")
+	}
+
+	revisions, err := mb.listRevisions(f.Id)
+	if err != nil {
+		t.Fatalf("listRevisions: %v", err)
+	}
+
+	// Editing either copy edits both, which should update the remote file once.
+	modifyTestFile(t, pullContext.AbsPath, "b/shared.txt", "shared and edited", time.Hour)
+	if err := NewWithBackend(pullContext, memoryTestOptions("/"), mb).Push(); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	if got := remoteContent(t, mb, "/a/shared.txt"); got != "shared and edited" {
+		t.Errorf("remote content: got %q", got)
+	}
+	edited, err := mb.listRevisions(f.Id)
+	if err != nil {
+		t.Fatalf("listRevisions: %v", err)
+	}
+	if len(edited) != len(revisions)+1 {
+		t.Errorf("revisions: got %d want %d", len(edited), len(revisions)+1)
+	}
+
+	// Copies that were edited differently can't both be pushed.
+	if err := os.Remove(bPath); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	modifyTestFile(t, pullContext.AbsPath, "a/shared.txt", "edited in a", 2*time.Hour)
+	modifyTestFile(t, pullContext.AbsPath, "b/shared.txt", "edited in b", 2*time.Hour)
+	if err := NewWithBackend(pullContext, memoryTestOptions("/"), mb).Push(); err == nil {
+		t.Errorf("expected differing copies to prevent the push")
+	}
+
+	symlinkContext := memoryTestContext(t)
+	defer os.RemoveAll(symlinkContext.AbsPath)
+
+	opts := memoryTestOptions("/")
+	opts.MultiParentLinks = MultiParentSymlink
+	if err := NewWithBackend(symlinkContext, opts, mb).Pull(); err != nil {
+		t.Fatalf("pull: %v", err)
+	}
+
+	linkTo, err := os.Readlink(filepath.Join(symlinkContext.AbsPath, "b", "shared.txt"))
+	if err != nil {
+		t.Fatalf("readlink: %v", err)
+	}
+	if want := filepath.Join("..", "a", "shared.txt"); linkTo != want {
+		t.Errorf("symlink: got %q want %q", linkTo, want)
+	}
+}
@@ -0,0 +1,501 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	drive "google.golang.org/api/drive/v2"
+)
+
+// The formats that list, stat, diff, about, md5sum, id, comments and watch print in.
+const (
+	OutputText = "text"
+	// OutputJSON prints a single JSON document, an array of
+	// records for all but about which prints a single record.
+	OutputJSON = "json"
+	// OutputJSONL prints each record on a line of its own as soon as it is known.
+	OutputJSONL = "jsonl"
+)
+
+// FileRecord is how list, stat, md5sum and id describe a file.
+// Fields that don't apply to a file, e.g the checksum of a
+// folder or the permissions outside of stat, are left out.
+type FileRecord struct {
+	// Path is relative to the root of the drive.
+	Path     string `json:"path"`
+	Id       string `json:"id,omitempty"`
+	Name     string `json:"name"`
+	IsDir    bool   `json:"isDir"`
+	MimeType string `json:"mimeType,omitempty"`
+	// Size is in bytes, QuotaBytesUsed is what the file counts against the quota.
+	Size           int64  `json:"size"`
+	QuotaBytesUsed int64  `json:"quotaBytesUsed"`
+	Md5Checksum    string `json:"md5Checksum,omitempty"`
+	Etag           string `json:"etag,omitempty"`
+	Version        int64  `json:"version"`
+
+	ModTime            time.Time  `json:"modTime"`
+	LastViewedByMeTime *time.Time `json:"lastViewedByMeTime,omitempty"`
+
+	Owners                []string `json:"owners,omitempty"`
+	LastModifyingUsername string   `json:"lastModifyingUsername,omitempty"`
+	OriginalFilename      string   `json:"originalFilename,omitempty"`
+	Description           string   `json:"description,omitempty"`
+	AlternateLink         string   `json:"alternateLink,omitempty"`
+	// ParentIds are the ids of the folders that the file is in.
+	ParentIds []string `json:"parentIds,omitempty"`
+
+	Shared   bool `json:"shared"`
+	Copyable bool `json:"copyable"`
+	Starred  bool `json:"starred"`
+	Trashed  bool `json:"trashed"`
+	Viewed   bool `json:"viewed"`
+	// Restricted is set if viewers can't download the file.
+	Restricted bool `json:"restricted"`
+
+	// Role is that of the authenticated user on the file.
+	Role       string            `json:"role,omitempty"`
+	Properties []*PropertyRecord `json:"properties,omitempty"`
+
+	ShortcutTargetId   string `json:"shortcutTargetId,omitempty"`
+	ShortcutTargetPath string `json:"shortcutTargetPath,omitempty"`
+
+	Permissions []*PermissionRecord `json:"permissions,omitempty"`
+}
+
+type PropertyRecord struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	// Visibility is either "public" or "private".
+	Visibility string `json:"visibility"`
+}
+
+// PermissionRecord is a grant of access to a file.
+type PermissionRecord struct {
+	Id           string `json:"id"`
+	Name         string `json:"name,omitempty"`
+	EmailAddress string `json:"emailAddress,omitempty"`
+	Domain       string `json:"domain,omitempty"`
+	// Role is one of owner, organizer, fileOrganizer, writer or reader,
+	// AdditionalRoles e.g ["commenter"] extend it.
+	Role            string   `json:"role"`
+	AdditionalRoles []string `json:"additionalRoles,omitempty"`
+	// AccountType is one of user, group, domain or anyone.
+	AccountType string `json:"accountType"`
+	WithLink    bool   `json:"withLink"`
+}
+
+// AboutRecord is what about prints, each part is only
+// present if the about command was asked for it.
+type AboutRecord struct {
+	Name           string               `json:"name"`
+	Quota          *QuotaRecord         `json:"quota,omitempty"`
+	MaxUploadSizes []*UploadSizeRecord  `json:"maxUploadSizes,omitempty"`
+	Features       []*FeatureRateRecord `json:"features,omitempty"`
+}
+
+// QuotaRecord is the usage of the quota of the account, in bytes.
+type QuotaRecord struct {
+	Type      string                `json:"type"`
+	Total     int64                 `json:"total"`
+	Used      int64                 `json:"used"`
+	Free      int64                 `json:"free"`
+	InTrash   int64                 `json:"inTrash"`
+	Aggregate int64                 `json:"aggregate"`
+	Services  []*ServiceQuotaRecord `json:"services,omitempty"`
+}
+
+type ServiceQuotaRecord struct {
+	Service   string `json:"service"`
+	BytesUsed int64  `json:"bytesUsed"`
+}
+
+type UploadSizeRecord struct {
+	Type string `json:"type"`
+	Size int64  `json:"size"`
+}
+
+type FeatureRateRecord struct {
+	Feature string `json:"feature"`
+	// QPS is the limit of requests per second.
+	QPS float64 `json:"qps"`
+}
+
+// ChangeRecord is how diff describes a path that differs between local
+// and remote. Operation and Crud are those that a push would perform.
+type ChangeRecord struct {
+	Path      string    `json:"path"`
+	Operation Operation `json:"operation"`
+	Crud      CrudValue `json:"crud"`
+	// Differences lists what differs of
+	// size, modTime, md5Checksum and dirType.
+	Differences []string    `json:"differences"`
+	Local       *FileRecord `json:"local,omitempty"`
+	Remote      *FileRecord `json:"remote,omitempty"`
+	// Hunks are those of a unified diff of the remote against
+	// the local content, the other way around with -base-local.
+	Hunks []*DiffHunk `json:"hunks,omitempty"`
+}
+
+type DiffHunk struct {
+	// Header is the range line e.g "@@ -1,3 +1,4 @@".
+	Header string `json:"header"`
+	// Lines start with ' ', '-' or '+', as in the unified diff.
+	Lines []string `json:"lines"`
+}
+
+// CommentRecord is how comments describes a comment on a file.
+type CommentRecord struct {
+	// Path is that of the file, relative to the root of the drive.
+	Path      string `json:"path"`
+	FileId    string `json:"fileId"`
+	CommentId string `json:"commentId"`
+	Author    string `json:"author,omitempty"`
+	Content   string `json:"content"`
+	Anchor    string `json:"anchor,omitempty"`
+	// Quote is the text of the file that the comment is about.
+	Quote string `json:"quote,omitempty"`
+	// Status is either "open" or "resolved".
+	Status   string         `json:"status"`
+	Created  string         `json:"created,omitempty"`
+	Modified string         `json:"modified,omitempty"`
+	Replies  []*ReplyRecord `json:"replies,omitempty"`
+}
+
+type ReplyRecord struct {
+	ReplyId string `json:"replyId"`
+	Author  string `json:"author,omitempty"`
+	Content string `json:"content,omitempty"`
+	// Verb is "resolve" or "reopen" for replies that change the status of the comment.
+	Verb    string `json:"verb,omitempty"`
+	Created string `json:"created,omitempty"`
+}
+
+// WatchEventRecord is what watch reports for every remote
+// change that it acts upon and for every pull that follows.
+type WatchEventRecord struct {
+	Time string `json:"time"`
+	// Action is one of update, trash, delete, pull, conflict or error.
+	Action   string `json:"action"`
+	ChangeId int64  `json:"changeId,omitempty"`
+	FileId   string `json:"fileId,omitempty"`
+	// Paths are those of the file within the sources being watched,
+	// or those pulled. A deleted file has its last known path.
+	Paths []string `json:"paths,omitempty"`
+	// MovedFrom is the last known path of a file that was
+	// moved or renamed away from it since it was last synced.
+	MovedFrom string `json:"movedFrom,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ErrorRecord is how errors are printed in the JSON formats,
+// under the key "error". Code is the ErrorStatus of the error.
+type ErrorRecord struct {
+	Message string      `json:"message"`
+	Code    ErrorStatus `json:"code"`
+}
+
+var operationNames = map[Operation]string{
+	OpNone:          "none",
+	OpAdd:           "add",
+	OpDelete:        "delete",
+	OpIndexAddition: "indexAddition",
+	OpMod:           "mod",
+	OpModConflict:   "modConflict",
+}
+
+func (op Operation) MarshalText() ([]byte, error) {
+	name, ok := operationNames[op]
+	if !ok {
+		return nil, fmt.Errorf("unknown operation %d", op)
+	}
+	return []byte(name), nil
+}
+
+// MarshalText names the operations of cv e.g "create,update" or "none".
+func (cv CrudValue) MarshalText() ([]byte, error) {
+	var names []string
+	for _, crud := range []struct {
+		value CrudValue
+		name  string
+	}{
+		{Create, "create"}, {Read, "read"}, {Update, "update"}, {Delete, "delete"},
+	} {
+		if cv&crud.value != 0 {
+			names = append(names, crud.name)
+		}
+	}
+	if len(names) < 1 {
+		return []byte("none"), nil
+	}
+	return []byte(strings.Join(names, ",")), nil
+}
+
+func ErrorRecordFor(err error) *ErrorRecord {
+	if err == nil {
+		return nil
+	}
+
+	code := StatusGeneric
+	switch e := err.(type) {
+	case *Error:
+		code = e.code
+	case Error:
+		code = e.code
+	}
+	return &ErrorRecord{Message: strings.TrimSpace(err.Error()), Code: code}
+}
+
+// WriteErrorRecord writes err to w as a line of JSON.
+func WriteErrorRecord(w io.Writer, err error) error {
+	blob, mErr := json.Marshal(map[string]*ErrorRecord{"error": ErrorRecordFor(err)})
+	if mErr != nil {
+		return mErr
+	}
+	_, wErr := fmt.Fprintf(w, "%s\n", blob)
+	return wErr
+}
+
+func (opts *Options) structuredOutput() bool {
+	return opts != nil && (opts.Output == OutputJSON || opts.Output == OutputJSONL)
+}
+
+// emitRecord prints v in the output format. In jsonl it goes on a
+// line of its own and in json into the array that endRecords closes.
+// Commands emit their records one after the other, never concurrently.
+func (g *Commands) emitRecord(v interface{}) {
+	if g.recordListener != nil {
+		g.recordListener(v)
+		return
+	}
+
+	blob, err := json.Marshal(v)
+	if err != nil {
+		g.log.LogErrf("%v\n", err)
+		return
+	}
+
+	if g.opts.Output == OutputJSONL {
+		g.log.Logf("%s\n", blob)
+		return
+	}
+
+	if g.recordCount == 0 {
+		g.log.Logf("[\n%s", blob)
+	} else {
+		g.log.Logf(",\n%s", blob)
+	}
+	g.recordCount += 1
+}
+
+// emitDocument prints v on a line of its own in either JSON format. It is
+// for the only record of a command, or for each record of a command that
+// goes on until it is stopped such as watch, which can't close an array.
+func (g *Commands) emitDocument(v interface{}) {
+	if g.recordListener != nil {
+		g.recordListener(v)
+		return
+	}
+
+	blob, err := json.Marshal(v)
+	if err != nil {
+		g.log.LogErrf("%v\n", err)
+		return
+	}
+	g.log.Logf("%s\n", blob)
+}
+
+// endRecords closes the array that json records are printed into.
+func (g *Commands) endRecords() {
+	if g.recordListener != nil || g.opts.Output != OutputJSON {
+		return
+	}
+
+	if g.recordCount == 0 {
+		g.log.Logln("[]")
+	} else {
+		g.log.Logln("\n]")
+	}
+	g.recordCount = 0
+}
+
+// emitError reports err, which doesn't stop the command, as a
+// JSON object on stderr in the JSON formats or as text otherwise.
+func (g *Commands) emitError(err error) {
+	if !g.opts.structuredOutput() {
+		g.log.LogErrf("%s\n", strings.TrimRight(err.Error(), "\n"))
+		return
+	}
+
+	blob, _ := json.Marshal(map[string]*ErrorRecord{"error": ErrorRecordFor(err)})
+	g.log.LogErrf("%s\n", blob)
+}
+
+func newFileRecord(relToRootPath string, f *File) *FileRecord {
+	fr := &FileRecord{
+		Path:     relToRootPath,
+		Id:       f.Id,
+		Name:     f.Name,
+		IsDir:    f.IsDir,
+		MimeType: f.MimeType,
+
+		Size:           f.Size,
+		QuotaBytesUsed: f.QuotaBytesUsed,
+		Etag:           f.Etag,
+		Version:        f.Version,
+		ModTime:        f.ModTime,
+
+		Owners:                f.OwnerNames,
+		LastModifyingUsername: f.LastModifyingUsername,
+		OriginalFilename:      f.OriginalFilename,
+		Description:           f.Description,
+		AlternateLink:         f.AlternateLink,
+
+		Shared:   f.Shared,
+		Copyable: f.Copyable,
+
+		ShortcutTargetId:   f.ShortcutTargetId,
+		ShortcutTargetPath: f.shortcutTargetPath,
+	}
+
+	if !f.IsDir {
+		fr.Md5Checksum = f.Md5Checksum
+	}
+	if !f.LastViewedByMeTime.IsZero() {
+		lastViewed := f.LastViewedByMeTime
+		fr.LastViewedByMeTime = &lastViewed
+	}
+	for _, parent := range f.Parents {
+		fr.ParentIds = append(fr.ParentIds, parent.Id)
+	}
+	if f.Labels != nil {
+		fr.Starred = f.Labels.Starred
+		fr.Trashed = f.Labels.Trashed
+		fr.Viewed = f.Labels.Viewed
+		fr.Restricted = f.Labels.Restricted
+	}
+	if f.UserPermission != nil {
+		fr.Role = f.UserPermission.Role
+	}
+	for _, prop := range f.Properties {
+		fr.Properties = append(fr.Properties, &PropertyRecord{
+			Key:        prop.Key,
+			Value:      prop.Value,
+			Visibility: strings.ToLower(prop.Visibility),
+		})
+	}
+
+	return fr
+}
+
+func newPermissionRecord(perm *drive.Permission) *PermissionRecord {
+	return &PermissionRecord{
+		Id:              perm.Id,
+		Name:            perm.Name,
+		EmailAddress:    perm.EmailAddress,
+		Domain:          perm.Domain,
+		Role:            perm.Role,
+		AdditionalRoles: perm.AdditionalRoles,
+		AccountType:     perm.Type,
+		WithLink:        perm.WithLink,
+	}
+}
+
+func newAboutRecord(about *drive.About, mask int) *AboutRecord {
+	ar := &AboutRecord{Name: about.Name}
+
+	if quotaRequested(mask) {
+		ar.Quota = &QuotaRecord{
+			Type:      about.QuotaType,
+			Total:     about.QuotaBytesTotal,
+			Used:      about.QuotaBytesUsed,
+			Free:      about.QuotaBytesTotal - about.QuotaBytesUsed,
+			InTrash:   about.QuotaBytesUsedInTrash,
+			Aggregate: about.QuotaBytesUsedAggregate,
+		}
+		for _, quotaService := range about.QuotaBytesByService {
+			ar.Quota.Services = append(ar.Quota.Services, &ServiceQuotaRecord{
+				Service:   quotaService.ServiceName,
+				BytesUsed: quotaService.BytesUsed,
+			})
+		}
+	}
+
+	if fileSizesRequested(mask) {
+		for _, uploadInfo := range about.MaxUploadSizes {
+			ar.MaxUploadSizes = append(ar.MaxUploadSizes, &UploadSizeRecord{
+				Type: uploadInfo.Type,
+				Size: uploadInfo.Size,
+			})
+		}
+	}
+
+	if featuresRequested(mask) {
+		for _, feature := range about.Features {
+			if feature.FeatureName == "" {
+				continue
+			}
+			ar.Features = append(ar.Features, &FeatureRateRecord{
+				Feature: feature.FeatureName,
+				QPS:     feature.FeatureRate,
+			})
+		}
+	}
+
+	return ar
+}
+
+// differenceNames names the differences in mask, as fileDifferences makes them.
+func differenceNames(mask int) []string {
+	names := []string{}
+	if sizeDiffers(mask) {
+		names = append(names, "size")
+	}
+	if modTimeDiffers(mask) {
+		names = append(names, "modTime")
+	}
+	if checksumDiffers(mask) {
+		names = append(names, "md5Checksum")
+	}
+	if dirTypeDiffers(mask) {
+		names = append(names, "dirType")
+	}
+	return names
+}
+
+// parseUnifiedDiff splits the output of `diff -u` into its hunks.
+func parseUnifiedDiff(output string) []*DiffHunk {
+	var hunks []*DiffHunk
+	var cur *DiffHunk
+
+	for _, line := range strings.Split(output, "\n") {
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			cur = &DiffHunk{Header: line, Lines: []string{}}
+			hunks = append(hunks, cur)
+		case cur == nil, line == "":
+			// The ---/+++ file headers and the trailing newline.
+		default:
+			cur.Lines = append(cur.Lines, line)
+		}
+	}
+
+	return hunks
+}
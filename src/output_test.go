@@ -0,0 +1,151 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/odeke-em/log"
+	drive "google.golang.org/api/drive/v2"
+)
+
+func TestStructuredOutput(t *testing.T) {
+	mb := NewMemoryBackend()
+
+	context := memoryTestContext(t)
+	defer os.RemoveAll(context.AbsPath)
+
+	writeTestFiles(t, context.AbsPath, map[string]string{
+		"docs/a.txt":   "alpha\nbravo\n",
+		"docs/b/c.txt": "charlie",
+	})
+	if err := NewWithBackend(context, memoryTestOptions("/"), mb).Push(); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	run := func(format string, opts *Options, fn func(g *Commands) error) (string, string, error) {
+		var stdout, stderr bytes.Buffer
+		opts.Quiet = false
+		opts.Output = format
+		g := NewWithBackend(context, opts, mb)
+		g.log = log.New(nil, &stdout, &stderr)
+		err := fn(g)
+		return stdout.String(), stderr.String(), err
+	}
+
+	opts := memoryTestOptions("/docs", "/missing")
+	opts.TypeMask = Minimal
+	stdout, stderr, err := run(OutputJSON, opts, func(g *Commands) error { return g.List(false) })
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	var files []*FileRecord
+	if err := json.Unmarshal([]byte(stdout), &files); err != nil {
+		t.Fatalf("list: %v in %s", err, stdout)
+	}
+	var paths []string
+	for _, fr := range files {
+		paths = append(paths, fr.Path)
+	}
+	if got, want := strings.Join(paths, " "), "/docs/a.txt /docs/b /docs/b/c.txt"; got != want {
+		t.Errorf("list: got %q want %q", got, want)
+	}
+	if files[0].Size != 12 || files[0].Md5Checksum == "" || !files[1].IsDir {
+		t.Errorf("list: incomplete records %+v %+v", files[0], files[1])
+	}
+	var errRecord struct{ Error *ErrorRecord }
+	if err := json.Unmarshal([]byte(stderr), &errRecord); err != nil || errRecord.Error.Code != StatusNonExistantRemote {
+		t.Errorf("list: expected an error record for /missing, got %q", stderr)
+	}
+
+	stdout, _, err = run(OutputJSONL, memoryTestOptions("/docs/b/c.txt"), func(g *Commands) error { return g.Stat() })
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	fr := &FileRecord{}
+	if err := json.Unmarshal([]byte(stdout), fr); err != nil || fr.Path != "/docs/b/c.txt" || fr.Name != "c.txt" {
+		t.Errorf("stat: got %+v, %v from %s", fr, err, stdout)
+	}
+
+	opts = memoryTestOptions("/docs")
+	opts.Depth = 2
+	stdout, _, err = run(OutputJSONL, opts, func(g *Commands) error { return g.Id() })
+	if err != nil {
+		t.Fatalf("id: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(stdout), "\n"); len(lines) != 3 {
+		t.Errorf("id: expected a line each for /docs and its children, got %s", stdout)
+	}
+
+	c, err := mb.FindByPath("/docs/b/c.txt")
+	if err != nil {
+		t.Fatalf("findByPath: %v", err)
+	}
+	if _, err := mb.insertComment(c.Id, &drive.Comment{Content: "check this"}); err != nil {
+		t.Fatalf("insertComment: %v", err)
+	}
+	stdout, _, err = run(OutputJSON, memoryTestOptions("/docs/b/c.txt"), func(g *Commands) error {
+		return g.Comments(&CommentsOptions{Action: CommentsActionList})
+	})
+	if err != nil {
+		t.Fatalf("comments: %v", err)
+	}
+	var comments []*CommentRecord
+	if err := json.Unmarshal([]byte(stdout), &comments); err != nil {
+		t.Fatalf("comments: %v in %s", err, stdout)
+	}
+	if len(comments) != 1 || comments[0].Path != "/docs/b/c.txt" || comments[0].Content != "check this" {
+		t.Errorf("comments: got %s", stdout)
+	}
+
+	// Only the content of a.txt differs locally.
+	later := time.Now().Add(time.Hour)
+	aPath := filepath.Join(context.AbsPath, "docs", "a.txt")
+	writeTestFiles(t, context.AbsPath, map[string]string{"docs/a.txt": "alpha\nbeta\n"})
+	if err := os.Chtimes(aPath, later, later); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+
+	stdout, _, err = run(OutputJSON, memoryTestOptions("/docs"), func(g *Commands) error { return g.Diff() })
+	if err != nil {
+		t.Fatalf("diff: %v", err)
+	}
+	var changes []*struct {
+		Path        string
+		Operation   string
+		Crud        string
+		Differences []string
+		Hunks       []*DiffHunk
+	}
+	if err := json.Unmarshal([]byte(stdout), &changes); err != nil {
+		t.Fatalf("diff: %v in %s", err, stdout)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("diff: expected only a.txt to differ, got %s", stdout)
+	}
+	change := changes[0]
+	if change.Path != "/docs/a.txt" || change.Crud != "update" || !strings.Contains(strings.Join(change.Differences, " "), "md5Checksum") {
+		t.Errorf("diff: got %+v", change)
+	}
+	if len(change.Hunks) != 1 || strings.Join(change.Hunks[0].Lines, "|") != " alpha|-bravo|+beta" {
+		t.Errorf("diff: unexpected hunks in %s", stdout)
+	}
+}
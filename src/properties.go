@@ -0,0 +1,189 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	drive "google.golang.org/api/drive/v2"
+)
+
+const (
+	PropActionSet = "set"
+	PropActionGet = "get"
+	PropActionRm  = "rm"
+)
+
+const (
+	PropertyVisibilityPublic  = "PUBLIC"
+	PropertyVisibilityPrivate = "PRIVATE"
+)
+
+type PropOptions struct {
+	// Action is one of PropActionSet, Get or Rm.
+	Action string
+	// Pairs are "key=value" pairs to set, or the keys to get or remove.
+	Pairs []string
+	// Private when set acts on the properties that only
+	// this app can see instead of the public ones.
+	Private bool
+}
+
+func (po *PropOptions) visibility() string {
+	if po.Private {
+		return PropertyVisibilityPrivate
+	}
+	return PropertyVisibilityPublic
+}
+
+// propertyQuery matches files that have the property key set to
+// value. An empty visibility matches properties of either visibility.
+type propertyQuery struct {
+	key        string
+	value      string
+	visibility string
+}
+
+func parsePropertyPair(pair string) (key, value string, err error) {
+	splits := strings.SplitN(pair, "=", 2)
+	key = strings.TrimSpace(splits[0])
+	if key == "" || len(splits) != 2 {
+		return "", "", invalidArgumentsErr(fmt.Errorf("property %s is not of the form key=value", customQuote(pair)))
+	}
+	return key, strings.TrimSpace(splits[1]), nil
+}
+
+func parsePropertyQueries(pairs []string) (pqs []*propertyQuery, err error) {
+	for _, pair := range pairs {
+		key, value, err := parsePropertyPair(pair)
+		if err != nil {
+			return nil, err
+		}
+		pqs = append(pqs, &propertyQuery{key: key, value: value})
+	}
+	return pqs, nil
+}
+
+func (pq *propertyQuery) Stringer() string {
+	visibilities := []string{pq.visibility}
+	if pq.visibility == "" {
+		visibilities = []string{PropertyVisibilityPublic, PropertyVisibilityPrivate}
+	}
+
+	var exprs []string
+	for _, visibility := range visibilities {
+		exprs = append(exprs, fmt.Sprintf("(properties has { key=%s and value=%s and visibility=%s })",
+			customQuote(pq.key), customQuote(pq.value), customQuote(visibility)))
+	}
+	return fmt.Sprintf("(%s)", strings.Join(exprs, " or "))
+}
+
+func (pq *propertyQuery) satisfiedBy(properties []*drive.Property) bool {
+	for _, prop := range properties {
+		if prop == nil || prop.Key != pq.key || prop.Value != pq.value {
+			continue
+		}
+		if pq.visibility == "" || strings.EqualFold(prop.Visibility, pq.visibility) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Remote) setProperty(fileId string, prop *drive.Property) (*drive.Property, error) {
+	// Insert updates the property if it already exists.
+	return r.service.Properties.Insert(fileId, prop).Do()
+}
+
+func (r *Remote) deleteProperty(fileId, key, visibility string) error {
+	return r.service.Properties.Delete(fileId, key).Visibility(visibility).Do()
+}
+
+// Prop sets, gets or removes the custom properties of the file at g.opts.Sources[0].
+func (g *Commands) Prop(po *PropOptions) error {
+	if len(g.opts.Sources) != 1 {
+		return invalidArgumentsErr(fmt.Errorf("prop %s: expecting exactly one path", po.Action))
+	}
+
+	relToRootPath := g.opts.Sources[0]
+	f, err := g.rem.FindByPath(relToRootPath)
+	if err != nil {
+		return err
+	}
+
+	switch po.Action {
+	case PropActionGet:
+		return g.getProperties(f, po)
+	case PropActionSet, PropActionRm:
+	default:
+		return invalidArgumentsErr(fmt.Errorf("prop: unknown action %s", customQuote(po.Action)))
+	}
+
+	if len(po.Pairs) < 1 {
+		return invalidArgumentsErr(fmt.Errorf("prop %s: expecting at least one property", po.Action))
+	}
+
+	for _, pair := range po.Pairs {
+		if po.Action == PropActionRm {
+			key := strings.TrimSpace(strings.SplitN(pair, "=", 2)[0])
+			if err := g.rem.deleteProperty(f.Id, key, po.visibility()); err != nil {
+				return err
+			}
+			continue
+		}
+
+		key, value, err := parsePropertyPair(pair)
+		if err != nil {
+			return err
+		}
+
+		prop := &drive.Property{Key: key, Value: value, Visibility: po.visibility()}
+		if _, err := g.rem.setProperty(f.Id, prop); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *Commands) getProperties(f *File, po *PropOptions) error {
+	wanted := map[string]bool{}
+	for _, key := range po.Pairs {
+		wanted[strings.TrimSpace(key)] = true
+	}
+
+	props := append([]*drive.Property{}, f.Properties...)
+	sort.SliceStable(props, func(i, j int) bool {
+		return props[i].Key < props[j].Key
+	})
+
+	for _, prop := range props {
+		if len(wanted) >= 1 && !wanted[prop.Key] {
+			continue
+		}
+		g.log.Logf("%s=%s\t%s\n", prop.Key, prop.Value, strings.ToLower(prop.Visibility))
+	}
+	return nil
+}
+
+// propertySearches returns the queries for the
+// properties that the files to act upon must have.
+func (g *Commands) propertySearches() ([]*propertyQuery, error) {
+	if g.opts.Meta == nil {
+		return nil, nil
+	}
+	return parsePropertyQueries((*g.opts.Meta)[PropertyKey])
+}
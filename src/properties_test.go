@@ -0,0 +1,91 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"os"
+	"testing"
+
+	drive "google.golang.org/api/drive/v2"
+)
+
+func TestPropertyQueryStringer(t *testing.T) {
+	pq := &propertyQuery{key: "project", value: "X", visibility: PropertyVisibilityPublic}
+	want := `(properties has { key="project" and value="X" and visibility="PUBLIC" })`
+	if got := pq.Stringer(); got != "("+want+")" {
+		t.Errorf("stringer: got %q want %q", got, "("+want+")")
+	}
+
+	if _, err := parsePropertyQueries([]string{"project"}); err == nil {
+		t.Errorf("expected an error for a property without a value")
+	}
+}
+
+func TestPropertyQuerySatisfiedBy(t *testing.T) {
+	props := []*drive.Property{
+		{Key: "project", Value: "X", Visibility: PropertyVisibilityPrivate},
+		{Key: "stage", Value: "draft", Visibility: PropertyVisibilityPublic},
+	}
+
+	cases := []struct {
+		pq   *propertyQuery
+		want bool
+	}{
+		{&propertyQuery{key: "project", value: "X"}, true},
+		{&propertyQuery{key: "project", value: "X", visibility: PropertyVisibilityPrivate}, true},
+		{&propertyQuery{key: "project", value: "X", visibility: PropertyVisibilityPublic}, false},
+		{&propertyQuery{key: "project", value: "Y"}, false},
+		{&propertyQuery{key: "stage", value: "draft", visibility: "public"}, true},
+	}
+	for _, tc := range cases {
+		if got := tc.pq.satisfiedBy(props); got != tc.want {
+			t.Errorf("%+v: got %v want %v", tc.pq, got, tc.want)
+		}
+	}
+}
+
+func TestPropRejectsBadArguments(t *testing.T) {
+	mb, context := memoryTestPush(t, map[string]string{
+		"a/brief.txt": "brief",
+		"b/notes.txt": "notes",
+	})
+	defer os.RemoveAll(context.AbsPath)
+
+	cases := []struct {
+		desc    string
+		sources []string
+		po      *PropOptions
+	}{
+		{"unknown action", []string{"/a/brief.txt"}, &PropOptions{Action: "list"}},
+		{"set without pairs", []string{"/a/brief.txt"}, &PropOptions{Action: PropActionSet}},
+		{"set without a value", []string{"/a/brief.txt"}, &PropOptions{Action: PropActionSet, Pairs: []string{"stage"}}},
+		{"set on two files", []string{"/a/brief.txt", "/b/notes.txt"}, &PropOptions{Action: PropActionSet, Pairs: []string{"stage=draft"}}},
+		{"rm of a missing property", []string{"/a/brief.txt"}, &PropOptions{Action: PropActionRm, Pairs: []string{"stage"}}},
+	}
+
+	for _, tc := range cases {
+		if err := NewWithBackend(context, memoryTestOptions(tc.sources...), mb).Prop(tc.po); err == nil {
+			t.Errorf("%s: succeeded", tc.desc)
+		}
+	}
+
+	f, err := mb.FindByPath("/a/brief.txt")
+	if err != nil {
+		t.Fatalf("findByPath: %v", err)
+	}
+	if len(f.Properties) != 0 {
+		t.Errorf("properties: got %+v want none", f.Properties)
+	}
+}
@@ -15,6 +15,7 @@
 package drive
 
 import (
+	"crypto/md5"
 	"errors"
 	"fmt"
 	"io"
@@ -23,9 +24,11 @@ import (
 	"path/filepath"
 	"runtime"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/odeke-em/drive/config"
+	expb "github.com/odeke-em/exponential-backoff"
 	"github.com/odeke-em/semalim"
 	"github.com/odeke-em/statos"
 )
@@ -34,6 +37,11 @@ var (
 	maxConcPulls = DefaultMaxProcs
 )
 
+// PartialFileSuffix is appended to the paths of files being downloaded
+// until all of their content has been received and verified. It is
+// particular to drive so that pushes only skip drive's own partial files.
+const PartialFileSuffix = ".drive-partial"
+
 type pullType uint
 
 const (
@@ -49,12 +57,17 @@ type urlMimeTypeExt struct {
 	ext      string
 	mimeType string
 	url      string
+	// path is where an export is saved to.
+	path string
 }
 
 type downloadArg struct {
-	id              string
-	path            string
-	exportURL       string
+	id        string
+	path      string
+	exportURL string
+	// md5Checksum if set is verified against the downloaded content.
+	md5Checksum     string
+	size            int64
 	ackByteProgress bool
 }
 
@@ -91,8 +104,7 @@ func (g *Commands) PullMatchLike() error {
 }
 
 func pull(g *Commands, pt pullType) error {
-	g.rem.encrypter = g.opts.Encrypter
-	g.rem.decrypter = g.opts.Decrypter
+	g.rem.setCrypto(g.opts.Encrypter, g.opts.Decrypter)
 
 	cl, clashes, err := pullLikeResolve(g, pt)
 
@@ -120,7 +132,7 @@ func pull(g *Commands, pt pullType) error {
 		return unresolvedConflictsErr(fmt.Errorf("conflicts have prevented a pull operation"))
 	}
 
-	nonConflicts := *nonConflictsPtr
+	nonConflicts := markMultiParentLinks(*nonConflictsPtr)
 
 	clArg := &changeListArg{
 		logy:       g.log,
@@ -158,9 +170,18 @@ func pullLikeResolve(g *Commands, pt pullType) (cl, clashes []*Change, err error
 	spin.play()
 	defer spin.stop()
 
+	matches, searched, err := g.searchedMatches(false)
+	if err != nil {
+		return cl, clashes, err
+	}
+
 	resolver := g.pullByPath
 
-	if typeById(pt) {
+	if searched {
+		resolver = func() (cl, cll []*Change, err error) {
+			return g.pullSearched(matches)
+		}
+	} else if typeById(pt) {
 		resolver = g.pullById
 	} else if typeByAllStarred(pt) {
 		resolver = g.pullAllStarred
@@ -299,8 +320,7 @@ func (g *Commands) pullLikeMatchesResolver(pt pullType) (cl, clashes []*Change,
 }
 
 func (g *Commands) PullPiped(byId bool) (err error) {
-	g.rem.encrypter = g.opts.Encrypter
-	g.rem.decrypter = g.opts.Decrypter
+	g.rem.setCrypto(g.opts.Encrypter, g.opts.Decrypter)
 
 	resolver := g.rem.FindByPathM
 	if byId {
@@ -349,7 +369,7 @@ func (g *Commands) pullPipedPerResolver(arg string, resolver func(string) *pagin
 		}
 	}
 
-	return nil
+	return err
 }
 
 func (g *Commands) pullById() (cl, clashes []*Change, err error) {
@@ -426,7 +446,7 @@ func (g *Commands) pullAndDownload(relToRootPath string, fh io.Writer, rem *File
 		return nil
 	}
 
-	_, err := io.Copy(fh, blobHandle)
+	_, err := io.Copy(fh, g.downloadThrottle.reader(blobHandle))
 	blobHandle.Close()
 	if err == nil {
 		return nil
@@ -449,14 +469,17 @@ func (g *Commands) playPullChanges(cl []*Change, exports []string, opMap *map[Op
 
 	g.taskStart(totalSize)
 
-	defer close(g.rem.progressChan)
+	defer close(g.progressChan)
 
 	go func() {
-		for n := range g.rem.progressChan {
+		for n := range g.progressChan {
 			g.taskAdd(int64(n))
 		}
 	}()
 
+	// Links can only be made once what they link to has been pulled.
+	cl, links := splitLinkChanges(cl)
+
 	// TODO: Only provide precedence ordering if all the other options are allowed
 	sort.Sort(ByPrecedence(cl))
 
@@ -504,6 +527,13 @@ func (g *Commands) playPullChanges(cl []*Change, exports []string, opMap *map[Op
 		}
 	}
 
+	for _, c := range links {
+		if lErr := g.localLink(c); lErr != nil {
+			msg := fmt.Sprintf("%v err: %v\n", c.Path, lErr)
+			err = reComposeError(err, msg)
+		}
+	}
+
 	g.taskFinish()
 	return err
 }
@@ -514,19 +544,19 @@ func (g *Commands) localAddIndex(change *Change, conform []string) (err error) {
 		if f != nil {
 			chunks := chunkInt64(change.Src.Size)
 			for n := range chunks {
-				g.rem.progressChan <- n
+				g.progressChan <- n
 			}
 		}
 	}()
 
-	return g.createIndex(f)
+	return g.createIndex(f, change.Path)
 }
 
 func (g *Commands) localMod(change *Change, exports []string) (err error) {
 	defer func() {
 		if err == nil {
 			src := change.Src
-			indexErr := g.createIndex(src)
+			indexErr := g.indexPulled(change)
 			// TODO: Should indexing errors be reported?
 			if indexErr != nil {
 				g.log.LogErrf("localMod:createIndex %s: %v\n", src.Name, indexErr)
@@ -543,7 +573,7 @@ func (g *Commands) localMod(change *Change, exports []string) (err error) {
 	mask := fileDifferences(change.Src, change.Dest, change.IgnoreChecksum)
 
 	needsDownload := checksumDiffers(mask) && !change.Dest.IsDir
-	exportsRequested := len(exports) >= 1 && hasExportLinks(change.Src)
+	exportsRequested := len(g.exportsFor(change.Src, exports)) >= 1 && hasExportLinks(change.Src)
 
 	if needsDownload || exportsRequested {
 		// download and replace
@@ -553,14 +583,14 @@ func (g *Commands) localMod(change *Change, exports []string) (err error) {
 		downloadPerformed = true
 	}
 
-	err = os.Chtimes(destAbsPath, change.Src.ModTime, change.Src.ModTime)
+	err = chtimesNoFollow(destAbsPath, change.Src.ModTime)
 
 	// Update progress for the case in which you are only Chtime-ing
 	// since progress for downloaded files is already handled separately
 	if !downloadPerformed {
 		chunks := chunkInt64(change.Src.Size)
 		for n := range chunks {
-			g.rem.progressChan <- n
+			g.progressChan <- n
 		}
 	}
 
@@ -572,7 +602,7 @@ func (g *Commands) localAdd(change *Change, exports []string) (err error) {
 		if err == nil && change.Src != nil {
 			fileToSerialize := change.Src
 
-			indexErr := g.createIndex(fileToSerialize)
+			indexErr := g.indexPulled(change)
 			// TODO: Should indexing errors be reported?
 			if indexErr != nil {
 				g.log.LogErrf("localAdd:createIndex %s: %v\n", fileToSerialize.Name, indexErr)
@@ -603,7 +633,7 @@ func (g *Commands) localAdd(change *Change, exports []string) (err error) {
 		}
 	}
 
-	return os.Chtimes(destAbsPath, change.Src.ModTime, change.Src.ModTime)
+	return chtimesNoFollow(destAbsPath, change.Src.ModTime)
 }
 
 func (g *Commands) localDelete(change *Change, conform []string) (err error) {
@@ -611,9 +641,11 @@ func (g *Commands) localDelete(change *Change, conform []string) (err error) {
 		if err == nil {
 			chunks := chunkInt64(change.Dest.Size)
 			for n := range chunks {
-				g.rem.progressChan <- n
+				g.progressChan <- n
 			}
 
+			g.removeExportsAt(change.Path)
+
 			dest := change.Dest
 			index := dest.ToIndex()
 			rmErr := g.context.RemoveIndex(index, g.context.AbsPathOf(""))
@@ -624,9 +656,18 @@ func (g *Commands) localDelete(change *Change, conform []string) (err error) {
 		}
 	}()
 
-	err = os.RemoveAll(change.Dest.BlobAt)
+	// Symlinked files are listed by the paths they resolve to,
+	// remove the symlink e.g to a shortcut's target instead.
+	blobAt := change.Dest.BlobAt
+	if linkPath := g.context.AbsPathOf(change.Path); linkPath != blobAt {
+		if info, lErr := os.Lstat(linkPath); lErr == nil && symlink(info.Mode()) {
+			blobAt = linkPath
+		}
+	}
+
+	err = os.RemoveAll(blobAt)
 	if err != nil {
-		g.log.LogErrf("localDelete: \"%s\" %v\n", change.Dest.BlobAt, err)
+		g.log.LogErrf("localDelete: \"%s\" %v\n", blobAt, err)
 	}
 
 	return
@@ -664,41 +705,56 @@ func (g *Commands) export(f *File, destAbsPath string, exports []string) (manife
 		return nil, err
 	}
 
-	var ok bool
-	var mimeType, exportURL string
-
 	waitables := []*urlMimeTypeExt{}
 
+	basePath := filepath.Base(f.Name)
+	baseDir := path.Join(dirPath, basePath)
+
+	var tabs []*sheetTab
 	for _, ext := range exports {
-		mimeType = mimeTypeFromExt(ext)
-		exportURL, ok = f.ExportLinks[mimeType]
+		mimeType, exportURL, ok := exportLink(f, ext)
 		if !ok {
 			continue
 		}
 
-		waitables = append(waitables, &urlMimeTypeExt{
-			mimeType: mimeType,
-			url:      exportURL,
-			ext:      ext,
-		})
+		if !exportedPerSheet(f, ext) {
+			waitables = append(waitables, &urlMimeTypeExt{
+				mimeType: mimeType,
+				url:      exportURL,
+				ext:      ext,
+				path:     sepJoin(".", baseDir, ext),
+			})
+			continue
+		}
+
+		if tabs == nil {
+			if tabs, err = g.rem.sheetTabs(f.Id); err != nil {
+				return nil, err
+			}
+			if err = os.MkdirAll(baseDir, os.ModeDir|0755); err != nil {
+				return nil, err
+			}
+		}
+
+		sheetWaitables, sErr := sheetTabExports(baseDir, mimeType, exportURL, ext, tabs)
+		if sErr != nil {
+			return nil, sErr
+		}
+		waitables = append(waitables, sheetWaitables...)
 	}
 
 	n := len(waitables)
 	errsChan := make(chan error, n)
-
-	basePath := filepath.Base(f.Name)
-	baseDir := path.Join(dirPath, basePath)
+	var manifestMu sync.Mutex
 
 	for _, exportee := range waitables {
-		go func(baseDirPath, id string, urlMExt *urlMimeTypeExt) {
+		go func(exportPath, id string, urlMExt *urlMimeTypeExt) {
 			var err error
 
 			defer func() {
 				errsChan <- err
 			}()
 
-			exportPath := sepJoin(".", baseDirPath, urlMExt.ext)
-
 			// TODO: Decide if users should get to make *.desktop users even for exports
 			if runtime.GOOS == OSLinuxKey && false {
 				desktopEntryPath := sepJoin(".", exportPath, DesktopExtension)
@@ -718,9 +774,16 @@ func (g *Commands) export(f *File, destAbsPath string, exports []string) (manife
 
 			err = g.singleDownload(&dlArg)
 			if err == nil {
+				// Exports take the modTime of their doc so
+				// that editing them can be told apart on push.
+				err = os.Chtimes(exportPath, f.ModTime, f.ModTime)
+			}
+			if err == nil {
+				manifestMu.Lock()
 				manifest = append(manifest, exportPath)
+				manifestMu.Unlock()
 			}
-		}(baseDir, f.Id, exportee)
+		}(exportee.path, f.Id, exportee)
 	}
 
 	for i := 0; i < n; i++ {
@@ -730,6 +793,7 @@ func (g *Commands) export(f *File, destAbsPath string, exports []string) (manife
 		}
 	}
 
+	sort.Strings(manifest)
 	return manifest, err
 }
 
@@ -748,14 +812,24 @@ func (g *Commands) download(change *Change, exports []string) error {
 		return illogicalStateErr(fmt.Errorf("tried to download nil change.Src"))
 	}
 
+	if isShortcut(change.Src) {
+		return g.pullShortcut(change, exports)
+	}
+
 	destAbsPath := g.context.AbsPathOf(change.Path)
 	if change.Src.BlobAt != "" {
 		dlArg := downloadArg{
 			path:            destAbsPath,
 			id:              change.Src.Id,
+			size:            change.Src.Size,
 			ackByteProgress: true,
 		}
 
+		// The checksum is that of the content as stored remotely.
+		if g.opts.Decrypter == nil {
+			dlArg.md5Checksum = change.Src.Md5Checksum
+		}
+
 		return g.singleDownload(&dlArg)
 	}
 
@@ -783,6 +857,7 @@ func (g *Commands) download(change *Change, exports []string) error {
 		}
 	}
 
+	exports = g.exportsFor(change.Src, exports)
 	canExport := len(exports) >= 1 && hasExportLinks(change.Src)
 	if !canExport {
 		return nil
@@ -798,6 +873,7 @@ func (g *Commands) download(change *Change, exports []string) error {
 	}
 
 	manifest, exportErr := g.export(change.Src, exportDirPath, exports)
+	change.exports = manifest
 
 	if exportErr == nil {
 		for _, exportPath := range manifest {
@@ -808,12 +884,74 @@ func (g *Commands) download(change *Change, exports []string) error {
 	return exportErr
 }
 
-func (g *Commands) singleDownload(dlArg *downloadArg) (err error) {
+// singleDownload downloads into a partial file alongside dlArg.path and only
+// moves it into place once complete. Failed downloads are retried, resuming
+// from whatever content the partial file already has, even one left behind
+// by an earlier pull. Exports can't be resumed so they always start afresh.
+func (g *Commands) singleDownload(dlArg *downloadArg) error {
+	partialPath := dlArg.path + PartialFileSuffix
+
+	emitter := func() (interface{}, error) {
+		err := g.downloadToPartial(dlArg, partialPath)
+		return &tuple{last: err}, err
+	}
+
+	retrier := retryableChangeOp(emitter, g.opts.Verbose, g.opts.ExponentialBackoffRetryCount)
+	retrier.StatusCheck = retryableDownloadCheck
+
+	if _, err := expb.ExponentialBackOffSync(retrier); err != nil {
+		return err
+	}
+
+	return os.Rename(partialPath, dlArg.path)
+}
+
+// retryableDownloadCheck retries downloads that failed because of network or
+// server errors but not those that we failed deliberately e.g on bad checksums.
+func retryableDownloadCheck(v interface{}) (ok, retryable bool) {
+	ok, retryable = retryableErrorCheck(v)
+	if pr, pOk := v.(*tuple); pOk && pr != nil {
+		if _, isOurs := pr.last.(*Error); isOurs {
+			retryable = false
+		}
+	}
+	return
+}
+
+func (g *Commands) downloadToPartial(dlArg *downloadArg, partialPath string) (err error) {
+	offset := int64(0)
+	if dlArg.exportURL == "" {
+		if info, statErr := os.Stat(partialPath); statErr == nil && info.Size() <= dlArg.size {
+			offset = info.Size()
+		}
+	}
+
+	var blob io.ReadCloser
+	defer func() {
+		if blob != nil {
+			blob.Close()
+		}
+	}()
+
+	start := int64(0)
+	switch {
+	case dlArg.exportURL != "":
+		blob, err = g.rem.Download(dlArg.id, dlArg.exportURL)
+	case offset > 0 && offset == dlArg.size:
+		// Everything was received, only verification is pending.
+		start = offset
+	default:
+		blob, start, err = g.rem.DownloadRange(dlArg.id, offset)
+	}
+	if err != nil {
+		return err
+	}
+
 	var fo *os.File
-	fo, err = os.Create(dlArg.path)
+	fo, err = os.OpenFile(partialPath, os.O_RDWR|os.O_CREATE, 0666)
 	if err != nil {
-		g.log.LogErrf("create: %s %v\n", dlArg.path, err)
-		return
+		g.log.LogErrf("create: %s %v\n", partialPath, err)
+		return err
 	}
 
 	// close fo on exit and check for its returned error
@@ -825,34 +963,56 @@ func (g *Commands) singleDownload(dlArg *downloadArg) (err error) {
 		}
 	}()
 
-	var blob io.ReadCloser
-	defer func() {
-		if blob != nil {
-			blob.Close()
-		}
-	}()
-
-	blob, err = g.rem.Download(dlArg.id, dlArg.exportURL)
-	if err != nil {
+	// Discard anything beyond where the content received starts and
+	// checksum what we are keeping, since it is the prefix of the content.
+	if err = fo.Truncate(start); err != nil {
+		return err
+	}
+	hash := md5.New()
+	if _, err = io.CopyN(hash, fo, start); err != nil {
 		return err
 	}
 
-	ws := statos.NewWriter(fo)
+	if start > 0 && dlArg.ackByteProgress {
+		g.progressChan <- int(start)
+	}
 
-	go func() {
-		commChan := ws.ProgressChan()
-		if dlArg.ackByteProgress {
-			for n := range commChan {
-				g.rem.progressChan <- n
-			}
-		} else { // Just drain the progress channel
-			for _ = range commChan {
-				g.rem.progressChan <- 0
+	if blob != nil {
+		ws := statos.NewWriter(fo)
+
+		go func() {
+			commChan := ws.ProgressChan()
+			if dlArg.ackByteProgress {
+				for n := range commChan {
+					g.progressChan <- n
+				}
+			} else { // Just drain the progress channel
+				for _ = range commChan {
+					g.progressChan <- 0
+				}
 			}
+		}()
+
+		if _, err = io.Copy(io.MultiWriter(ws, hash), g.downloadThrottle.reader(blob)); err != nil {
+			return err
 		}
-	}()
+	}
+
+	if dlArg.md5Checksum == "" {
+		return nil
+	}
 
-	_, err = io.Copy(ws, blob)
+	if checksum := fmt.Sprintf("%x", hash.Sum(nil)); checksum != dlArg.md5Checksum {
+		os.Remove(partialPath)
 
-	return
+		mismatchErr := fmt.Errorf("%s: md5 checksum mismatch, got %s expected %s", dlArg.path, checksum, dlArg.md5Checksum)
+		if start > 0 {
+			// The content that we resumed from could have been stale,
+			// the retry will download everything from scratch.
+			return mismatchErr
+		}
+		return downloadFailedErr(mismatchErr)
+	}
+
+	return nil
 }
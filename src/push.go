@@ -35,8 +35,7 @@ var mkdirAllMu = sync.Mutex{}
 // directory, it recursively pushes to the remote if there are local changes.
 // It doesn't check if there are local changes if isForce is set.
 func (g *Commands) Push() error {
-	g.rem.encrypter = g.opts.Encrypter
-	g.rem.decrypter = g.opts.Decrypter
+	g.rem.setCrypto(g.opts.Encrypter, g.opts.Decrypter)
 
 	defer g.clearMountPoints()
 
@@ -108,13 +107,25 @@ func (g *Commands) Push() error {
 
 	spin.stop()
 
+	cl, exportConflicts, err := g.pushExportsToSources(cl)
+	if err != nil {
+		return err
+	}
+	if len(exportConflicts) >= 1 {
+		warnConflictsPersist(g.log, exportConflicts)
+		return unresolvedConflictsErr(fmt.Errorf("docs changed remotely since they were exported"))
+	}
+
 	nonConflictsPtr, conflictsPtr := g.resolveConflicts(cl, true)
 	if conflictsPtr != nil {
 		warnConflictsPersist(g.log, *conflictsPtr)
 		return unresolvedConflictsErr(fmt.Errorf("conflicts have prevented a push operation"))
 	}
 
-	nonConflicts := *nonConflictsPtr
+	nonConflicts, multiParentConflicts := dedupMultiParentPushes(*nonConflictsPtr)
+	if len(multiParentConflicts) >= 1 {
+		return warnMultiParentConflicts(g, multiParentConflicts)
+	}
 
 	pushSize, modSize := reduceToSize(cl, SelectDest|SelectSrc)
 
@@ -165,8 +176,7 @@ func (g *Commands) Push() error {
 }
 
 func (g *Commands) PushPiped() error {
-	g.rem.encrypter = g.opts.Encrypter
-	g.rem.decrypter = g.opts.Decrypter
+	g.rem.setCrypto(g.opts.Encrypter, g.opts.Decrypter)
 
 	// Cannot push asynchronously because the push order must be maintained
 	for _, relToRootPath := range g.opts.Sources {
@@ -229,6 +239,7 @@ func (g *Commands) PushPiped() error {
 		}
 
 		index := rem.ToIndex()
+		index.Path = relToRootPath
 		wErr := g.context.SerializeIndex(index)
 
 		// TODO: Should indexing errors be reported?
@@ -262,10 +273,10 @@ func (g *Commands) playPushChanges(cl []*Change, opMap *map[Operation]sizeCounte
 
 	g.taskStart(totalSize)
 
-	defer close(g.rem.progressChan)
+	defer close(g.progressChan)
 
 	go func() {
-		for n := range g.rem.progressChan {
+		for n := range g.progressChan {
 			g.taskAdd(int64(n))
 		}
 	}()
@@ -381,9 +392,11 @@ func (g *Commands) remoteMod(change *Change) (err error) {
 		src:             change.Src,
 		dest:            change.Dest,
 		mask:            g.opts.TypeMask,
-		ignoreChecksum:  g.opts.IgnoreChecksum,
+		ignoreChecksum:  change.IgnoreChecksum,
 		debug:           g.opts.Verbose && g.opts.canPreview(),
 		retryCount:      g.opts.ExponentialBackoffRetryCount,
+		sessions:        g.context,
+		progress:        g.progressChan,
 	}
 
 	coercedMimeKey, ok := g.coercedMimeKey()
@@ -402,6 +415,8 @@ func (g *Commands) remoteMod(change *Change) (err error) {
 		return
 	}
 	index := rem.ToIndex()
+	index.Path = change.Path
+	index.Exports = change.exports
 	wErr := g.context.SerializeIndex(index)
 
 	// TODO: Should indexing errors be reported?
@@ -531,6 +546,7 @@ func (g *Commands) remoteMkdirAllLocked(d string) (*File, error) {
 		src:             remoteFile,
 		debug:           g.opts.Verbose && g.opts.canPreview(),
 		retryCount:      g.opts.ExponentialBackoffRetryCount,
+		progress:        g.progressChan,
 	}
 
 	cur, curErr := g.rem.UpsertByComparison(&args)
@@ -543,6 +559,7 @@ func (g *Commands) remoteMkdirAllLocked(d string) (*File, error) {
 
 	// Now index the created folder locally for persistence
 	index := cur.ToIndex()
+	index.Path = remotePathJoin(d)
 	wErr := g.context.SerializeIndex(index)
 
 	// TODO: Should indexing errors be reported?
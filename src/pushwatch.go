@@ -0,0 +1,284 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/odeke-em/drive/config"
+)
+
+// fsWatcherBacklog is the number of events that can queue up
+// while a push is in progress before the watcher blocks.
+const fsWatcherBacklog = 1024
+
+var errFsWatcherOverflow = fmt.Errorf("too many local changes at once, some may have been missed")
+
+// fsWatcher reports the paths of the entries that change within the
+// directories that it watches. It doesn't descend into subdirectories.
+type fsWatcher interface {
+	add(dir string) error
+	events() <-chan string
+	errors() <-chan error
+	close() error
+}
+
+var (
+	// pushWatchDebounce is how long local changes have to quiet down for before being pushed.
+	pushWatchDebounce = 2 * time.Second
+	// pushWatchSettle is how long a file's size and modification time have to stay
+	// the same for it to be considered completely written.
+	pushWatchSettle = time.Second
+)
+
+// PushWatch pushes the sources then keeps watching them for local changes,
+// pushing only the paths that changed once they are no longer being written to.
+func (g *Commands) PushWatch() error {
+	return g.pushWatch(nil)
+}
+
+func (g *Commands) pushWatch(done <-chan bool) error {
+	watcher, err := newFsWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.close()
+
+	if err := g.watchSources(watcher); err != nil {
+		return err
+	}
+
+	// Only push once watching so that changes
+	// made while that push happens aren't missed.
+	if err := g.Push(); err != nil {
+		return err
+	}
+
+	g.log.Logln("Watching for local changes to push...")
+
+	ignoresPath := g.context.AbsPathOf(DriveIgnoreSuffix)
+	pending := map[string]bool{}
+	var debounce <-chan time.Time
+
+	for {
+		select {
+		case <-done:
+			return nil
+
+		case err := <-watcher.errors():
+			g.log.LogErrf("push: watch: %v\n", err)
+			if err != errFsWatcherOverflow {
+				continue
+			}
+
+			// There is no telling what changed, so rescan and push all the sources.
+			if err := g.watchSources(watcher); err != nil {
+				g.log.LogErrf("push: watch: %v\n", err)
+			}
+			for _, relToRootPath := range g.opts.Sources {
+				pending[g.context.AbsPathOf(relToRootPath)] = true
+			}
+			debounce = time.After(pushWatchDebounce)
+
+		case fsAbsPath, ok := <-watcher.events():
+			if !ok {
+				return nil
+			}
+
+			if fsAbsPath == ignoresPath {
+				g.reloadIgnores(ignoresPath)
+				continue
+			}
+			if !g.pushWatched(fsAbsPath) {
+				continue
+			}
+
+			if info, err := os.Stat(fsAbsPath); err == nil && info.IsDir() {
+				if err := g.watchLocalTree(watcher, fsAbsPath); err != nil {
+					g.log.LogErrf("push: watch %s: %v\n", fsAbsPath, err)
+				}
+			}
+
+			pending[fsAbsPath] = true
+			debounce = time.After(pushWatchDebounce)
+
+		case <-debounce:
+			debounce = nil
+
+			settled := settledPaths(pending)
+			if len(pending) >= 1 {
+				// Give the files still being written some more time.
+				debounce = time.After(pushWatchDebounce)
+			}
+			if len(settled) < 1 {
+				continue
+			}
+
+			if err := g.pushWatchedPaths(settled); err != nil {
+				g.log.LogErrf("push: %v\n", err)
+			}
+		}
+	}
+}
+
+// watchSources watches the directories of all the sources.
+func (g *Commands) watchSources(watcher fsWatcher) error {
+	for _, relToRootPath := range g.opts.Sources {
+		fsAbsPath := g.context.AbsPathOf(relToRootPath)
+		info, err := os.Stat(fsAbsPath)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			// Only the directories can be watched.
+			fsAbsPath = filepath.Dir(fsAbsPath)
+		}
+		if err := g.watchLocalTree(watcher, fsAbsPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// watchLocalTree watches the directory and all the
+// directories beneath it that would be pushed.
+func (g *Commands) watchLocalTree(watcher fsWatcher, root string) error {
+	return filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if p != root && !g.pushWatched(p) {
+			return filepath.SkipDir
+		}
+		return watcher.add(p)
+	})
+}
+
+// pushWatched tells whether a change to the path could warrant a push,
+// that is whether it is within the sources and not ignored.
+func (g *Commands) pushWatched(fsAbsPath string) bool {
+	relPath, err := filepath.Rel(g.context.AbsPathOf(""), fsAbsPath)
+	if err != nil || strings.HasPrefix(relPath, "..") {
+		return false
+	}
+
+	for _, segment := range strings.Split(filepath.ToSlash(relPath), "/") {
+		if segment == config.GDDirSuffix {
+			return false
+		}
+	}
+
+	name := filepath.Base(fsAbsPath)
+	if isHidden(name, g.opts.Hidden) || anyMatch(g.opts.Ignorer, name, fsAbsPath) {
+		return false
+	}
+
+	for _, relToRootPath := range g.opts.Sources {
+		srcAbsPath := g.context.AbsPathOf(relToRootPath)
+		if fsAbsPath == srcAbsPath || strings.HasPrefix(fsAbsPath, srcAbsPath+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Commands) reloadIgnores(ignoresPath string) {
+	if g.opts.Force {
+		return
+	}
+
+	ignorer, err := combineIgnores(ignoresPath)
+	if err != nil {
+		g.log.LogErrf("combining ignores from path %s and internally: %v\n", ignoresPath, err)
+		return
+	}
+	g.opts.Ignorer = ignorer
+}
+
+type fileStat struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+func statOf(p string) fileStat {
+	info, err := os.Stat(p)
+	if err != nil {
+		return fileStat{}
+	}
+	return fileStat{exists: true, size: info.Size(), modTime: info.ModTime()}
+}
+
+// settledPaths removes from pending and returns the paths whose size and
+// modification time didn't change over pushWatchSettle. Paths that no
+// longer exist are settled too, their removal has to be pushed.
+func settledPaths(pending map[string]bool) []string {
+	before := map[string]fileStat{}
+	for p := range pending {
+		before[p] = statOf(p)
+	}
+
+	time.Sleep(pushWatchSettle)
+
+	var settled []string
+	for p, prev := range before {
+		cur := statOf(p)
+		if cur.exists != prev.exists || cur.size != prev.size || !cur.modTime.Equal(prev.modTime) {
+			continue
+		}
+		delete(pending, p)
+		settled = append(settled, p)
+	}
+	return settled
+}
+
+// pushWatchedPaths pushes the paths, leaving out those
+// already covered by the push of one of their ancestors.
+func (g *Commands) pushWatchedPaths(fsAbsPaths []string) error {
+	sort.Strings(fsAbsPaths)
+
+	var sources []string
+	var last string
+	for _, fsAbsPath := range fsAbsPaths {
+		if last != "" && strings.HasPrefix(fsAbsPath, last+string(filepath.Separator)) {
+			continue
+		}
+		last = fsAbsPath
+
+		relPath, err := filepath.Rel(g.context.AbsPathOf(""), fsAbsPath)
+		if err != nil {
+			return err
+		}
+		sources = append(sources, remotePathJoin(filepath.ToSlash(relPath)))
+	}
+
+	opts := *g.opts
+	opts.Sources = sources
+	// Nobody is around to answer prompts.
+	opts.NoPrompt = true
+
+	return NewWithBackend(g.context, &opts, g.rem).Push()
+}
@@ -0,0 +1,87 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func waitForRemote(t *testing.T, mb *MemoryBackend, p string, present bool) {
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		f, err := mb.FindByPath(p)
+		if (err == nil && f != nil) == present {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("remote %q: timed out waiting for present=%v", p, present)
+}
+
+func TestPushWatch(t *testing.T) {
+	defer func(debounce, settle time.Duration) {
+		pushWatchDebounce, pushWatchSettle = debounce, settle
+	}(pushWatchDebounce, pushWatchSettle)
+	pushWatchDebounce, pushWatchSettle = 100*time.Millisecond, 100*time.Millisecond
+
+	mb := NewMemoryBackend()
+
+	context := memoryTestContext(t)
+	defer os.RemoveAll(context.AbsPath)
+
+	writeTestFiles(t, context.AbsPath, map[string]string{
+		"a.txt":         "alpha",
+		".driveignore":  "\\.log$",
+		"docs/keep.txt": "keep",
+	})
+
+	done := make(chan bool)
+	errsChan := make(chan error, 1)
+	go func() {
+		errsChan <- NewWithBackend(context, memoryTestOptions("/"), mb).pushWatch(done)
+	}()
+
+	// The initial push.
+	waitForRemote(t, mb, "/a.txt", true)
+
+	writeTestFiles(t, context.AbsPath, map[string]string{
+		"docs/b.txt":     "bravo",
+		"new/deep/c.txt": "charlie",
+		"debug.log":      "ignored",
+	})
+	waitForRemote(t, mb, "/docs/b.txt", true)
+	waitForRemote(t, mb, "/new/deep/c.txt", true)
+
+	if got, want := remoteContent(t, mb, "/new/deep/c.txt"), "charlie"; got != want {
+		t.Errorf("remote c.txt: got %q want %q", got, want)
+	}
+
+	if err := os.Remove(filepath.Join(context.AbsPath, "a.txt")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	waitForRemote(t, mb, "/a.txt", false)
+
+	close(done)
+	if err := <-errsChan; err != nil {
+		t.Fatalf("pushWatch: %v", err)
+	}
+
+	if f, _ := mb.FindByPath("/debug.log"); f != nil {
+		t.Errorf("ignored debug.log was pushed")
+	}
+}
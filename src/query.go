@@ -0,0 +1,678 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// A query selects files by their attributes e.g
+//
+//	name ~ "report" and modified > 2026-01-01 and size > 10MB and not owner:bob@x
+//
+// Conditions are joined by and, or and not and grouped by parentheses,
+// adjacent conditions without a joiner between them are and-ed.
+// The parts of a query that Drive's search syntax can express are sent along
+// with the search, the rest such as regexes, sizes and paths are evaluated
+// on the files that the search returns.
+
+type queryNode interface {
+	// driveQuery translates the node into Drive's search syntax.
+	driveQuery() string
+	// matches evaluates the node against f, a file found at relToRoot.
+	matches(f *File, relToRoot string) bool
+}
+
+type queryJoin struct {
+	and   bool
+	nodes []queryNode
+}
+
+type queryNot struct {
+	node queryNode
+}
+
+type queryCond struct {
+	field string
+	op    string
+	value string
+
+	// remote is set if Drive can evaluate the condition.
+	remote bool
+
+	// The value parsed as the field requires.
+	mimeType string
+	n        int64
+	boolean  bool
+	t        time.Time
+	// day is set if t was only given as a date, which then
+	// matches every time during that day for = and !=.
+	day bool
+	re  *regexp.Regexp
+}
+
+const (
+	queryFieldName     = "name"
+	queryFieldMime     = "mime"
+	queryFieldOwner    = "owner"
+	queryFieldModified = "modified"
+	queryFieldSize     = "size"
+	queryFieldStarred  = "starred"
+	queryFieldFolder   = "folder"
+	queryFieldPath     = "path"
+	queryFieldDepth    = "depth"
+	queryFieldExt      = "ext"
+)
+
+var queryFieldAliases = map[string]string{
+	"name":     queryFieldName,
+	"title":    queryFieldName,
+	"mime":     queryFieldMime,
+	"type":     queryFieldMime,
+	"owner":    queryFieldOwner,
+	"modified": queryFieldModified,
+	"mtime":    queryFieldModified,
+	"size":     queryFieldSize,
+	"starred":  queryFieldStarred,
+	"folder":   queryFieldFolder,
+	"dir":      queryFieldFolder,
+	"path":     queryFieldPath,
+	"depth":    queryFieldDepth,
+	"ext":      queryFieldExt,
+}
+
+var (
+	queryEqualityOps   = []string{"=", "!="}
+	queryComparisonOps = []string{"=", "!=", ">", ">=", "<", "<="}
+	queryTextOps       = []string{"=", "!=", "~", "!~", "=~"}
+)
+
+// queryFieldOps lists the operators that each field takes,
+// ":" is taken by all fields as a synonym of "=".
+var queryFieldOps = map[string][]string{
+	queryFieldName:     queryTextOps,
+	queryFieldMime:     queryTextOps,
+	queryFieldOwner:    queryTextOps,
+	queryFieldModified: queryComparisonOps,
+	queryFieldSize:     queryComparisonOps,
+	queryFieldStarred:  queryEqualityOps,
+	queryFieldFolder:   queryEqualityOps,
+	queryFieldPath:     queryTextOps,
+	queryFieldDepth:    queryComparisonOps,
+	queryFieldExt:      queryEqualityOps,
+}
+
+// queryOps are ordered such that longer operators are lexed before their prefixes.
+var queryOps = []string{"!=", "!~", "=~", ">=", "<=", "=", "~", ">", "<", ":"}
+
+var queryDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+}
+
+const queryDayLayout = "2006-01-02"
+
+type queryTokenKind int
+
+const (
+	queryEOF queryTokenKind = iota
+	queryWord
+	queryString
+	queryOp
+	queryLParen
+	queryRParen
+)
+
+type queryToken struct {
+	kind queryTokenKind
+	text string
+	pos  int
+}
+
+func queryErr(pos int, format string, args ...interface{}) error {
+	return invalidArgumentsErr(fmt.Errorf("query: at %d: %s", pos, fmt.Sprintf(format, args...)))
+}
+
+func lexQuery(q string) ([]queryToken, error) {
+	var tokens []queryToken
+	runes := []rune(q)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		afterOp := len(tokens) >= 1 && tokens[len(tokens)-1].kind == queryOp
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, queryToken{kind: queryLParen, text: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, queryToken{kind: queryRParen, text: ")", pos: i})
+			i++
+		case r == '"' || r == '\'':
+			start := i
+			var value []rune
+			for i++; i < len(runes) && runes[i] != r; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				value = append(value, runes[i])
+			}
+			if i >= len(runes) {
+				return nil, queryErr(start, "unterminated string")
+			}
+			i++
+			tokens = append(tokens, queryToken{kind: queryString, text: string(value), pos: start})
+		case afterOp:
+			// A value runs up to whitespace or a parenthesis, so that
+			// those like 2026-01-01T15:04:05 can hold operator characters.
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' {
+				i++
+			}
+			tokens = append(tokens, queryToken{kind: queryWord, text: string(runes[start:i]), pos: start})
+		default:
+			if op := queryOpAt(runes[i:]); op != "" {
+				tokens = append(tokens, queryToken{kind: queryOp, text: op, pos: i})
+				i += len(op)
+				continue
+			}
+
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' && queryOpAt(runes[i:]) == "" {
+				i++
+			}
+			tokens = append(tokens, queryToken{kind: queryWord, text: string(runes[start:i]), pos: start})
+		}
+	}
+
+	return append(tokens, queryToken{kind: queryEOF, pos: len(runes)}), nil
+}
+
+func queryOpAt(runes []rune) string {
+	for _, op := range queryOps {
+		if strings.HasPrefix(string(runes), op) {
+			return op
+		}
+	}
+	return ""
+}
+
+type queryParser struct {
+	tokens []queryToken
+	i      int
+}
+
+// parseQuery parses a query into the tree of conditions that it is made of.
+func parseQuery(q string) (queryNode, error) {
+	tokens, err := lexQuery(q)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &queryParser{tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != queryEOF {
+		return nil, queryErr(tok.pos, "unexpected %q", tok.text)
+	}
+	return node, nil
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.i]
+}
+
+func (p *queryParser) next() queryToken {
+	tok := p.tokens[p.i]
+	if tok.kind != queryEOF {
+		p.i++
+	}
+	return tok
+}
+
+func (tok queryToken) isKeyword(keyword string) bool {
+	return tok.kind == queryWord && strings.EqualFold(tok.text, keyword)
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	node, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := []queryNode{node}
+	for p.peek().isKeyword("or") {
+		p.next()
+		if node, err = p.parseAnd(); err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return &queryJoin{and: false, nodes: nodes}, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	node, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := []queryNode{node}
+	for {
+		tok := p.peek()
+		if tok.isKeyword("and") {
+			p.next()
+		} else if tok.kind != queryLParen && (tok.kind != queryWord || tok.isKeyword("or")) {
+			break
+		}
+
+		if node, err = p.parseUnary(); err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return &queryJoin{and: true, nodes: nodes}, nil
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) {
+	tok := p.peek()
+	switch {
+	case tok.isKeyword("not"):
+		p.next()
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &queryNot{node: node}, nil
+
+	case tok.kind == queryLParen:
+		p.next()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != queryRParen {
+			return nil, queryErr(closing.pos, "expected \")\"")
+		}
+		return node, nil
+	}
+
+	return p.parseCond()
+}
+
+func (p *queryParser) parseCond() (queryNode, error) {
+	tok := p.next()
+	if tok.kind != queryWord {
+		return nil, queryErr(tok.pos, "expected a field instead of %q", tok.text)
+	}
+
+	field, ok := queryFieldAliases[strings.ToLower(tok.text)]
+	if !ok {
+		return nil, queryErr(tok.pos, "unknown field %q", tok.text)
+	}
+
+	opTok := p.peek()
+	if opTok.kind != queryOp {
+		// Boolean fields can stand on their own e.g starred.
+		if field == queryFieldStarred || field == queryFieldFolder {
+			return newQueryCond(field, "=", "true", tok.pos)
+		}
+		return nil, queryErr(opTok.pos, "expected an operator after %q", tok.text)
+	}
+	p.next()
+
+	valueTok := p.next()
+	if valueTok.kind != queryWord && valueTok.kind != queryString {
+		return nil, queryErr(valueTok.pos, "expected a value after %q", opTok.text)
+	}
+
+	op := opTok.text
+	if op == ":" {
+		op = "="
+	}
+	return newQueryCond(field, op, valueTok.text, valueTok.pos)
+}
+
+func newQueryCond(field, op, value string, pos int) (*queryCond, error) {
+	if !queryOpAllowed(field, op) {
+		return nil, queryErr(pos, "%s does not take %q, only %s", field, op, strings.Join(queryFieldOps[field], " "))
+	}
+
+	c := &queryCond{field: field, op: op, value: value}
+	if op == "=~" {
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, queryErr(pos, "%v", err)
+		}
+		c.re = re
+	}
+
+	var err error
+	// Drive's contains only matches the starts of the words in names, so
+	// a search with it could leave out files that ~ should match.
+	textOpRemote := op == "=" || op == "!="
+
+	switch field {
+	case queryFieldName:
+		c.remote = textOpRemote
+	case queryFieldMime:
+		// Mime types are taken as they are, anything else e.g docs or pdf is
+		// resolved unless it is only to be contained in the mime type.
+		c.mimeType = value
+		resolvable := (op == "=" || op == "!=") && !strings.Contains(value, "/")
+		if resolved := mimeTypeFromQuery(value); resolvable && resolved != "" {
+			c.mimeType = resolved
+		}
+		c.remote = textOpRemote
+	case queryFieldOwner:
+		c.remote = textOpRemote
+	case queryFieldModified:
+		c.t, c.day, err = parseQueryTime(value)
+		c.remote = true
+	case queryFieldSize:
+		c.n, err = parseQuerySize(value)
+	case queryFieldDepth:
+		c.n, err = strconv.ParseInt(value, 10, 64)
+	case queryFieldStarred, queryFieldFolder:
+		c.boolean, err = strconv.ParseBool(value)
+		c.remote = true
+	}
+
+	if err != nil {
+		return nil, queryErr(pos, "%s: %v", field, err)
+	}
+	return c, nil
+}
+
+func queryOpAllowed(field, op string) bool {
+	for _, allowed := range queryFieldOps[field] {
+		if op == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func parseQueryTime(value string) (t time.Time, day bool, err error) {
+	if t, err = time.ParseInLocation(queryDayLayout, value, time.Local); err == nil {
+		return t, true, nil
+	}
+	for _, layout := range queryDateLayouts {
+		if t, err = time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, false, nil
+		}
+	}
+	return t, false, fmt.Errorf("%q is neither a date like 2006-01-02 nor a time like 2006-01-02T15:04:05", value)
+}
+
+var querySizeUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   BytesPerKB,
+	"kb":  BytesPerKB,
+	"kib": BytesPerKB,
+	"m":   BytesPerKB * BytesPerKB,
+	"mb":  BytesPerKB * BytesPerKB,
+	"mib": BytesPerKB * BytesPerKB,
+	"g":   BytesPerKB * BytesPerKB * BytesPerKB,
+	"gb":  BytesPerKB * BytesPerKB * BytesPerKB,
+	"gib": BytesPerKB * BytesPerKB * BytesPerKB,
+	"t":   BytesPerKB * BytesPerKB * BytesPerKB * BytesPerKB,
+	"tb":  BytesPerKB * BytesPerKB * BytesPerKB * BytesPerKB,
+	"tib": BytesPerKB * BytesPerKB * BytesPerKB * BytesPerKB,
+}
+
+func parseQuerySize(value string) (int64, error) {
+	i := strings.IndexFunc(value, func(r rune) bool {
+		return !unicode.IsDigit(r) && r != '.'
+	})
+	if i < 0 {
+		i = len(value)
+	}
+
+	n, err := strconv.ParseFloat(value[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a size like 10MB", value)
+	}
+	unit, ok := querySizeUnits[strings.ToLower(value[i:])]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q in %q", value[i:], value)
+	}
+	return int64(n * unit), nil
+}
+
+func (qj *queryJoin) driveQuery() string {
+	joiner := " or "
+	if qj.and {
+		joiner = " and "
+	}
+
+	var exprs []string
+	for _, node := range qj.nodes {
+		exprs = append(exprs, node.driveQuery())
+	}
+	return joinLists(joiner, exprs)
+}
+
+func (qj *queryJoin) matches(f *File, relToRoot string) bool {
+	for _, node := range qj.nodes {
+		if node.matches(f, relToRoot) != qj.and {
+			return !qj.and
+		}
+	}
+	return qj.and
+}
+
+func (qn *queryNot) driveQuery() string {
+	return fmt.Sprintf("(not %s)", qn.node.driveQuery())
+}
+
+func (qn *queryNot) matches(f *File, relToRoot string) bool {
+	return !qn.node.matches(f, relToRoot)
+}
+
+func (c *queryCond) driveQuery() string {
+	negated := c.op == "!=" || c.op == "!~"
+	expr := ""
+
+	switch c.field {
+	case queryFieldName:
+		expr = fmt.Sprintf("title = %s", customQuote(c.value))
+	case queryFieldMime:
+		expr = fmt.Sprintf("mimeType = %s", customQuote(c.mimeType))
+	case queryFieldOwner:
+		expr = fmt.Sprintf("%s in owners", customQuote(c.value))
+	case queryFieldModified:
+		if c.day && (c.op == "=" || c.op == "!=") {
+			expr = fmt.Sprintf("modifiedDate >= %s and modifiedDate < %s",
+				customQuote(toUTCString(c.t)), customQuote(toUTCString(c.t.AddDate(0, 0, 1))))
+		} else {
+			negated = false
+			expr = fmt.Sprintf("modifiedDate %s %s", c.op, customQuote(toUTCString(c.t)))
+		}
+	case queryFieldStarred:
+		negated = c.op == "!="
+		expr = fmt.Sprintf("starred = %v", c.boolean)
+	case queryFieldFolder:
+		negated = (c.op == "!=") == c.boolean
+		expr = fmt.Sprintf("mimeType = %s", customQuote(DriveFolderMimeType))
+	}
+
+	if negated {
+		return fmt.Sprintf("(not %s)", expr)
+	}
+	return fmt.Sprintf("(%s)", expr)
+}
+
+func (c *queryCond) matches(f *File, relToRoot string) bool {
+	if f == nil {
+		return false
+	}
+
+	switch c.field {
+	case queryFieldName:
+		return c.negate(c.matchesText(f.Name))
+	case queryFieldMime:
+		if c.op == "=" || c.op == "!=" {
+			return c.negate(f.MimeType == c.mimeType)
+		}
+		return c.negate(c.matchesText(f.MimeType))
+	case queryFieldOwner:
+		// Only the names of owners are known locally, not their emails.
+		owned := false
+		for _, owner := range f.OwnerNames {
+			owned = owned || c.matchesText(owner)
+		}
+		return c.negate(owned)
+	case queryFieldModified:
+		if c.day && (c.op == "=" || c.op == "!=") {
+			withinDay := !f.ModTime.Before(c.t) && f.ModTime.Before(c.t.AddDate(0, 0, 1))
+			return c.negate(withinDay)
+		}
+		return compareQueryValues(c.op, f.ModTime.Unix(), c.t.Unix())
+	case queryFieldSize:
+		return compareQueryValues(c.op, f.Size, c.n)
+	case queryFieldDepth:
+		return compareQueryValues(c.op, int64(pathDepth(relToRoot)), c.n)
+	case queryFieldStarred:
+		starred := f.Labels != nil && f.Labels.Starred
+		return c.negate(starred == c.boolean)
+	case queryFieldFolder:
+		return c.negate(f.IsDir == c.boolean)
+	case queryFieldPath:
+		return c.negate(c.matchesText(relToRoot))
+	case queryFieldExt:
+		ext := strings.TrimPrefix(filepath.Ext(f.Name), ".")
+		return c.negate(strings.EqualFold(ext, strings.TrimPrefix(c.value, ".")))
+	}
+	return false
+}
+
+// matchesText matches s by equality, case insensitive containment or by
+// regex, as the operator requires. Negation is left to the caller.
+func (c *queryCond) matchesText(s string) bool {
+	switch c.op {
+	case "=~":
+		return c.re.MatchString(s)
+	case "~", "!~":
+		return strings.Contains(strings.ToLower(s), strings.ToLower(c.value))
+	}
+	return s == c.value
+}
+
+func (c *queryCond) negate(matched bool) bool {
+	if c.op == "!=" || c.op == "!~" {
+		return !matched
+	}
+	return matched
+}
+
+func compareQueryValues(op string, a, b int64) bool {
+	switch op {
+	case "=":
+		return a == b
+	case "!=":
+		return a != b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	}
+	return false
+}
+
+func pathDepth(relToRoot string) int {
+	trimmed := strings.Trim(relToRoot, "/")
+	if trimmed == "" {
+		return 0
+	}
+	return len(strings.Split(trimmed, "/"))
+}
+
+// splitQuery splits a query into the part that Drive can evaluate and
+// the rest, which must be evaluated on the files that Drive returns.
+// Either is nil if nothing of the query belongs to it.
+func splitQuery(node queryNode) (remote, local queryNode) {
+	switch n := node.(type) {
+	case *queryCond:
+		if n.remote {
+			return n, nil
+		}
+		return nil, n
+
+	case *queryNot:
+		if _, nLocal := splitQuery(n.node); nLocal == nil {
+			return n, nil
+		}
+		return nil, n
+
+	case *queryJoin:
+		var remotes, locals []queryNode
+		for _, child := range n.nodes {
+			cRemote, cLocal := splitQuery(child)
+			if cRemote != nil {
+				remotes = append(remotes, cRemote)
+			}
+			if cLocal != nil {
+				locals = append(locals, cLocal)
+			}
+		}
+
+		if !n.and {
+			// Any part of an or left to be evaluated
+			// locally could match what Drive rejects.
+			if len(locals) >= 1 {
+				return nil, n
+			}
+			return n, nil
+		}
+		return joinQueryNodes(remotes), joinQueryNodes(locals)
+	}
+
+	return nil, node
+}
+
+func joinQueryNodes(nodes []queryNode) queryNode {
+	switch len(nodes) {
+	case 0:
+		return nil
+	case 1:
+		return nodes[0]
+	}
+	return &queryJoin{and: true, nodes: nodes}
+}
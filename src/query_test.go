@@ -0,0 +1,139 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query  string
+		remote string
+		local  bool
+	}{
+		{
+			query:  `name ~ "report" and modified > 2026-01-01 and size > 10MB and not owner:bob@x`,
+			remote: `((modifiedDate > "2026-01-01T00:00:00.000Z") and (not ("bob@x" in owners)))`,
+			local:  true,
+		},
+		{
+			query:  `modified > 2026-01-01T15:04:05 and (name:a:b)`,
+			remote: `((modifiedDate > "` + toUTCString(mustParseQueryTime(t, "2026-01-01T15:04:05")) + `") and (title = "a:b"))`,
+		},
+		{
+			query:  `modified = 2026-01-02 and not folder`,
+			remote: `((modifiedDate >= "2026-01-02T00:00:00.000Z" and modifiedDate < "2026-01-03T00:00:00.000Z") and (not (mimeType = "application/vnd.google-apps.folder")))`,
+		},
+		{query: `name =~ "^a.*z$" or starred`, local: true},
+		{query: `(mime = pdf or ext:md) and depth <= 2`, local: true},
+	}
+
+	for _, tt := range tests {
+		node, err := parseQuery(tt.query)
+		if err != nil {
+			t.Errorf("%q: %v", tt.query, err)
+			continue
+		}
+		remote, local := splitQuery(node)
+		got := ""
+		if remote != nil {
+			got = remote.driveQuery()
+		}
+		if got != tt.remote {
+			t.Errorf("%q: remote got %s want %s", tt.query, got, tt.remote)
+		}
+		if (local != nil) != tt.local {
+			t.Errorf("%q: local got %v want %v", tt.query, local != nil, tt.local)
+		}
+	}
+
+	for _, query := range []string{`name ~ "open`, `size > 10XB`, `color = red`, `name ~`, `(starred`} {
+		if _, err := parseQuery(query); err == nil {
+			t.Errorf("%q: expected an error", query)
+		}
+	}
+}
+
+func mustParseQueryTime(t *testing.T, value string) time.Time {
+	qt, _, err := parseQueryTime(value)
+	if err != nil {
+		t.Fatalf("parseQueryTime %q: %v", value, err)
+	}
+	return qt
+}
+
+func TestQuerySearch(t *testing.T) {
+	mb := NewMemoryBackend()
+
+	context := memoryTestContext(t)
+	defer os.RemoveAll(context.AbsPath)
+
+	writeTestFiles(t, context.AbsPath, map[string]string{
+		"a/report.txt":       "a short report",
+		"a/b/report-2.md":    "a much longer report than the other",
+		"a/b/c/report-3.md":  "the deepest report of them all",
+		"notes/shopping.txt": "milk",
+	})
+	if err := NewWithBackend(context, memoryTestOptions("/"), mb).Push(); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	pullContext := memoryTestContext(t)
+	defer os.RemoveAll(pullContext.AbsPath)
+
+	opts := memoryTestOptions("/")
+	opts.Meta = &map[string][]string{QueryKey: {`name ~ report and (ext = md or size < 20) and depth <= 3`}}
+	if err := NewWithBackend(pullContext, opts, mb).Pull(); err != nil {
+		t.Fatalf("pull: %v", err)
+	}
+
+	for _, rel := range []string{"a/report.txt", "a/b/report-2.md"} {
+		if _, err := os.Stat(filepath.Join(pullContext.AbsPath, rel)); err != nil {
+			t.Errorf("%s should have been pulled: %v", rel, err)
+		}
+	}
+	for _, rel := range []string{"a/b/c/report-3.md", "notes/shopping.txt"} {
+		if _, err := os.Stat(filepath.Join(pullContext.AbsPath, rel)); err == nil {
+			t.Errorf("%s should not have been pulled", rel)
+		}
+	}
+
+	opts = memoryTestOptions("/a")
+	opts.Meta = &map[string][]string{QueryKey: {`name =~ "^report-[0-9]+\.md$"`}}
+	if err := NewWithBackend(context, opts, mb).Trash(false); err != nil {
+		t.Fatalf("trash: %v", err)
+	}
+
+	for _, p := range []string{"/a/b/report-2.md", "/a/b/c/report-3.md"} {
+		if _, err := mb.FindByPath(p); err == nil {
+			t.Errorf("%s should have been trashed", p)
+		}
+	}
+	for _, p := range []string{"/a/report.txt", "/notes/shopping.txt"} {
+		if _, err := mb.FindByPath(p); err != nil {
+			t.Errorf("%s should not have been trashed: %v", p, err)
+		}
+	}
+
+	opts = memoryTestOptions("/")
+	opts.Meta = &map[string][]string{QueryKey: {`name = "report.txt" or`}}
+	if err := NewWithBackend(context, opts, mb).List(false); err == nil {
+		t.Errorf("expected an error listing with an incomplete query")
+	}
+}
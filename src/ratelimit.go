@@ -0,0 +1,338 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mxk/go-flowrate/flowrate"
+	"github.com/odeke-em/namespace"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	// DefaultMaxQPS is the ceiling on API requests per second
+	// unless `max-qps` is set in the global section of .driverc.
+	DefaultMaxQPS = 100
+
+	// minQPS is the floor that rate limiting responses shrink the rate to.
+	minQPS = 1
+
+	// rateLimitCooldown keeps a burst of rate limiting responses to
+	// requests that were in flight together from shrinking the rate
+	// more than once.
+	rateLimitCooldown = time.Second
+)
+
+// apiRateLimiter is shared by every Remote in the process, so that
+// all workers of all commands draw from the same budget.
+var apiRateLimiter = newAdaptiveRateLimiter(DefaultMaxQPS)
+
+// SetMaxQPS changes the ceiling on API requests per second.
+// A non-positive qps restores DefaultMaxQPS.
+func SetMaxQPS(qps float64) {
+	apiRateLimiter.setCeiling(qps)
+}
+
+// adaptiveRateLimiter is a token bucket whose rate is halved whenever
+// the API says that we are going too fast and that then gradually
+// recovers towards the ceiling with every successful response.
+type adaptiveRateLimiter struct {
+	mu sync.Mutex
+
+	ceiling float64
+	rate    float64
+	tokens  float64
+	last    time.Time
+
+	lastShrink   time.Time
+	blockedUntil time.Time
+}
+
+func newAdaptiveRateLimiter(ceiling float64) *adaptiveRateLimiter {
+	rl := &adaptiveRateLimiter{}
+	rl.setCeiling(ceiling)
+	return rl
+}
+
+func (rl *adaptiveRateLimiter) setCeiling(ceiling float64) {
+	if ceiling <= 0 {
+		ceiling = DefaultMaxQPS
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.ceiling = ceiling
+	rl.rate = ceiling
+	rl.tokens = ceiling
+	rl.last = time.Now()
+}
+
+// burst is the number of requests that can go out back to
+// back, about a second's worth at the current rate.
+func (rl *adaptiveRateLimiter) burstLocked() float64 {
+	if rl.rate < 1 {
+		return 1
+	}
+	return rl.rate
+}
+
+func (rl *adaptiveRateLimiter) refillLocked(now time.Time) {
+	rl.tokens += now.Sub(rl.last).Seconds() * rl.rate
+	if burst := rl.burstLocked(); rl.tokens > burst {
+		rl.tokens = burst
+	}
+	rl.last = now
+}
+
+// wait blocks until a request can be made or ctx is done.
+func (rl *adaptiveRateLimiter) wait(ctx context.Context) error {
+	for {
+		rl.mu.Lock()
+		now := time.Now()
+		rl.refillLocked(now)
+
+		var pause time.Duration
+		switch {
+		case now.Before(rl.blockedUntil):
+			pause = rl.blockedUntil.Sub(now)
+		case rl.tokens >= 1:
+			rl.tokens -= 1
+			rl.mu.Unlock()
+			return nil
+		default:
+			pause = time.Duration((1 - rl.tokens) / rl.rate * float64(time.Second))
+		}
+		rl.mu.Unlock()
+
+		timer := time.NewTimer(pause)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// shrink halves the rate and if retryAfter is set,
+// holds off all requests for that long.
+func (rl *adaptiveRateLimiter) shrink(retryAfter time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	if retryAfter > 0 && now.Add(retryAfter).After(rl.blockedUntil) {
+		rl.blockedUntil = now.Add(retryAfter)
+	}
+
+	if now.Sub(rl.lastShrink) < rateLimitCooldown {
+		return
+	}
+	rl.lastShrink = now
+
+	rl.refillLocked(now)
+	rl.rate /= 2
+	if rl.rate < minQPS {
+		rl.rate = minQPS
+	}
+	if burst := rl.burstLocked(); rl.tokens > burst {
+		rl.tokens = burst
+	}
+}
+
+// grow nudges the rate back up by a hundredth of the ceiling.
+func (rl *adaptiveRateLimiter) grow() {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if rl.rate >= rl.ceiling {
+		return
+	}
+
+	rl.refillLocked(time.Now())
+	step := rl.ceiling / 100
+	if step < 1 {
+		step = 1
+	}
+	rl.rate += step
+	if rl.rate > rl.ceiling {
+		rl.rate = rl.ceiling
+	}
+}
+
+func (rl *adaptiveRateLimiter) currentRate() float64 {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.rate
+}
+
+// rateLimitedTransport makes every request wait for the limiter
+// and feeds the API's rate limiting responses back into it.
+type rateLimitedTransport struct {
+	base    http.RoundTripper
+	limiter *adaptiveRateLimiter
+}
+
+func newRateLimitedTransport(base http.RoundTripper, limiter *adaptiveRateLimiter) *rateLimitedTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &rateLimitedTransport{base: base, limiter: limiter}
+}
+
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.wait(req.Context()); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	res, err := t.base.RoundTrip(req)
+	if err != nil {
+		return res, err
+	}
+
+	limited, err := isRateLimited(res)
+	if err != nil {
+		return nil, err
+	}
+
+	if limited {
+		t.limiter.shrink(retryAfter(res))
+	} else if res.StatusCode < 400 {
+		t.limiter.grow()
+	}
+	return res, nil
+}
+
+// Errors bodies are small, anything longer isn't a rate limiting response.
+const maxRateLimitBodySize = 1 << 16
+
+// The reasons that Drive gives for 403s that are due to rate limiting.
+const (
+	reasonUserRateLimitExceeded = "userRateLimitExceeded"
+	reasonRateLimitExceeded     = "rateLimitExceeded"
+)
+
+// isRateLimited tells whether the response is a 429 or a 403 with reason
+// userRateLimitExceeded or rateLimitExceeded. For the latter it has to read
+// the body, which is then replaced so that callers can still read it.
+func isRateLimited(res *http.Response) (bool, error) {
+	switch res.StatusCode {
+	case http.StatusTooManyRequests:
+		return true, nil
+	case http.StatusForbidden:
+	default:
+		return false, nil
+	}
+
+	blob, err := ioutil.ReadAll(io.LimitReader(res.Body, maxRateLimitBodySize))
+	rest := res.Body
+	res.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(blob), rest), rest}
+	if err != nil {
+		res.Body.Close()
+		return false, err
+	}
+
+	// CheckResponse decodes the body into a *googleapi.Error.
+	gErr, ok := googleapi.CheckResponse(&http.Response{
+		StatusCode: res.StatusCode,
+		Header:     res.Header,
+		Body:       ioutil.NopCloser(bytes.NewReader(blob)),
+	}).(*googleapi.Error)
+	if !ok {
+		return false, nil
+	}
+
+	for _, item := range gErr.Errors {
+		switch item.Reason {
+		case reasonUserRateLimitExceeded, reasonRateLimitExceeded:
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func retryAfter(res *http.Response) time.Duration {
+	secs, err := strconv.Atoi(strings.TrimSpace(res.Header.Get("Retry-After")))
+	if err != nil || secs < 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
+
+// maxQPSFromRc looks up `max-qps` in the global section
+// of the .driverc that applies to the directory dir.
+func maxQPSFromRc(dir string) (int, bool) {
+	rcMappings, err := ResourceMappings(dir)
+	if err != nil {
+		return 0, false
+	}
+
+	qps, ok := rcMappings[namespace.GlobalNamespaceKey][CLIOptionMaxQPS].(int)
+	return qps, ok && qps > 0
+}
+
+// bandwidthThrottle caps the combined throughput of many concurrent
+// transfers: all their readers draw from a single flowrate.Monitor.
+type bandwidthThrottle struct {
+	monitor *flowrate.Monitor
+	// bytesPerSec is the limit in bytes per second.
+	bytesPerSec int64
+}
+
+func newBandwidthThrottle(bytesPerSec int64) *bandwidthThrottle {
+	return &bandwidthThrottle{
+		monitor:     flowrate.New(0, 0),
+		bytesPerSec: bytesPerSec,
+	}
+}
+
+// reader returns r throttled by t. A nil throttle leaves r as is.
+func (t *bandwidthThrottle) reader(r io.Reader) io.Reader {
+	if t == nil {
+		return r
+	}
+	return &throttledReader{Reader: r, throttle: t}
+}
+
+type throttledReader struct {
+	io.Reader
+	throttle *bandwidthThrottle
+}
+
+func (tr *throttledReader) Read(p []byte) (n int, err error) {
+	m := tr.throttle.monitor
+	// Limit blocks until the others' reads leave room for more.
+	p = p[:m.Limit(len(p), tr.throttle.bytesPerSec, true)]
+	if len(p) > 0 {
+		n, err = m.IO(tr.Reader.Read(p))
+	}
+	return
+}
@@ -0,0 +1,123 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimitedTransportAdapts(t *testing.T) {
+	const rateLimitBody = `{"error":{"errors":[{"reason":"userRateLimitExceeded"}],"code":403}}`
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(rateLimitBody))
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	limiter := newAdaptiveRateLimiter(200)
+	client := &http.Client{Transport: newRateLimitedTransport(nil, limiter)}
+
+	res, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	blob, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+
+	if got := string(blob); got != rateLimitBody {
+		t.Errorf("body after inspection: got %q want %q", got, rateLimitBody)
+	}
+	if got, want := limiter.currentRate(), 100.0; got != want {
+		t.Errorf("rate after rate limiting: got %v want %v", got, want)
+	}
+
+	for i := 0; i < 10; i++ {
+		res, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("get #%d: %v", i, err)
+		}
+		res.Body.Close()
+	}
+
+	if got, want := limiter.currentRate(), 120.0; got != want {
+		t.Errorf("rate after recovering: got %v want %v", got, want)
+	}
+}
+
+func TestIsRateLimited(t *testing.T) {
+	tests := [...]struct {
+		status int
+		body   string
+		want   bool
+	}{
+		0: {status: http.StatusTooManyRequests, want: true},
+		1: {status: http.StatusForbidden, body: `{"error":{"errors":[{"reason":"rateLimitExceeded"}]}}`, want: true},
+		2: {status: http.StatusForbidden, body: `{"error":{"errors":[{"reason":"insufficientPermissions"}]}}`},
+		3: {status: http.StatusInternalServerError, body: "backendError"},
+		4: {status: http.StatusForbidden, body: `{"error":{"errors":[{"reason":"forbidden","message":"rateLimitExceeded"}]}}`},
+		5: {status: http.StatusForbidden, body: "userRateLimitExceeded"},
+	}
+
+	for i, tt := range tests {
+		res := &http.Response{StatusCode: tt.status, Body: ioutil.NopCloser(strings.NewReader(tt.body))}
+		got, err := isRateLimited(res)
+		if err != nil {
+			t.Errorf("#%d: err=%v", i, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("#%d: got %v want %v", i, got, tt.want)
+		}
+	}
+}
+
+func TestBandwidthThrottleIsShared(t *testing.T) {
+	const size = 50 * 1024
+
+	// Each read on its own is within the limit, together they take twice as long.
+	throttle := newBandwidthThrottle(2 * size)
+
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			blob, err := ioutil.ReadAll(throttle.reader(bytes.NewReader(make([]byte, size))))
+			if err != nil || len(blob) != size {
+				t.Errorf("read %d bytes, err=%v", len(blob), err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if elapsed := time.Since(start); elapsed < 800*time.Millisecond {
+		t.Errorf("combined reads took %v, expected about a second", elapsed)
+	}
+}
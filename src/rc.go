@@ -136,6 +136,8 @@ func parseRCValues(rcMap map[string]string) (valueMappings map[string]interface{
 				PageSizeKey,
 				DepthKey,
 				CLIOptionRetryCount,
+				CLIOptionMaxQPS,
+				CLIOptionDownloadRateLimit,
 			},
 		},
 		{
@@ -145,7 +147,7 @@ func parseRCValues(rcMap map[string]string) (valueMappings map[string]interface{
 				CLIEncryptionPassword, CLIDecryptionPassword, SortKey,
 				CLIOptionNotOwner, ExportsDirKey, CLIOptionExactTitle, AddressKey,
 				CLIOptionPushDestination, CLIOptionSkipMime, CLIOptionMatchMime,
-				ExportsKey,
+				ExportsKey, CLIOptionExportMap, CLIOptionAddr, CLIOptionSocket,
 			},
 		},
 		{
@@ -88,11 +88,18 @@ func errCannotMkdirAll(p string) error {
 }
 
 type Remote struct {
-	client       *http.Client
-	service      *drive.Service
-	encrypter    func(io.Reader) (io.Reader, error)
-	decrypter    func(io.Reader) (io.ReadCloser, error)
-	progressChan chan int
+	client    *http.Client
+	service   *drive.Service
+	encrypter func(io.Reader) (io.Reader, error)
+	decrypter func(io.Reader) (io.ReadCloser, error)
+
+	// sharedDriveId is the id of the shared drive that
+	// the context is rooted at, empty for "My Drive".
+	sharedDriveId string
+
+	// baseURL when set is where API requests are sent
+	// instead of to Google's servers, see NewRemoteContextWithBaseURL.
+	baseURL string
 }
 
 // NewRemoteContextFromServiceAccount returns a remote initialized
@@ -108,25 +115,46 @@ func NewRemoteContextFromServiceAccount(jwtConfig *jwt.Config) (*Remote, error)
 }
 
 func NewRemoteContext(context *config.Context) (*Remote, error) {
-	client := newOAuthClient(context)
-	return remoteFromClient(client)
+	return NewRemoteContextWithBaseURL(context, os.Getenv(DriveAPIBaseURLEnvKey))
+}
+
+// NewRemoteContextWithBaseURL returns a remote that sends its API and
+// OAuth2.0 token requests to baseURL instead of to Google's servers
+// e.g to talk to drive-fakeserver. An empty baseURL uses Google's servers.
+func NewRemoteContextWithBaseURL(context *config.Context, baseURL string) (*Remote, error) {
+	client := newOAuthClient(context, baseURL)
+	rem, err := remoteFromClient(client)
+	if err != nil {
+		return nil, err
+	}
+
+	if baseURL != "" {
+		rem.service.BasePath = strings.TrimSuffix(baseURL, "/") + "/drive/v2/"
+		rem.baseURL = baseURL
+	}
+	return rem, nil
 }
 
 func remoteFromClient(client *http.Client) (*Remote, error) {
+	client.Transport = newRateLimitedTransport(client.Transport, apiRateLimiter)
+
 	service, err := drive.New(client)
 	if err != nil {
 		return nil, err
 	}
 
-	progressChan := make(chan int)
 	rem := &Remote{
-		progressChan: progressChan,
-		service:      service,
-		client:       client,
+		service: service,
+		client:  client,
 	}
 	return rem, nil
 }
 
+func (r *Remote) setCrypto(encrypter func(io.Reader) (io.Reader, error), decrypter func(io.Reader) (io.ReadCloser, error)) {
+	r.encrypter = encrypter
+	r.decrypter = decrypter
+}
+
 func hasExportLinks(f *File) bool {
 	if f == nil || f.IsDir {
 		return false
@@ -134,35 +162,50 @@ func hasExportLinks(f *File) bool {
 	return len(f.ExportLinks) >= 1
 }
 
-func (r *Remote) changes(startChangeId int64) (chan *drive.Change, error) {
-	req := r.service.Changes.List()
+func (r *Remote) changes(startChangeId int64, fn func(*drive.Change) error) error {
+	req := r.service.Changes.List().SupportsAllDrives(true)
+	if r.sharedDriveId != "" {
+		req = req.IncludeItemsFromAllDrives(true).DriveId(r.sharedDriveId)
+	}
 	if startChangeId >= 0 {
 		req = req.StartChangeId(startChangeId)
 	}
 
-	changeChan := make(chan *drive.Change)
-	go func() {
-		pageToken := ""
-		for {
-			if pageToken != "" {
-				req = req.PageToken(pageToken)
-			}
-			res, err := req.Do()
-			if err != nil {
-				break
-			}
-			for _, chItem := range res.Items {
-				changeChan <- chItem
-			}
-			pageToken = res.NextPageToken
-			if pageToken == "" {
-				break
+	for {
+		res, err := req.Do()
+		if err != nil {
+			return err
+		}
+		for _, chItem := range res.Items {
+			if err := fn(chItem); err != nil {
+				return err
 			}
 		}
-		close(changeChan)
-	}()
+		if res.NextPageToken == "" {
+			return nil
+		}
+		req = req.PageToken(res.NextPageToken)
+	}
+}
+
+func (r *Remote) allFiles(fn func(*drive.File) error) error {
+	root, err := r.service.Files.Get(r.RootId()).SupportsAllDrives(true).Do()
+	if err != nil {
+		return err
+	}
+	if err := fn(root); err != nil {
+		return err
+	}
 
-	return changeChan, nil
+	req := r.filesList().MaxResults(1000)
+	return req.Pages(context.Background(), func(res *drive.FileList) error {
+		for _, f := range res.Items {
+			if err := fn(f); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 func buildExpression(parentId string, typeMask int, inTrash bool) string {
@@ -178,11 +221,11 @@ func buildExpression(parentId string, typeMask int, inTrash bool) string {
 }
 
 func (r *Remote) change(changeId string) (*drive.Change, error) {
-	return r.service.Changes.Get(changeId).Do()
+	return r.service.Changes.Get(changeId).SupportsAllDrives(true).Do()
 }
 
 func RetrieveRefreshToken(ctx context.Context, context *config.Context) (string, error) {
-	config := newAuthConfig(context)
+	config := newAuthConfig(context, os.Getenv(DriveAPIBaseURLEnvKey))
 
 	randState := fmt.Sprintf("%s%v", time.Now(), rand.Uint32())
 	url := config.AuthCodeURL(randState, oauth2.AccessTypeOffline)
@@ -197,8 +240,12 @@ func RetrieveRefreshToken(ctx context.Context, context *config.Context) (string,
 	return token.RefreshToken, nil
 }
 
-func (r *Remote) FindBackPaths(id string) (backPaths []string, err error) {
-	f, fErr := r.FindById(id)
+func (r *Remote) FindBackPaths(id string) ([]string, error) {
+	return findBackPaths(r, id)
+}
+
+func findBackPaths(b backend, id string) (backPaths []string, err error) {
+	f, fErr := b.FindById(id)
 	if fErr != nil {
 		err = fErr
 		return
@@ -219,12 +266,13 @@ func (r *Remote) FindBackPaths(id string) (backPaths []string, err error) {
 			continue
 		}
 
-		if p.IsRoot {
+		// Shared drives' roots aren't flagged as such.
+		if p.IsRoot || p.Id == b.RootId() {
 			backPaths = append(backPaths, sepJoin(DriveRemoteSep, relPath))
 			continue
 		}
 
-		fullSubPaths, pErr := r.FindBackPaths(p.Id)
+		fullSubPaths, pErr := findBackPaths(b, p.Id)
 		if pErr != nil {
 			continue
 		}
@@ -260,7 +308,7 @@ func (r *Remote) FindByIdM(id string) *paginationPair {
 }
 
 func (r *Remote) FindById(id string) (*File, error) {
-	req := r.service.Files.Get(id)
+	req := r.service.Files.Get(id).SupportsAllDrives(true)
 	f, err := req.Do()
 	if err != nil {
 		return nil, err
@@ -268,6 +316,10 @@ func (r *Remote) FindById(id string) (*File, error) {
 	return NewRemoteFile(f), nil
 }
 
+func (r *Remote) Get(id string) (*drive.File, error) {
+	return r.service.Files.Get(id).SupportsAllDrives(true).Do()
+}
+
 func retryableChangeOp(fn func() (interface{}, error), debug bool, retryCount int) *expb.ExponentialBacker {
 	if retryCount < 0 {
 		retryCount = MaxFailedRetryCount
@@ -283,7 +335,7 @@ func retryableChangeOp(fn func() (interface{}, error), debug bool, retryCount in
 
 func (r *Remote) findByPathM(p string, trashed bool) *paginationPair {
 	if rootLike(p) {
-		return r.FindByIdM("root")
+		return r.FindByIdM(r.RootId())
 	}
 
 	parts := strings.Split(p, RemoteSeparator)
@@ -292,19 +344,19 @@ func (r *Remote) findByPathM(p string, trashed bool) *paginationPair {
 		finder = r.findByPathTrashedM
 	}
 
-	return finder("root", parts[1:])
+	return finder(r.RootId(), parts[1:])
 }
 
 func (r *Remote) findByPath(p string, trashed bool) (*File, error) {
 	if rootLike(p) {
-		return r.FindById("root")
+		return r.FindById(r.RootId())
 	}
 	parts := strings.Split(p, "/")
 	finder := r.findByPathRecv
 	if trashed {
 		finder = r.findByPathTrashed
 	}
-	return finder("root", parts[1:])
+	return finder(r.RootId(), parts[1:])
 }
 
 func (r *Remote) FindByPath(p string) (*File, error) {
@@ -390,7 +442,7 @@ func _reqDoPage(req *drive.FilesListCall, hidden bool, promptOnPagination, nilOn
 }
 
 func (r *Remote) findByParentIdRaw(parentId string, trashed, hidden bool) *paginationPair {
-	req := r.service.Files.List()
+	req := r.filesList()
 	req.Q(fmt.Sprintf("%s in parents and trashed=%v", customQuote(parentId), trashed))
 	return reqDoPage(req, hidden, false)
 }
@@ -404,21 +456,24 @@ func (r *Remote) FindByParentIdTrashed(parentId string, hidden bool) *pagination
 }
 
 func (r *Remote) EmptyTrash() error {
+	if r.sharedDriveId != "" {
+		return r.emptySharedDriveTrash()
+	}
 	return r.service.Files.EmptyTrash().Do()
 }
 
 func (r *Remote) Trash(id string) error {
-	_, err := r.service.Files.Trash(id).Do()
+	_, err := r.service.Files.Trash(id).SupportsAllDrives(true).Do()
 	return err
 }
 
 func (r *Remote) Untrash(id string) error {
-	_, err := r.service.Files.Untrash(id).Do()
+	_, err := r.service.Files.Untrash(id).SupportsAllDrives(true).Do()
 	return err
 }
 
 func (r *Remote) Delete(id string) error {
-	return r.service.Files.Delete(id).Do()
+	return r.service.Files.Delete(id).SupportsAllDrives(true).Do()
 }
 
 func (r *Remote) idForEmail(email string) (string, error) {
@@ -430,7 +485,7 @@ func (r *Remote) idForEmail(email string) (string, error) {
 }
 
 func (r *Remote) listPermissions(id string) ([]*drive.Permission, error) {
-	res, err := r.service.Permissions.List(id).Do()
+	res, err := r.service.Permissions.List(id).SupportsAllDrives(true).Do()
 	if err != nil {
 		return nil, err
 	}
@@ -448,7 +503,7 @@ func (r *Remote) insertPermissions(permInfo *permission) (*drive.Permission, err
 		perm.Value = permInfo.value
 	}
 
-	req := r.service.Permissions.Insert(permInfo.fileId, perm)
+	req := r.service.Permissions.Insert(permInfo.fileId, perm).SupportsAllDrives(true)
 
 	if permInfo.message != "" {
 		req = req.EmailMessage(permInfo.message)
@@ -469,7 +524,7 @@ func (r *Remote) revokePermissions(p *permission) (err error) {
 			continue
 		}
 
-		req := r.service.Permissions.Delete(p.fileId, perm.Id)
+		req := r.service.Permissions.Delete(p.fileId, perm.Id).SupportsAllDrives(true)
 		if delErr := req.Do(); delErr != nil {
 			err = reComposeError(err, fmt.Sprintf("err: %v fileId: %s permissionId %s", delErr, p.fileId, perm.Id))
 		} else {
@@ -534,7 +589,7 @@ func (r *Remote) findPermissions(pquery *permission) (permChan chan *drive.Permi
 	go func() {
 		defer close(permChan)
 
-		req := r.service.Permissions.List(pquery.fileId)
+		req := r.service.Permissions.List(pquery.fileId).SupportsAllDrives(true)
 
 		results, err := req.Do()
 		if err != nil {
@@ -563,7 +618,7 @@ func (r *Remote) findPermissions(pquery *permission) (permChan chan *drive.Permi
 }
 
 func (r *Remote) deletePermissions(id string, accountType AccountType) error {
-	return r.service.Permissions.Delete(id, accountType.String()).Do()
+	return r.service.Permissions.Delete(id, accountType.String()).SupportsAllDrives(true).Do()
 }
 
 func (r *Remote) Unpublish(id string) error {
@@ -598,7 +653,7 @@ func (r *Remote) Download(id string, exportURL string) (io.ReadCloser, error) {
 	var err error
 
 	if len(exportURL) < 1 {
-		resp, err = r.service.Files.Get(id).Download()
+		resp, err = r.service.Files.Get(id).SupportsAllDrives(true).Download()
 	} else {
 		resp, err = r.client.Get(exportURL)
 	}
@@ -625,8 +680,37 @@ func (r *Remote) Download(id string, exportURL string) (io.ReadCloser, error) {
 	return body, err
 }
 
+// DownloadRange downloads the content of the file with id starting at offset.
+// Servers are free to ignore the requested range, so it also returns the
+// offset at which the returned content actually starts.
+func (r *Remote) DownloadRange(id string, offset int64) (io.ReadCloser, int64, error) {
+	// Encrypted content can only be decrypted from its start.
+	if offset <= 0 || r.decrypter != nil {
+		body, err := r.Download(id, "")
+		return body, 0, err
+	}
+
+	req := r.service.Files.Get(id).SupportsAllDrives(true)
+	req.Header().Set("Range", fmt.Sprintf("bytes=%d-", offset))
+
+	resp, err := req.Download()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return resp.Body, offset, nil
+	case http.StatusOK:
+		return resp.Body, 0, nil
+	}
+
+	resp.Body.Close()
+	return nil, 0, downloadFailedErr(fmt.Errorf("download: range from %d of %q. StatusCode: %v", offset, id, resp.StatusCode))
+}
+
 func (r *Remote) Touch(id string) (*File, error) {
-	f, err := r.service.Files.Touch(id).Do()
+	f, err := r.service.Files.Touch(id).SupportsAllDrives(true).Do()
 	if err != nil {
 		return nil, err
 	}
@@ -646,7 +730,7 @@ func (r *Remote) SetModTime(fileId string, modTime time.Time) (*File, error) {
 	// Ensure that the ModifiedDate is retrieved from local
 	repr.ModifiedDate = toUTCString(modTime)
 
-	req := r.service.Files.Update(fileId, repr)
+	req := r.service.Files.Update(fileId, repr).SupportsAllDrives(true)
 
 	// We always want it to match up with the local time
 	req.SetModifiedDate(true)
@@ -697,6 +781,16 @@ type upsertOpt struct {
 	retryCount      int
 	uploadChunkSize int
 	uploadRateLimit int
+	sessions        uploadSessionStore
+	// progress is told the number of bytes uploaded, it is
+	// the channel of the Commands that the upload is part of.
+	progress chan<- int
+}
+
+func (args *upsertOpt) reportProgress(n int) {
+	if args.progress != nil {
+		args.progress <- n
+	}
 }
 
 func togglePropertiesInsertCall(req *drive.FilesInsertCall, mask int) *drive.FilesInsertCall {
@@ -791,8 +885,16 @@ func (r *Remote) upsertByComparison(body io.Reader, args *upsertOpt) (f *File, m
 		mediaOptions = append(mediaOptions, googleapi.ChunkSize(args.uploadChunkSize))
 	}
 
+	// Encrypted content can't be resumed: every encryption uses a new random
+	// salt, so what was already uploaded doesn't match the rest of the content.
+	if r.encrypter == nil && body != nil && args.persistsUploadSession() && (args.src.Id == "" || args.shouldUploadBody()) {
+		f, err = r.resumableUpsert(body, args, uploaded)
+		mediaInserted = err == nil
+		return
+	}
+
 	if args.src.Id == "" {
-		req := r.service.Files.Insert(uploaded)
+		req := r.service.Files.Insert(uploaded).SupportsAllDrives(true)
 
 		if !args.src.IsDir && body != nil {
 			req = req.Media(reader, mediaOptions...)
@@ -811,7 +913,7 @@ func (r *Remote) upsertByComparison(body io.Reader, args *upsertOpt) (f *File, m
 	}
 
 	// update the existing
-	req := r.service.Files.Update(args.src.Id, uploaded)
+	req := r.service.Files.Update(args.src.Id, uploaded).SupportsAllDrives(true)
 
 	// We always want it to match up with the local time
 	req.SetModifiedDate(true)
@@ -832,7 +934,7 @@ func (r *Remote) upsertByComparison(body io.Reader, args *upsertOpt) (f *File, m
 }
 
 func (r *Remote) byFileIdUpdater(fileId string, f *drive.File) (*File, error) {
-	req := r.service.Files.Update(fileId, f)
+	req := r.service.Files.Update(fileId, f).SupportsAllDrives(true)
 	uploaded, err := req.Do()
 	if err != nil {
 		return nil, err
@@ -841,6 +943,61 @@ func (r *Remote) byFileIdUpdater(fileId string, f *drive.File) (*File, error) {
 	return NewRemoteFile(uploaded), nil
 }
 
+func (r *Remote) Create(req *CreateRequest) (*drive.File, error) {
+	f := &drive.File{
+		Title:       req.Name,
+		MimeType:    req.MimeType,
+		Description: req.Description,
+		Parents:     []*drive.ParentReference{&drive.ParentReference{Id: req.ParentId}},
+	}
+	if !req.ModTime.IsZero() {
+		f.ModifiedDate = toUTCString(req.ModTime)
+	}
+	if req.ShortcutTargetId != "" {
+		f.MimeType = DriveShortcutMimeType
+		f.ShortcutDetails = &drive.FileShortcutDetails{TargetId: req.ShortcutTargetId}
+	}
+
+	call := r.service.Files.Insert(f).SupportsAllDrives(true)
+	if req.Content != nil {
+		call.Media(req.Content)
+	}
+	return call.Do()
+}
+
+func (r *Remote) Update(req *UpdateRequest) (*drive.File, error) {
+	f := &drive.File{
+		Title:    req.Name,
+		MimeType: req.MimeType,
+	}
+	if req.Description != nil {
+		f.Description = *req.Description
+		f.ForceSendFields = []string{"Description"}
+	}
+	if req.Starred != nil {
+		f.Labels = &drive.FileLabels{
+			Starred:         *req.Starred,
+			ForceSendFields: []string{"Starred"},
+		}
+	}
+
+	call := r.service.Files.Update(req.Id, f).SupportsAllDrives(true)
+	if !req.ModTime.IsZero() {
+		f.ModifiedDate = toUTCString(req.ModTime)
+		call.SetModifiedDate(true)
+	}
+	if len(req.AddParents) >= 1 {
+		call.AddParents(strings.Join(req.AddParents, ","))
+	}
+	if len(req.RemoveParents) >= 1 {
+		call.RemoveParents(strings.Join(req.RemoveParents, ","))
+	}
+	if req.Content != nil {
+		call.Media(req.Content)
+	}
+	return call.Do()
+}
+
 func (r *Remote) rename(fileId, newTitle string) (*File, error) {
 	f := &drive.File{
 		Title: newTitle,
@@ -876,7 +1033,7 @@ func (r *Remote) removeParent(fileId, parentId string) error {
 
 func (r *Remote) insertParent(fileId, parentId string) error {
 	parent := &drive.ParentReference{Id: parentId}
-	_, err := r.service.Parents.Insert(fileId, parent).Do()
+	_, err := r.service.Parents.Insert(fileId, parent).SupportsAllDrives(true).Do()
 	return err
 }
 
@@ -888,14 +1045,21 @@ func (r *Remote) copy(newName, parentId string, srcFile *File) (*File, error) {
 	if parentId != "" {
 		f.Parents = []*drive.ParentReference{&drive.ParentReference{Id: parentId}}
 	}
-	copied, err := r.service.Files.Copy(srcFile.Id, f).Do()
+	copied, err := r.service.Files.Copy(srcFile.Id, f).SupportsAllDrives(true).Do()
 	if err != nil {
 		return nil, err
 	}
 	return NewRemoteFile(copied), nil
 }
 
-func (r *Remote) UpsertByComparison(args *upsertOpt) (f *File, err error) {
+func (r *Remote) UpsertByComparison(args *upsertOpt) (*File, error) {
+	return upsertWithProgress(r, args)
+}
+
+// upsertWithProgress opens the local content described by args, uploads
+// it through the backend's upsertByComparison with retries and reports
+// the number of bytes sent on the backend's progress channel.
+func upsertWithProgress(b backend, args *upsertOpt) (f *File, err error) {
 	/*
 	   // TODO: (@odeke-em) decide:
 	   //   + if to reject FIFO
@@ -914,10 +1078,7 @@ func (r *Remote) UpsertByComparison(args *upsertOpt) (f *File, err error) {
 		// relative to the current working directory, we should try reading
 		// first from the source's original local fsAbsPath aka `BlobAt`
 		// because the resolved path might be different from the original path.
-		fsAbsPath := args.src.BlobAt
-		if fsAbsPath == "" {
-			fsAbsPath = args.fsAbsPath
-		}
+		fsAbsPath := args.localPath()
 
 		if args.shouldUploadBody() {
 			file, err := os.Open(fsAbsPath)
@@ -932,14 +1093,21 @@ func (r *Remote) UpsertByComparison(args *upsertOpt) (f *File, err error) {
 		}
 	}
 
-	bd := statos.NewReader(body)
+	var upload io.Reader
+	if seeker, ok := body.(io.ReadSeeker); ok {
+		// Lets resumable uploads skip the content that was already committed.
+		upload = &seekableReader{ReadSeeker: seeker, progress: args.progress}
+	} else {
+		bd := statos.NewReader(body)
+		upload = bd
 
-	go func() {
-		commChan := bd.ProgressChan()
-		for n := range commChan {
-			r.progressChan <- n
-		}
-	}()
+		go func() {
+			commChan := bd.ProgressChan()
+			for n := range commChan {
+				args.reportProgress(n)
+			}
+		}()
+	}
 
 	resultLoad := make(chan *tuple)
 
@@ -949,7 +1117,15 @@ func (r *Remote) UpsertByComparison(args *upsertOpt) (f *File, err error) {
 		}
 
 		emitter := func() (interface{}, error) {
-			f, mediaInserted, err := r.upsertByComparison(bd, args)
+			// A failed attempt might have consumed part of the body
+			// so rewind it, otherwise retries upload truncated content.
+			if seeker, ok := upload.(io.Seeker); ok {
+				if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+					return &tuple{last: err}, err
+				}
+			}
+
+			f, mediaInserted, err := b.upsertByComparison(upload, args)
 			return &tuple{first: f, second: mediaInserted, last: err}, err
 		}
 
@@ -977,7 +1153,7 @@ func (r *Remote) UpsertByComparison(args *upsertOpt) (f *File, err error) {
 		if mediaOk && !mediaInserted && f != nil {
 			chunks := chunkInt64(f.Size)
 			for n := range chunks {
-				r.progressChan <- n
+				args.reportProgress(n)
 			}
 		}
 
@@ -991,7 +1167,8 @@ func (r *Remote) UpsertByComparison(args *upsertOpt) (f *File, err error) {
 }
 
 func (r *Remote) findShared(p []string) *paginationPair {
-	req := r.service.Files.List()
+	// Being shared with the user only makes sense in their own corpus.
+	req := r.service.Files.List().SupportsAllDrives(true)
 	expr := "sharedWithMe=true"
 	if len(p) >= 1 {
 		expr = fmt.Sprintf("title = '%s' and %s", p[0], expr)
@@ -1019,13 +1196,20 @@ func (r *Remote) FindByPathShared(p string) *paginationPair {
 }
 
 func (r *Remote) FindStarred(trashed, hidden bool) *paginationPair {
-	req := r.service.Files.List()
+	req := r.filesList()
 	expr := fmt.Sprintf("(starred=true) and (trashed=%v)", trashed)
 	req.Q(expr)
 	return reqDoPage(req, hidden, false)
 }
 
 func (r *Remote) FindMatches(mq *matchQuery) *paginationPair {
+	if mq.anywhere {
+		req := r.filesList()
+		trashQuery := fmt.Sprintf("(trashed=%v)", mq.inTrash)
+		req.Q(sepJoinNonEmpty(" and ", trashQuery, mq.Stringer()))
+		return reqDoPage(req, true, false)
+	}
+
 	parent, err := r.FindByPath(mq.dirPath)
 	if err != nil || parent == nil {
 		if parent == nil && err == nil {
@@ -1034,7 +1218,7 @@ func (r *Remote) FindMatches(mq *matchQuery) *paginationPair {
 		return wrapInPaginationPair(parent, err)
 	}
 
-	req := r.service.Files.List()
+	req := r.filesList()
 
 	parQuery := fmt.Sprintf("(%s in parents)", customQuote(parent.Id))
 	expr := sepJoinNonEmpty(" and ", parQuery, mq.Stringer())
@@ -1044,11 +1228,36 @@ func (r *Remote) FindMatches(mq *matchQuery) *paginationPair {
 }
 
 func (r *Remote) findChildren(parentId string, trashed bool) *paginationPair {
-	req := r.service.Files.List()
+	req := r.filesList()
 	req.Q(fmt.Sprintf("%s in parents and trashed=%v", customQuote(parentId), trashed))
 	return reqDoPage(req, true, false)
 }
 
+func (r *Remote) Children(parentId string) (files []*drive.File, err error) {
+	req := r.filesList().MaxResults(1000)
+	req.Q(fmt.Sprintf("%s in parents", customQuote(parentId)))
+	err = req.Pages(context.Background(), func(res *drive.FileList) error {
+		files = append(files, res.Items...)
+		return nil
+	})
+	return files, err
+}
+
+func (r *Remote) listChildren(lq *listQuery) *paginationPair {
+	expr := buildExpression(lq.parentId, lq.typeMask, lq.inTrash)
+
+	if lq.matchQuery != nil {
+		exprExtra := lq.matchQuery.Stringer()
+		expr = sepJoinNonEmpty(" and ", fmt.Sprintf("(%s)", expr), exprExtra)
+	}
+
+	req := r.filesList()
+	req.Q(expr)
+	req.MaxResults(lq.pageSize)
+
+	return reqDoPage(req, lq.hidden, false)
+}
+
 func (r *Remote) About() (*drive.About, error) {
 	return r.service.About.Get().Do()
 }
@@ -1068,7 +1277,7 @@ func (r *Remote) findByPathRecvRawM(parentId string, p []string, trashed bool) *
 
 		first, rest := p[0], p[1:]
 		// find the file or directory under parentId and titled with p[0]
-		req := r.service.Files.List()
+		req := r.filesList()
 		// TODO: use field selectors
 		var expr string
 		head := urlToPath(first, false)
@@ -1152,7 +1361,7 @@ func (r *Remote) findByPathRecvRawM(parentId string, p []string, trashed bool) *
 
 func (r *Remote) findByPathRecvRaw(parentId string, p []string, trashed bool) (*File, error) {
 	// find the file or directory under parentId and titled with p[0]
-	req := r.service.Files.List()
+	req := r.filesList()
 	// TODO: use field selectors
 	var expr string
 	head := urlToPath(p[0], false)
@@ -1203,18 +1412,30 @@ func (r *Remote) findByPathTrashed(parentId string, p []string) (*File, error) {
 	return r.findByPathRecvRaw(parentId, p, true)
 }
 
-func newAuthConfig(context *config.Context) *oauth2.Config {
+func authEndpoint(baseURL string) oauth2.Endpoint {
+	if baseURL == "" {
+		return google.Endpoint
+	}
+
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	return oauth2.Endpoint{
+		AuthURL:  baseURL + "/auth",
+		TokenURL: baseURL + "/token",
+	}
+}
+
+func newAuthConfig(context *config.Context, baseURL string) *oauth2.Config {
 	return &oauth2.Config{
 		ClientID:     context.ClientId,
 		ClientSecret: context.ClientSecret,
 		RedirectURL:  RedirectURL,
-		Endpoint:     google.Endpoint,
+		Endpoint:     authEndpoint(baseURL),
 		Scopes:       []string{DriveScope},
 	}
 }
 
-func newOAuthClient(configContext *config.Context) *http.Client {
-	config := newAuthConfig(configContext)
+func newOAuthClient(configContext *config.Context, baseURL string) *http.Client {
+	config := newAuthConfig(configContext, baseURL)
 
 	token := oauth2.Token{
 		RefreshToken: configContext.RefreshToken,
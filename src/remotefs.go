@@ -0,0 +1,138 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"sort"
+)
+
+var errNotADirectory = errors.New("not a directory")
+
+// RemoteFileSystem is a read only fs.FS over a remote folder. Files are
+// looked up by path on every open and their content is only downloaded
+// as it is read. Google Docs are seen as the formats that they export
+// to, named e.g "report.pdf", and left out if they have none.
+//
+// With it http.FileServer(http.FS(fsys)), fs.WalkDir, template.ParseFS
+// and the like work against Drive, e.g
+//
+//	rem, err := drive.NewRemoteContext(context)
+//	...
+//	fsys := drive.RemoteFS(rem, "/Sites/blog")
+//	fsys.Exports = []string{"html"}
+//	http.Handle("/", http.FileServer(http.FS(fsys)))
+type RemoteFileSystem struct {
+	// Exports are the formats, by extension, that Google Docs are exported to.
+	Exports []string
+	// ExportMap overrides Exports for the types of docs that it has
+	// formats for, it is keyed by mime type as ParseExportMap returns.
+	ExportMap map[string][]string
+
+	rem  backend
+	root string
+}
+
+var (
+	_ fs.FS        = (*RemoteFileSystem)(nil)
+	_ fs.ReadDirFS = (*RemoteFileSystem)(nil)
+	_ fs.StatFS    = (*RemoteFileSystem)(nil)
+)
+
+// RemoteFS returns a read only fs.FS over the remote folder at rootPath.
+func RemoteFS(rem Backend, rootPath string) *RemoteFileSystem {
+	return &RemoteFileSystem{rem: asBackend(rem), root: remotePathJoin(rootPath)}
+}
+
+// remote is the file system of the folder that fsys
+// serves as WebDAV and S3 do, with fsys' exports.
+func (fsys *RemoteFileSystem) remote() *davFileSystem {
+	g := &Commands{
+		rem:  fsys.rem,
+		opts: &Options{Exports: fsys.Exports, ExportMap: fsys.ExportMap},
+	}
+	return &davFileSystem{g: g, root: fsys.root}
+}
+
+// resolve finds the entry that the fs.FS path name refers to.
+func (fsys *RemoteFileSystem) resolve(op, name string) (*davFileSystem, *davEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	remote := fsys.remote()
+	e, err := remote.resolve(name)
+	if err != nil {
+		return nil, nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	if name == "." {
+		e.name = name
+	}
+	return remote, e, nil
+}
+
+func (fsys *RemoteFileSystem) Open(name string) (fs.File, error) {
+	remote, e, err := fsys.resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return &davFile{fs: remote, name: "/" + name, entry: e}, nil
+}
+
+func (fsys *RemoteFileSystem) Stat(name string) (fs.FileInfo, error) {
+	_, e, err := fsys.resolve("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// ReadDir lists the folder name sorted by filename.
+func (fsys *RemoteFileSystem) ReadDir(name string) ([]fs.DirEntry, error) {
+	remote, e, err := fsys.resolve("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !e.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errNotADirectory}
+	}
+
+	children, err := remote.children(e.f)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+
+	entries := dirEntries(children)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// ReadDir makes an open folder a fs.ReadDirFile.
+func (df *davFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	children, err := df.Readdir(n)
+	return dirEntries(children), err
+}
+
+func dirEntries(infos []os.FileInfo) []fs.DirEntry {
+	entries := make([]fs.DirEntry, len(infos))
+	for i, info := range infos {
+		entries[i] = fs.FileInfoToDirEntry(info)
+	}
+	return entries
+}
@@ -0,0 +1,67 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRemoteFS(t *testing.T) {
+	mb := NewMemoryBackend()
+
+	context := memoryTestContext(t)
+	defer os.RemoveAll(context.AbsPath)
+
+	writeTestFiles(t, context.AbsPath, map[string]string{
+		"site/index.html":       "<h1>hello</h1>",
+		"site/posts/first.md":   "first post",
+		"site/posts/second.md":  "second post",
+		"elsewhere/secrets.txt": "not served",
+	})
+	if err := NewWithBackend(context, memoryTestOptions("/"), mb).Push(); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	fsys := RemoteFS(mb, "/site")
+	if err := fstest.TestFS(fsys, "index.html", "posts/first.md", "posts/second.md"); err != nil {
+		t.Fatal(err)
+	}
+
+	var walked []string
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		walked = append(walked, p)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walkDir: %v", err)
+	}
+	if got, want := strings.Join(walked, " "), ". index.html posts posts/first.md posts/second.md"; got != want {
+		t.Errorf("walkDir: got %q want %q", got, want)
+	}
+
+	if _, err := fsys.Open("../elsewhere/secrets.txt"); err == nil {
+		t.Errorf("open: expected paths outside the root to be invalid")
+	}
+	if _, err := fs.Stat(fsys, "missing.md"); !os.IsNotExist(err) {
+		t.Errorf("stat: expected a not exist error, got %v", err)
+	}
+}
@@ -0,0 +1,364 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mxk/go-flowrate/flowrate"
+	"github.com/odeke-em/drive/config"
+	drive "google.golang.org/api/drive/v2"
+	"google.golang.org/api/googleapi"
+)
+
+// Google discards resumable upload sessions after a week.
+const uploadSessionLifetime = 7 * 24 * time.Hour
+
+var errUploadSessionGone = fmt.Errorf("resumable upload session no longer exists")
+
+// uploadSessionStore persists resumable upload sessions
+// across invocations of drive, see config.Context.
+type uploadSessionStore interface {
+	DeserializeUploadSession(key string) (*config.UploadSession, error)
+	SerializeUploadSession(key string, session *config.UploadSession) error
+	PopUploadSession(key string) error
+}
+
+func (args *upsertOpt) localPath() string {
+	if args.src.BlobAt != "" {
+		return args.src.BlobAt
+	}
+	return args.fsAbsPath
+}
+
+func (args *upsertOpt) chunkSize() int64 {
+	size := int64(args.uploadChunkSize)
+	if size <= 0 {
+		size = googleapi.DefaultUploadChunkSize
+	}
+
+	// All chunks except the last have to be multiples of MinUploadChunkSize.
+	if rem := size % googleapi.MinUploadChunkSize; rem != 0 {
+		size += googleapi.MinUploadChunkSize - rem
+	}
+	return size
+}
+
+// persistsUploadSession tells whether the content should be uploaded
+// through a resumable session whose progress is saved locally. That is
+// only worth it for regular files spanning more than one chunk.
+func (args *upsertOpt) persistsUploadSession() bool {
+	if args.sessions == nil || args.src.IsDir || args.nonStatable {
+		return false
+	}
+	return args.src.Size > args.chunkSize()
+}
+
+func (args *upsertOpt) matchesUploadSession(session *config.UploadSession) bool {
+	if session == nil || session.URI == "" {
+		return false
+	}
+	if time.Since(time.Unix(session.CreatedTime, 0)) >= uploadSessionLifetime {
+		return false
+	}
+	return session.FileId == args.src.Id &&
+		session.Size == args.src.Size &&
+		session.ModTime == args.src.ModTime.Unix()
+}
+
+// seekableReader reads and seeks the content of an upload, reporting on
+// progress only what is read beyond the furthest offset reported so far.
+// Retries and resumed sessions go over committed content again, which
+// would otherwise be counted more than once.
+type seekableReader struct {
+	io.ReadSeeker
+	progress chan<- int
+
+	offset   int64
+	reported int64
+}
+
+func (sr *seekableReader) Read(p []byte) (int, error) {
+	n, err := sr.ReadSeeker.Read(p)
+	sr.offset += int64(n)
+	sr.reportUpTo(sr.offset)
+	return n, err
+}
+
+func (sr *seekableReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := sr.ReadSeeker.Seek(offset, whence)
+	if err == nil {
+		sr.offset = pos
+	}
+	return pos, err
+}
+
+// skipTo seeks to offset, counting the content before it as progress.
+func (sr *seekableReader) skipTo(offset int64) error {
+	if _, err := sr.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	sr.reportUpTo(offset)
+	return nil
+}
+
+func (sr *seekableReader) reportUpTo(offset int64) {
+	if offset > sr.reported {
+		if sr.progress != nil {
+			sr.progress <- int(offset - sr.reported)
+		}
+		sr.reported = offset
+	}
+}
+
+func uploadParams(mask int, update bool) url.Values {
+	params := url.Values{}
+	params.Set("alt", "json")
+	params.Set("uploadType", "resumable")
+	params.Set("supportsAllDrives", "true")
+
+	if update {
+		// We always want it to match up with the local time
+		params.Set("setModifiedDate", "true")
+	}
+	if ocr(mask) {
+		params.Set("ocr", "true")
+	}
+	if convert(mask) {
+		params.Set("convert", "true")
+	}
+	if pin(mask) {
+		params.Set("pinned", "true")
+	}
+	if indexContent(mask) {
+		params.Set("useContentAsIndexableText", "true")
+	}
+	return params
+}
+
+// resumableUpsert uploads body in chunks through a resumable session,
+// saving the committed offset after every chunk. If a session had been
+// saved for the same unchanged local file, it continues from that offset.
+func (r *Remote) resumableUpsert(body io.Reader, args *upsertOpt, uploaded *drive.File) (*File, error) {
+	key := args.localPath()
+
+	session, err := args.sessions.DeserializeUploadSession(key)
+	if err != nil || !args.matchesUploadSession(session) {
+		session = nil
+	}
+
+	if session != nil {
+		offset, f, err := r.queryUploadSession(session)
+		switch {
+		case err == errUploadSessionGone:
+			session = nil
+		case err != nil:
+			return nil, err
+		case f != nil:
+			// Everything had been uploaded but we didn't get to hear back.
+			args.sessions.PopUploadSession(key)
+			return NewRemoteFile(f), nil
+		default:
+			session.Offset = offset
+		}
+	}
+
+	if session == nil {
+		uri, err := r.initiateResumableUpload(args, uploaded)
+		if err != nil {
+			return nil, err
+		}
+
+		session = &config.UploadSession{
+			URI:         uri,
+			FileId:      args.src.Id,
+			Size:        args.src.Size,
+			ModTime:     args.src.ModTime.Unix(),
+			CreatedTime: time.Now().Unix(),
+		}
+		if err := args.sessions.SerializeUploadSession(key, session); err != nil {
+			return nil, err
+		}
+	}
+
+	// Skip the content that was already committed.
+	if sr, ok := body.(*seekableReader); ok {
+		if err := sr.skipTo(session.Offset); err != nil {
+			return nil, err
+		}
+	} else if _, err := io.CopyN(ioutil.Discard, body, session.Offset); err != nil {
+		return nil, err
+	}
+
+	// throttled reader: implement upload bandwidth limit
+	reader := flowrate.NewReader(body, int64(args.uploadRateLimit*1024))
+
+	chunkSize := args.chunkSize()
+	for {
+		n := session.Size - session.Offset
+		if n > chunkSize {
+			n = chunkSize
+		}
+
+		offset, f, err := r.uploadChunk(session, io.LimitReader(reader, n), n)
+		if err == errUploadSessionGone {
+			// Start afresh on the next attempt.
+			args.sessions.PopUploadSession(key)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if f != nil {
+			args.sessions.PopUploadSession(key)
+			return NewRemoteFile(f), nil
+		}
+
+		if expected := session.Offset + n; offset != expected {
+			// The server committed fewer bytes than were sent. Record that and
+			// bail out: a retry rewinds the body and resumes from the new offset.
+			session.Offset = offset
+			args.sessions.SerializeUploadSession(key, session)
+			return nil, fmt.Errorf("resumable upload: server committed %d bytes, expected %d", offset, expected)
+		}
+
+		session.Offset = offset
+		if err := args.sessions.SerializeUploadSession(key, session); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (r *Remote) initiateResumableUpload(args *upsertOpt, uploaded *drive.File) (string, error) {
+	method := "POST"
+	urlPath := "/upload/drive/v2/files"
+	if args.src.Id != "" {
+		method = "PUT"
+		urlPath += "/" + url.PathEscape(args.src.Id)
+	}
+
+	urls := googleapi.ResolveRelative(r.service.BasePath, urlPath)
+	urls += "?" + uploadParams(args.mask, args.src.Id != "").Encode()
+
+	metadata, err := json.Marshal(uploaded)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(method, urls, bytes.NewReader(metadata))
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	req.Header.Set("X-Upload-Content-Length", strconv.FormatInt(args.src.Size, 10))
+	if uploaded.MimeType != "" {
+		req.Header.Set("X-Upload-Content-Type", uploaded.MimeType)
+	}
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if err := googleapi.CheckResponse(res); err != nil {
+		return "", err
+	}
+
+	uri := res.Header.Get("Location")
+	if uri == "" {
+		return "", illogicalStateErr(fmt.Errorf("resumable upload: no session URI returned"))
+	}
+	return uri, nil
+}
+
+// queryUploadSession asks the server how much of the content it has committed.
+func (r *Remote) queryUploadSession(session *config.UploadSession) (int64, *drive.File, error) {
+	return r.uploadChunk(session, nil, 0)
+}
+
+// uploadChunk sends n bytes from chunk starting at the session's offset. If chunk
+// is nil, it only queries the session. It returns the offset committed so far
+// or the uploaded file once all of the content has been received.
+func (r *Remote) uploadChunk(session *config.UploadSession, chunk io.Reader, n int64) (int64, *drive.File, error) {
+	contentRange := fmt.Sprintf("bytes */%d", session.Size)
+	if chunk != nil && n > 0 {
+		contentRange = fmt.Sprintf("bytes %d-%d/%d", session.Offset, session.Offset+n-1, session.Size)
+	} else {
+		chunk, n = http.NoBody, 0
+	}
+
+	req, err := http.NewRequest("PUT", session.URI, chunk)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	req.ContentLength = n
+	req.Header.Set("Content-Range", contentRange)
+	// Same as google.golang.org/api/internal/gensupport, ask to be told
+	// about incomplete uploads by a header instead of a 308 status code.
+	req.Header.Set("X-GUploader-No-308", "yes")
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+
+	incomplete := res.StatusCode == http.StatusPermanentRedirect ||
+		res.Header.Get("X-Http-Status-Code-Override") == "308"
+
+	switch {
+	case incomplete:
+		return committedOffset(res.Header.Get("Range")), nil, nil
+
+	case res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusGone:
+		return 0, nil, errUploadSessionGone
+	}
+
+	if err := googleapi.CheckResponse(res); err != nil {
+		return 0, nil, err
+	}
+
+	f := new(drive.File)
+	if err := json.NewDecoder(res.Body).Decode(f); err != nil {
+		return 0, nil, err
+	}
+	return session.Size, f, nil
+}
+
+// committedOffset parses a Range header of the form "bytes=0-n".
+func committedOffset(rangeHeader string) int64 {
+	dash := strings.LastIndex(rangeHeader, "-")
+	if dash < 0 {
+		return 0
+	}
+
+	last, err := strconv.ParseInt(rangeHeader[dash+1:], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return last + 1
+}
@@ -0,0 +1,65 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestSeekableReaderReportsContentOnce(t *testing.T) {
+	const content = "0123456789abcdefghij"
+
+	progress := make(chan int, 100)
+	sr := &seekableReader{ReadSeeker: strings.NewReader(content), progress: progress}
+
+	reported := func() (total int) {
+		for {
+			select {
+			case n := <-progress:
+				total += n
+			default:
+				return total
+			}
+		}
+	}
+
+	// A first attempt that fails after reading 12 bytes, a retry that
+	// resumes from the 8 committed and one more that starts afresh.
+	if _, err := io.CopyN(ioutil.Discard, sr, 12); err != nil {
+		t.Fatalf("first attempt: %v", err)
+	}
+	if err := sr.skipTo(8); err != nil {
+		t.Fatalf("skipTo: %v", err)
+	}
+	if _, err := io.CopyN(ioutil.Discard, sr, 6); err != nil {
+		t.Fatalf("resumed attempt: %v", err)
+	}
+	if got, want := reported(), 14; got != want {
+		t.Errorf("after resuming: got %d bytes reported want %d", got, want)
+	}
+
+	if _, err := sr.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("rewind: %v", err)
+	}
+	if _, err := io.Copy(ioutil.Discard, sr); err != nil {
+		t.Fatalf("last attempt: %v", err)
+	}
+	if got, want := reported(), len(content)-14; got != want {
+		t.Errorf("after starting afresh: got %d more bytes reported want %d", got, want)
+	}
+}
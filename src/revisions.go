@@ -0,0 +1,331 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	drive "google.golang.org/api/drive/v2"
+)
+
+// revisionTimeFmt is how revision modification times are listed.
+const revisionTimeFmt = "2006-01-02 15:04:05 MST"
+
+func (r *Remote) listRevisions(fileId string) ([]*drive.Revision, error) {
+	var revisions []*drive.Revision
+	err := r.service.Revisions.List(fileId).Pages(context.Background(), func(res *drive.RevisionList) error {
+		revisions = append(revisions, res.Items...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+func (r *Remote) getRevision(fileId, revisionId string) (*drive.Revision, error) {
+	return r.service.Revisions.Get(fileId, revisionId).Do()
+}
+
+func (r *Remote) downloadRevision(fileId string, rev *drive.Revision, exportURL string) (io.ReadCloser, error) {
+	if exportURL == "" {
+		exportURL = rev.DownloadUrl
+	}
+	if exportURL == "" {
+		return nil, downloadFailedErr(fmt.Errorf("revision %s of %s has no downloadable content", customQuote(rev.Id), customQuote(fileId)))
+	}
+
+	// The revision's links are fetched by the same means as export links.
+	return r.Download(fileId, exportURL)
+}
+
+func (r *Remote) pinRevision(fileId, revisionId string, pinned bool) (*drive.Revision, error) {
+	rev := &drive.Revision{
+		Pinned:          pinned,
+		ForceSendFields: []string{"Pinned"},
+	}
+	return r.service.Revisions.Patch(fileId, revisionId, rev).Do()
+}
+
+func revisionModifier(rev *drive.Revision) string {
+	if rev.LastModifyingUser != nil && rev.LastModifyingUser.EmailAddress != "" {
+		return rev.LastModifyingUser.EmailAddress
+	}
+	return rev.LastModifyingUserName
+}
+
+func (g *Commands) Revisions() (err error) {
+	for _, relToRootPath := range g.opts.Sources {
+		if rErr := g.listRevisionsOf(relToRootPath); rErr != nil {
+			msg := fmt.Sprintf("revisions: %s err: %v\n", relToRootPath, rErr)
+			err = reComposeError(err, msg)
+			err = copyErrStatusCode(err, rErr)
+		}
+	}
+	return err
+}
+
+func (g *Commands) listRevisionsOf(relToRootPath string) error {
+	f, err := g.rem.FindByPath(relToRootPath)
+	if err != nil {
+		return err
+	}
+	if f.IsDir {
+		return invalidArgumentsErr(fmt.Errorf("folders don't have revisions"))
+	}
+
+	revisions, err := g.rem.listRevisions(f.Id)
+	if err != nil {
+		return err
+	}
+
+	idWidth := len("RevisionId")
+	for _, rev := range revisions {
+		if len(rev.Id) > idWidth {
+			idWidth = len(rev.Id)
+		}
+	}
+
+	if len(g.opts.Sources) > 1 {
+		g.log.Logf("\n\033[92m%s\033[00m\n", relToRootPath)
+	}
+
+	g.log.Logf("%-*s %-23s %10s %s\n", idWidth, "RevisionId", "ModTime", "Size", "ModifiedBy")
+	for _, rev := range revisions {
+		modTime := parseTime(rev.ModifiedDate, true).Local().Format(revisionTimeFmt)
+
+		size := ""
+		if rev.FileSize > 0 || rev.DownloadUrl != "" {
+			size = prettyBytes(rev.FileSize)
+		}
+
+		var tags []string
+		if rev.Id == revisions[len(revisions)-1].Id {
+			tags = append(tags, "current")
+		}
+		if rev.Pinned {
+			tags = append(tags, CLIOptionKeepForever)
+		}
+
+		g.log.Logf("%-*s %-23s %10s %s", idWidth, rev.Id, modTime, size, revisionModifier(rev))
+		if len(tags) >= 1 {
+			g.log.Logf(" (%s)", strings.Join(tags, ", "))
+		}
+		g.log.Logln()
+	}
+	return nil
+}
+
+// RestoreRevision makes the content of revision g.opts.Revision the current content
+// of the file at g.opts.Sources[0]. Google Drive keeps the old revisions around so
+// the restore itself creates a new revision, pinned if g.opts.KeepForever is set.
+func (g *Commands) RestoreRevision() error {
+	if len(g.opts.Sources) != 1 || g.opts.Revision == "" {
+		return invalidArgumentsErr(fmt.Errorf("restore: expecting <path> <revisionId>"))
+	}
+
+	relToRootPath := g.opts.Sources[0]
+	f, err := g.rem.FindByPath(relToRootPath)
+	if err != nil {
+		return err
+	}
+	if f.IsDir {
+		return invalidArgumentsErr(fmt.Errorf("%s: folders don't have revisions", relToRootPath))
+	}
+	if hasExportLinks(f) {
+		return googleDocNonExportErr(fmt.Errorf("%s: GoogleDoc/Sheet revisions cannot be restored in place, "+
+			"use `drive pull -%s %s -%s <ext>` and push the export instead", relToRootPath, CLIOptionRevision, g.opts.Revision, ExportsKey))
+	}
+
+	revisions, err := g.rem.listRevisions(f.Id)
+	if err != nil {
+		return err
+	}
+
+	var rev *drive.Revision
+	for _, r := range revisions {
+		if r.Id == g.opts.Revision {
+			rev = r
+		}
+	}
+	if rev == nil {
+		return nonExistantRemoteErr(fmt.Errorf("%s: no revision %s", relToRootPath, customQuote(g.opts.Revision)))
+	}
+
+	if rev == revisions[len(revisions)-1] {
+		g.log.Logf("%s: revision %s is already the current one\n", relToRootPath, rev.Id)
+		if !g.opts.KeepForever || rev.Pinned {
+			return nil
+		}
+		_, err := g.rem.pinRevision(f.Id, rev.Id, true)
+		return err
+	}
+
+	if g.opts.canPrompt() {
+		modTime := parseTime(rev.ModifiedDate, true).Local().Format(revisionTimeFmt)
+		status := promptForChanges(fmt.Sprintf("Restore %s to revision %s from %s? [Y/n] ", relToRootPath, rev.Id, modTime))
+		if !accepted(status) {
+			return status.Error()
+		}
+	}
+
+	body, err := g.rem.downloadRevision(f.Id, rev, "")
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	src := DupFile(f)
+	src.ModTime = time.Now()
+	src.Size = rev.FileSize
+
+	parentId := g.rem.RootId()
+	if len(f.Parents) >= 1 && f.Parents[0] != nil {
+		parentId = f.Parents[0].Id
+	}
+
+	mask := 0
+	if g.opts.KeepForever {
+		mask |= OptPinned
+	}
+
+	args := &upsertOpt{
+		parentId:    parentId,
+		src:         src,
+		dest:        f,
+		mask:        mask,
+		nonStatable: true,
+		retryCount:  g.opts.ExponentialBackoffRetryCount,
+	}
+
+	if _, _, err := g.rem.upsertByComparison(body, args); err != nil {
+		return err
+	}
+
+	g.log.Logf("%s: restored revision %s\n", relToRootPath, rev.Id)
+	return nil
+}
+
+// PullRevision downloads revision g.opts.Revision of the file at g.opts.Sources[0]
+// to g.opts.RevisionDest, to stdout if piping or else next to its local counterpart.
+// GoogleDoc/Sheet revisions are exported to the first format of g.opts.Exports that
+// the revision offers.
+func (g *Commands) PullRevision(byId bool) error {
+	if len(g.opts.Sources) != 1 {
+		return invalidArgumentsErr(fmt.Errorf("pull: -%s takes exactly one path", CLIOptionRevision))
+	}
+
+	g.rem.setCrypto(g.opts.Encrypter, g.opts.Decrypter)
+
+	resolver := g.rem.FindByPath
+	if byId {
+		resolver = g.rem.FindById
+	}
+
+	arg := g.opts.Sources[0]
+	f, err := resolver(arg)
+	if err != nil {
+		return err
+	}
+	if f.IsDir {
+		return invalidArgumentsErr(fmt.Errorf("%s: folders don't have revisions", arg))
+	}
+
+	rev, err := g.rem.getRevision(f.Id, g.opts.Revision)
+	if err != nil {
+		return err
+	}
+
+	exportURL, ext := "", filepath.Ext(f.Name)
+	if hasExportLinks(f) {
+		for _, exportExt := range g.opts.Exports {
+			if link, ok := rev.ExportLinks[mimeTypeFromExt(exportExt)]; ok {
+				exportURL, ext = link, "."+exportExt
+				break
+			}
+		}
+		if exportURL == "" {
+			return googleDocNonExportErr(fmt.Errorf("%s: GoogleDoc/Sheet revisions can only be exported, "+
+				"pass -%s with one of the formats the revision offers", arg, ExportsKey))
+		}
+	}
+
+	body, err := g.rem.downloadRevision(f.Id, rev, exportURL)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	if g.opts.Piped {
+		if _, err := io.Copy(os.Stdout, g.downloadThrottle.reader(body)); err != nil {
+			return downloadFailedErr(err)
+		}
+		return nil
+	}
+
+	destAbsPath := g.opts.RevisionDest
+	if destAbsPath == "" {
+		relToRootPath := arg
+		if byId {
+			relToRootPath = f.Name
+		}
+		localPath := g.context.AbsPathOf(relToRootPath)
+		localPath = strings.TrimSuffix(localPath, filepath.Ext(localPath))
+		destAbsPath = fmt.Sprintf("%s.rev-%s%s", localPath, rev.Id, ext)
+	}
+	if destAbsPath, err = filepath.Abs(destAbsPath); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(destAbsPath); err == nil && !g.opts.Force {
+		return overwriteAttemptedErr(fmt.Errorf("%s already exists locally, use `%s` to override this behaviour", destAbsPath, ForceKey))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(destAbsPath), os.ModeDir|0755); err != nil {
+		return err
+	}
+
+	partialPath := destAbsPath + PartialFileSuffix
+	fh, err := os.Create(partialPath)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(fh, g.downloadThrottle.reader(body))
+	if cErr := fh.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		os.Remove(partialPath)
+		return downloadFailedErr(err)
+	}
+
+	if err := os.Rename(partialPath, destAbsPath); err != nil {
+		return err
+	}
+
+	if modTime := parseTime(rev.ModifiedDate, true); !modTime.IsZero() {
+		os.Chtimes(destAbsPath, modTime, modTime)
+	}
+
+	g.log.Logf("%s: pulled revision %s to %s\n", arg, rev.Id, destAbsPath)
+	return nil
+}
@@ -0,0 +1,92 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPullRevisionDestination(t *testing.T) {
+	mb, context := memoryTestPush(t, map[string]string{"docs/report.txt": "first draft"})
+	defer os.RemoveAll(context.AbsPath)
+
+	f, err := mb.FindByPath("/docs/report.txt")
+	if err != nil {
+		t.Fatalf("findByPath: %v", err)
+	}
+	revisions, err := mb.listRevisions(f.Id)
+	if err != nil || len(revisions) != 1 {
+		t.Fatalf("listRevisions: got %d revisions, err %v", len(revisions), err)
+	}
+	revisionId := revisions[0].Id
+
+	pull := func(force bool) error {
+		opts := memoryTestOptions("/docs/report.txt")
+		opts.Revision = revisionId
+		opts.Force = force
+		return NewWithBackend(context, opts, mb).PullRevision(false)
+	}
+
+	// Without -revision-dest, the revision lands beside the file named after it.
+	dest := filepath.Join(context.AbsPath, "docs", "report.rev-"+revisionId+".txt")
+	expectPulled := func(when string) {
+		blob, err := ioutil.ReadFile(dest)
+		if err != nil {
+			t.Fatalf("%s: %v", when, err)
+		}
+		if got, want := string(blob), "first draft"; got != want {
+			t.Errorf("%s: got %q want %q", when, got, want)
+		}
+	}
+
+	if err := pull(false); err != nil {
+		t.Fatalf("pull revision: %v", err)
+	}
+	expectPulled("pull revision")
+
+	if err := ioutil.WriteFile(dest, []byte("local edits"), 0644); err != nil {
+		t.Fatalf("writeFile: %v", err)
+	}
+	if err := pull(false); err == nil {
+		t.Errorf("pull revision overwrote %s without force", dest)
+	}
+	if err := pull(true); err != nil {
+		t.Fatalf("pull revision with force: %v", err)
+	}
+	expectPulled("pull revision with force")
+}
+
+func TestRevisionsOfFolders(t *testing.T) {
+	mb, context := memoryTestPush(t, map[string]string{"docs/report.txt": "first draft"})
+	defer os.RemoveAll(context.AbsPath)
+
+	opts := memoryTestOptions("/docs")
+	opts.Revision = "1"
+	g := NewWithBackend(context, opts, mb)
+
+	errs := map[string]error{
+		"revisions": g.Revisions(),
+		"restore":   g.RestoreRevision(),
+		"pull":      g.PullRevision(false),
+	}
+	for name, err := range errs {
+		if err == nil {
+			t.Errorf("%s of a folder succeeded", name)
+		}
+	}
+}
@@ -0,0 +1,824 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	s3Namespace       = "http://s3.amazonaws.com/doc/2006-03-01/"
+	s3TimeFormat      = "2006-01-02T15:04:05.000Z"
+	s3DefaultMaxKeys  = 1000
+	s3MaxPartNumber   = 10000
+	s3EmptyContentMd5 = "d41d8cd98f00b204e9800998ecf8427e"
+)
+
+// S3CredentialsFromRC reads the access key=secret key pairs
+// that S3 requests can be signed with from the .driverc.
+func S3CredentialsFromRC(rcSourcePath string) (map[string]string, error) {
+	opts := Options{Path: rcSourcePath}
+	rcPath, err := opts.rcPath()
+	if err != nil {
+		if NotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	nsRCMap, err := kvifyCommentedFile(rcPath, CommentStr)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := make(map[string]string)
+	for accessKey, secretKey := range nsRCMap[S3CredentialsKey] {
+		credentials[strings.TrimSpace(accessKey)] = secretKey
+	}
+	return credentials, nil
+}
+
+// s3Error is an error as S3 clients understand it.
+type s3Error struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *s3Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.code, e.message)
+}
+
+var (
+	errS3AccessDenied          = &s3Error{http.StatusForbidden, "AccessDenied", "Access Denied"}
+	errS3BadDigest             = &s3Error{http.StatusBadRequest, "XAmzContentSHA256Mismatch", "The provided 'x-amz-content-sha256' header does not match what was computed"}
+	errS3IncompleteBody        = &s3Error{http.StatusBadRequest, "IncompleteBody", "The request body is malformed or shorter than expected"}
+	errS3InvalidBucketName     = &s3Error{http.StatusBadRequest, "InvalidBucketName", "The specified bucket is not valid"}
+	errS3InvalidAccessKeyId    = &s3Error{http.StatusForbidden, "InvalidAccessKeyId", "The access key Id you provided does not exist in our records"}
+	errS3InvalidPart           = &s3Error{http.StatusBadRequest, "InvalidPart", "One or more of the specified parts could not be found"}
+	errS3InvalidPartOrder      = &s3Error{http.StatusBadRequest, "InvalidPartOrder", "The list of parts was not in ascending order"}
+	errS3MalformedXML          = &s3Error{http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed"}
+	errS3MissingSecurityHeader = &s3Error{http.StatusBadRequest, "MissingSecurityHeader", "Your request is missing a required header"}
+	errS3NoSuchBucket          = &s3Error{http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist"}
+	errS3NoSuchKey             = &s3Error{http.StatusNotFound, "NoSuchKey", "The specified key does not exist"}
+	errS3NoSuchUpload          = &s3Error{http.StatusNotFound, "NoSuchUpload", "The specified multipart upload does not exist"}
+	errS3NotImplemented        = &s3Error{http.StatusNotImplemented, "NotImplemented", "A header or operation you provided implies functionality that is not implemented"}
+	errS3RequestTimeTooSkewed  = &s3Error{http.StatusForbidden, "RequestTimeTooSkewed", "The difference between the request time and the server's time is too large"}
+	errS3SignatureDoesNotMatch = &s3Error{http.StatusForbidden, "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided"}
+	errS3ExpiredRequest        = &s3Error{http.StatusForbidden, "AccessDenied", "Request has expired"}
+	errS3NotAFolder            = &s3Error{http.StatusConflict, "InvalidRequest", "A parent of the key is a file"}
+)
+
+func s3InvalidArgument(message string) *s3Error {
+	return &s3Error{http.StatusBadRequest, "InvalidArgument", message}
+}
+
+// s3UploadExpiry is how long a multipart upload is kept after it was
+// created, abandoned uploads would otherwise hold onto their parts.
+var s3UploadExpiry = 24 * time.Hour
+
+// s3Server is an S3 gateway over the remote tree under the root of fs,
+// each folder at the top is a bucket and the path of each file within
+// it is its key. Requests have to be signed with SigV4 by one of the
+// credentials.
+type s3Server struct {
+	fs          *davFileSystem
+	credentials map[string]string
+
+	sync.Mutex
+	uploads map[string]*s3Upload
+}
+
+// s3Upload is a multipart upload whose parts are spooled in dir until completed.
+type s3Upload struct {
+	bucket  string
+	key     string
+	dir     string
+	created time.Time
+	// parts maps the number of each part uploaded to its md5 checksum.
+	parts map[int]string
+}
+
+// s3Handler serves the remote tree under root as S3.
+func (g *Commands) s3Handler(root string, credentials map[string]string) (http.Handler, error) {
+	if len(credentials) < 1 {
+		return nil, invalidArgumentsErr(fmt.Errorf("serve %s: no credentials, add access key=secret key pairs to the [%s] section of your .driverc", ServeProtocolS3, S3CredentialsKey))
+	}
+
+	dir, err := g.rem.FindByPath(root)
+	if err != nil {
+		return nil, err
+	}
+	if !dir.IsDir {
+		return nil, invalidArgumentsErr(fmt.Errorf("serve: %q is not a folder", root))
+	}
+
+	g.serveSetup()
+
+	return &s3Server{
+		fs:          &davFileSystem{g: g, root: root},
+		credentials: credentials,
+		uploads:     make(map[string]*s3Upload),
+	}, nil
+}
+
+func (s *s3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := s.serve(w, r); err != nil {
+		s.writeError(w, r, err)
+	}
+}
+
+func (s *s3Server) serve(w http.ResponseWriter, r *http.Request) error {
+	sig, err := s.authenticate(r)
+	if err != nil {
+		return err
+	}
+
+	bucket, key := s3BucketAndKey(r.URL.Path)
+	query := r.URL.Query()
+
+	if bucket == "." || bucket == ".." {
+		return errS3InvalidBucketName
+	}
+	if key != "" {
+		if _, err := s3Name(bucket, key); err != nil {
+			return err
+		}
+	}
+
+	if bucket == "" {
+		if r.Method != "GET" {
+			return errS3NotImplemented
+		}
+		return s.listBuckets(w)
+	}
+
+	if _, err := s.fs.resolveDir("/" + bucket); err != nil {
+		if os.IsNotExist(err) {
+			return errS3NoSuchBucket
+		}
+		return err
+	}
+
+	uploadId := query.Get("uploadId")
+	_, initiatesUpload := query["uploads"]
+
+	switch {
+	case key == "" && r.Method == "GET":
+		return s.listObjects(w, bucket, query)
+	case key == "" && r.Method == "HEAD":
+		return nil
+	case key == "":
+		return errS3NotImplemented
+
+	case r.Method == "GET", r.Method == "HEAD":
+		return s.getObject(w, r, bucket, key)
+	case r.Method == "PUT" && uploadId != "":
+		return s.uploadPart(w, r, sig, bucket, key, uploadId)
+	case r.Method == "PUT" && r.Header.Get("X-Amz-Copy-Source") != "":
+		return errS3NotImplemented
+	case r.Method == "PUT":
+		return s.putObject(w, r, sig, bucket, key)
+	case r.Method == "POST" && initiatesUpload:
+		return s.createMultipartUpload(w, bucket, key)
+	case r.Method == "POST" && uploadId != "":
+		return s.completeMultipartUpload(w, r, sig, bucket, key, uploadId)
+	case r.Method == "DELETE" && uploadId != "":
+		return s.abortMultipartUpload(w, bucket, key, uploadId)
+	case r.Method == "DELETE":
+		return s.deleteObject(w, bucket, key)
+	}
+	return errS3NotImplemented
+}
+
+// s3BucketAndKey splits a path style request path into its bucket and key.
+func s3BucketAndKey(p string) (bucket, key string) {
+	p = strings.TrimPrefix(p, "/")
+	if i := strings.Index(p, "/"); i >= 0 {
+		return p[:i], p[i+1:]
+	}
+	return p, ""
+}
+
+// s3Name is the name that key of bucket has in the served tree. Keys that
+// would name something outside of the bucket e.g "../other/key" are refused.
+func s3Name(bucket, key string) (string, error) {
+	bucketName := "/" + bucket
+	name := path.Clean(bucketName + "/" + key)
+	if name != bucketName && !strings.HasPrefix(name, bucketName+"/") {
+		return "", s3InvalidArgument(fmt.Sprintf("%q is not a key within bucket %q", key, bucket))
+	}
+	return name, nil
+}
+
+func (s *s3Server) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	s3Err, ok := err.(*s3Error)
+	switch {
+	case ok:
+	case os.IsNotExist(err):
+		s3Err = errS3NoSuchKey
+	case os.IsPermission(err):
+		s3Err = errS3AccessDenied
+	case os.IsExist(err):
+		s3Err = errS3NotAFolder
+	default:
+		s.fs.g.log.LogErrf("%s %s: %v\n", r.Method, r.URL.Path, err)
+		s3Err = &s3Error{http.StatusInternalServerError, "InternalError", err.Error()}
+	}
+
+	if r.Method == "HEAD" {
+		w.WriteHeader(s3Err.status)
+		return
+	}
+	writeXML(w, s3Err.status, &struct {
+		XMLName  xml.Name `xml:"Error"`
+		Code     string
+		Message  string
+		Resource string
+	}{Code: s3Err.code, Message: s3Err.message, Resource: r.URL.Path})
+}
+
+func writeXML(w http.ResponseWriter, status int, v interface{}) error {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(v)
+}
+
+func s3ETag(md5Checksum string) string {
+	return fmt.Sprintf("%q", md5Checksum)
+}
+
+type s3Bucket struct {
+	Name         string
+	CreationDate string
+}
+
+func (s *s3Server) listBuckets(w http.ResponseWriter) error {
+	root, err := s.fs.resolveDir("/")
+	if err != nil {
+		return err
+	}
+	children, err := s.fs.children(root)
+	if err != nil {
+		return err
+	}
+
+	var buckets []s3Bucket
+	for _, child := range children {
+		if child.IsDir() {
+			buckets = append(buckets, s3Bucket{Name: child.Name(), CreationDate: child.ModTime().UTC().Format(s3TimeFormat)})
+		}
+	}
+
+	return writeXML(w, http.StatusOK, &struct {
+		XMLName xml.Name   `xml:"ListAllMyBucketsResult"`
+		Xmlns   string     `xml:"xmlns,attr"`
+		Buckets []s3Bucket `xml:"Buckets>Bucket"`
+	}{Xmlns: s3Namespace, Buckets: buckets})
+}
+
+type s3Object struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int64
+	StorageClass string
+}
+
+type s3CommonPrefix struct {
+	Prefix string
+}
+
+// s3Listed is an object or, when object is nil, a common prefix.
+type s3Listed struct {
+	key    string
+	object *s3Object
+}
+
+// walk lists the keys under the folder dir, whose own key is dirKey, that start with
+// prefix. Folders are left whole as common prefixes if delimiter is "/" otherwise
+// they are walked into, any other delimiter is only applied once all keys are known.
+func (s *s3Server) walk(dir *File, dirKey, prefix, delimiter string, listed *[]*s3Listed) error {
+	children, err := s.fs.children(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, child := range children {
+		key := dirKey + child.Name()
+		if !child.IsDir() {
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+			e := child.(*davEntry)
+			object := &s3Object{
+				Key:          key,
+				LastModified: e.ModTime().UTC().Format(s3TimeFormat),
+				Size:         e.Size(),
+				StorageClass: "STANDARD",
+			}
+			if e.f.Md5Checksum != "" {
+				object.ETag = s3ETag(e.f.Md5Checksum)
+			}
+			*listed = append(*listed, &s3Listed{key: key, object: object})
+			continue
+		}
+
+		key += "/"
+		switch {
+		case delimiter == "/" && strings.HasPrefix(key, prefix) && key != prefix:
+			*listed = append(*listed, &s3Listed{key: key})
+		case strings.HasPrefix(key, prefix), strings.HasPrefix(prefix, key):
+			if err := s.walk(child.(*davEntry).f, key, prefix, delimiter, listed); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *s3Server) listObjects(w http.ResponseWriter, bucket string, query url.Values) error {
+	prefix, delimiter := query.Get("prefix"), query.Get("delimiter")
+	urlEncoded := query.Get("encoding-type") == "url"
+
+	maxKeys := s3DefaultMaxKeys
+	if v := query.Get("max-keys"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return s3InvalidArgument("max-keys must be a non-negative integer")
+		}
+		if n < maxKeys {
+			maxKeys = n
+		}
+	}
+
+	// Marker is what version 1 of the listing calls StartAfter.
+	after := query.Get("start-after")
+	if after == "" {
+		after = query.Get("marker")
+	}
+	token := query.Get("continuation-token")
+	if token != "" {
+		decoded, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return s3InvalidArgument("The continuation token provided is incorrect")
+		}
+		after = string(decoded)
+	}
+
+	// Only the folder that the prefix is within needs to be walked.
+	dirKey := prefix[:strings.LastIndex(prefix, "/")+1]
+	dirName, err := s3Name(bucket, dirKey)
+	if err != nil {
+		return err
+	}
+	var listed []*s3Listed
+	if dir, err := s.fs.resolveDir(dirName); err == nil {
+		if err := s.walk(dir, dirKey, prefix, delimiter, &listed); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if delimiter != "" && delimiter != "/" {
+		listed = s3GroupByDelimiter(listed, prefix, delimiter)
+	}
+	sort.Slice(listed, func(i, j int) bool {
+		return listed[i].key < listed[j].key
+	})
+
+	encode := func(s string) string {
+		if urlEncoded {
+			return s3URIEncode(s, false)
+		}
+		return s
+	}
+
+	result := &s3ListBucketResult{
+		Xmlns:             s3Namespace,
+		Name:              bucket,
+		Prefix:            encode(prefix),
+		Delimiter:         encode(delimiter),
+		StartAfter:        encode(query.Get("start-after")),
+		Marker:            query.Get("marker"),
+		ContinuationToken: token,
+		MaxKeys:           maxKeys,
+	}
+	if urlEncoded {
+		result.EncodingType = "url"
+	}
+
+	for _, l := range listed {
+		if l.key <= after {
+			continue
+		}
+		if result.KeyCount == maxKeys {
+			result.IsTruncated = true
+			break
+		}
+		result.KeyCount++
+		if l.object == nil {
+			result.CommonPrefixes = append(result.CommonPrefixes, s3CommonPrefix{Prefix: encode(l.key)})
+		} else {
+			l.object.Key = encode(l.object.Key)
+			result.Contents = append(result.Contents, l.object)
+		}
+		after = l.key
+	}
+	if result.IsTruncated {
+		result.NextContinuationToken = base64.StdEncoding.EncodeToString([]byte(after))
+		result.NextMarker = encode(after)
+	}
+
+	return writeXML(w, http.StatusOK, result)
+}
+
+// s3GroupByDelimiter rolls the keys that have delimiter after
+// prefix up into a common prefix that ends at the delimiter.
+func s3GroupByDelimiter(listed []*s3Listed, prefix, delimiter string) (grouped []*s3Listed) {
+	seen := make(map[string]bool)
+	for _, l := range listed {
+		i := strings.Index(l.key[len(prefix):], delimiter)
+		if i < 0 {
+			grouped = append(grouped, l)
+			continue
+		}
+		common := l.key[:len(prefix)+i+len(delimiter)]
+		if !seen[common] {
+			seen[common] = true
+			grouped = append(grouped, &s3Listed{key: common})
+		}
+	}
+	return grouped
+}
+
+type s3ListBucketResult struct {
+	XMLName               xml.Name `xml:"ListBucketResult"`
+	Xmlns                 string   `xml:"xmlns,attr"`
+	Name                  string
+	Prefix                string
+	Delimiter             string `xml:",omitempty"`
+	EncodingType          string `xml:",omitempty"`
+	StartAfter            string `xml:",omitempty"`
+	Marker                string `xml:",omitempty"`
+	NextMarker            string `xml:",omitempty"`
+	ContinuationToken     string `xml:",omitempty"`
+	NextContinuationToken string `xml:",omitempty"`
+	MaxKeys               int
+	KeyCount              int
+	IsTruncated           bool
+	Contents              []*s3Object
+	CommonPrefixes        []s3CommonPrefix
+}
+
+func (s *s3Server) getObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	name, err := s3Name(bucket, key)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(key, "/") {
+		return errS3NoSuchKey
+	}
+	e, err := s.fs.resolve(name)
+	if err != nil {
+		return err
+	}
+	if e.IsDir() {
+		return errS3NoSuchKey
+	}
+
+	f, err := s.fs.OpenFile(r.Context(), name, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	contentType, _ := e.ContentType(r.Context())
+	w.Header().Set("Content-Type", contentType)
+	if etag, err := e.ETag(r.Context()); err == nil {
+		w.Header().Set("ETag", etag)
+	}
+	w.Header().Set("Accept-Ranges", "bytes")
+
+	http.ServeContent(w, r, e.Name(), e.ModTime(), f)
+	return nil
+}
+
+// spool writes the payload of r to a temporary file in dir and
+// returns its path and md5 checksum, removing it if that fails.
+func (s *s3Server) spool(r *http.Request, sig *s3Signature, dir string) (p, md5Checksum string, err error) {
+	spooled, err := ioutil.TempFile(dir, "drive-s3")
+	if err != nil {
+		return "", "", err
+	}
+	defer func() {
+		spooled.Close()
+		if err != nil {
+			os.Remove(spooled.Name())
+		}
+	}()
+
+	digest := md5.New()
+	if _, err = io.Copy(io.MultiWriter(spooled, digest), s3Payload(r, sig)); err != nil {
+		return "", "", err
+	}
+	return spooled.Name(), hex.EncodeToString(digest.Sum(nil)), nil
+}
+
+func (s *s3Server) putObject(w http.ResponseWriter, r *http.Request, sig *s3Signature, bucket, key string) error {
+	name, err := s3Name(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	// Keys ending with a "/" stand for folders.
+	if strings.HasSuffix(key, "/") {
+		if _, err := io.Copy(ioutil.Discard, s3Payload(r, sig)); err != nil {
+			return err
+		}
+		if err := s.fs.mkdirAll(name); err != nil {
+			return err
+		}
+		w.Header().Set("ETag", s3ETag(s3EmptyContentMd5))
+		return nil
+	}
+
+	spooled, md5Checksum, err := s.spool(r, sig, "")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(spooled)
+
+	if err := s.fs.mkdirAll(path.Dir(name)); err != nil {
+		return err
+	}
+	if err := s.fs.upload(name, spooled); err != nil {
+		return err
+	}
+
+	w.Header().Set("ETag", s3ETag(md5Checksum))
+	return nil
+}
+
+func (s *s3Server) deleteObject(w http.ResponseWriter, bucket, key string) error {
+	name, err := s3Name(bucket, key)
+	if err != nil {
+		return err
+	}
+	e, err := s.fs.resolve(name)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// Deleting what doesn't exist succeeds, as does deleting a folder
+	// with its key while it holds other keys though the folder remains.
+	if err == nil && e.IsDir() == strings.HasSuffix(key, "/") {
+		empty := true
+		if e.IsDir() {
+			children, err := s.fs.children(e.f)
+			if err != nil {
+				return err
+			}
+			empty = len(children) < 1
+		}
+		if empty {
+			if err := s.fs.RemoveAll(context.Background(), name); err != nil {
+				return err
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *s3Server) createMultipartUpload(w http.ResponseWriter, bucket, key string) error {
+	s.expireUploads()
+
+	dir, err := ioutil.TempDir("", "drive-s3-upload")
+	if err != nil {
+		return err
+	}
+
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+	uploadId := hex.EncodeToString(idBytes)
+
+	s.Lock()
+	s.uploads[uploadId] = &s3Upload{bucket: bucket, key: key, dir: dir, created: time.Now(), parts: make(map[int]string)}
+	s.Unlock()
+
+	return writeXML(w, http.StatusOK, &struct {
+		XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+		Xmlns    string   `xml:"xmlns,attr"`
+		Bucket   string
+		Key      string
+		UploadId string
+	}{Xmlns: s3Namespace, Bucket: bucket, Key: key, UploadId: uploadId})
+}
+
+func (s *s3Server) upload(bucket, key, uploadId string) (*s3Upload, error) {
+	s.expireUploads()
+
+	s.Lock()
+	defer s.Unlock()
+
+	upload, ok := s.uploads[uploadId]
+	if !ok || upload.bucket != bucket || upload.key != key {
+		return nil, errS3NoSuchUpload
+	}
+	return upload, nil
+}
+
+func (s *s3Server) uploadPart(w http.ResponseWriter, r *http.Request, sig *s3Signature, bucket, key, uploadId string) error {
+	partNumber, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil || partNumber < 1 || partNumber > s3MaxPartNumber {
+		return s3InvalidArgument(fmt.Sprintf("Part number must be an integer between 1 and %d", s3MaxPartNumber))
+	}
+
+	upload, err := s.upload(bucket, key, uploadId)
+	if err != nil {
+		return err
+	}
+
+	spooled, md5Checksum, err := s.spool(r, sig, upload.dir)
+	if err != nil {
+		return err
+	}
+
+	partPath := filepath.Join(upload.dir, strconv.Itoa(partNumber))
+	if err := os.Rename(spooled, partPath); err != nil {
+		os.Remove(spooled)
+		return err
+	}
+
+	s.Lock()
+	upload.parts[partNumber] = md5Checksum
+	s.Unlock()
+
+	w.Header().Set("ETag", s3ETag(md5Checksum))
+	return nil
+}
+
+func (s *s3Server) completeMultipartUpload(w http.ResponseWriter, r *http.Request, sig *s3Signature, bucket, key, uploadId string) error {
+	upload, err := s.upload(bucket, key, uploadId)
+	if err != nil {
+		return err
+	}
+
+	var completed struct {
+		Parts []struct {
+			PartNumber int
+			ETag       string
+		} `xml:"Part"`
+	}
+	if err := xml.NewDecoder(s3Payload(r, sig)).Decode(&completed); err != nil {
+		if s3Err, ok := err.(*s3Error); ok {
+			return s3Err
+		}
+		return errS3MalformedXML
+	}
+	if len(completed.Parts) < 1 {
+		return errS3MalformedXML
+	}
+
+	joined, err := ioutil.TempFile("", "drive-s3")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(joined.Name())
+	defer joined.Close()
+
+	// The ETag of a multipart upload is the md5 checksum
+	// of the checksums of its parts followed by their count.
+	digests := md5.New()
+	prev := 0
+	for _, part := range completed.Parts {
+		if part.PartNumber <= prev {
+			return errS3InvalidPartOrder
+		}
+		prev = part.PartNumber
+
+		s.Lock()
+		md5Checksum, ok := upload.parts[part.PartNumber]
+		s.Unlock()
+		if !ok || strings.Trim(part.ETag, "\"") != md5Checksum {
+			return errS3InvalidPart
+		}
+		if err := appendFile(joined, filepath.Join(upload.dir, strconv.Itoa(part.PartNumber))); err != nil {
+			return err
+		}
+		rawChecksum, _ := hex.DecodeString(md5Checksum)
+		digests.Write(rawChecksum)
+	}
+	if err := joined.Close(); err != nil {
+		return err
+	}
+
+	name, err := s3Name(bucket, key)
+	if err != nil {
+		return err
+	}
+	if err := s.fs.mkdirAll(path.Dir(name)); err != nil {
+		return err
+	}
+	if err := s.fs.upload(name, joined.Name()); err != nil {
+		return err
+	}
+	s.discardUpload(uploadId)
+
+	etag := fmt.Sprintf("\"%s-%d\"", hex.EncodeToString(digests.Sum(nil)), len(completed.Parts))
+	return writeXML(w, http.StatusOK, &struct {
+		XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+		Xmlns    string   `xml:"xmlns,attr"`
+		Location string
+		Bucket   string
+		Key      string
+		ETag     string
+	}{Xmlns: s3Namespace, Location: "/" + bucket + "/" + key, Bucket: bucket, Key: key, ETag: etag})
+}
+
+func appendFile(dst io.Writer, p string) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(dst, f)
+	return err
+}
+
+func (s *s3Server) abortMultipartUpload(w http.ResponseWriter, bucket, key, uploadId string) error {
+	if _, err := s.upload(bucket, key, uploadId); err != nil {
+		return err
+	}
+	s.discardUpload(uploadId)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *s3Server) discardUpload(uploadId string) {
+	s.Lock()
+	upload, ok := s.uploads[uploadId]
+	delete(s.uploads, uploadId)
+	s.Unlock()
+
+	if ok {
+		os.RemoveAll(upload.dir)
+	}
+}
+
+// expireUploads discards the uploads created longer than s3UploadExpiry ago.
+func (s *s3Server) expireUploads() {
+	var expired []*s3Upload
+	s.Lock()
+	for uploadId, upload := range s.uploads {
+		if time.Since(upload.created) > s3UploadExpiry {
+			expired = append(expired, upload)
+			delete(s.uploads, uploadId)
+		}
+	}
+	s.Unlock()
+
+	for _, upload := range expired {
+		os.RemoveAll(upload.dir)
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// querySearch returns the query that the files to act upon must match.
+func (g *Commands) querySearch() (queryNode, error) {
+	if g.opts.Meta == nil {
+		return nil, nil
+	}
+	queries := NonEmptyTrimmedStrings((*g.opts.Meta)[QueryKey]...)
+	if len(queries) < 1 {
+		return nil, nil
+	}
+	return parseQuery(strings.Join(queries, " and "))
+}
+
+// searchedMatches searches through all folders for the files that have the
+// properties of -property and match -query, and returns those that lie
+// within g.opts.Sources keyed by their paths. searched is false if
+// neither -property nor -query were passed.
+func (g *Commands) searchedMatches(inTrash bool) (matches []*keyValue, searched bool, err error) {
+	pqs, err := g.propertySearches()
+	if err != nil {
+		return nil, false, err
+	}
+	query, err := g.querySearch()
+	if err != nil {
+		return nil, false, err
+	}
+	if len(pqs) < 1 && query == nil {
+		return nil, false, nil
+	}
+
+	remote, local := splitQuery(query)
+	mq := &matchQuery{
+		dirPath:          "/",
+		inTrash:          inTrash,
+		anywhere:         true,
+		propertySearches: pqs,
+		query:            remote,
+	}
+
+	pagePair := g.rem.FindMatches(mq)
+	errsChan := pagePair.errsChan
+	matchesChan := pagePair.filesChan
+
+	working := true
+	for working {
+		select {
+		case err := <-errsChan:
+			if err != nil {
+				return matches, true, err
+			}
+		case match, stillHasContent := <-matchesChan:
+			if !stillHasContent {
+				working = false
+				break
+			}
+			if match == nil || isHidden(match.Name, g.opts.Hidden) {
+				continue
+			}
+
+			backPaths, _ := g.rem.FindBackPaths(match.Id)
+			for _, p := range backPaths {
+				relToRoot := remotePathJoin(p)
+				if !g.withinSources(relToRoot) {
+					continue
+				}
+				if local != nil && !local.matches(match, relToRoot) {
+					continue
+				}
+				matches = append(matches, &keyValue{key: relToRoot, value: match})
+			}
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].key < matches[j].key
+	})
+	return matches, true, nil
+}
+
+func (g *Commands) withinSources(relToRoot string) bool {
+	for _, src := range g.opts.Sources {
+		if rootLike(src) || relToRoot == src || strings.HasPrefix(relToRoot, strings.TrimSuffix(src, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Commands) listSearched(matches []*keyValue) error {
+	spin := g.playabler()
+	spin.play()
+	defer spin.stop()
+
+	for _, kv := range matches {
+		travSt := traversalSt{
+			depth:    g.opts.Depth,
+			file:     kv.value.(*File),
+			headPath: path.Dir(kv.key),
+			inTrash:  g.opts.InTrash,
+			mask:     g.opts.TypeMask,
+			sorters:  sorters(g.opts),
+		}
+
+		if !g.breadthFirst(travSt, spin) {
+			break
+		}
+	}
+
+	if len(matches) < 1 {
+		g.log.LogErrln("no matches found!")
+	}
+	return nil
+}
+
+func (g *Commands) pullSearched(matches []*keyValue) (cl, clashes []*Change, err error) {
+	for _, kv := range matches {
+		relToRoot := kv.key
+		fsPath := g.context.AbsPathOf(relToRoot)
+
+		ccl, cclashes, cErr := g.byRemoteResolve(relToRoot, fsPath, kv.value.(*File), false)
+		if cErr != nil {
+			if cErr != ErrClashesDetected {
+				return cl, clashes, cErr
+			}
+			clashes = append(clashes, cclashes...)
+		}
+
+		cl = append(cl, ccl...)
+	}
+	return cl, clashes, nil
+}
+
+func (g *Commands) trashSearched(matches []*keyValue, opt *trashOpt) error {
+	var cl []*Change
+	for _, kv := range matches {
+		if rootLike(kv.key) {
+			continue
+		}
+
+		ch := &Change{Path: kv.key, g: g}
+		if opt.toTrash {
+			ch.Dest = kv.value.(*File)
+		} else {
+			ch.Src = kv.value.(*File)
+		}
+		cl = append(cl, ch)
+	}
+
+	return g.confirmAndPlayTrashChangeList(cl, opt)
+}
+
+func (g *Commands) touchSearched(matches []*keyValue, touchModTime *time.Time) error {
+	throttle := time.Tick(1e9 / 10)
+	chanMap := map[int]chan *keyValue{}
+
+	for i, kv := range matches {
+		chanMap[i] = g.touch(kv.key, kv.value.(*File).Id, g.opts.Depth, touchModTime)
+		<-throttle
+	}
+
+	if len(matches) < 1 {
+		g.log.LogErrln("no matches found!")
+	}
+
+	multiplexOnChanMapResults(g, chanMap)
+	return nil
+}
@@ -0,0 +1,185 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	ServeProtocolWebDAV = "webdav"
+	ServeProtocolS3     = "s3"
+	ServeProtocolAPI    = "api"
+)
+
+const DefaultServeAddress = "127.0.0.1:8080"
+
+type ServeOptions struct {
+	// Protocol is what the remote tree is served over e.g ServeProtocolWebDAV.
+	Protocol string
+	// Addr is the host:port to listen on.
+	Addr string
+	// Socket when set is the path of a Unix socket
+	// to listen on instead of Addr.
+	Socket string
+	// S3Credentials maps the access keys that S3 requests
+	// can be signed with to their secret keys.
+	S3Credentials map[string]string
+}
+
+// Serve serves the remote tree under the first source, or the
+// root if none was given, over the requested protocol until
+// the server fails.
+func (g *Commands) Serve(so *ServeOptions) error {
+	if so == nil {
+		so = &ServeOptions{}
+	}
+	addr := so.Addr
+	if addr == "" {
+		addr = DefaultServeAddress
+	}
+
+	root := "/"
+	if len(g.opts.Sources) >= 1 {
+		root = g.opts.Sources[0]
+	}
+
+	// WebDAV and the API let in anyone who can reach them, to read and write
+	// as the user, so only those on this machine should be able to.
+	localOnly := so.Protocol == ServeProtocolWebDAV || so.Protocol == ServeProtocolAPI
+	if localOnly && so.Socket == "" && !loopbackAddr(addr) {
+		return invalidArgumentsErr(fmt.Errorf("serve: %s only listens on loopback addresses or a socket, not %q", so.Protocol, addr))
+	}
+
+	var handler http.Handler
+	var err error
+
+	switch so.Protocol {
+	case ServeProtocolWebDAV:
+		handler, err = g.webDAVHandler(root)
+	case ServeProtocolS3:
+		handler, err = g.s3Handler(root, so.S3Credentials)
+	case ServeProtocolAPI:
+		token, tErr := newAPIToken()
+		if tErr != nil {
+			return tErr
+		}
+		if handler, err = g.apiHandler(token); err == nil {
+			defer g.context.ReleaseDB()
+			// The token is printed even when quiet, clients can't do without it.
+			g.log.LogErrf("api token: %s\n", token)
+		}
+	default:
+		err = invalidArgumentsErr(fmt.Errorf("serve: unknown protocol %q, expecting %s, %s or %s", so.Protocol, ServeProtocolWebDAV, ServeProtocolS3, ServeProtocolAPI))
+	}
+	if err != nil {
+		return err
+	}
+	if localOnly {
+		// Over a socket, the Host is whatever the client made up.
+		handler = localRequestsOnly(handler, so.Socket == "")
+	}
+
+	if so.Socket == "" {
+		g.log.Logf("serving %q over %s on http://%s\n", root, so.Protocol, addr)
+		return http.ListenAndServe(addr, handler)
+	}
+
+	// A socket left behind by a previous run would fail the listen.
+	if info, err := os.Lstat(so.Socket); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(so.Socket)
+	}
+	listener, err := net.Listen("unix", so.Socket)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	if err := os.Chmod(so.Socket, 0600); err != nil {
+		return err
+	}
+
+	g.log.Logf("serving %q over %s on %s\n", root, so.Protocol, so.Socket)
+	return http.Serve(listener, handler)
+}
+
+func loopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	return loopbackHost(host)
+}
+
+func loopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// localRequestsOnly refuses the requests that a web page could get a browser
+// to send to a local server: any from another origin and, if checkHost is
+// set, those for a host name that isn't loopback, as after DNS rebinding.
+func localRequestsOnly(handler http.Handler, checkHost bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Origin") != "" {
+			http.Error(w, "cross origin requests are refused", http.StatusForbidden)
+			return
+		}
+		if checkHost {
+			host := r.Host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			} else {
+				host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+			}
+			if !loopbackHost(host) {
+				http.Error(w, fmt.Sprintf("only loopback hosts are served, not %q", r.Host), http.StatusForbidden)
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// newAPIToken returns a random token for the API's clients to present.
+func newAPIToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// serveSetup readies the backend for serving: uploads and downloads
+// go through the configured crypto and their progress is discarded
+// since nobody is around to watch it.
+func (g *Commands) serveSetup() {
+	g.rem.setCrypto(g.opts.Encrypter, g.opts.Decrypter)
+
+	progress := g.progressChan
+	go func() {
+		for range progress {
+		}
+	}()
+}
@@ -40,6 +40,9 @@ const (
 	Reader
 	Writer
 	Commenter
+	// Organizer and FileOrganizer only apply to shared drives.
+	Organizer
+	FileOrganizer
 )
 
 const (
@@ -82,6 +85,10 @@ func (r *Role) String() string {
 		return "writer"
 	case Commenter:
 		return "commenter"
+	case Organizer:
+		return "organizer"
+	case FileOrganizer:
+		return "fileOrganizer"
 	}
 	return "unknown"
 }
@@ -110,9 +117,9 @@ func unknownAccountType(a string) bool {
 
 func stringToRole() func(string) Role {
 	roleMap := make(map[string]Role)
-	roles := []Role{UnknownRole, Owner, Reader, Writer, Commenter}
+	roles := []Role{UnknownRole, Owner, Reader, Writer, Commenter, Organizer, FileOrganizer}
 	for _, role := range roles {
-		roleMap[role.String()] = role
+		roleMap[strings.ToLower(role.String())] = role
 	}
 	return func(s string) Role {
 		r, ok := roleMap[strings.ToLower(s)]
@@ -350,7 +357,7 @@ func (c *Commands) share(revoke, byId bool) (err error) {
 	if revoke {
 		// In case of unsharing, when a user doesn't specify the
 		// roles, the addressee should be removed from all roles
-		roles = append(roles, Reader, Writer, Commenter)
+		roles = append(roles, Reader, Writer, Commenter, Organizer, FileOrganizer)
 	} else {
 		roles = append(roles, Reader)
 	}
@@ -0,0 +1,155 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	drive "google.golang.org/api/drive/v2"
+)
+
+var sharedDrivesTableHeader = fmt.Sprintf("%*s %s", int(fileIdWidth), "DriveId", "Name")
+
+// RootId returns the id of the folder that paths are resolved relative to:
+// the shared drive that the context is rooted at or else "My Drive".
+func (r *Remote) RootId() string {
+	if r.sharedDriveId != "" {
+		return r.sharedDriveId
+	}
+	return "root"
+}
+
+// filesList returns a files listing scoped to the
+// shared drive that the context is rooted at, if any.
+func (r *Remote) filesList() *drive.FilesListCall {
+	req := r.service.Files.List().SupportsAllDrives(true)
+	if r.sharedDriveId == "" {
+		return req
+	}
+	return req.IncludeItemsFromAllDrives(true).Corpora("drive").DriveId(r.sharedDriveId)
+}
+
+// emptySharedDriveTrash permanently deletes the trashed content of the shared
+// drive. Shared drives don't have a per-user trash that Files.EmptyTrash clears
+// and only organizers are allowed to delete content.
+func (r *Remote) emptySharedDriveTrash() (err error) {
+	req := r.filesList().Q("trashed=true")
+
+	var ids []string
+	pagesErr := req.Pages(context.Background(), func(res *drive.FileList) error {
+		for _, f := range res.Items {
+			// Descendants of trashed folders go away with them.
+			if f.ExplicitlyTrashed {
+				ids = append(ids, f.Id)
+			}
+		}
+		return nil
+	})
+	if pagesErr != nil {
+		return pagesErr
+	}
+
+	for _, id := range ids {
+		if delErr := r.Delete(id); delErr != nil {
+			err = reComposeError(err, fmt.Sprintf("delete %s: %v", customQuote(id), delErr))
+		}
+	}
+	return err
+}
+
+func (r *Remote) SharedDrives() ([]*drive.Drive, error) {
+	var drives []*drive.Drive
+	err := r.service.Drives.List().Pages(context.Background(), func(res *drive.DriveList) error {
+		drives = append(drives, res.Items...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return drives, nil
+}
+
+// resolveSharedDrive finds the shared drive whose id or name is nameOrId.
+func resolveSharedDrive(b backend, nameOrId string) (*drive.Drive, error) {
+	drives, err := b.SharedDrives()
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []*drive.Drive
+	for _, d := range drives {
+		if d.Id == nameOrId {
+			return d, nil
+		}
+		if d.Name == nameOrId {
+			matches = append(matches, d)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, nonExistantRemoteErr(fmt.Errorf("no shared drive named or with id %s", customQuote(nameOrId)))
+	case 1:
+		return matches[0], nil
+	}
+
+	var ids []string
+	for _, d := range matches {
+		ids = append(ids, d.Id)
+	}
+	return nil, invalidArgumentsErr(fmt.Errorf("%d shared drives are named %s, pick one by id: %s",
+		len(matches), customQuote(nameOrId), strings.Join(ids, ", ")))
+}
+
+// InitSharedDrive roots the context at the shared drive whose name or id is
+// nameOrId. It has to be invoked after the context has acquired credentials.
+func (g *Commands) InitSharedDrive(nameOrId string) error {
+	rem, err := remoteForContext(g.context)
+	if err != nil {
+		return err
+	}
+
+	d, err := resolveSharedDrive(rem, nameOrId)
+	if err != nil {
+		return err
+	}
+
+	g.context.SharedDriveId = d.Id
+	if err := g.context.Write(); err != nil {
+		return err
+	}
+
+	g.log.Logf("Rooted at shared drive %s (%s)\n", customQuote(d.Name), d.Id)
+	return nil
+}
+
+func (g *Commands) ListSharedDrives() error {
+	drives, err := g.rem.SharedDrives()
+	if err != nil {
+		return err
+	}
+
+	if len(drives) < 1 {
+		return nil
+	}
+
+	g.log.Logln(sharedDrivesTableHeader)
+	for _, d := range drives {
+		g.log.Logf("%*s %s\n", int(fileIdWidth), customQuote(d.Id), customQuote(d.Name))
+	}
+	return nil
+}
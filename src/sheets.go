@@ -0,0 +1,107 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	sheets "google.golang.org/api/sheets/v4"
+)
+
+const DriveSpreadsheetMimeType = "application/vnd.google-apps.spreadsheet"
+
+// sheetTab is a tab of a Google Sheet, its gid
+// identifies it in the URLs that export the sheet.
+type sheetTab struct {
+	gid   int64
+	title string
+}
+
+// perSheetExts are the formats that only hold a single tab
+// of a spreadsheet, hence are exported once for every tab.
+var perSheetExts = map[string]bool{
+	"csv": true,
+	"tsv": true,
+}
+
+func exportedPerSheet(f *File, ext string) bool {
+	return f != nil && f.MimeType == DriveSpreadsheetMimeType && perSheetExts[ext]
+}
+
+// gidExportURL scopes the export URL of a spreadsheet to one of its tabs.
+func gidExportURL(exportURL string, gid int64) (string, error) {
+	u, err := url.Parse(exportURL)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	query.Set("gid", strconv.FormatInt(gid, 10))
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// sheetTabExports lists the exports of every tab of a spreadsheet
+// as ext, each saved in sheetDir and named after its tab.
+func sheetTabExports(sheetDir, mimeType, exportURL, ext string, tabs []*sheetTab) ([]*urlMimeTypeExt, error) {
+	var exportees []*urlMimeTypeExt
+	for _, tab := range tabs {
+		tabURL, err := gidExportURL(exportURL, tab.gid)
+		if err != nil {
+			return nil, err
+		}
+
+		// Titles can have slashes which would otherwise make up subdirectories.
+		name := strings.Replace(strings.TrimSpace(tab.title), "/", "_", -1)
+		if name == "" {
+			name = fmt.Sprintf("gid-%d", tab.gid)
+		}
+
+		exportees = append(exportees, &urlMimeTypeExt{
+			mimeType: mimeType,
+			url:      tabURL,
+			ext:      ext,
+			path:     sepJoin(".", path.Join(sheetDir, name), ext),
+		})
+	}
+	return exportees, nil
+}
+
+func (r *Remote) sheetTabs(spreadsheetId string) ([]*sheetTab, error) {
+	service, err := sheets.New(r.client)
+	if err != nil {
+		return nil, err
+	}
+	if r.baseURL != "" {
+		service.BasePath = strings.TrimSuffix(r.baseURL, "/") + "/"
+	}
+
+	spreadsheet, err := service.Spreadsheets.Get(spreadsheetId).Fields("sheets.properties(sheetId,title)").Do()
+	if err != nil {
+		return nil, err
+	}
+
+	var tabs []*sheetTab
+	for _, sheet := range spreadsheet.Sheets {
+		if sheet.Properties == nil {
+			continue
+		}
+		tabs = append(tabs, &sheetTab{gid: sheet.Properties.SheetId, title: sheet.Properties.Title})
+	}
+	return tabs, nil
+}
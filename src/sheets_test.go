@@ -0,0 +1,55 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"testing"
+)
+
+func TestSheetTabExports(t *testing.T) {
+	sheet := &File{MimeType: DriveSpreadsheetMimeType}
+	doc := &File{MimeType: "application/vnd.google-apps.document"}
+	if !exportedPerSheet(sheet, "csv") || !exportedPerSheet(sheet, "tsv") {
+		t.Errorf("csv and tsv exports of sheets should be per sheet")
+	}
+	if exportedPerSheet(sheet, "xlsx") || exportedPerSheet(doc, "csv") {
+		t.Errorf("only csv and tsv exports of sheets should be per sheet")
+	}
+
+	tabs := []*sheetTab{
+		{gid: 0, title: "Summary"},
+		{gid: 1234, title: "Q1/Q2"},
+		{gid: 99, title: " "},
+	}
+	exportURL := "https://docs.google.com/spreadsheets/export?id=abc&exportFormat=csv"
+	exportees, err := sheetTabExports("/x/budget_exports/budget", "text/csv", exportURL, "csv", tabs)
+	if err != nil {
+		t.Fatalf("sheetTabExports: %v", err)
+	}
+
+	want := []struct{ path, url string }{
+		{"/x/budget_exports/budget/Summary.csv", "https://docs.google.com/spreadsheets/export?exportFormat=csv&gid=0&id=abc"},
+		{"/x/budget_exports/budget/Q1_Q2.csv", "https://docs.google.com/spreadsheets/export?exportFormat=csv&gid=1234&id=abc"},
+		{"/x/budget_exports/budget/gid-99.csv", "https://docs.google.com/spreadsheets/export?exportFormat=csv&gid=99&id=abc"},
+	}
+	if len(exportees) != len(want) {
+		t.Fatalf("got %d exports want %d", len(exportees), len(want))
+	}
+	for i, w := range want {
+		if got := exportees[i]; got.path != w.path || got.url != w.url || got.ext != "csv" {
+			t.Errorf("#%d: got %q %q want %q %q", i, got.path, got.url, w.path, w.url)
+		}
+	}
+}
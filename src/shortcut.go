@@ -0,0 +1,204 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	drive "google.golang.org/api/drive/v2"
+)
+
+// ShortcutPolicy decides what a shortcut is pulled as.
+type ShortcutPolicy uint8
+
+const (
+	// ShortcutSymlink pulls shortcuts as symlinks to the local copies of their
+	// targets. Shortcuts to files outside of the drive become link files.
+	ShortcutSymlink ShortcutPolicy = iota
+	// ShortcutLink pulls shortcuts as link files that open their targets.
+	ShortcutLink
+	// ShortcutFollow pulls the content of the targets of shortcuts. Shortcuts
+	// to folders are pulled as they would be with ShortcutSymlink.
+	ShortcutFollow
+)
+
+func isShortcut(f *File) bool {
+	return f != nil && f.MimeType == DriveShortcutMimeType
+}
+
+func (r *Remote) insertShortcut(parentId, title, targetId string) (*File, error) {
+	f := &drive.File{
+		Title:           urlToPath(title, false),
+		MimeType:        DriveShortcutMimeType,
+		Parents:         []*drive.ParentReference{&drive.ParentReference{Id: parentId}},
+		ShortcutDetails: &drive.FileShortcutDetails{TargetId: targetId},
+	}
+	inserted, err := r.service.Files.Insert(f).SupportsAllDrives(true).Do()
+	if err != nil {
+		return nil, err
+	}
+	return NewRemoteFile(inserted), nil
+}
+
+// resolveShortcutTarget returns the target of the shortcut f together with its path
+// relative to the root, which is empty if the target can't be reached from the root
+// e.g if it was shared with us or is in the trash.
+func (g *Commands) resolveShortcutTarget(f *File) (target *File, relToRoot string, err error) {
+	target, err = g.rem.FindById(f.ShortcutTargetId)
+	if err != nil {
+		return nil, "", err
+	}
+	if target == nil {
+		return nil, "", nonExistantRemoteErr(fmt.Errorf("%s: shortcut target %s not found", f.Name, f.ShortcutTargetId))
+	}
+
+	backPaths, _ := g.rem.FindBackPaths(target.Id)
+	for _, p := range backPaths {
+		p = remotePathJoin(p)
+		// A path is only good if it leads back to the target, which
+		// isn't the case for trashed or parentless targets.
+		if found, fErr := g.rem.FindByPath(p); fErr == nil && found != nil && found.Id == target.Id {
+			return target, p, nil
+		}
+	}
+	return target, "", nil
+}
+
+// shortcutTargetPath returns the path of the target of the shortcut
+// f or its id if the target can't be reached from the root.
+func (g *Commands) shortcutTargetPath(f *File) string {
+	if _, relToRoot, err := g.resolveShortcutTarget(f); err == nil && relToRoot != "" {
+		return relToRoot
+	}
+	return f.ShortcutTargetId
+}
+
+// Shortcut creates a shortcut at g.opts.Sources[1] to the file at g.opts.Sources[0].
+// If the shortcut's path is an existing folder, the shortcut is created inside it.
+func (g *Commands) Shortcut(byId bool) error {
+	if len(g.opts.Sources) != 2 {
+		return invalidArgumentsErr(fmt.Errorf("shortcut: expecting <target> <linkpath> got: %v", g.opts.Sources))
+	}
+
+	targetPath, linkPath := g.opts.Sources[0], g.opts.Sources[1]
+
+	resolver := g.rem.FindByPath
+	if byId {
+		resolver = g.rem.FindById
+	}
+
+	target, err := resolver(targetPath)
+	if err != nil {
+		return err
+	}
+	if isShortcut(target) {
+		return invalidArgumentsErr(fmt.Errorf("%s: shortcuts to shortcuts are not allowed", targetPath))
+	}
+
+	existing, err := g.rem.FindByPath(linkPath)
+	if err != nil && err != ErrPathNotExists {
+		return err
+	}
+	if existing != nil && existing.IsDir {
+		linkPath = remotePathJoin(linkPath, target.Name)
+		existing, err = g.rem.FindByPath(linkPath)
+		if err != nil && err != ErrPathNotExists {
+			return err
+		}
+	}
+	if existing != nil {
+		return overwriteAttemptedErr(fmt.Errorf("%s already exists remotely", linkPath))
+	}
+
+	parentPath, name := g.pathSplitter(linkPath)
+	parent, err := g.rem.FindByPath(parentPath)
+	if err != nil {
+		return err
+	}
+
+	shortcut, err := g.rem.insertShortcut(parent.Id, name, target.Id)
+	if err != nil {
+		return err
+	}
+
+	g.log.Logf("%s %s -> %s\n", linkPath, shortcut.Id, targetPath)
+	return nil
+}
+
+// pullShortcut creates the local equivalent of the shortcut
+// change.Src according to g.opts.ShortcutPolicy.
+func (g *Commands) pullShortcut(change *Change, exports []string) error {
+	f := change.Src
+	destAbsPath := g.context.AbsPathOf(change.Path)
+
+	// Whatever an earlier pull created for the shortcut has to go,
+	// otherwise we could end up writing through a symlink.
+	if info, err := os.Lstat(destAbsPath); err == nil && !info.IsDir() {
+		if err := os.Remove(destAbsPath); err != nil {
+			return err
+		}
+	}
+
+	policy := g.opts.ShortcutPolicy
+
+	target, relToRoot, err := g.resolveShortcutTarget(f)
+	if err != nil {
+		if policy == ShortcutFollow {
+			return err
+		}
+		// The target might be gone or no longer shared with us
+		// yet a link file that opens it is still of use.
+		target = nil
+	}
+
+	if policy == ShortcutFollow && target != nil && !target.IsDir {
+		followed := DupFile(target)
+		followed.Name = f.Name
+
+		return g.download(&Change{Path: change.Path, Parent: change.Parent, Src: followed, g: g}, exports)
+	}
+
+	if policy != ShortcutLink && relToRoot != "" {
+		linkTo, err := filepath.Rel(filepath.Dir(destAbsPath), g.context.AbsPathOf(relToRoot))
+		if err == nil && os.Symlink(linkTo, destAbsPath) == nil {
+			return nil
+		}
+		// Symlinks aren't always supported, a link file will do.
+	}
+
+	urlMExt := &urlMimeTypeExt{
+		url:      fmt.Sprintf("%s/open?id=%s", DriveResourceEntryURL, f.ShortcutTargetId),
+		mimeType: f.ShortcutTargetMimeType,
+	}
+	if target != nil {
+		urlMExt.url = target.Url()
+		urlMExt.mimeType = target.MimeType
+	}
+
+	_, err = f.serializeAsDesktopEntry(destAbsPath, urlMExt)
+	return err
+}
+
+// chtimesNoFollow is os.Chtimes except that it leaves
+// symlinks, and therefore their targets, untouched.
+func chtimesNoFollow(p string, t time.Time) error {
+	if info, err := os.Lstat(p); err == nil && symlink(info.Mode()) {
+		return nil
+	}
+	return os.Chtimes(p, t, t)
+}
@@ -0,0 +1,123 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/odeke-em/drive/config"
+)
+
+func TestShortcuts(t *testing.T) {
+	mb := NewMemoryBackend()
+
+	context := memoryTestContext(t)
+	defer os.RemoveAll(context.AbsPath)
+
+	writeTestFiles(t, context.AbsPath, map[string]string{
+		"a/report.txt": "quarterly numbers",
+		"b/notes.txt":  "notes",
+	})
+	if err := NewWithBackend(context, memoryTestOptions("/"), mb).Push(); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	if err := NewWithBackend(context, memoryTestOptions("/a/report.txt", "/b"), mb).Shortcut(false); err != nil {
+		t.Fatalf("shortcut: %v", err)
+	}
+	if err := NewWithBackend(context, memoryTestOptions("/a/report.txt", "/b"), mb).Shortcut(false); err == nil {
+		t.Errorf("expected an error creating the shortcut twice")
+	}
+
+	target, err := mb.FindByPath("/a/report.txt")
+	if err != nil {
+		t.Fatalf("findByPath: %v", err)
+	}
+	shortcut, err := mb.FindByPath("/b/report.txt")
+	if err != nil {
+		t.Fatalf("findByPath: %v", err)
+	}
+	if !isShortcut(shortcut) || shortcut.ShortcutTargetId != target.Id {
+		t.Fatalf("shortcut: got %+v", shortcut)
+	}
+
+	g := NewWithBackend(context, memoryTestOptions("/"), mb)
+	if got := g.shortcutTargetPath(shortcut); got != "/a/report.txt" {
+		t.Errorf("shortcutTargetPath: got %q want %q", got, "/a/report.txt")
+	}
+
+	pulled := func(policy ShortcutPolicy) *config.Context {
+		pullContext := memoryTestContext(t)
+
+		opts := memoryTestOptions("/")
+		opts.ShortcutPolicy = policy
+		g := NewWithBackend(pullContext, opts, mb)
+		if err := g.Pull(); err != nil {
+			t.Fatalf("pull: %v", err)
+		}
+		// Pulling again should leave whatever the shortcut was pulled as alone.
+		if err := g.Pull(); err != nil {
+			t.Fatalf("pull again: %v", err)
+		}
+		return pullContext
+	}
+
+	symlinkContext := pulled(ShortcutSymlink)
+	defer os.RemoveAll(symlinkContext.AbsPath)
+	root := symlinkContext.AbsPath
+
+	linkPath := filepath.Join(root, "b", "report.txt")
+	linkTo, err := os.Readlink(linkPath)
+	if err != nil {
+		t.Fatalf("readlink: %v", err)
+	}
+	if want := filepath.Join("..", "a", "report.txt"); linkTo != want {
+		t.Errorf("symlink: got %q want %q", linkTo, want)
+	}
+
+	// Pushing shouldn't replace the shortcut with the content that its symlink resolves to.
+	if err := NewWithBackend(symlinkContext, memoryTestOptions("/"), mb).Push(); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	if shortcut, err = mb.FindByPath("/b/report.txt"); err != nil || !isShortcut(shortcut) {
+		t.Errorf("shortcut should have been left alone, got %+v err %v", shortcut, err)
+	}
+
+	root = pulled(ShortcutLink).AbsPath
+	defer os.RemoveAll(root)
+
+	blob, err := ioutil.ReadFile(filepath.Join(root, "b", "report.txt"))
+	if err != nil {
+		t.Fatalf("readFile: %v", err)
+	}
+	if !strings.HasPrefix(string(blob), "[Desktop Entry]") || !strings.Contains(string(blob), target.Id) {
+		t.Errorf("link file: got %q", blob)
+	}
+
+	root = pulled(ShortcutFollow).AbsPath
+	defer os.RemoveAll(root)
+
+	followedPath := filepath.Join(root, "b", "report.txt")
+	if info, err := os.Lstat(followedPath); err != nil || !info.Mode().IsRegular() {
+		t.Fatalf("followed shortcut should be a regular file: %v", err)
+	}
+	if blob, _ := ioutil.ReadFile(followedPath); string(blob) != "quarterly numbers" {
+		t.Errorf("followed content: got %q", blob)
+	}
+}
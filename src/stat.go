@@ -37,6 +37,8 @@ func (g *Commands) Stat() error {
 }
 
 func (g *Commands) statfn(fname string, fn func(string) (*File, error)) error {
+	defer g.endRecords()
+
 	var err error
 	for _, src := range g.opts.Sources {
 		f, fErr := fn(src)
@@ -128,17 +130,35 @@ func prettyFileStat(logf log.Loggerf, relToRootPath string, file *File) {
 		)
 	}
 
+	if file.shortcutTargetPath != "" {
+		kvList = append(kvList,
+			&keyValue{"ShortcutTarget", file.shortcutTargetPath},
+			&keyValue{"ShortcutTargetId", file.ShortcutTargetId},
+		)
+	}
+
+	for _, prop := range file.Properties {
+		kvList = append(kvList, &keyValue{"Property", fmt.Sprintf("%s=%s (%s)", prop.Key, prop.Value, strings.ToLower(prop.Visibility))})
+	}
+
 	for _, kv := range kvList {
 		logf("%-25s %-30v\n", kv.key, kv.value.(string))
 	}
 }
 
 func (g *Commands) stat(relToRootPath string, file *File, depth int) error {
-	if g.opts.Md5sum {
+	if g.opts.structuredOutput() {
+		if err := g.emitStat(relToRootPath, file); err != nil {
+			return err
+		}
+	} else if g.opts.Md5sum {
 		if file.Md5Checksum != "" {
 			g.log.Logf("%32s  %s\n", file.Md5Checksum, strings.TrimPrefix(relToRootPath, "/"))
 		}
 	} else {
+		if isShortcut(file) {
+			file.shortcutTargetPath = g.shortcutTargetPath(file)
+		}
 		prettyFileStat(g.log.Logf, relToRootPath, file)
 		perms, permErr := g.rem.listPermissions(file.Id)
 		if permErr != nil {
@@ -194,3 +214,29 @@ func (g *Commands) stat(relToRootPath string, file *File, depth int) error {
 
 	return nil
 }
+
+// emitStat emits file as a record, with its permissions unless
+// only its checksum was asked for, as md5sum skips folders.
+func (g *Commands) emitStat(relToRootPath string, file *File) error {
+	if g.opts.Md5sum {
+		if file.Md5Checksum != "" {
+			g.emitRecord(newFileRecord(remotePathJoin(relToRootPath), file))
+		}
+		return nil
+	}
+
+	if isShortcut(file) {
+		file.shortcutTargetPath = g.shortcutTargetPath(file)
+	}
+	perms, err := g.rem.listPermissions(file.Id)
+	if err != nil {
+		return err
+	}
+
+	fr := newFileRecord(remotePathJoin(relToRootPath), file)
+	for _, perm := range perms {
+		fr.Permissions = append(fr.Permissions, newPermissionRecord(perm))
+	}
+	g.emitRecord(fr)
+	return nil
+}
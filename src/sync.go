@@ -0,0 +1,324 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/odeke-em/drive/config"
+)
+
+const (
+	syncTargetLocal  = "local"
+	syncTargetRemote = "remote"
+)
+
+// Sync reconciles the local and remote copies of the sources in both
+// directions, using the index saved at the last push or pull of every
+// file as the common ancestor of both copies. Changes, including deletions,
+// made on only one side since then are applied to the other side while
+// paths that changed on both sides are conflicts. All the changes are
+// previewed together and applied in one run.
+func (g *Commands) Sync() error {
+	g.rem.setCrypto(g.opts.Encrypter, g.opts.Decrypter)
+
+	cl, clashes, err := g.syncResolve()
+
+	if len(clashes) >= 1 {
+		if !g.opts.FixClashes {
+			warnClashesPersist(g.log, clashes)
+			return ErrClashesDetected
+		}
+
+		fn := g.opts.clashesHandler()
+		if err := fn(g, clashes); err != nil {
+			return err
+		}
+		return clashesFixedErr(errors.New(MsgClashesFixedNowRetry))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	indicesByPath, err := g.context.IndicesByPath()
+	if err != nil {
+		return err
+	}
+
+	var changes, conflicts []*Change
+	for _, c := range cl {
+		decided, isConflict := g.syncDecision(c, indicesByPath)
+		switch {
+		case isConflict:
+			conflicts = append(conflicts, c)
+		case decided == nil:
+		case (g.opts.ExcludeCrudMask & decided.crudValue()) != 0:
+		default:
+			changes = append(changes, decided)
+		}
+	}
+
+	changes, conflicts = pruneSyncDeletions(changes, conflicts)
+
+	if conflictsPersist(conflicts) {
+		if !g.opts.IgnoreConflict {
+			_warnChangeStopper(g.log, conflicts, "\033[31mX\033[00m", "These %d path(s) changed both locally and remotely. Use -%s to sync everything else\n", len(conflicts), CLIOptionIgnoreConflict)
+			return unresolvedConflictsErr(fmt.Errorf("conflicts have prevented a sync operation"))
+		}
+		_warnChangeStopper(g.log, conflicts, "\033[31mX\033[00m", "Skipping these %d path(s) that changed both locally and remotely\n", len(conflicts))
+	}
+
+	clArg := &changeListArg{
+		logy:       g.log,
+		changes:    changes,
+		noPrompt:   !g.opts.canPrompt(),
+		noClobber:  g.opts.NoClobber,
+		canPreview: g.opts.canPreview(),
+	}
+
+	status, _ := printChangeList(clArg)
+	if !accepted(status) {
+		return status.Error()
+	}
+
+	var pulls, pushes []*Change
+	for _, c := range changes {
+		if c.syncTarget == syncTargetLocal {
+			pulls = append(pulls, c)
+		} else {
+			pushes = append(pushes, c)
+		}
+	}
+
+	// Both plays signal that they are done by closing the progress channel.
+	if len(pulls) >= 1 {
+		g.progressChan = make(chan int)
+		err = combineErrors(err, g.playPullChanges(pulls, g.opts.Exports, nil))
+	}
+	if len(pushes) >= 1 {
+		g.progressChan = make(chan int)
+		err = combineErrors(err, g.playPushChanges(pushes, nil))
+	}
+
+	return err
+}
+
+// syncResolve lists the differences between the local and remote copies
+// from the perspective of a pull, ie with the remote copy as the source.
+// Every difference is listed regardless of options that restrict pushes
+// or pulls, since the direction of each is yet to be decided.
+func (g *Commands) syncResolve() (cl, clashes []*Change, err error) {
+	g.log.Logln("Resolving...")
+
+	spin := g.playabler()
+	spin.play()
+	defer spin.stop()
+
+	opts := *g.opts
+	opts.NoClobber = false
+	opts.IgnoreConflict = false
+	opts.ExcludeCrudMask = None
+
+	resolver := *g
+	resolver.opts = &opts
+
+	return resolver.pullByPath()
+}
+
+// syncDecision decides which way to apply the change c which was resolved
+// as for a pull, returning the change to apply or whether it is a conflict.
+// A nil change means that there is nothing to apply.
+func (g *Commands) syncDecision(c *Change, indicesByPath map[string]*config.Index) (*Change, bool) {
+	local, remote := c.Dest, c.Src
+
+	pull := func() (*Change, bool) {
+		c.g = g
+		c.IgnoreConflict = true
+		c.syncTarget = syncTargetLocal
+		return c, false
+	}
+
+	// Cleared when the content has to be compared by checksum.
+	ignoreChecksum := c.IgnoreChecksum
+
+	push := func() (*Change, bool) {
+		return &Change{
+			Path:           c.Path,
+			Parent:         c.Parent,
+			Src:            local,
+			Dest:           remote,
+			IgnoreConflict: true,
+			IgnoreChecksum: ignoreChecksum,
+			g:              g,
+			syncTarget:     syncTargetRemote,
+		}, false
+	}
+
+	conflicted := func() (*Change, bool) {
+		return nil, true
+	}
+
+	if hasExportLinks(remote) || isShortcut(remote) {
+		// Google Docs can't be pushed, only exported.
+		// Neither can shortcuts, only materialised.
+		return pull()
+	}
+
+	var index *config.Index
+	if remote != nil {
+		index = g.deserializeIndex(remote.Id)
+	}
+	if index == nil {
+		index = indicesByPath[c.Path]
+	}
+
+	switch {
+	case local == nil && remote == nil:
+		return nil, false
+
+	case local == nil:
+		if index == nil || index.FileId != remote.Id || (index.Path != "" && index.Path != c.Path) {
+			// Created or moved remotely.
+			return pull()
+		}
+		// Deleted locally.
+		if changedSinceIndex(remote, index) {
+			return conflicted()
+		}
+		return push()
+
+	case remote == nil:
+		if index == nil {
+			// Created locally.
+			return push()
+		}
+		// Deleted remotely.
+		if changedSinceIndex(local, index) {
+			return conflicted()
+		}
+		return pull()
+
+	case local.IsDir != remote.IsDir:
+		return conflicted()
+
+	case local.IsDir:
+		return nil, false
+	}
+
+	localChanged := changedSinceIndex(local, index)
+	remoteChanged := changedSinceIndex(remote, index)
+
+	// An edit that keeps the size only shows in the checksum, so
+	// it is compared whenever either side changed since indexing.
+	ignoreChecksum = ignoreChecksum && !localChanged && !remoteChanged
+	mask := fileDifferences(remote, local, ignoreChecksum)
+	if !checksumDiffers(mask) {
+		// Same content, the modification time is all that
+		// needs to be updated which a pull does without downloading.
+		return pull()
+	}
+
+	switch {
+	case localChanged && !remoteChanged:
+		return push()
+	case remoteChanged && !localChanged:
+		return pull()
+	}
+	return conflicted()
+}
+
+// changedSinceIndex tells whether f differs from what it was when it was indexed.
+func changedSinceIndex(f *File, index *config.Index) bool {
+	if index == nil {
+		return true
+	}
+	if f.ModTime.Unix() == index.ModTime {
+		return false
+	}
+	if f.IsDir {
+		// Directories' modification times change along with their children.
+		return false
+	}
+	return md5Checksum(f) != index.Md5Checksum
+}
+
+// pruneSyncDeletions drops the changes beneath directories that get deleted
+// since deleting the directory takes care of them. A directory that would be
+// deleted with anything beneath it conflicting or changing otherwise, becomes
+// a conflict itself.
+func pruneSyncDeletions(changes, conflicts []*Change) (pruned, stillConflicts []*Change) {
+	isDirDeletion := func(c *Change) bool {
+		return c.Op() == OpDelete && c.Dest != nil && c.Dest.IsDir
+	}
+
+	beneath := func(parent, p string) bool {
+		return strings.HasPrefix(p, strings.TrimSuffix(parent, "/")+"/")
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+
+	conflictPaths := map[string]bool{}
+	for _, c := range conflicts {
+		conflictPaths[c.Path] = true
+	}
+
+	blocked := func(dir *Change) bool {
+		for p := range conflictPaths {
+			if beneath(dir.Path, p) {
+				return true
+			}
+		}
+		for _, c := range changes {
+			if beneath(dir.Path, c.Path) && (c.Op() != OpDelete || c.syncTarget != dir.syncTarget) {
+				return true
+			}
+		}
+		return false
+	}
+
+	stillConflicts = conflicts
+	var deletedDirs []*Change
+
+	for _, c := range changes {
+		underDeletedDir := false
+		for _, dir := range deletedDirs {
+			if beneath(dir.Path, c.Path) {
+				underDeletedDir = true
+				break
+			}
+		}
+		if underDeletedDir {
+			continue
+		}
+
+		if isDirDeletion(c) {
+			if blocked(c) {
+				stillConflicts = append(stillConflicts, c)
+				continue
+			}
+			deletedDirs = append(deletedDirs, c)
+		}
+
+		pruned = append(pruned, c)
+	}
+
+	return pruned, stillConflicts
+}
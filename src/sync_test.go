@@ -0,0 +1,147 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func modifyTestFile(t *testing.T, root, relPath, content string, offset time.Duration) {
+	writeTestFiles(t, root, map[string]string{relPath: content})
+
+	modTime := time.Now().Add(offset)
+	if err := os.Chtimes(filepath.Join(root, relPath), modTime, modTime); err != nil {
+		t.Fatalf("chtimes %q: %v", relPath, err)
+	}
+}
+
+func TestSync(t *testing.T) {
+	mb := NewMemoryBackend()
+
+	context := memoryTestContext(t)
+	defer os.RemoveAll(context.AbsPath)
+
+	writeTestFiles(t, context.AbsPath, map[string]string{
+		"a.txt":      "alpha",
+		"b.txt":      "bravo",
+		"c.txt":      "charlie",
+		"docs/d.txt": "delta",
+		"x.txt":      "x-ray",
+	})
+	if err := NewWithBackend(context, memoryTestOptions("/"), mb).Push(); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	// Make changes remotely through another context.
+	otherContext := memoryTestContext(t)
+	defer os.RemoveAll(otherContext.AbsPath)
+
+	if err := NewWithBackend(otherContext, memoryTestOptions("/"), mb).Pull(); err != nil {
+		t.Fatalf("pull: %v", err)
+	}
+	modifyTestFile(t, otherContext.AbsPath, "b.txt", "bravo, remotely modified", time.Hour)
+	modifyTestFile(t, otherContext.AbsPath, "r.txt", "romeo", time.Hour)
+	if err := NewWithBackend(otherContext, memoryTestOptions("/b.txt", "/r.txt"), mb).Push(); err != nil {
+		t.Fatalf("push remote changes: %v", err)
+	}
+
+	c, err := mb.FindByPath("/c.txt")
+	if err != nil {
+		t.Fatalf("findByPath: %v", err)
+	}
+	if err := mb.Trash(c.Id); err != nil {
+		t.Fatalf("trash: %v", err)
+	}
+
+	// Then make changes locally.
+	modifyTestFile(t, context.AbsPath, "a.txt", "alpha, locally modified", 2*time.Hour)
+	modifyTestFile(t, context.AbsPath, "l.txt", "lima", 2*time.Hour)
+	if err := os.Remove(filepath.Join(context.AbsPath, "docs", "d.txt")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+
+	if err := NewWithBackend(context, memoryTestOptions("/"), mb).Sync(); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+
+	for relPath, want := range map[string]string{
+		"/a.txt": "alpha, locally modified",
+		"/l.txt": "lima",
+	} {
+		if got := remoteContent(t, mb, relPath); got != want {
+			t.Errorf("remote %q: got %q want %q", relPath, got, want)
+		}
+	}
+	if f, _ := mb.FindByPath("/docs/d.txt"); f != nil {
+		t.Errorf("locally deleted /docs/d.txt still exists remotely")
+	}
+
+	for relPath, want := range map[string]string{
+		"b.txt": "bravo, remotely modified",
+		"r.txt": "romeo",
+	} {
+		blob, err := ioutil.ReadFile(filepath.Join(context.AbsPath, relPath))
+		if err != nil {
+			t.Errorf("local %q: %v", relPath, err)
+			continue
+		}
+		if got := string(blob); got != want {
+			t.Errorf("local %q: got %q want %q", relPath, got, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(context.AbsPath, "c.txt")); !os.IsNotExist(err) {
+		t.Errorf("remotely trashed c.txt still exists locally: %v", err)
+	}
+
+	// Everything is in sync now.
+	if err := NewWithBackend(context, memoryTestOptions("/"), mb).Sync(); err != nil {
+		t.Fatalf("second sync: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(context.AbsPath, "l.txt")); err != nil {
+		t.Errorf("l.txt after second sync: %v", err)
+	}
+
+	// An edit that keeps the size is pushed even when checksums are
+	// otherwise ignored, as they are by default for sync.
+	modifyTestFile(t, context.AbsPath, "a.txt", "ALPHA, LOCALLY MODIFIED", 3*time.Hour)
+	for i := 0; i < 2; i++ {
+		opts := memoryTestOptions("/")
+		opts.IgnoreChecksum = true
+		if err := NewWithBackend(context, opts, mb).Sync(); err != nil {
+			t.Fatalf("sync same size edit: %v", err)
+		}
+	}
+	if got, want := remoteContent(t, mb, "/a.txt"), "ALPHA, LOCALLY MODIFIED"; got != want {
+		t.Errorf("remote a.txt after a same size edit: got %q want %q", got, want)
+	}
+
+	// Changes on both sides conflict.
+	modifyTestFile(t, otherContext.AbsPath, "x.txt", "x-ray, remotely modified", 3*time.Hour)
+	if err := NewWithBackend(otherContext, memoryTestOptions("/x.txt"), mb).Push(); err != nil {
+		t.Fatalf("push remote conflict: %v", err)
+	}
+	modifyTestFile(t, context.AbsPath, "x.txt", "x-ray, locally modified", 4*time.Hour)
+
+	if err := NewWithBackend(context, memoryTestOptions("/"), mb).Sync(); err == nil {
+		t.Fatalf("sync with a conflict: expected an error")
+	}
+	if got, want := remoteContent(t, mb, "/x.txt"), "x-ray, remotely modified"; got != want {
+		t.Errorf("remote x.txt after conflict: got %q want %q", got, want)
+	}
+}
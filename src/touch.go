@@ -56,6 +56,16 @@ func (g *Commands) Touch(byId bool) (err error) {
 		return err
 	}
 
+	if !byId {
+		matches, searched, err := g.searchedMatches(false)
+		if err != nil {
+			return err
+		}
+		if searched {
+			return g.touchSearched(matches, touchModTime)
+		}
+	}
+
 	for i, relToRootPath := range g.opts.Sources {
 		fileId := ""
 		if byId {
@@ -170,6 +170,16 @@ func (g *Commands) trashByMatch(inTrash, permanent bool) error {
 		}
 	}
 
+	toTrash := !inTrash
+	opt := trashOpt{
+		toTrash:   toTrash,
+		permanent: permanent,
+	}
+
+	return g.confirmAndPlayTrashChangeList(cl, &opt)
+}
+
+func (g *Commands) confirmAndPlayTrashChangeList(cl []*Change, opt *trashOpt) error {
 	if len(cl) < 1 {
 		return noMatchesFoundErr(fmt.Errorf("no matches found!"))
 	}
@@ -187,13 +197,7 @@ func (g *Commands) trashByMatch(inTrash, permanent bool) error {
 		return status.Error()
 	}
 
-	toTrash := !inTrash
-	opt := trashOpt{
-		toTrash:   toTrash,
-		permanent: permanent,
-	}
-
-	return g.playTrashChangeList(cl, &opt)
+	return g.playTrashChangeList(cl, opt)
 }
 
 func (g *Commands) TrashByMatch() error {
@@ -209,6 +213,14 @@ func (g *Commands) DeleteByMatch() error {
 }
 
 func (g *Commands) reduceForTrash(args []string, opt *trashOpt) error {
+	matches, searched, err := g.searchedMatches(!opt.toTrash)
+	if err != nil {
+		return err
+	}
+	if searched {
+		return g.trashSearched(matches, opt)
+	}
+
 	var cl []*Change
 	for i, relToRoot := range args {
 		c, cErr := g.trasher(relToRoot, opt)
@@ -62,7 +62,8 @@ const (
 )
 
 const (
-	DriveFolderMimeType = "application/vnd.google-apps.folder"
+	DriveFolderMimeType   = "application/vnd.google-apps.folder"
+	DriveShortcutMimeType = "application/vnd.google-apps.shortcut"
 )
 
 // Arbitrary value. TODO: Get better definition of BigFileSize.
@@ -116,6 +117,16 @@ type File struct {
 	Description           string
 	Parents               []*ParentFile
 	QuotaBytesUsed        int64
+	// Properties are the custom key-value pairs attached to this file
+	Properties []*drive.Property
+	// ShortcutTargetId is the id of the file that
+	// this file points to if it is a shortcut.
+	ShortcutTargetId       string
+	ShortcutTargetMimeType string
+
+	// shortcutTargetPath is the resolved path of
+	// the target of a shortcut, set only for display.
+	shortcutTargetPath string
 }
 
 func newParentFile(p *drive.ParentReference) *ParentFile {
@@ -142,6 +153,12 @@ func NewRemoteFile(f *drive.File) *File {
 		return pfl
 	}(f.Parents)
 
+	var shortcutTargetId, shortcutTargetMimeType string
+	if f.ShortcutDetails != nil {
+		shortcutTargetId = f.ShortcutDetails.TargetId
+		shortcutTargetMimeType = f.ShortcutDetails.TargetMimeType
+	}
+
 	return &File{
 		AlternateLink:      f.AlternateLink,
 		BlobAt:             f.DownloadUrl,
@@ -168,6 +185,10 @@ func NewRemoteFile(f *drive.File) *File {
 		Description:           f.Description,
 		Parents:               parents,
 		QuotaBytesUsed:        f.QuotaBytesUsed,
+		Properties:            f.Properties,
+
+		ShortcutTargetId:       shortcutTargetId,
+		ShortcutTargetMimeType: shortcutTargetMimeType,
 	}
 }
 
@@ -198,9 +219,13 @@ func DupFile(f *File) *File {
 		Labels:             f.Labels,
 		AlternateLink:      f.AlternateLink,
 		OriginalFilename:   f.OriginalFilename,
+		Properties:         f.Properties,
 		Description:        f.Description,
 		Parents:            f.Parents,
 		QuotaBytesUsed:     f.QuotaBytesUsed,
+
+		ShortcutTargetId:       f.ShortcutTargetId,
+		ShortcutTargetMimeType: f.ShortcutTargetMimeType,
 	}
 }
 
@@ -282,6 +307,18 @@ type Change struct {
 	IgnoreConflict bool
 	IgnoreChecksum bool
 	g              *Commands
+
+	// syncTarget is the side, local or remote, that
+	// a sync applies the change to. See Commands.Sync.
+	syncTarget string
+
+	// linkTo when set is the path of another change that pulls the
+	// same file, this change only links to what that one pulled.
+	linkTo string
+
+	// exports are the local paths that the Google Doc
+	// of the change was exported to by a pull.
+	exports []string
 }
 
 type ByPrecedence []*Change
@@ -575,6 +612,12 @@ type matchQuery struct {
 	mimeQuerySearches []fuzzyStringsValuePair
 	titleSearches     []fuzzyStringsValuePair
 	ownerSearches     []fuzzyStringsValuePair
+	propertySearches  []*propertyQuery
+	// query is the part of a -query that Drive evaluates.
+	query queryNode
+	// anywhere when set searches through all folders
+	// instead of only the children of dirPath.
+	anywhere bool
 }
 
 type fuzziness int
@@ -721,6 +764,16 @@ func (mq *matchQuery) Stringer() string {
 		ownerTranslations = append(ownerTranslations, ownerQuery)
 	}
 
+	propertyTranslations := []string{}
+	for _, pq := range mq.propertySearches {
+		propertyTranslations = append(propertyTranslations, pq.Stringer())
+	}
+
+	queryTranslations := []string{}
+	if mq.query != nil {
+		queryTranslations = []string{mq.query.driveQuery()}
+	}
+
 	starredTranslations := []string{}
 	if mq.starred {
 		starredTranslations = []string{"(starred=true)"}
@@ -733,6 +786,8 @@ func (mq *matchQuery) Stringer() string {
 		{" and ", mimeTranslations},
 		{" and ", titleTranslations},
 		{" and ", ownerTranslations},
+		{" and ", propertyTranslations},
+		{" and ", queryTranslations},
 		{" and ", starredTranslations},
 	}
 
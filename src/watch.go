@@ -0,0 +1,403 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/odeke-em/drive/config"
+	drive "google.golang.org/api/drive/v2"
+)
+
+const DefaultWatchInterval = 30 * time.Second
+
+const (
+	WatchActionUpdate   = "update"
+	WatchActionTrash    = "trash"
+	WatchActionDelete   = "delete"
+	WatchActionPull     = "pull"
+	WatchActionConflict = "conflict"
+	WatchActionError    = "error"
+)
+
+type WatchOptions struct {
+	// Interval is how long to wait between polls of the changes feed.
+	Interval time.Duration
+	// Once polls the changes feed only once.
+	Once bool
+}
+
+// watchEvent is a WatchEventRecord along with what
+// watch needs to know to act upon the change.
+type watchEvent struct {
+	WatchEventRecord
+
+	isDir bool
+	// index is the local index of the file, if it was ever synced.
+	index *config.Index
+}
+
+// Watch polls the remote changes feed and pulls the files affected by
+// every change within the context's sources. The id of the last change
+// processed is saved in the index db, so that watching can resume from
+// where it left off. The first run only records the current change id.
+func (g *Commands) Watch(wo *WatchOptions) error {
+	if wo == nil {
+		wo = &WatchOptions{}
+	}
+	interval := wo.Interval
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+
+	for {
+		if err := g.watchOnce(); err != nil {
+			if wo.Once {
+				return err
+			}
+			g.emitWatchEvent(&WatchEventRecord{Action: WatchActionError, Error: err.Error()})
+		}
+
+		if wo.Once {
+			return nil
+		}
+		time.Sleep(interval)
+	}
+}
+
+func (g *Commands) watchOnce() error {
+	lastChangeId, err := g.context.LargestChangeId()
+	if err == config.ErrNoSuchDbKey {
+		about, aErr := g.rem.About()
+		if aErr != nil {
+			return aErr
+		}
+
+		if !g.opts.structuredOutput() {
+			g.log.Logf("watching from change %d\n", about.LargestChangeId)
+		}
+		return g.context.SetLargestChangeId(about.LargestChangeId)
+	}
+	if err != nil {
+		return err
+	}
+
+	largestChangeId := lastChangeId
+
+	// A file can change several times between polls,
+	// only its latest state matters.
+	var fileIds []string
+	latest := map[string]*drive.Change{}
+	err = g.rem.changes(lastChangeId+1, func(change *drive.Change) error {
+		if change.Id > largestChangeId {
+			largestChangeId = change.Id
+		}
+		if _, ok := latest[change.FileId]; !ok {
+			fileIds = append(fileIds, change.FileId)
+		}
+		latest[change.FileId] = change
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// The depth to pull each affected path at.
+	depths := map[string]int{}
+
+	for _, fileId := range fileIds {
+		event := g.watchEventFor(latest[fileId])
+		if event == nil {
+			continue
+		}
+		g.emitWatchEvent(&event.WatchEventRecord)
+
+		if err := g.watchRemoveLocal(event); err != nil {
+			return err
+		}
+
+		for p, depth := range watchPullTargets(event) {
+			if cur, ok := depths[p]; !ok || depth == InfiniteDepth || (cur != InfiniteDepth && depth > cur) {
+				depths[p] = depth
+			}
+		}
+	}
+
+	if len(depths) >= 1 {
+		if err := g.watchPull(depths); err != nil {
+			// Don't move past the changes so that the next poll retries.
+			return err
+		}
+	}
+
+	if largestChangeId == lastChangeId {
+		return nil
+	}
+	return g.context.SetLargestChangeId(largestChangeId)
+}
+
+// watchEventFor maps the change to the paths of the affected file within
+// the sources being watched. It returns nil if the change is irrelevant.
+func (g *Commands) watchEventFor(change *drive.Change) *watchEvent {
+	event := &watchEvent{
+		WatchEventRecord: WatchEventRecord{
+			ChangeId: change.Id,
+			FileId:   change.FileId,
+		},
+	}
+
+	// The path that the file was last synced at, if any.
+	lastPath := ""
+	if index, err := g.context.DeserializeIndex(change.FileId); err == nil && index != nil {
+		event.index = index
+		if index.Path != "" {
+			lastPath = remotePathJoin(index.Path)
+		}
+	}
+	lastPathWatched := lastPath != "" && !rootLike(lastPath) && g.watching(lastPath)
+
+	if change.Deleted || change.File == nil {
+		// The file is gone so its paths can't be looked up
+		// anymore, only its last known path is left to go by.
+		if !lastPathWatched {
+			return nil
+		}
+		event.Action = WatchActionDelete
+		event.Paths = []string{lastPath}
+		return event
+	}
+
+	event.Action = WatchActionUpdate
+	event.isDir = change.File.MimeType == DriveFolderMimeType
+	if change.File.Labels != nil && change.File.Labels.Trashed {
+		event.Action = WatchActionTrash
+	}
+
+	backPaths, err := g.rem.FindBackPaths(change.FileId)
+	if err != nil {
+		return nil
+	}
+
+	for _, p := range backPaths {
+		p = remotePathJoin(p)
+		if p == lastPath {
+			lastPathWatched = false
+		}
+		if !rootLike(p) && g.watching(p) {
+			event.Paths = append(event.Paths, p)
+		}
+	}
+
+	// The file was moved or renamed, possibly out of the sources
+	// being watched, so its local copy at the old path is stale.
+	if lastPathWatched {
+		event.MovedFrom = lastPath
+	}
+	if len(event.Paths) < 1 && event.MovedFrom == "" {
+		return nil
+	}
+	return event
+}
+
+// watchRemoveLocal removes the local copy of a file that was deleted
+// or that was moved away from its last known path, along with its index.
+// A local copy with changes that were never pushed is left alone and
+// reported as a conflict instead.
+func (g *Commands) watchRemoveLocal(event *watchEvent) error {
+	stalePath := event.MovedFrom
+	if event.Action == WatchActionDelete && len(event.Paths) >= 1 {
+		stalePath = event.Paths[0]
+	}
+	if stalePath == "" {
+		return nil
+	}
+
+	changedPath, err := g.locallyChangedPath(stalePath, event.index)
+	if err != nil {
+		return err
+	}
+	if changedPath != "" {
+		g.emitWatchEvent(&WatchEventRecord{
+			Action:   WatchActionConflict,
+			ChangeId: event.ChangeId,
+			FileId:   event.FileId,
+			Paths:    []string{stalePath},
+			Error:    fmt.Sprintf("%s changed locally, not removing it", changedPath),
+		})
+		return nil
+	}
+
+	if err := os.RemoveAll(g.context.AbsPathOf(stalePath)); err != nil {
+		return err
+	}
+	if event.index == nil || event.Action != WatchActionDelete {
+		// A moved file gets indexed afresh when its new path is pulled.
+		return nil
+	}
+	return g.context.RemoveIndex(event.index, g.context.AbsPathOf(""))
+}
+
+// locallyChangedPath returns the first path at or beneath relToRootPath
+// that changed locally since it was last synced, a file that was never
+// synced included, or "" if there is none. index is that of relToRootPath.
+func (g *Commands) locallyChangedPath(relToRootPath string, index *config.Index) (string, error) {
+	fsAbsPath := g.context.AbsPathOf(relToRootPath)
+	info, err := os.Lstat(fsAbsPath)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		if changedSinceIndex(NewLocalFile(fsAbsPath, info), index) {
+			return relToRootPath, nil
+		}
+		return "", nil
+	}
+
+	indicesByPath, err := g.context.IndicesByPath()
+	if err != nil {
+		return "", err
+	}
+
+	changedPath := ""
+	err = filepath.Walk(fsAbsPath, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if changedPath != "" {
+			return filepath.SkipDir
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		relPath, err := filepath.Rel(g.context.AbsPathOf(""), p)
+		if err != nil {
+			return err
+		}
+		relPath = remotePathJoin(filepath.ToSlash(relPath))
+		if changedSinceIndex(NewLocalFile(p, fi), indicesByPath[relPath]) {
+			changedPath = relPath
+		}
+		return nil
+	})
+	return changedPath, err
+}
+
+func (g *Commands) watching(p string) bool {
+	for _, src := range g.opts.Sources {
+		if rootLike(src) || p == src || strings.HasPrefix(p, strings.TrimSuffix(src, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// watchPullTargets returns the paths to pull to reconcile the local copies
+// with the change, along with the depth to pull each at. Trashed files are
+// no longer reachable by path so it is their parent folders that get pulled,
+// which removes the local copies. Folders are pulled entirely since
+// moving or renaming one only registers a change for the folder itself.
+func watchPullTargets(event *watchEvent) map[string]int {
+	targets := map[string]int{}
+	if event.Action == WatchActionDelete {
+		// The local copy is removed directly.
+		return targets
+	}
+	for _, p := range event.Paths {
+		switch {
+		case event.Action == WatchActionTrash:
+			targets[path.Dir(p)] = 2
+		case event.isDir:
+			targets[p] = InfiniteDepth
+		default:
+			targets[p] = 1
+		}
+	}
+	return targets
+}
+
+// watchPull pulls the paths, grouped by the depth each has to be pulled at.
+func (g *Commands) watchPull(depths map[string]int) error {
+	byDepth := map[int][]string{}
+	var orderedDepths []int
+	for p, depth := range depths {
+		if _, ok := byDepth[depth]; !ok {
+			orderedDepths = append(orderedDepths, depth)
+		}
+		byDepth[depth] = append(byDepth[depth], p)
+	}
+
+	// Pull the shallowest first so that, where the paths overlap,
+	// the deepest pulls which see the most have the last say.
+	sort.Slice(orderedDepths, func(i, j int) bool {
+		if orderedDepths[j] == InfiniteDepth {
+			return orderedDepths[i] != InfiniteDepth
+		}
+		return orderedDepths[i] != InfiniteDepth && orderedDepths[i] < orderedDepths[j]
+	})
+
+	for _, depth := range orderedDepths {
+		targets := byDepth[depth]
+		sort.Strings(targets)
+
+		opts := *g.opts
+		opts.Sources = targets
+		opts.Depth = depth
+		opts.Recursive = true
+		opts.NoPrompt = true
+		if g.opts.structuredOutput() {
+			// Keep stdout to the events.
+			opts.Quiet = true
+		}
+
+		if err := NewWithBackend(g.context, &opts, g.rem).Pull(); err != nil {
+			return err
+		}
+		g.emitWatchEvent(&WatchEventRecord{Action: WatchActionPull, Paths: targets})
+	}
+	return nil
+}
+
+func (g *Commands) emitWatchEvent(event *WatchEventRecord) {
+	event.Time = time.Now().UTC().Format(time.RFC3339)
+
+	if g.opts.structuredOutput() {
+		g.emitDocument(event)
+		return
+	}
+
+	switch event.Action {
+	case WatchActionError:
+		g.log.LogErrf("%s %s %s\n", event.Time, event.Action, event.Error)
+	case WatchActionConflict:
+		g.log.LogErrf("%s change %d %s %s\n", event.Time, event.ChangeId, event.Action, event.Error)
+	case WatchActionPull:
+		g.log.Logf("%s %s %s\n", event.Time, event.Action, strings.Join(event.Paths, " "))
+	default:
+		paths := strings.Join(event.Paths, " ")
+		if event.MovedFrom != "" {
+			paths = strings.TrimSpace(paths + " (from " + event.MovedFrom + ")")
+		}
+		g.log.Logf("%s change %d %s %s\n", event.Time, event.ChangeId, event.Action, paths)
+	}
+}
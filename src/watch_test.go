@@ -0,0 +1,174 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchPullsRemoteChanges(t *testing.T) {
+	mb := NewMemoryBackend()
+
+	pushContext := memoryTestContext(t)
+	defer os.RemoveAll(pushContext.AbsPath)
+
+	writeTestFiles(t, pushContext.AbsPath, map[string]string{
+		"a.txt":      "alpha",
+		"docs/b.txt": "bravo",
+	})
+	if err := NewWithBackend(pushContext, memoryTestOptions("/"), mb).Push(); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	watchContext := memoryTestContext(t)
+	defer os.RemoveAll(watchContext.AbsPath)
+
+	if err := NewWithBackend(watchContext, memoryTestOptions("/"), mb).Pull(); err != nil {
+		t.Fatalf("pull: %v", err)
+	}
+
+	watch := func() {
+		wo := &WatchOptions{Once: true}
+		if err := NewWithBackend(watchContext, memoryTestOptions("/"), mb).Watch(wo); err != nil {
+			t.Fatalf("watch: %v", err)
+		}
+	}
+
+	// The first run only records where to start watching from.
+	watch()
+	if _, err := watchContext.LargestChangeId(); err != nil {
+		t.Fatalf("largestChangeId: %v", err)
+	}
+
+	later := time.Now().Add(time.Hour)
+	writeTestFiles(t, pushContext.AbsPath, map[string]string{
+		"a.txt":      "alpha, modified",
+		"docs/c.txt": "charlie",
+	})
+	if err := os.Chtimes(filepath.Join(pushContext.AbsPath, "a.txt"), later, later); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	opts := memoryTestOptions("/")
+	opts.IgnoreChecksum = true
+	if err := NewWithBackend(pushContext, opts, mb).Push(); err != nil {
+		t.Fatalf("push changes: %v", err)
+	}
+
+	b, err := mb.FindByPath("/docs/b.txt")
+	if err != nil {
+		t.Fatalf("findByPath: %v", err)
+	}
+	if err := mb.Trash(b.Id); err != nil {
+		t.Fatalf("trash: %v", err)
+	}
+
+	watch()
+
+	for relPath, want := range map[string]string{"a.txt": "alpha, modified", "docs/c.txt": "charlie"} {
+		blob, err := ioutil.ReadFile(filepath.Join(watchContext.AbsPath, relPath))
+		if err != nil {
+			t.Errorf("watched %q: %v", relPath, err)
+			continue
+		}
+		if got := string(blob); got != want {
+			t.Errorf("watched %q: got %q want %q", relPath, got, want)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(watchContext.AbsPath, "docs", "b.txt")); !os.IsNotExist(err) {
+		t.Errorf("trashed file still present locally: %v", err)
+	}
+}
+
+func TestWatchRemovesDeletedAndMovedOutFiles(t *testing.T) {
+	mb := NewMemoryBackend()
+
+	pushContext := memoryTestContext(t)
+	defer os.RemoveAll(pushContext.AbsPath)
+
+	writeTestFiles(t, pushContext.AbsPath, map[string]string{
+		"docs/d.txt":     "delta",
+		"docs/e.txt":     "echo",
+		"docs/g.txt":     "golf",
+		"docs/sub/h.txt": "hotel",
+		"other/f.txt":    "foxtrot",
+	})
+	if err := NewWithBackend(pushContext, memoryTestOptions("/"), mb).Push(); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	watchContext := memoryTestContext(t)
+	defer os.RemoveAll(watchContext.AbsPath)
+
+	if err := NewWithBackend(watchContext, memoryTestOptions("/"), mb).Pull(); err != nil {
+		t.Fatalf("pull: %v", err)
+	}
+
+	watch := func() {
+		wo := &WatchOptions{Once: true}
+		if err := NewWithBackend(watchContext, memoryTestOptions("/docs"), mb).Watch(wo); err != nil {
+			t.Fatalf("watch: %v", err)
+		}
+	}
+	watch()
+
+	lookup := func(p string) *File {
+		f, err := mb.FindByPath(p)
+		if err != nil {
+			t.Fatalf("findByPath %q: %v", p, err)
+		}
+		return f
+	}
+	d, e, docs, other := lookup("/docs/d.txt"), lookup("/docs/e.txt"), lookup("/docs"), lookup("/other")
+	g, sub := lookup("/docs/g.txt"), lookup("/docs/sub")
+
+	// Local changes that were never pushed are kept.
+	modifyTestFile(t, watchContext.AbsPath, "docs/g.txt", "golf, locally modified", time.Hour)
+	writeTestFiles(t, watchContext.AbsPath, map[string]string{"docs/sub/i.txt": "india"})
+
+	for _, id := range []string{d.Id, g.Id, sub.Id} {
+		if err := mb.Delete(id); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+	}
+	req := &UpdateRequest{Id: e.Id, AddParents: []string{other.Id}, RemoveParents: []string{docs.Id}}
+	if _, err := mb.Update(req); err != nil {
+		t.Fatalf("move: %v", err)
+	}
+
+	watch()
+
+	for _, relPath := range []string{"docs/d.txt", "docs/e.txt"} {
+		if _, err := os.Stat(filepath.Join(watchContext.AbsPath, relPath)); !os.IsNotExist(err) {
+			t.Errorf("%q is still present locally: %v", relPath, err)
+		}
+	}
+	for relPath, want := range map[string]string{"docs/g.txt": "golf, locally modified", "docs/sub/i.txt": "india"} {
+		blob, err := ioutil.ReadFile(filepath.Join(watchContext.AbsPath, relPath))
+		if got := string(blob); got != want {
+			t.Errorf("locally changed %q: got %q, %v want %q", relPath, got, err, want)
+		}
+	}
+	if _, err := watchContext.DeserializeIndex(d.Id); err == nil {
+		t.Errorf("the index of the deleted %q was kept", "/docs/d.txt")
+	}
+	if _, err := os.Stat(filepath.Join(watchContext.AbsPath, "other", "f.txt")); err != nil {
+		t.Errorf("unwatched file was touched: %v", err)
+	}
+}
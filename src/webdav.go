@@ -0,0 +1,703 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+// davFileSystem is a webdav.FileSystem over the remote tree under root.
+// Google Docs can't be downloaded as they are so each one is seen as
+// the formats that it exports to e.g "report.docx" and "report.pdf",
+// those are read only. Docs without any export format are left out.
+type davFileSystem struct {
+	g    *Commands
+	root string
+}
+
+var _ webdav.FileSystem = (*davFileSystem)(nil)
+
+// webDAVHandler serves the remote tree under root over WebDAV.
+func (g *Commands) webDAVHandler(root string) (http.Handler, error) {
+	dir, err := g.rem.FindByPath(root)
+	if err != nil {
+		return nil, err
+	}
+	if !dir.IsDir {
+		return nil, invalidArgumentsErr(fmt.Errorf("serve: %q is not a folder", root))
+	}
+
+	g.serveSetup()
+
+	fs := &davFileSystem{g: g, root: root}
+	return &davHandler{
+		fs: fs,
+		Handler: &webdav.Handler{
+			FileSystem: fs,
+			LockSystem: webdav.NewMemLS(),
+			Logger: func(req *http.Request, err error) {
+				// Clients probe for plenty of files that don't exist.
+				if err != nil && !os.IsNotExist(err) {
+					g.log.LogErrf("%s %s: %v\n", req.Method, req.URL.Path, err)
+				}
+			},
+		},
+	}, nil
+}
+
+func (fs *davFileSystem) remotePath(name string) string {
+	return remotePathJoin(fs.root, path.Clean("/"+name))
+}
+
+// davEntry is what a WebDAV path resolves to, a remote
+// file or one of the exports of a Google Doc.
+type davEntry struct {
+	name string
+	f    *File
+	// exportURL and mimeType are set when the entry is an export of f.
+	exportURL string
+	mimeType  string
+}
+
+func (e *davEntry) exported() bool {
+	return e.exportURL != ""
+}
+
+func (e *davEntry) Name() string {
+	return e.name
+}
+
+// Size is unknown for exports until they are downloaded.
+func (e *davEntry) Size() int64 {
+	if e.exported() {
+		return 0
+	}
+	return e.f.Size
+}
+
+func (e *davEntry) Mode() os.FileMode {
+	switch {
+	case e.f.IsDir:
+		return os.ModeDir | 0755
+	case e.exported():
+		return 0444
+	}
+	return 0644
+}
+
+func (e *davEntry) ModTime() time.Time {
+	return e.f.ModTime
+}
+
+func (e *davEntry) IsDir() bool {
+	return e.f.IsDir
+}
+
+func (e *davEntry) Sys() interface{} {
+	return e.f
+}
+
+// ContentType spares webdav from sniffing the content
+// which would otherwise download every file it lists.
+func (e *davEntry) ContentType(ctx context.Context) (string, error) {
+	switch {
+	case e.exported():
+		return e.mimeType, nil
+	case e.f.MimeType != "":
+		return e.f.MimeType, nil
+	}
+	if mimeType := mime.TypeByExtension(path.Ext(e.name)); mimeType != "" {
+		return mimeType, nil
+	}
+	return "application/octet-stream", nil
+}
+
+func (e *davEntry) ETag(ctx context.Context) (string, error) {
+	if e.exported() || e.f.Md5Checksum == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return fmt.Sprintf("%q", e.f.Md5Checksum), nil
+}
+
+// exportEntry is the entry for f exported as ext, nil
+// if f isn't a Google Doc or isn't exported to ext.
+func (fs *davFileSystem) exportEntry(f *File, ext string) *davEntry {
+	if !hasExportLinks(f) {
+		return nil
+	}
+	for _, wanted := range fs.g.exportsFor(f, fs.g.opts.Exports) {
+		if wanted != ext {
+			continue
+		}
+		mimeType, url, ok := exportLink(f, ext)
+		if !ok {
+			return nil
+		}
+		return &davEntry{name: sepJoin(".", f.Name, ext), f: f, exportURL: url, mimeType: mimeType}
+	}
+	return nil
+}
+
+// entries is how f is seen over WebDAV: as itself or,
+// for a Google Doc, as each of its exports.
+func (fs *davFileSystem) entries(f *File) (entries []*davEntry) {
+	if !hasExportLinks(f) {
+		return []*davEntry{{name: f.Name, f: f}}
+	}
+	for _, ext := range fs.g.exportsFor(f, fs.g.opts.Exports) {
+		if e := fs.exportEntry(f, ext); e != nil {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// resolve finds the entry that name refers to. A name that doesn't exist
+// remotely could still be the export of a Google Doc named without the extension.
+func (fs *davFileSystem) resolve(name string) (*davEntry, error) {
+	p := fs.remotePath(name)
+	f, err := fs.g.rem.FindByPath(p)
+	if err != nil && err != ErrPathNotExists {
+		return nil, err
+	}
+	if f != nil && !hasExportLinks(f) {
+		return &davEntry{name: path.Base(p), f: f}, nil
+	}
+
+	ext := strings.TrimPrefix(path.Ext(p), ".")
+	if ext == "" {
+		return nil, os.ErrNotExist
+	}
+	doc, err := fs.g.rem.FindByPath(strings.TrimSuffix(p, "."+ext))
+	if err == ErrPathNotExists {
+		return nil, os.ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	if e := fs.exportEntry(doc, ext); e != nil {
+		return e, nil
+	}
+	return nil, os.ErrNotExist
+}
+
+// resolveDir finds the folder that name refers to.
+func (fs *davFileSystem) resolveDir(name string) (*File, error) {
+	e, err := fs.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	if !e.IsDir() {
+		return nil, os.ErrNotExist
+	}
+	return e.f, nil
+}
+
+func (fs *davFileSystem) children(dir *File) (infos []os.FileInfo, err error) {
+	pagePair := fs.g.rem.FindByParentId(dir.Id, true)
+
+	errsChan := pagePair.errsChan
+	children := pagePair.filesChan
+
+	working := true
+	for working {
+		select {
+		case pageErr := <-errsChan:
+			if pageErr != nil {
+				return nil, pageErr
+			}
+		case child, stillHasContent := <-children:
+			if !stillHasContent {
+				working = false
+				break
+			}
+			if child == nil {
+				continue
+			}
+			for _, e := range fs.entries(child) {
+				infos = append(infos, e)
+			}
+		}
+	}
+
+	return infos, nil
+}
+
+func (fs *davFileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	return fs.resolve(name)
+}
+
+func (fs *davFileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	if _, err := fs.resolve(name); err == nil {
+		return os.ErrExist
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	parent, err := fs.resolveDir(path.Dir(path.Clean("/" + name)))
+	if err != nil {
+		return err
+	}
+
+	args := &upsertOpt{
+		uploadChunkSize: fs.g.opts.UploadChunkSize,
+		parentId:        parent.Id,
+		src:             &File{IsDir: true, Name: path.Base(name), ModTime: time.Now()},
+		retryCount:      fs.g.opts.ExponentialBackoffRetryCount,
+		progress:        fs.g.progressChan,
+	}
+	_, err = fs.g.rem.UpsertByComparison(args)
+	return err
+}
+
+// mkdirAll makes the folder name along with any of its missing parents.
+func (fs *davFileSystem) mkdirAll(name string) error {
+	name = path.Clean("/" + name)
+	if rootLike(name) {
+		return nil
+	}
+
+	e, err := fs.resolve(name)
+	if err == nil {
+		if !e.IsDir() {
+			return os.ErrExist
+		}
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := fs.mkdirAll(path.Dir(name)); err != nil {
+		return err
+	}
+	return fs.Mkdir(context.Background(), name, 0755)
+}
+
+// RemoveAll moves what name refers to into the trash.
+func (fs *davFileSystem) RemoveAll(ctx context.Context, name string) error {
+	if rootLike(path.Clean("/" + name)) {
+		return os.ErrPermission
+	}
+	e, err := fs.resolve(name)
+	if err != nil {
+		return err
+	}
+	if e.exported() {
+		return os.ErrPermission
+	}
+	return fs.g.rem.Trash(e.f.Id)
+}
+
+// Rename moves the file to the new parent if it changed, then renames it.
+func (fs *davFileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	oldName, newName = path.Clean("/"+oldName), path.Clean("/"+newName)
+	if rootLike(oldName) || rootLike(newName) {
+		return os.ErrPermission
+	}
+
+	e, err := fs.resolve(oldName)
+	if err != nil {
+		return err
+	}
+	if e.exported() {
+		return os.ErrPermission
+	}
+
+	oldParent, err := fs.resolveDir(path.Dir(oldName))
+	if err != nil {
+		return err
+	}
+	newParent, err := fs.resolveDir(path.Dir(newName))
+	if err != nil {
+		return err
+	}
+
+	if oldParent.Id != newParent.Id {
+		if err := fs.g.rem.insertParent(e.f.Id, newParent.Id); err != nil {
+			return err
+		}
+		if err := fs.g.rem.removeParent(e.f.Id, oldParent.Id); err != nil {
+			return err
+		}
+	}
+
+	if newBase := path.Base(newName); newBase != e.f.Name {
+		_, err = fs.g.rem.rename(e.f.Id, newBase)
+	}
+	return err
+}
+
+func (fs *davFileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	writable := flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC) != 0
+
+	e, err := fs.resolve(name)
+	switch {
+	case err == nil:
+		if writable && (e.IsDir() || e.exported()) {
+			return nil, os.ErrPermission
+		}
+		if writable && flag&os.O_EXCL != 0 {
+			return nil, os.ErrExist
+		}
+	case !os.IsNotExist(err):
+		return nil, err
+	case !writable || flag&os.O_CREATE == 0:
+		return nil, err
+	default:
+		// Creating a file that doesn't exist yet, it only needs a parent.
+		if _, err := fs.resolveDir(path.Dir(path.Clean("/" + name))); err != nil {
+			return nil, err
+		}
+	}
+
+	df := &davFile{fs: fs, name: path.Clean("/" + name), entry: e, writable: writable}
+	if writable {
+		if df.spooled, err = ioutil.TempFile("", "drive-webdav"); err != nil {
+			return nil, err
+		}
+		if e != nil && flag&os.O_TRUNC == 0 {
+			if err := df.spoolContent(); err != nil {
+				df.discardSpooled()
+				return nil, err
+			}
+		}
+	}
+	return df, nil
+}
+
+// davFile is an open WebDAV file. Plain files are read through ranged
+// downloads, exports and encrypted content can only be read from the start
+// so they are spooled to a temporary file first. Written content is spooled
+// as well and uploaded once the file is closed.
+type davFile struct {
+	fs       *davFileSystem
+	name     string
+	entry    *davEntry
+	writable bool
+
+	spooled *os.File
+
+	body   io.ReadCloser
+	offset int64
+
+	children []os.FileInfo
+	listed   bool
+}
+
+var _ webdav.File = (*davFile)(nil)
+
+// streams tells whether reads can be served by ranged downloads.
+func (df *davFile) streams() bool {
+	return df.spooled == nil && !df.entry.exported() && df.fs.g.opts.Decrypter == nil
+}
+
+// spoolContent downloads the entry's content to the spooled file.
+func (df *davFile) spoolContent() error {
+	if df.spooled == nil {
+		spooled, err := ioutil.TempFile("", "drive-webdav")
+		if err != nil {
+			return err
+		}
+		df.spooled = spooled
+	}
+
+	body, err := df.fs.g.rem.Download(df.entry.f.Id, df.entry.exportURL)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	if _, err := io.Copy(df.spooled, body); err != nil {
+		return err
+	}
+	_, err = df.spooled.Seek(0, io.SeekStart)
+	return err
+}
+
+func (df *davFile) discardSpooled() {
+	if df.spooled == nil {
+		return
+	}
+	df.spooled.Close()
+	os.Remove(df.spooled.Name())
+	df.spooled = nil
+}
+
+func (df *davFile) Read(p []byte) (int, error) {
+	if df.entry != nil && df.entry.IsDir() {
+		return 0, os.ErrInvalid
+	}
+	if df.entry == nil || !df.streams() {
+		if df.spooled == nil {
+			if err := df.spoolContent(); err != nil {
+				return 0, err
+			}
+		}
+		return df.spooled.Read(p)
+	}
+
+	if df.offset >= df.entry.f.Size {
+		return 0, io.EOF
+	}
+	if df.body == nil {
+		body, start, err := df.fs.g.rem.DownloadRange(df.entry.f.Id, df.offset)
+		if err != nil {
+			return 0, err
+		}
+		// The content could start earlier than asked for.
+		if _, err := io.CopyN(ioutil.Discard, body, df.offset-start); err != nil {
+			body.Close()
+			return 0, err
+		}
+		df.body = body
+	}
+
+	n, err := df.body.Read(p)
+	df.offset += int64(n)
+	return n, err
+}
+
+func (df *davFile) Seek(offset int64, whence int) (int64, error) {
+	if df.entry == nil || !df.streams() {
+		if df.spooled == nil {
+			if err := df.spoolContent(); err != nil {
+				return 0, err
+			}
+		}
+		return df.spooled.Seek(offset, whence)
+	}
+
+	switch whence {
+	case io.SeekCurrent:
+		offset += df.offset
+	case io.SeekEnd:
+		offset += df.entry.f.Size
+	}
+	if offset < 0 {
+		return 0, os.ErrInvalid
+	}
+
+	if offset != df.offset && df.body != nil {
+		df.body.Close()
+		df.body = nil
+	}
+	df.offset = offset
+	return offset, nil
+}
+
+func (df *davFile) Write(p []byte) (int, error) {
+	if !df.writable {
+		return 0, os.ErrPermission
+	}
+	return df.spooled.Write(p)
+}
+
+func (df *davFile) Readdir(count int) ([]os.FileInfo, error) {
+	if df.entry == nil || !df.entry.IsDir() {
+		return nil, os.ErrInvalid
+	}
+	if !df.listed {
+		children, err := df.fs.children(df.entry.f)
+		if err != nil {
+			return nil, err
+		}
+		df.children, df.listed = children, true
+	}
+
+	if count <= 0 {
+		children := df.children
+		df.children = nil
+		return children, nil
+	}
+	if len(df.children) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(df.children) {
+		count = len(df.children)
+	}
+	children := df.children[:count]
+	df.children = df.children[count:]
+	return children, nil
+}
+
+// Stat describes a file being written as what it will be once uploaded.
+func (df *davFile) Stat() (os.FileInfo, error) {
+	if !df.writable {
+		return df.entry, nil
+	}
+	fi, err := df.spooled.Stat()
+	if err != nil {
+		return nil, err
+	}
+	f := &File{Name: path.Base(df.name), Size: fi.Size(), ModTime: fi.ModTime()}
+	if df.entry != nil {
+		f.Id, f.MimeType = df.entry.f.Id, df.entry.f.MimeType
+	}
+	return &davEntry{name: f.Name, f: f}, nil
+}
+
+func (df *davFile) Close() error {
+	if df.body != nil {
+		df.body.Close()
+		df.body = nil
+	}
+	defer df.discardSpooled()
+	if !df.writable {
+		return nil
+	}
+	return df.fs.upload(df.name, df.spooled.Name())
+}
+
+// upload creates the file name or replaces its content with that at fsAbsPath.
+func (fs *davFileSystem) upload(name, fsAbsPath string) error {
+	name = path.Clean("/" + name)
+	parent, err := fs.resolveDir(path.Dir(name))
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(fsAbsPath)
+	if err != nil {
+		return err
+	}
+
+	base := path.Base(name)
+	src := &File{Name: base, Size: fi.Size(), ModTime: time.Now()}
+
+	var dest *File
+	e, err := fs.resolve(name)
+	switch {
+	case err == nil:
+		if e.IsDir() || e.exported() {
+			return os.ErrPermission
+		}
+		dest = e.f
+		src.Id = dest.Id
+	case !os.IsNotExist(err):
+		return err
+	}
+
+	args := &upsertOpt{
+		uploadChunkSize: fs.g.opts.UploadChunkSize,
+		parentId:        parent.Id,
+		fsAbsPath:       fsAbsPath,
+		src:             src,
+		dest:            dest,
+		mimeKey:         path.Ext(base),
+		nonStatable:     true,
+		retryCount:      fs.g.opts.ExponentialBackoffRetryCount,
+		progress:        fs.g.progressChan,
+	}
+	_, err = fs.g.rem.UpsertByComparison(args)
+	return err
+}
+
+// davHandler serves COPY requests with copies made on the server,
+// anything else is left to webdav which would otherwise download
+// and upload every file copied.
+type davHandler struct {
+	*webdav.Handler
+	fs *davFileSystem
+}
+
+func (h *davHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "COPY" {
+		h.Handler.ServeHTTP(w, r)
+		return
+	}
+
+	status, err := h.copy(r)
+	if err != nil {
+		h.Handler.Logger(r, err)
+		w.WriteHeader(status)
+		w.Write([]byte(http.StatusText(status)))
+		return
+	}
+	w.WriteHeader(status)
+}
+
+func (h *davHandler) copy(r *http.Request) (status int, err error) {
+	u, err := url.Parse(r.Header.Get("Destination"))
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	if u.Host != "" && u.Host != r.Host {
+		return http.StatusBadGateway, fmt.Errorf("copy: destination %q is on another server", u.Host)
+	}
+
+	src, dest := path.Clean("/"+r.URL.Path), path.Clean("/"+u.Path)
+	if src == dest || strings.HasPrefix(dest, src+"/") {
+		return http.StatusForbidden, fmt.Errorf("copy: %q can't be copied into itself", src)
+	}
+
+	overwrite := true
+	switch r.Header.Get("Overwrite") {
+	case "F":
+		overwrite = false
+	case "", "T":
+	default:
+		return http.StatusBadRequest, fmt.Errorf("copy: invalid Overwrite header")
+	}
+
+	e, err := h.fs.resolve(src)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return http.StatusNotFound, err
+		}
+		return http.StatusInternalServerError, err
+	}
+	if e.exported() {
+		return http.StatusForbidden, os.ErrPermission
+	}
+	if _, err := h.fs.resolveDir(path.Dir(dest)); err != nil {
+		return http.StatusConflict, err
+	}
+
+	status = http.StatusCreated
+	if _, err := h.fs.resolve(dest); err == nil {
+		if !overwrite {
+			return http.StatusPreconditionFailed, os.ErrExist
+		}
+		if err := h.fs.RemoveAll(r.Context(), dest); err != nil {
+			return http.StatusForbidden, err
+		}
+		status = http.StatusNoContent
+	} else if !os.IsNotExist(err) {
+		return http.StatusInternalServerError, err
+	}
+
+	// A folder copied with "Depth: 0" is copied without its content.
+	if e.IsDir() && r.Header.Get("Depth") == "0" {
+		err = h.fs.Mkdir(r.Context(), dest, 0755)
+	} else {
+		_, err = h.fs.g.copy(e.f, h.fs.remotePath(dest))
+	}
+	if err != nil {
+		return http.StatusForbidden, err
+	}
+	return status, nil
+}
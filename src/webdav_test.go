@@ -0,0 +1,133 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWebDAVServesRemoteTree(t *testing.T) {
+	mb := NewMemoryBackend()
+
+	context := memoryTestContext(t)
+	defer os.RemoveAll(context.AbsPath)
+
+	writeTestFiles(t, context.AbsPath, map[string]string{
+		"docs/a.txt": "alpha",
+		"other.txt":  "outside",
+	})
+	if err := NewWithBackend(context, memoryTestOptions("/"), mb).Push(); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	a, err := mb.FindByPath("/docs/a.txt")
+	if err != nil {
+		t.Fatalf("findByPath: %v", err)
+	}
+
+	g := NewWithBackend(context, memoryTestOptions("/docs"), mb)
+	so := &ServeOptions{Protocol: ServeProtocolWebDAV, Addr: "0.0.0.0:8080"}
+	if err := g.Serve(so); err == nil || !strings.Contains(err.Error(), "loopback") {
+		t.Errorf("serve: expected to refuse listening on %q, got %v", so.Addr, err)
+	}
+
+	handler, err := g.webDAVHandler("/docs")
+	if err != nil {
+		t.Fatalf("webDAVHandler: %v", err)
+	}
+	server := httptest.NewServer(localRequestsOnly(handler, true))
+	defer server.Close()
+
+	do := func(method, p, body string, headers map[string]string) (int, string) {
+		req, err := http.NewRequest(method, server.URL+p, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, p, err)
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, p, err)
+		}
+		defer res.Body.Close()
+		content, _ := ioutil.ReadAll(res.Body)
+		return res.StatusCode, string(content)
+	}
+
+	expectStatus := func(method, p, body string, headers map[string]string, want int) string {
+		got, content := do(method, p, body, headers)
+		if got != want {
+			t.Fatalf("%s %s: got status %d want %d", method, p, got, want)
+		}
+		return content
+	}
+
+	if got := expectStatus("GET", "/a.txt", "", nil, http.StatusOK); got != "alpha" {
+		t.Errorf("GET /a.txt: got %q", got)
+	}
+	if got := expectStatus("GET", "/a.txt", "", map[string]string{"Range": "bytes=2-"}, http.StatusPartialContent); got != "pha" {
+		t.Errorf("GET /a.txt range: got %q", got)
+	}
+	expectStatus("GET", "/other.txt", "", nil, http.StatusNotFound)
+
+	expectStatus("MKCOL", "/new", "", nil, http.StatusCreated)
+	expectStatus("PUT", "/new/b.txt", "bravo", nil, http.StatusCreated)
+	expectStatus("PUT", "/a.txt", "alpha two", nil, http.StatusCreated)
+
+	listing := expectStatus("PROPFIND", "/", "", map[string]string{"Depth": "1"}, http.StatusMultiStatus)
+	for _, want := range []string{"/a.txt", "/new/"} {
+		if !strings.Contains(listing, want) {
+			t.Errorf("PROPFIND /: %q missing from %s", want, listing)
+		}
+	}
+
+	expectStatus("MOVE", "/new/b.txt", "", map[string]string{"Destination": server.URL + "/b.txt"}, http.StatusCreated)
+	expectStatus("COPY", "/a.txt", "", map[string]string{"Destination": server.URL + "/new/a.txt"}, http.StatusCreated)
+	expectStatus("COPY", "/a.txt", "", map[string]string{"Destination": server.URL + "/b.txt", "Overwrite": "F"}, http.StatusPreconditionFailed)
+	expectStatus("DELETE", "/a.txt", "", nil, http.StatusNoContent)
+
+	remote := map[string]string{
+		"/docs/b.txt":     "bravo",
+		"/docs/new/a.txt": "alpha two",
+	}
+	for p, want := range remote {
+		f, err := mb.FindByPath(p)
+		if err != nil {
+			t.Fatalf("findByPath %q: %v", p, err)
+		}
+		body, err := mb.Download(f.Id, "")
+		if err != nil {
+			t.Fatalf("download %q: %v", p, err)
+		}
+		got, _ := ioutil.ReadAll(body)
+		if string(got) != want {
+			t.Errorf("%s: got %q want %q", p, got, want)
+		}
+	}
+	for _, p := range []string{"/docs/a.txt", "/docs/new/b.txt"} {
+		if _, err := mb.FindByPath(p); err != ErrPathNotExists {
+			t.Errorf("%s: expected it to be gone, got %v", p, err)
+		}
+	}
+	if a, err = mb.FindById(a.Id); err != nil || a.Labels == nil || !a.Labels.Trashed {
+		t.Errorf("deleted /docs/a.txt should be in the trash: %v", err)
+	}
+}
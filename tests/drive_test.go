@@ -0,0 +1,851 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tests runs the drive binary against drive-fakeserver,
+// so that the whole CLI is exercised without a network connection.
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/odeke-em/drive/config"
+)
+
+var (
+	driveBin      string
+	fakeServerBin string
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(runTests(m))
+}
+
+func runTests(m *testing.M) int {
+	binDir, err := ioutil.TempDir("", "drive-tests")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "tempDir: %v\n", err)
+		return 1
+	}
+	defer os.RemoveAll(binDir)
+
+	driveBin = filepath.Join(binDir, "drive")
+	fakeServerBin = filepath.Join(binDir, "drive-fakeserver")
+
+	builds := map[string]string{
+		driveBin:      "github.com/odeke-em/drive/cmd/drive",
+		fakeServerBin: "github.com/odeke-em/drive/drive-fakeserver",
+	}
+	for out, pkg := range builds {
+		build := exec.Command("go", "build", "-o", out, pkg)
+		build.Stderr = os.Stderr
+		if err := build.Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "building %s: %v\n", pkg, err)
+			return 1
+		}
+	}
+
+	return m.Run()
+}
+
+type harness struct {
+	t       *testing.T
+	baseURL string
+	home    string
+	root    string
+	server  *exec.Cmd
+}
+
+// newHarness starts a fresh drive-fakeserver and initializes
+// a drive context that talks to it.
+func newHarness(t *testing.T) *harness {
+	if testing.Short() {
+		t.Skip("skipping CLI tests in short mode")
+	}
+
+	dir, err := ioutil.TempDir("", "drive-cli")
+	if err != nil {
+		t.Fatalf("tempDir: %v", err)
+	}
+
+	h := &harness{
+		t:    t,
+		home: filepath.Join(dir, "home"),
+		root: filepath.Join(dir, "root"),
+	}
+	for _, p := range []string{h.home, h.root} {
+		if err := os.MkdirAll(p, 0755); err != nil {
+			t.Fatalf("mkdirAll %q: %v", p, err)
+		}
+	}
+
+	h.server = exec.Command(fakeServerBin)
+	h.server.Env = append(os.Environ(), "DRIVE_FAKESERVER_DATA_DIR="+filepath.Join(dir, "server"))
+	stdout, err := h.server.StdoutPipe()
+	if err != nil {
+		t.Fatalf("stdoutPipe: %v", err)
+	}
+	if err := h.server.Start(); err != nil {
+		t.Fatalf("starting fakeserver: %v", err)
+	}
+
+	// The server announces its address on the first line.
+	h.baseURL, err = bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		h.close()
+		t.Fatalf("reading fakeserver address: %v", err)
+	}
+	h.baseURL = strings.TrimSpace(h.baseURL)
+
+	h.runOK("code\n", "init")
+	return h
+}
+
+func (h *harness) close() {
+	if h.server.Process != nil {
+		h.server.Process.Kill()
+		h.server.Wait()
+	}
+	os.RemoveAll(filepath.Dir(h.root))
+}
+
+func (h *harness) run(stdin string, args ...string) (stdout, stderr string, err error) {
+	cmd := exec.Command(driveBin, args...)
+	cmd.Dir = h.root
+	cmd.Env = append(os.Environ(),
+		"HOME="+h.home,
+		"DRIVE_API_BASE_URL="+h.baseURL,
+		// Push and pull throttle every change by 1/DRIVE_GOMAXPROCS seconds.
+		"DRIVE_GOMAXPROCS=100",
+	)
+	cmd.Stdin = strings.NewReader(stdin)
+
+	var outBuf, errBuf bytes.Buffer
+	cmd.Stdout = &outBuf
+	cmd.Stderr = &errBuf
+
+	err = cmd.Run()
+	return outBuf.String(), errBuf.String(), err
+}
+
+func (h *harness) runOK(stdin string, args ...string) (stdout, stderr string) {
+	stdout, stderr, err := h.run(stdin, args...)
+	if err != nil {
+		h.t.Fatalf("drive %v: %v\nstdout: %s\nstderr: %s", args, err, stdout, stderr)
+	}
+	return stdout, stderr
+}
+
+func (h *harness) runFail(stdin string, args ...string) (stdout, stderr string) {
+	stdout, stderr, err := h.run(stdin, args...)
+	if err == nil {
+		h.t.Fatalf("drive %v: unexpectedly passed\nstdout: %s\nstderr: %s", args, stdout, stderr)
+	}
+	return stdout, stderr
+}
+
+func (h *harness) pushPiped(p, content string) {
+	h.runOK(content, "push", "-piped", p)
+}
+
+func (h *harness) pullPiped(p string) string {
+	stdout, _ := h.runOK("", "pull", "-piped", p)
+	return stdout
+}
+
+var colorCodes = regexp.MustCompile("\033\\[[0-9;]*m")
+
+func (h *harness) list(p string, recursive bool) []string {
+	args := []string{"list", "-no-prompt"}
+	if recursive {
+		args = append(args, "-recursive", "-depth=-1")
+	}
+	stdout, _ := h.runOK("", append(args, p)...)
+
+	paths := []string{}
+	for _, line := range strings.Split(colorCodes.ReplaceAllString(stdout, ""), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			paths = append(paths, line)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (h *harness) setFaults(faults map[string]interface{}) {
+	blob, err := json.Marshal(faults)
+	if err != nil {
+		h.t.Fatalf("marshal faults: %v", err)
+	}
+
+	req, err := http.NewRequest("PUT", h.baseURL+"/fakeserver/faults", bytes.NewReader(blob))
+	if err != nil {
+		h.t.Fatalf("faults request: %v", err)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		h.t.Fatalf("setting faults: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		h.t.Fatalf("setting faults: status %d", res.StatusCode)
+	}
+}
+
+type serverStats struct {
+	MediaBytesReceived int64 `json:"mediaBytesReceived"`
+	MediaBytesSent     int64 `json:"mediaBytesSent"`
+}
+
+func (h *harness) stats() *serverStats {
+	res, err := http.Get(h.baseURL + "/fakeserver/stats")
+	if err != nil {
+		h.t.Fatalf("getting stats: %v", err)
+	}
+	defer res.Body.Close()
+
+	stats := new(serverStats)
+	if err := json.NewDecoder(res.Body).Decode(stats); err != nil {
+		h.t.Fatalf("decoding stats: %v", err)
+	}
+	return stats
+}
+
+type remoteFile struct {
+	path, content string
+}
+
+// setup pushes the given files and returns a harness ready for use.
+func setup(t *testing.T, files ...remoteFile) *harness {
+	h := newHarness(t)
+	for _, f := range files {
+		h.pushPiped(f.path, f.content)
+	}
+	return h
+}
+
+func (h *harness) expectList(p string, recursive bool, want ...string) {
+	if want == nil {
+		want = []string{}
+	}
+	if got := h.list(p, recursive); !reflect.DeepEqual(got, want) {
+		h.t.Errorf("list %q recursive=%v: got %q want %q", p, recursive, got, want)
+	}
+}
+
+func (h *harness) verifyFiles(files ...remoteFile) {
+	for _, f := range files {
+		if got := h.pullPiped(f.path); got != f.content {
+			h.t.Errorf("pull %q: got %q want %q", f.path, got, f.content)
+		}
+	}
+}
+
+func TestBasic(t *testing.T) {
+	h := setup(t, remoteFile{"foo.txt", "foobar"})
+	defer h.close()
+
+	h.verifyFiles(remoteFile{"foo.txt", "foobar"})
+	h.runOK("y\n", "trash", "foo.txt")
+	h.expectList("", false)
+}
+
+func TestList(t *testing.T) {
+	t.Run("empty drive", func(t *testing.T) {
+		h := setup(t)
+		defer h.close()
+
+		h.expectList("", false)
+	})
+
+	t.Run("folder", func(t *testing.T) {
+		h := setup(t, remoteFile{"a/b/c.txt", "foobar"})
+		defer h.close()
+
+		h.expectList("", false, "/a")
+		h.expectList("a", false, "/a/b")
+		h.expectList("a/b", false, "/a/b/c.txt")
+		// Issue #97.
+		h.expectList("a/b/c.txt", false, "/a/b/c.txt")
+	})
+
+	t.Run("not found, issue #95", func(t *testing.T) {
+		h := setup(t)
+		defer h.close()
+
+		// list reports missing paths but carries on with the rest
+		// of its arguments, hence the error only goes to stderr.
+		stdout, stderr, _ := h.run("", "list", "not-found")
+		if stdout != "" || stderr == "" {
+			t.Errorf("got stdout %q stderr %q", stdout, stderr)
+		}
+	})
+}
+
+func TestRename(t *testing.T) {
+	t.Run("file in root", func(t *testing.T) {
+		h := setup(t, remoteFile{"a.txt", "a"})
+		defer h.close()
+
+		h.runOK("", "rename", "a.txt", "abc.txt")
+		h.expectList("", false, "/abc.txt")
+	})
+
+	t.Run("file in folder", func(t *testing.T) {
+		h := setup(t, remoteFile{"b/b.txt", "b"})
+		defer h.close()
+
+		h.runOK("", "rename", "b/b.txt", "c.txt")
+		h.expectList("", true, "/b", "/b/c.txt")
+	})
+
+	t.Run("to self", func(t *testing.T) {
+		h := setup(t, remoteFile{"b.txt", "b"}, remoteFile{"c/c.txt", "c"})
+		defer h.close()
+
+		h.runOK("", "rename", "b.txt", "b.txt")
+		h.runOK("", "rename", "c/c.txt", "c.txt")
+		h.expectList("", true, "/b.txt", "/c", "/c/c.txt")
+	})
+
+	t.Run("to existing file", func(t *testing.T) {
+		files := []remoteFile{{"a.txt", "a"}, {"b.txt", "b"}}
+		h := setup(t, files...)
+		defer h.close()
+
+		_, stderr := h.runFail("", "rename", "a.txt", "b.txt")
+		if !strings.Contains(stderr, "already exists") {
+			t.Errorf("stderr %q does not mention the clash", stderr)
+		}
+		h.expectList("", true, "/a.txt", "/b.txt")
+		h.verifyFiles(files...)
+	})
+}
+
+func TestMove(t *testing.T) {
+	t.Run("folder to another", func(t *testing.T) {
+		h := setup(t, remoteFile{"a/a.txt", "a"}, remoteFile{"b/b.txt", "b"})
+		defer h.close()
+
+		h.runOK("", "move", "a", "b")
+		h.expectList("", true, "/b", "/b/a", "/b/a/a.txt", "/b/b.txt")
+	})
+
+	t.Run("multiple files", func(t *testing.T) {
+		h := setup(t, remoteFile{"a/a.txt", "a"}, remoteFile{"b/b.txt", "b"}, remoteFile{"c/c.txt", "c"})
+		defer h.close()
+
+		h.runOK("", "move", "a/a.txt", "b/b.txt", "c")
+		h.expectList("", true, "/a", "/b", "/c", "/c/a.txt", "/c/b.txt", "/c/c.txt")
+
+		h.runOK("", "move", "c/a.txt", "c/b.txt", "c/c.txt", "")
+		h.expectList("", true, "/a", "/a.txt", "/b", "/b.txt", "/c", "/c.txt")
+	})
+
+	t.Run("file to file", func(t *testing.T) {
+		files := []remoteFile{{"a.txt", "a"}, {"b.txt", "b"}}
+		h := setup(t, files...)
+		defer h.close()
+
+		h.runFail("", "move", "a.txt", "b.txt")
+		h.expectList("", true, "/a.txt", "/b.txt")
+		h.verifyFiles(files...)
+	})
+
+	t.Run("folder to its child", func(t *testing.T) {
+		h := setup(t, remoteFile{"a/b/c.txt", "c"})
+		defer h.close()
+
+		h.runFail("", "move", "a", "a/b")
+		h.expectList("", true, "/a", "/a/b", "/a/b/c.txt")
+	})
+}
+
+func TestStat(t *testing.T) {
+	var allBytes []byte
+	for i := 0; i < 256; i++ {
+		allBytes = append(allBytes, byte(i))
+	}
+
+	for _, data := range []string{"", "foobar", string(allBytes)} {
+		h := setup(t, remoteFile{"foo.txt", data})
+
+		stdout, _ := h.runOK("", "stat", "foo.txt")
+		patterns := []string{
+			fmt.Sprintf(`Bytes\s+%d`, len(data)),
+			`DirType\s+file`,
+			`MimeType\s+text/plain`,
+			fmt.Sprintf(`Md5Checksum\s+%x`, md5.Sum([]byte(data))),
+		}
+		for _, pattern := range patterns {
+			if !regexp.MustCompile(pattern).MatchString(stdout) {
+				t.Errorf("size %d: stat output does not match %q\n%s", len(data), pattern, stdout)
+			}
+		}
+
+		h.close()
+	}
+}
+
+func TestPullPiped(t *testing.T) {
+	h := setup(t, remoteFile{"a/a.txt", ""})
+	defer h.close()
+
+	// Issue #95.
+	for _, p := range []string{"not-found", "a"} {
+		stdout, stderr := h.runFail("", "pull", "-piped", p)
+		if stdout != "" || stderr == "" {
+			t.Errorf("pull -piped %q: got stdout %q stderr %q", p, stdout, stderr)
+		}
+	}
+}
+
+func TestTrash(t *testing.T) {
+	t.Run("file", func(t *testing.T) {
+		h := setup(t, remoteFile{"a.txt", "a"})
+		defer h.close()
+
+		h.runOK("y\n", "trash", "a.txt")
+		h.expectList("", false)
+	})
+
+	t.Run("folder", func(t *testing.T) {
+		h := setup(t, remoteFile{"a/b.txt", "b"})
+		defer h.close()
+
+		h.runOK("y\n", "trash", "a/b.txt")
+		h.expectList("", true, "/a")
+		h.runOK("y\n", "trash", "a")
+		h.expectList("", false)
+	})
+
+	t.Run("multiple files and emptytrash", func(t *testing.T) {
+		h := setup(t, remoteFile{"a.txt", ""}, remoteFile{"b.txt", ""}, remoteFile{"c.txt", ""})
+		defer h.close()
+
+		h.runOK("y\n", "trash", "a.txt", "b.txt", "c.txt")
+		h.expectList("", false)
+
+		h.runOK("", "emptytrash", "-no-prompt")
+		if stdout, _ := h.runOK("", "list", "-no-prompt", "-trashed"); strings.TrimSpace(stdout) != "" {
+			t.Errorf("trash not emptied: %q", stdout)
+		}
+	})
+
+	t.Run("non-existent file", func(t *testing.T) {
+		h := setup(t)
+		defer h.close()
+
+		if _, stderr, _ := h.run("y\n", "trash", "not-found"); stderr == "" {
+			t.Errorf("expected an error message")
+		}
+	})
+}
+
+func (h *harness) writeLocalFiles(files ...remoteFile) {
+	for _, f := range files {
+		absPath := filepath.Join(h.root, f.path)
+		if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
+			h.t.Fatalf("mkdirAll %q: %v", absPath, err)
+		}
+		if err := ioutil.WriteFile(absPath, []byte(f.content), 0644); err != nil {
+			h.t.Fatalf("writeFile %q: %v", absPath, err)
+		}
+	}
+}
+
+func (h *harness) verifyLocalFiles(files ...remoteFile) {
+	for _, f := range files {
+		blob, err := ioutil.ReadFile(filepath.Join(h.root, f.path))
+		if err != nil {
+			h.t.Errorf("local %q: %v", f.path, err)
+			continue
+		}
+		if got := string(blob); got != f.content {
+			h.t.Errorf("local %q: got %q want %q", f.path, got, f.content)
+		}
+	}
+}
+
+func TestPushPullTree(t *testing.T) {
+	h := setup(t)
+	defer h.close()
+
+	files := []remoteFile{{"a.txt", "alpha"}, {"docs/b.txt", "bravo"}, {"docs/deep/c.txt", "charlie"}}
+	h.writeLocalFiles(files...)
+
+	h.runOK("", "push", "-no-prompt", "-quiet")
+	h.expectList("", true, "/a.txt", "/docs", "/docs/b.txt", "/docs/deep", "/docs/deep/c.txt")
+
+	if err := os.RemoveAll(filepath.Join(h.root, "docs")); err != nil {
+		t.Fatalf("removeAll: %v", err)
+	}
+	h.runOK("", "pull", "-no-prompt", "-quiet")
+	h.verifyLocalFiles(files...)
+}
+
+func TestPushRetriesTransientErrors(t *testing.T) {
+	faultsList := []map[string]interface{}{
+		{"rateLimitEvery": 2, "pathPrefix": "/upload/"},
+		{"serverErrorEvery": 2, "pathPrefix": "/upload/"},
+	}
+
+	for _, faults := range faultsList {
+		h := setup(t)
+		h.setFaults(faults)
+
+		// Unlike push -piped which reads from stdin, pushing
+		// local files retries with exponential backoff.
+		files := []remoteFile{{"a.txt", "alpha"}, {"b.txt", "bravo"}, {"c.txt", "charlie"}}
+		h.writeLocalFiles(files...)
+		h.runOK("", "push", "-no-prompt", "-quiet")
+
+		h.setFaults(map[string]interface{}{})
+		h.verifyFiles(files...)
+		h.expectList("", false, "/a.txt", "/b.txt", "/c.txt")
+
+		h.close()
+	}
+}
+
+func TestPushResumesInterruptedUpload(t *testing.T) {
+	h := setup(t)
+	defer h.close()
+
+	const chunkSize = 256 * 1024
+	content := make([]byte, 4*chunkSize+100)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	h.writeLocalFiles(remoteFile{"big.bin", string(content)})
+
+	// The first upload request starts the session and the first chunk goes
+	// through but then the second chunk fails. Without retries, push gives up.
+	h.setFaults(map[string]interface{}{"serverErrorEvery": 3, "pathPrefix": "/upload/"})
+	h.run("", "push", "-no-prompt", "-quiet", "-retry-count=0", fmt.Sprintf("-upload-chunk-size=%d", chunkSize), "big.bin")
+	h.setFaults(map[string]interface{}{})
+
+	context, err := config.Discover(h.root)
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+
+	key := filepath.Join(h.root, "big.bin")
+	session, err := context.DeserializeUploadSession(key)
+	if err != nil {
+		t.Fatalf("no upload session saved after the failed push: %v", err)
+	}
+	if session.Offset != chunkSize {
+		t.Errorf("saved offset: got %d want %d", session.Offset, chunkSize)
+	}
+
+	h.runOK("", "push", "-no-prompt", "-quiet", fmt.Sprintf("-upload-chunk-size=%d", chunkSize), "big.bin")
+
+	if got, want := h.stats().MediaBytesReceived, int64(len(content)); got != want {
+		t.Errorf("uploaded bytes: got %d want %d, the upload was not resumed", got, want)
+	}
+	if _, err := context.DeserializeUploadSession(key); err != config.ErrNoSuchDbKey {
+		t.Errorf("upload session not cleared after completion: %v", err)
+	}
+	h.verifyFiles(remoteFile{"big.bin", string(content)})
+}
+
+func TestPullTruncatedDownload(t *testing.T) {
+	h := setup(t, remoteFile{"big.txt", strings.Repeat("0123456789", 1000)})
+	defer h.close()
+
+	h.setFaults(map[string]interface{}{"truncateEvery": 1})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.runFail("", "pull", "-piped", "big.txt")
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Minute):
+		t.Fatalf("pull of a truncated download did not terminate")
+	}
+}
+
+func TestPullResumesTruncatedDownload(t *testing.T) {
+	h := setup(t)
+	defer h.close()
+
+	content := strings.Repeat("0123456789", 10000)
+	h.writeLocalFiles(remoteFile{"big.txt", content})
+	h.runOK("", "push", "-no-prompt", "-quiet", "big.txt")
+
+	localPath := filepath.Join(h.root, "big.txt")
+	partialPath := localPath + ".drive-partial"
+	if err := os.Remove(localPath); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+
+	// Without retries, the truncated download is left in the partial file.
+	h.setFaults(map[string]interface{}{"truncateEvery": 1})
+	h.run("", "pull", "-no-prompt", "-quiet", "-retry-count=0", "big.txt")
+	h.setFaults(map[string]interface{}{})
+
+	if _, err := os.Stat(localPath); !os.IsNotExist(err) {
+		t.Errorf("truncated download was moved into place: %v", err)
+	}
+	info, err := os.Stat(partialPath)
+	if err != nil {
+		t.Fatalf("no partial file left behind: %v", err)
+	}
+	if info.Size() < 1 || info.Size() >= int64(len(content)) {
+		t.Errorf("partial file size: got %d want within (0, %d)", info.Size(), len(content))
+	}
+
+	h.runOK("", "pull", "-no-prompt", "-quiet", "big.txt")
+
+	h.verifyLocalFiles(remoteFile{"big.txt", content})
+	if _, err := os.Stat(partialPath); !os.IsNotExist(err) {
+		t.Errorf("partial file not cleaned up: %v", err)
+	}
+	if got, want := h.stats().MediaBytesSent, int64(len(content)); got != want {
+		t.Errorf("downloaded bytes: got %d want %d, the download was not resumed", got, want)
+	}
+
+	// With retries, pull recovers from truncation by itself.
+	if err := os.Remove(localPath); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	h.setFaults(map[string]interface{}{"truncateEvery": 2})
+	// This is the first download thus the pull's is the one truncated.
+	h.verifyFiles(remoteFile{"big.txt", content})
+	before := h.stats().MediaBytesSent
+	h.runOK("", "pull", "-no-prompt", "-quiet", "big.txt")
+	h.verifyLocalFiles(remoteFile{"big.txt", content})
+	if got, want := h.stats().MediaBytesSent-before, int64(len(content)); got != want {
+		t.Errorf("downloaded bytes with retries: got %d want %d", got, want)
+	}
+}
+
+func (h *harness) createSharedDrive(name string) string {
+	blob, err := json.Marshal(map[string]string{"name": name})
+	if err != nil {
+		h.t.Fatalf("marshal drive: %v", err)
+	}
+
+	res, err := http.Post(h.baseURL+"/drive/v2/drives?requestId="+name, "application/json", bytes.NewReader(blob))
+	if err != nil {
+		h.t.Fatalf("creating shared drive: %v", err)
+	}
+	defer res.Body.Close()
+
+	var created struct {
+		Id string `json:"id"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&created); err != nil {
+		h.t.Fatalf("decoding shared drive: %v", err)
+	}
+	return created.Id
+}
+
+func TestSharedDrive(t *testing.T) {
+	h := setup(t, remoteFile{"mine.txt", "my drive"})
+	defer h.close()
+
+	teamId := h.createSharedDrive("Team")
+	h.createSharedDrive("Other")
+
+	stdout, _ := h.runOK("", "list", "-shared-drives")
+	for _, want := range []string{teamId, "Team", "Other"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("list -shared-drives: %q not in %q", want, stdout)
+		}
+	}
+
+	h.runFail("code\n", "init", "-shared-drive", "not-found")
+	h.runOK("code\n", "init", "-shared-drive", "Team")
+
+	h.pushPiped("a/b.txt", "team content")
+	h.expectList("", true, "/a", "/a/b.txt")
+	h.verifyFiles(remoteFile{"a/b.txt", "team content"})
+
+	// Rooting by id is equivalent.
+	h.runOK("code\n", "init", "-shared-drive", teamId)
+	h.expectList("", true, "/a", "/a/b.txt")
+
+	h.runOK("y\n", "trash", "a")
+	h.expectList("", true)
+	if stdout, _ := h.runOK("", "list", "-no-prompt", "-trashed"); !strings.Contains(stdout, "/a") {
+		t.Errorf("trashed folder not listed: %q", stdout)
+	}
+
+	h.runOK("", "emptytrash", "-no-prompt")
+	if stdout, _ := h.runOK("", "list", "-no-prompt", "-trashed"); strings.TrimSpace(stdout) != "" {
+		t.Errorf("shared drive trash not emptied: %q", stdout)
+	}
+
+	// Back in My Drive, none of the shared drive's content shows up.
+	h.runOK("code\n", "init")
+	h.expectList("", true, "/mine.txt")
+}
+
+// revisionIds returns the ids that `drive revisions` lists, oldest first.
+func (h *harness) revisionIds(p string) (ids []string, current string) {
+	stdout, _ := h.runOK("", "revisions", p)
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	for _, line := range lines[1:] {
+		ids = append(ids, strings.Fields(line)[0])
+	}
+	return ids, lines[len(lines)-1]
+}
+
+func TestRevisions(t *testing.T) {
+	h := setup(t, remoteFile{"report.txt", "first draft"})
+	defer h.close()
+
+	h.runOK("second draft", "push", "-piped", "-force", "report.txt")
+	ids, current := h.revisionIds("report.txt")
+	if len(ids) != 2 {
+		t.Fatalf("revisions: got %q want 2 of them", ids)
+	}
+	if !strings.HasSuffix(current, "(current)") {
+		t.Errorf("revisions: the last one isn't marked as current %q", current)
+	}
+
+	if stdout, _ := h.runOK("", "pull", "-piped", "-revision", ids[0], "report.txt"); stdout != "first draft" {
+		t.Errorf("pull -revision %s: got %q", ids[0], stdout)
+	}
+	h.runOK("", "pull", "-revision", ids[0], "-revision-dest", "old.txt", "report.txt")
+	h.verifyLocalFiles(remoteFile{"old.txt", "first draft"})
+
+	// Restoring the current revision only keeps it forever.
+	h.runOK("", "revisions", "restore", "-no-prompt", "-keep-forever", "report.txt", ids[1])
+	if ids, current = h.revisionIds("report.txt"); len(ids) != 2 || !strings.HasSuffix(current, "(current, keep-forever)") {
+		t.Errorf("restoring the current revision: got %q and %q", ids, current)
+	}
+
+	h.runOK("", "revisions", "restore", "-no-prompt", "report.txt", ids[0])
+	h.verifyFiles(remoteFile{"report.txt", "first draft"})
+	if ids, _ = h.revisionIds("report.txt"); len(ids) != 3 {
+		t.Errorf("restore: got revisions %q want 3 of them", ids)
+	}
+
+	h.runFail("", "revisions", "restore", "-no-prompt", "report.txt", "no-such-revision")
+	h.runFail("", "pull", "-piped", "-revision", "no-such-revision", "report.txt")
+}
+
+type commentRecord struct {
+	CommentId string `json:"commentId"`
+	Content   string `json:"content"`
+	Status    string `json:"status"`
+	Replies   []struct {
+		Content string `json:"content"`
+		Verb    string `json:"verb"`
+	} `json:"replies"`
+}
+
+func (h *harness) comments(p string) (comments []*commentRecord) {
+	stdout, _ := h.runOK("", "comments", "list", "-json", p)
+	for _, line := range strings.Split(strings.TrimSpace(stdout), "\n") {
+		if line == "" {
+			continue
+		}
+		comment := new(commentRecord)
+		if err := json.Unmarshal([]byte(line), comment); err != nil {
+			h.t.Fatalf("comments %q: %v in %q", p, err, line)
+		}
+		comments = append(comments, comment)
+	}
+	return comments
+}
+
+func TestComments(t *testing.T) {
+	h := setup(t, remoteFile{"report.txt", "quarterly numbers"})
+	defer h.close()
+
+	if comments := h.comments("report.txt"); len(comments) != 0 {
+		t.Errorf("comments before adding any: got %d", len(comments))
+	}
+
+	h.runOK("", "comments", "add", "report.txt", "check", "the", "totals")
+	comments := h.comments("report.txt")
+	if len(comments) != 1 || comments[0].Content != "check the totals" || comments[0].Status != "open" {
+		t.Fatalf("comments after add: got %+v", comments)
+	}
+	commentId := comments[0].CommentId
+
+	h.runOK("", "comments", "reply", "report.txt", commentId, "fixed")
+	h.runOK("", "comments", "resolve", "report.txt", commentId)
+
+	comments = h.comments("report.txt")
+	if len(comments) != 1 || comments[0].Status != "resolved" {
+		t.Fatalf("comments after resolve: got %+v", comments)
+	}
+	if replies := comments[0].Replies; len(replies) != 2 || replies[0].Content != "fixed" || replies[1].Verb != "resolve" {
+		t.Errorf("replies: got %+v", replies)
+	}
+
+	h.runFail("", "comments", "reply", "report.txt", "no-such-comment", "?")
+}
+
+func TestProperties(t *testing.T) {
+	h := setup(t,
+		remoteFile{"a/brief.txt", "brief"},
+		remoteFile{"b/c/design.txt", "design"},
+		remoteFile{"b/notes.txt", "notes"},
+	)
+	defer h.close()
+
+	h.runOK("", "prop", "set", "a/brief.txt", "project=X", "stage=draft")
+	h.runOK("", "prop", "set", "b/c/design.txt", "project=X")
+	h.runOK("", "prop", "set", "b/notes.txt", "project=Y")
+	h.runOK("", "prop", "set", "-private", "b/notes.txt", "project=X")
+
+	h.runOK("", "prop", "rm", "a/brief.txt", "stage")
+	h.runFail("", "prop", "rm", "a/brief.txt", "stage")
+	if stdout, _ := h.runOK("", "prop", "get", "b/notes.txt"); stdout != "project=Y\tpublic\nproject=X\tprivate\n" {
+		t.Errorf("prop get: got %q", stdout)
+	}
+	if stdout, _ := h.runOK("", "prop", "get", "a/brief.txt"); stdout != "project=X\tpublic\n" {
+		t.Errorf("prop get after rm: got %q", stdout)
+	}
+
+	// Either visibility matches, so b/notes.txt has project=X too.
+	h.runOK("", "prop", "rm", "-private", "b/notes.txt", "project")
+	stdout, _ := h.runOK("", "list", "-no-prompt", "-property", "project=X")
+	if !strings.Contains(stdout, "/a/brief.txt") || !strings.Contains(stdout, "/b/c/design.txt") || strings.Contains(stdout, "notes.txt") {
+		t.Errorf("list -property: got %q", stdout)
+	}
+
+	h.runOK("", "pull", "-no-prompt", "-property", "project=X", "b")
+	h.verifyLocalFiles(remoteFile{"b/c/design.txt", "design"})
+	if _, err := os.Stat(filepath.Join(h.root, "b", "notes.txt")); !os.IsNotExist(err) {
+		t.Errorf("b/notes.txt should not have been pulled: %v", err)
+	}
+
+	h.runOK("y\n", "trash", "-property", "project=X", "b")
+	h.expectList("", true, "/a", "/a/brief.txt", "/b", "/b/c", "/b/notes.txt")
+}